@@ -0,0 +1,104 @@
+// Command fsdreplay replays openfsd packet capture files into an in-process FSD server.
+//
+// The server uses an in-memory SQLite database and does not listen for connections.
+// Packets the server sends to replayed clients are written as capture records to
+// stdout, or to the file given by -out, so that they can be compared with the recording.
+//
+// Usage:
+//
+//	fsdreplay [-speed 0] [-out replayed.log] capture-1.log [capture-2.log ...]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/renorris/openfsd/fsd"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	speed := flag.Float64("speed", 0, "Replay speed relative to the recording. 0 replays without delay.")
+	outPath := flag.String("out", "-", "File to write server packets to, or - for stdout")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] capture-file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, flag.Args(), *outPath, *speed); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, capturePaths []string, outPath string, speed float64) (err error) {
+	var out io.Writer = os.Stdout
+	if outPath != "-" {
+		var outFile *os.File
+		if outFile, err = os.Create(outPath); err != nil {
+			return
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+
+	cfg, err := fsd.LoadServerConfig(ctx)
+	if err != nil {
+		return
+	}
+
+	// Run an isolated server that only serves replayed connections
+	cfg.DatabaseDriver = "sqlite"
+	cfg.DatabaseSourceName = ":memory:"
+	cfg.DatabaseAutoMigrate = true
+	cfg.DatabaseMaxConns = 1
+	cfg.FsdListenAddrs = nil
+	cfg.ServiceHTTPListenAddr = "127.0.0.1:0"
+	cfg.StatsSampleInterval = 0
+	cfg.CaptureDir = ""
+	if cfg.LogLevel == "" || cfg.LogLevel == "info" {
+		cfg.LogLevel = "warn"
+	}
+
+	// Keep gin's debug output off stdout, which may carry the replayed packets
+	gin.SetMode(gin.ReleaseMode)
+
+	server, err := fsd.NewServerFromConfig(ctx, cfg)
+	if err != nil {
+		return
+	}
+
+	serverCtx, cancelServer := context.WithCancel(ctx)
+	defer cancelServer()
+	go server.Run(serverCtx)
+
+	for _, path := range capturePaths {
+		if err = replayFile(ctx, server, path, out, speed); err != nil {
+			return fmt.Errorf("error replaying %s: %w", path, err)
+		}
+	}
+	return
+}
+
+func replayFile(ctx context.Context, server *fsd.Server, path string, out io.Writer, speed float64) (err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	return server.Replay(ctx, f, out, speed)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"github.com/renorris/openfsd/fsd/client"
+	"math"
+	"math/rand/v2"
+	"strconv"
+)
+
+// earthRadiusNm is the mean radius of the earth in nautical miles
+const earthRadiusNm = 3440.065
+
+type airport struct {
+	icao     string
+	lat, lon float64
+}
+
+// airports are the origins and destinations of simulated flights
+var airports = []airport{
+	{"KATL", 33.6367, -84.4281},
+	{"KBOS", 42.3656, -71.0096},
+	{"KDEN", 39.8617, -104.6731},
+	{"KDFW", 32.8968, -97.0380},
+	{"KJFK", 40.6398, -73.7789},
+	{"KLAX", 33.9425, -118.4081},
+	{"KMIA", 25.7932, -80.2906},
+	{"KORD", 41.9786, -87.9048},
+	{"KSEA", 47.4490, -122.3093},
+	{"KSFO", 37.6190, -122.3749},
+	{"CYYZ", 43.6772, -79.6306},
+	{"EDDF", 50.0333, 8.5706},
+	{"EGLL", 51.4775, -0.4614},
+	{"EHAM", 52.3086, 4.7639},
+	{"LEMD", 40.4719, -3.5626},
+	{"LFPG", 49.0097, 2.5478},
+	{"LIRF", 41.8003, 12.2389},
+	{"LSZH", 47.4647, 8.5492},
+}
+
+// aircraftTypes are the aircraft types filed by simulated flights
+var aircraftTypes = []string{"A320/L", "A321/L", "A359/L", "B738/L", "B77W/L", "B789/L", "E175/L"}
+
+// flight is a simulated aircraft flying great-circle paths between airports
+type flight struct {
+	origin, destination airport
+	aircraftType        string
+	cruiseAltitude      int     // Feet
+	speed               float64 // Knots
+
+	lat, lon float64
+	altitude float64
+	heading  float64
+}
+
+// newFlight creates a flight at a random point along a random route
+func newFlight() (f *flight) {
+	f = &flight{
+		aircraftType:   aircraftTypes[rand.IntN(len(aircraftTypes))],
+		cruiseAltitude: 24000 + 1000*rand.IntN(16),
+		speed:          380 + 100*rand.Float64(),
+	}
+	f.newRoute(airports[rand.IntN(len(airports))])
+
+	// Start somewhere along the route so that not every flight begins on the ground
+	f.lat, f.lon = intermediatePoint(f.origin.lat, f.origin.lon, f.destination.lat, f.destination.lon, rand.Float64())
+	f.update()
+	return
+}
+
+// newRoute starts a new route from an airport to a different random airport
+func (f *flight) newRoute(origin airport) {
+	f.origin = origin
+	for f.destination = origin; f.destination == origin; {
+		f.destination = airports[rand.IntN(len(airports))]
+	}
+	f.lat, f.lon = origin.lat, origin.lon
+	f.update()
+}
+
+// advance moves the flight along its great-circle route by the distance flown in seconds.
+// Returns true if the flight arrived and started a new route.
+func (f *flight) advance(seconds float64) (arrived bool) {
+	distance := f.speed * seconds / 3600
+	if distance >= distanceNm(f.lat, f.lon, f.destination.lat, f.destination.lon) {
+		f.newRoute(f.destination)
+		return true
+	}
+
+	f.lat, f.lon = destinationPoint(f.lat, f.lon, f.heading, distance)
+	f.update()
+	return
+}
+
+// update recomputes the heading and altitude from the current position.
+// Flights climb and descend on a 3 degree path to and from their cruise altitude.
+func (f *flight) update() {
+	f.heading = initialBearing(f.lat, f.lon, f.destination.lat, f.destination.lon)
+
+	const feetPerNm = 318
+	fromOrigin := distanceNm(f.origin.lat, f.origin.lon, f.lat, f.lon)
+	toDestination := distanceNm(f.lat, f.lon, f.destination.lat, f.destination.lon)
+	f.altitude = math.Min(float64(f.cruiseAltitude), feetPerNm*math.Min(fromOrigin, toDestination))
+}
+
+// groundspeed returns the groundspeed in knots, slowing down close to the ground
+func (f *flight) groundspeed() int {
+	if f.altitude < 10000 {
+		return int(math.Min(f.speed, 250))
+	}
+	return int(f.speed)
+}
+
+// velocity returns the east, up and north velocity components in metres per second
+func (f *flight) velocity() (east, up, north float64) {
+	const metresPerSecondPerKnot = 0.514444
+	speed := float64(f.groundspeed()) * metresPerSecondPerKnot
+	heading := radians(f.heading)
+	return speed * math.Sin(heading), 0, speed * math.Cos(heading)
+}
+
+// flightPlan returns the IFR flight plan for the current route
+func (f *flight) flightPlan() client.FlightPlan {
+	enroute := distanceNm(f.origin.lat, f.origin.lon, f.destination.lat, f.destination.lon) / f.speed
+	hours, minutes := int(enroute), int((enroute-math.Floor(enroute))*60)
+	return client.FlightPlan{
+		Rules:               "I",
+		Aircraft:            f.aircraftType,
+		CruiseSpeed:         strconv.Itoa(int(f.speed)),
+		Departure:           f.origin.icao,
+		DepartureTime:       "0000",
+		ActualDepartureTime: "0000",
+		Altitude:            strconv.Itoa(f.cruiseAltitude),
+		Destination:         f.destination.icao,
+		HoursEnroute:        strconv.Itoa(hours),
+		MinutesEnroute:      strconv.Itoa(minutes),
+		HoursFuel:           strconv.Itoa(hours + 2),
+		MinutesFuel:         "0",
+		Alternate:           "",
+		Remarks:             "/v/ LOADGEN",
+		Route:               "DCT",
+	}
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+// distanceNm returns the great-circle distance between two points in nautical miles
+func distanceNm(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := radians(lat1), radians(lat2)
+	dPhi, dLambda := radians(lat2-lat1), radians(lon2-lon1)
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadiusNm * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// initialBearing returns the initial true bearing of the great circle from the first point to the second
+func initialBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := radians(lat1), radians(lat2)
+	dLambda := radians(lon2 - lon1)
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return math.Mod(degrees(math.Atan2(y, x))+360, 360)
+}
+
+// destinationPoint returns the point reached by following a great circle from a starting point
+// on an initial bearing for a distance in nautical miles
+func destinationPoint(lat, lon, bearing, distance float64) (float64, float64) {
+	phi1, lambda1, theta := radians(lat), radians(lon), radians(bearing)
+	delta := distance / earthRadiusNm
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi1), math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+	return degrees(phi2), math.Mod(degrees(lambda2)+540, 360) - 180
+}
+
+// intermediatePoint returns the point at a fraction of the great circle between two points
+func intermediatePoint(lat1, lon1, lat2, lon2, fraction float64) (float64, float64) {
+	distance := distanceNm(lat1, lon1, lat2, lon2)
+	return destinationPoint(lat1, lon1, initialBearing(lat1, lon1, lat2, lon2), distance*fraction)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGreatCircle(t *testing.T) {
+	jfk, lhr := airports[4], airports[12]
+	if jfk.icao != "KJFK" || lhr.icao != "EGLL" {
+		t.Fatalf("unexpected airports %s and %s", jfk.icao, lhr.icao)
+	}
+
+	// KJFK to EGLL is about 2991 nm on an initial bearing of about 51 degrees
+	if d := distanceNm(jfk.lat, jfk.lon, lhr.lat, lhr.lon); math.Abs(d-2991) > 5 {
+		t.Errorf("expected distance of about 2991 nm, got %.1f", d)
+	}
+	if b := initialBearing(jfk.lat, jfk.lon, lhr.lat, lhr.lon); math.Abs(b-51.4) > 1 {
+		t.Errorf("expected initial bearing of about 51.4, got %.1f", b)
+	}
+
+	// Following the initial bearing for the full distance arrives at the destination
+	lat, lon := intermediatePoint(jfk.lat, jfk.lon, lhr.lat, lhr.lon, 1)
+	if d := distanceNm(lat, lon, lhr.lat, lhr.lon); d > 0.1 {
+		t.Errorf("expected to arrive at EGLL, ended %.1f nm away at %f, %f", d, lat, lon)
+	}
+
+	// The midpoint is equidistant and north of both ends
+	lat, lon = intermediatePoint(jfk.lat, jfk.lon, lhr.lat, lhr.lon, 0.5)
+	if d1, d2 := distanceNm(jfk.lat, jfk.lon, lat, lon), distanceNm(lat, lon, lhr.lat, lhr.lon); math.Abs(d1-d2) > 0.1 {
+		t.Errorf("expected midpoint to be equidistant, got %.1f and %.1f", d1, d2)
+	}
+	if lat < lhr.lat {
+		t.Errorf("expected great circle midpoint north of EGLL, got latitude %f", lat)
+	}
+
+	// Longitudes are normalized across the antimeridian
+	if _, lon = destinationPoint(0, 179.5, 90, 60); math.Abs(lon+179.5) > 0.01 {
+		t.Errorf("expected longitude -179.5, got %f", lon)
+	}
+}
+
+func TestFlightAdvance(t *testing.T) {
+	f := newFlight()
+	f.newRoute(airports[0])
+	destination := f.destination
+	total := distanceNm(f.origin.lat, f.origin.lon, destination.lat, destination.lon)
+
+	// Flying half of the route leaves half of it to go, at cruise altitude
+	if f.advance(total / 2 / f.speed * 3600) {
+		t.Fatal("expected flight not to have arrived halfway")
+	}
+	if remaining := distanceNm(f.lat, f.lon, destination.lat, destination.lon); math.Abs(remaining-total/2) > 1 {
+		t.Errorf("expected %.1f nm remaining, got %.1f", total/2, remaining)
+	}
+	if total > 300 && f.altitude != float64(f.cruiseAltitude) {
+		t.Errorf("expected cruise altitude %d, got %.0f", f.cruiseAltitude, f.altitude)
+	}
+
+	// Flying past the destination starts a new route from it
+	if !f.advance(total / f.speed * 3600) {
+		t.Fatal("expected flight to have arrived")
+	}
+	if f.origin != destination || f.destination == destination || f.altitude != 0 {
+		t.Errorf("expected new route from %s on the ground, got %s to %s at %.0f ft",
+			destination.icao, f.origin.icao, f.destination.icao, f.altitude)
+	}
+}
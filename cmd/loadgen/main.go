@@ -0,0 +1,148 @@
+// Command loadgen simulates pilots and controllers against an FSD server to measure its capacity.
+//
+// Pilots fly great-circle routes between airports, sending @ position updates every -position-interval
+// and ^ fast updates every -fast-interval while the server has enabled them. They file flight plans and
+// exchange text messages with other simulated clients. Controllers send position updates and text messages
+// and request the flight plans of random pilots.
+//
+// All clients log in with the -cid account, or with -cids consecutive accounts starting at -cid, using the
+// plaintext -password or FSD JWTs issued by the web server when -jwt-url is set.
+// Statistics are reported every -report-interval and summarized at exit.
+//
+// Usage:
+//
+//	loadgen -addr localhost:6809 -cid 100000 -password secret [-jwt-url http://localhost:8000/api/v1/fsd-jwt] [-pilots 1000] [-atc 50] [-duration 10m]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/renorris/openfsd/fsd"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func main() {
+	cfg := simConfig{}
+	flag.StringVar(&cfg.addr, "addr", "localhost:6809", "FSD server address")
+	pilots := flag.Int("pilots", 100, "Number of simulated pilots")
+	atc := flag.Int("atc", 10, "Number of simulated controllers")
+	flag.StringVar(&cfg.callsignPrefix, "prefix", "LG", "Callsign prefix. Pilots are <prefix><n> and controllers <prefix><n>_CTR.")
+	flag.IntVar(&cfg.cid, "cid", 0, "CID to log in with")
+	flag.IntVar(&cfg.cidCount, "cids", 1, "Number of consecutive CIDs starting at -cid to spread logins across. All must share -password.")
+	flag.StringVar(&cfg.password, "password", "", "Password of the -cid account")
+	jwtURL := flag.String("jwt-url", "", "fsd-jwt endpoint of the web server, e.g. http://localhost:8000/api/v1/fsd-jwt. If set, clients log in with FSD JWTs instead of the plaintext password.")
+	rampRate := flag.Float64("ramp", 50, "Connections opened per second. 0 connects all clients at once.")
+	duration := flag.Duration("duration", 0, "How long to run. 0 runs until interrupted.")
+	flag.DurationVar(&cfg.positionInterval, "position-interval", 5*time.Second, "Interval between pilot @ position updates")
+	flag.DurationVar(&cfg.atcPositionInterval, "atc-position-interval", 15*time.Second, "Interval between controller % position updates")
+	flag.DurationVar(&cfg.fastInterval, "fast-interval", 200*time.Millisecond, "Interval between pilot ^ fast position updates")
+	flag.BoolVar(&cfg.alwaysFast, "always-fast", false, "Send fast position updates without waiting for the server to enable them")
+	flag.DurationVar(&cfg.textInterval, "text-interval", 30*time.Second, "Average interval between text messages sent by each client")
+	flag.DurationVar(&cfg.fpQueryInterval, "fp-query-interval", 30*time.Second, "Average interval between flight plan requests sent by each controller")
+	atcRating := flag.Int("atc-rating", int(fsd.NetworkRatingController1), "Network rating requested by controllers")
+	flag.IntVar(&cfg.atcFacility, "atc-facility", 6, "Facility type of controllers. 6 (CTR) requires -atc-rating 5 or above.")
+	reportInterval := flag.Duration("report-interval", 10*time.Second, "Interval between statistics reports")
+	flag.Parse()
+
+	cfg.atcRating = fsd.NetworkRating(*atcRating)
+	if err := validateConfig(&cfg, *pilots, *atc, *rampRate, *reportInterval); err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	if *duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	sim := &simulation{
+		cfg:    cfg,
+		stats:  newStats(),
+		tokens: newTokenSource(*jwtURL, cfg.password),
+	}
+	run(ctx, sim, *pilots, *atc, *rampRate, *reportInterval)
+}
+
+func validateConfig(cfg *simConfig, pilots int, atc int, rampRate float64, reportInterval time.Duration) error {
+	switch {
+	case cfg.cid < 1:
+		return errors.New("-cid is required")
+	case cfg.password == "":
+		return errors.New("-password is required")
+	case cfg.cidCount < 1:
+		return errors.New("-cids must be at least 1")
+	case pilots < 0 || atc < 0 || pilots+atc == 0:
+		return errors.New("at least one pilot or controller is required")
+	case len(cfg.callsignPrefix)+len(strconv.Itoa(max(pilots, atc)))+len("_CTR") > 10:
+		return errors.New("callsigns would exceed 10 characters: use a shorter -prefix")
+	case rampRate < 0:
+		return errors.New("-ramp must not be negative")
+	case cfg.positionInterval <= 0 || cfg.atcPositionInterval <= 0 || cfg.fastInterval <= 0 ||
+		cfg.textInterval <= 0 || cfg.fpQueryInterval <= 0 || reportInterval <= 0:
+		return errors.New("intervals must be positive")
+	}
+	return nil
+}
+
+// run starts the simulated clients, reports statistics until the context is done and waits for all clients to log off
+func run(ctx context.Context, sim *simulation, pilots int, atc int, rampRate float64, reportInterval time.Duration) {
+	rep := newReporter(sim.stats, os.Stdout)
+
+	reportTicker := time.NewTicker(reportInterval)
+	defer reportTicker.Stop()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-reportTicker.C:
+				rep.report(pilots, atc)
+			}
+		}
+	}()
+
+	slog.Info("starting clients", slog.String("addr", sim.cfg.addr), slog.Int("pilots", pilots), slog.Int("atc", atc))
+
+	// Controllers are connected first so that they see the pilots connect
+	wg := sync.WaitGroup{}
+	var rampDelay time.Duration
+	if rampRate > 0 {
+		rampDelay = time.Duration(float64(time.Second) / rampRate)
+	}
+	for i := range atc + pilots {
+		if i > 0 && rampDelay > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(rampDelay):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i < atc {
+				sim.runATC(ctx, i)
+			} else {
+				sim.runPilot(ctx, i-atc)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	slog.Info("stopping clients")
+	wg.Wait()
+	rep.final()
+}
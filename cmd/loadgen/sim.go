@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/renorris/openfsd/fsd"
+	"github.com/renorris/openfsd/fsd/client"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// simConfig holds the settings shared by all simulated clients
+type simConfig struct {
+	addr           string
+	callsignPrefix string
+
+	cid      int // First CID to log in with
+	cidCount int // Number of consecutive CIDs to spread logins across
+	password string
+
+	positionInterval    time.Duration
+	atcPositionInterval time.Duration
+	fastInterval        time.Duration
+	alwaysFast          bool // Send fast updates without waiting for the server to enable them
+	textInterval        time.Duration
+	fpQueryInterval     time.Duration
+
+	atcRating   fsd.NetworkRating
+	atcFacility int
+}
+
+// simulation runs simulated pilots and controllers against a server
+type simulation struct {
+	cfg    simConfig
+	stats  *stats
+	tokens *tokenSource
+
+	pilots  registry // Connected pilot callsigns
+	clients registry // All connected callsigns
+
+	loggedLoginErrors atomic.Int64
+}
+
+// loginTimeout bounds the connection and login of each client
+const loginTimeout = 30 * time.Second
+
+// textPrefix starts every text message sent by loadgen. It is followed by the send time in Unix nanoseconds.
+const textPrefix = "loadgen "
+
+// maxLoggedLoginErrors is the number of login failures logged before further failures are only counted
+const maxLoggedLoginErrors = 10
+
+// pilotCallsign returns the callsign of the nth pilot
+func (sim *simulation) pilotCallsign(n int) string {
+	return sim.cfg.callsignPrefix + strconv.Itoa(n)
+}
+
+// atcCallsign returns the callsign of the nth controller
+func (sim *simulation) atcCallsign(n int) string {
+	return sim.cfg.callsignPrefix + strconv.Itoa(n) + "_CTR"
+}
+
+// login connects and logs in the nth client
+func (sim *simulation) login(ctx context.Context, n int, cfg client.Config) (c *client.Client, err error) {
+	cfg.CID = sim.cfg.cid + n%sim.cfg.cidCount
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		sim.stats.loginsFailed.Add(1)
+		serverErr := &client.ServerError{}
+		if errors.As(err, &serverErr) {
+			sim.stats.serverError(serverErr.Code)
+		}
+		if sim.loggedLoginErrors.Add(1) <= maxLoggedLoginErrors && ctx.Err() == nil {
+			slog.Warn("login failed", slog.String("callsign", cfg.Callsign), slog.Int("cid", cfg.CID), slog.Any("error", err))
+		}
+	}()
+
+	if cfg.Password, err = sim.tokens.get(ctx, cfg.CID); err != nil {
+		return
+	}
+
+	loginCtx, cancel := context.WithTimeout(ctx, loginTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if c, err = client.Dial(loginCtx, sim.cfg.addr, cfg); err != nil {
+		return
+	}
+	sim.stats.loginLatency.record(time.Since(start))
+	sim.stats.loginsSucceeded.Add(1)
+	return
+}
+
+// sent records the result of sending a packet
+func (sim *simulation) sent(err error) {
+	if err != nil {
+		sim.stats.sendErrors.Add(1)
+		return
+	}
+	sim.stats.packetsSent.Add(1)
+}
+
+// handleEvent records statistics common to all clients
+func (sim *simulation) handleEvent(event client.Event) {
+	sim.stats.packetsReceived.Add(1)
+
+	switch event := event.(type) {
+	case *client.TextMessage:
+		sentAt, ok := strings.CutPrefix(event.Message, textPrefix)
+		if !ok {
+			return
+		}
+		nanos, err := strconv.ParseInt(sentAt, 10, 64)
+		if err != nil {
+			return
+		}
+		sim.stats.textsReceived.Add(1)
+		sim.stats.textLatency.record(time.Since(time.Unix(0, nanos)))
+	case *client.ServerError:
+		sim.stats.serverError(event.Code)
+	}
+}
+
+// sendText sends a timestamped text message to a random other connected client
+func (sim *simulation) sendText(c *client.Client) {
+	recipient := sim.clients.random(c.Callsign())
+	if recipient == "" {
+		return
+	}
+	sim.sent(c.SendTextMessage(recipient, textPrefix+strconv.FormatInt(time.Now().UnixNano(), 10)))
+	sim.stats.textsSent.Add(1)
+}
+
+// runPilot simulates the nth pilot until the context is done or the server closes the connection
+func (sim *simulation) runPilot(ctx context.Context, n int) {
+	f := newFlight()
+	c, err := sim.login(ctx, n, client.Config{
+		Callsign: sim.pilotCallsign(n),
+		RealName: "Loadgen Pilot " + strconv.Itoa(n),
+	})
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	sim.stats.pilotsConnected.Add(1)
+	defer sim.stats.pilotsConnected.Add(-1)
+	sim.pilots.add(c.Callsign())
+	defer sim.pilots.remove(c.Callsign())
+	sim.clients.add(c.Callsign())
+	defer sim.clients.remove(c.Callsign())
+
+	fileFlightPlan := func() {
+		sim.sent(c.SendFlightPlan(f.flightPlan()))
+		sim.stats.flightPlansFiled.Add(1)
+	}
+	fileFlightPlan()
+	sim.sent(c.SendPilotPosition(pilotPosition(f)))
+
+	lastMove := time.Now()
+	move := func(now time.Time) {
+		if f.advance(now.Sub(lastMove).Seconds()) {
+			fileFlightPlan()
+		}
+		lastMove = now
+	}
+
+	positionTicker := time.NewTicker(sim.cfg.positionInterval)
+	defer positionTicker.Stop()
+	textTimer := time.NewTimer(jitter(sim.cfg.textInterval))
+	defer textTimer.Stop()
+
+	// Fast updates are sent while the server has enabled them
+	var fastTicker *time.Ticker
+	var fastTicks <-chan time.Time
+	setFast := func(enabled bool) {
+		switch {
+		case enabled && fastTicker == nil:
+			fastTicker = time.NewTicker(sim.cfg.fastInterval)
+			fastTicks = fastTicker.C
+		case !enabled && fastTicker != nil:
+			fastTicker.Stop()
+			fastTicker, fastTicks = nil, nil
+		}
+	}
+	defer setFast(false)
+	setFast(sim.cfg.alwaysFast)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-c.Events():
+			if !ok {
+				sim.stats.disconnects.Add(1)
+				return
+			}
+			sim.handleEvent(event)
+			if sendFast, ok := event.(*client.SendFast); ok && !sim.cfg.alwaysFast {
+				setFast(sendFast.Enabled)
+			}
+		case now := <-positionTicker.C:
+			move(now)
+			sim.sent(c.SendPilotPosition(pilotPosition(f)))
+		case now := <-fastTicks:
+			move(now)
+			sim.sent(c.SendFastPilotPosition(fastPilotPosition(f)))
+		case <-textTimer.C:
+			sim.sendText(c)
+			textTimer.Reset(jitter(sim.cfg.textInterval))
+		}
+	}
+}
+
+func pilotPosition(f *flight) client.PilotPosition {
+	return client.PilotPosition{
+		Transponder: "2000",
+		Latitude:    f.lat,
+		Longitude:   f.lon,
+		Altitude:    int(f.altitude),
+		Groundspeed: f.groundspeed(),
+		Heading:     f.heading,
+	}
+}
+
+func fastPilotPosition(f *flight) client.FastPilotPosition {
+	east, up, north := f.velocity()
+	return client.FastPilotPosition{
+		Latitude:    f.lat,
+		Longitude:   f.lon,
+		Altitude:    f.altitude,
+		AltitudeAGL: f.altitude,
+		Heading:     f.heading,
+		VelocityX:   east,
+		VelocityY:   up,
+		VelocityZ:   north,
+	}
+}
+
+// maxPendingFlightPlanQuery is how long a controller waits for the answer to a flight plan request
+const maxPendingFlightPlanQuery = 30 * time.Second
+
+// runATC simulates the nth controller until the context is done or the server closes the connection.
+// Controllers are placed at airports, send text messages and request the flight plans of random pilots.
+func (sim *simulation) runATC(ctx context.Context, n int) {
+	c, err := sim.login(ctx, n, client.Config{
+		Callsign:      sim.atcCallsign(n),
+		RealName:      "Loadgen Controller " + strconv.Itoa(n),
+		NetworkRating: sim.cfg.atcRating,
+		IsATC:         true,
+	})
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	sim.stats.atcConnected.Add(1)
+	defer sim.stats.atcConnected.Add(-1)
+	sim.clients.add(c.Callsign())
+	defer sim.clients.remove(c.Callsign())
+
+	ap := airports[n%len(airports)]
+	position := client.ATCPosition{
+		Frequency: strconv.Itoa(28000 + 25*(n%200)), // 128.000 to 132.975
+		Facility:  sim.cfg.atcFacility,
+		VisRange:  600,
+		Latitude:  ap.lat,
+		Longitude: ap.lon,
+	}
+	sim.sent(c.SendATCPosition(position))
+
+	positionTicker := time.NewTicker(sim.cfg.atcPositionInterval)
+	defer positionTicker.Stop()
+	textTimer := time.NewTimer(jitter(sim.cfg.textInterval))
+	defer textTimer.Stop()
+	fpTimer := time.NewTimer(jitter(sim.cfg.fpQueryInterval))
+	defer fpTimer.Stop()
+
+	// Flight plan requests awaiting an answer, by callsign
+	pending := make(map[string]time.Time)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-c.Events():
+			if !ok {
+				sim.stats.disconnects.Add(1)
+				return
+			}
+			sim.handleEvent(event)
+			if fp, ok := event.(*client.FlightPlanReceived); ok {
+				if sentAt, ok := pending[fp.Callsign]; ok {
+					delete(pending, fp.Callsign)
+					sim.stats.flightPlanResponses.Add(1)
+					sim.stats.flightPlanLatency.record(time.Since(sentAt))
+				}
+			}
+		case <-positionTicker.C:
+			sim.sent(c.SendATCPosition(position))
+		case <-textTimer.C:
+			sim.sendText(c)
+			textTimer.Reset(jitter(sim.cfg.textInterval))
+		case now := <-fpTimer.C:
+			for callsign, sentAt := range pending {
+				if now.Sub(sentAt) > maxPendingFlightPlanQuery {
+					delete(pending, callsign)
+				}
+			}
+			if callsign := sim.pilots.random(""); callsign != "" {
+				pending[callsign] = now
+				sim.sent(c.SendClientQuery("SERVER", "FP", callsign))
+				sim.stats.flightPlanQueries.Add(1)
+			}
+			fpTimer.Reset(jitter(sim.cfg.fpQueryInterval))
+		}
+	}
+}
+
+// jitter returns a random duration between half and one and a half times d,
+// so that clients started together do not send in lockstep
+func jitter(d time.Duration) time.Duration {
+	return d/2 + rand.N(d)
+}
+
+// registry is a set of connected callsigns supporting random selection
+type registry struct {
+	lock      sync.RWMutex
+	callsigns []string
+	index     map[string]int
+}
+
+func (r *registry) add(callsign string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.index == nil {
+		r.index = make(map[string]int)
+	}
+	r.index[callsign] = len(r.callsigns)
+	r.callsigns = append(r.callsigns, callsign)
+}
+
+func (r *registry) remove(callsign string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	i, ok := r.index[callsign]
+	if !ok {
+		return
+	}
+	last := r.callsigns[len(r.callsigns)-1]
+	r.callsigns[i] = last
+	r.index[last] = i
+	r.callsigns = r.callsigns[:len(r.callsigns)-1]
+	delete(r.index, callsign)
+}
+
+// random returns a random callsign other than exclude, or an empty string if there is none
+func (r *registry) random(exclude string) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	switch len(r.callsigns) {
+	case 0:
+		return ""
+	case 1:
+		if r.callsigns[0] == exclude {
+			return ""
+		}
+	}
+	for {
+		if callsign := r.callsigns[rand.IntN(len(r.callsigns))]; callsign != exclude {
+			return callsign
+		}
+	}
+}
+
+// tokenReuseDuration is how long an FSD JWT is reused. Tokens issued by the web server are valid for 5 minutes
+// and are only checked at login.
+const tokenReuseDuration = 4 * time.Minute
+
+// tokenSource provides the password field of login packets:
+// either the plaintext password, or an FSD JWT issued by the web server's /api/v1/fsd-jwt endpoint.
+type tokenSource struct {
+	url      string // fsd-jwt endpoint. Empty to log in with the plaintext password.
+	password string
+	http     *http.Client
+
+	lock   sync.Mutex
+	tokens map[int]issuedToken
+}
+
+type issuedToken struct {
+	token  string
+	issued time.Time
+}
+
+func newTokenSource(url string, password string) *tokenSource {
+	return &tokenSource{
+		url:      url,
+		password: password,
+		http:     &http.Client{Timeout: loginTimeout},
+		tokens:   make(map[int]issuedToken),
+	}
+}
+
+// get returns the password field to log in with the given CID
+func (t *tokenSource) get(ctx context.Context, cid int) (token string, err error) {
+	if t.url == "" {
+		return t.password, nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if issued, ok := t.tokens[cid]; ok && time.Since(issued.issued) < tokenReuseDuration {
+		return issued.token, nil
+	}
+	if token, err = t.fetch(ctx, cid); err != nil {
+		return
+	}
+	t.tokens[cid] = issuedToken{token: token, issued: time.Now()}
+	return
+}
+
+// fetch requests a new FSD JWT from the web server
+func (t *tokenSource) fetch(ctx context.Context, cid int) (token string, err error) {
+	reqBody, err := json.Marshal(map[string]string{"cid": strconv.Itoa(cid), "password": t.password})
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(reqBody))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := t.http.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	resBody := struct {
+		Success  bool   `json:"success"`
+		Token    string `json:"token"`
+		ErrorMsg string `json:"error_msg"`
+	}{}
+	if err = json.NewDecoder(res.Body).Decode(&resBody); err != nil {
+		return "", fmt.Errorf("error decoding fsd-jwt response (HTTP %d): %w", res.StatusCode, err)
+	}
+	if !resBody.Success || resBody.Token == "" {
+		return "", fmt.Errorf("fsd-jwt request failed (HTTP %d): %s", res.StatusCode, resBody.ErrorMsg)
+	}
+	return resBody.Token, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stats collects load generation statistics from all simulated clients
+type stats struct {
+	start time.Time
+
+	pilotsConnected atomic.Int64
+	atcConnected    atomic.Int64
+
+	loginsSucceeded atomic.Int64
+	loginsFailed    atomic.Int64
+	disconnects     atomic.Int64 // Connections closed by the server
+	sendErrors      atomic.Int64
+
+	packetsSent     atomic.Int64
+	packetsReceived atomic.Int64
+
+	textsSent           atomic.Int64
+	textsReceived       atomic.Int64
+	flightPlansFiled    atomic.Int64
+	flightPlanQueries   atomic.Int64
+	flightPlanResponses atomic.Int64
+
+	serverErrorsLock sync.Mutex
+	serverErrors     map[int]int64 // $ER packets received by error code
+
+	loginLatency      latencyRecorder
+	textLatency       latencyRecorder // Time from sending a text message to its recipient receiving it
+	flightPlanLatency latencyRecorder // Round trip time of $CQ FP flight plan requests
+}
+
+func newStats() *stats {
+	return &stats{
+		start:        time.Now(),
+		serverErrors: make(map[int]int64),
+	}
+}
+
+func (s *stats) serverError(code int) {
+	s.serverErrorsLock.Lock()
+	defer s.serverErrorsLock.Unlock()
+	s.serverErrors[code]++
+}
+
+// maxLatencySamples bounds the memory used by each latency sample set
+const maxLatencySamples = 100000
+
+// latencySamples is a reservoir sample of latencies
+type latencySamples struct {
+	samples []time.Duration
+	count   int64
+	max     time.Duration
+}
+
+func (l *latencySamples) add(d time.Duration) {
+	l.count++
+	l.max = max(l.max, d)
+	if len(l.samples) < maxLatencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+	if i := rand.Int64N(l.count); i < maxLatencySamples {
+		l.samples[i] = d
+	}
+}
+
+// latencySummary holds percentiles of a set of latency samples
+type latencySummary struct {
+	count              int64
+	p50, p95, p99, max time.Duration
+}
+
+func (l *latencySamples) summary() (summary latencySummary) {
+	summary = latencySummary{count: l.count, max: l.max}
+	if len(l.samples) == 0 {
+		return
+	}
+
+	sorted := slices.Clone(l.samples)
+	slices.Sort(sorted)
+	percentile := func(p float64) time.Duration {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	summary.p50, summary.p95, summary.p99 = percentile(0.50), percentile(0.95), percentile(0.99)
+	return
+}
+
+func (s latencySummary) String() string {
+	if s.count == 0 {
+		return "n=0"
+	}
+	return fmt.Sprintf("n=%d p50=%s p95=%s p99=%s max=%s",
+		s.count, roundLatency(s.p50), roundLatency(s.p95), roundLatency(s.p99), roundLatency(s.max))
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(100 * time.Microsecond)
+}
+
+// latencyRecorder records latencies for the current report interval and for the whole run
+type latencyRecorder struct {
+	lock     sync.Mutex
+	interval latencySamples
+	total    latencySamples
+}
+
+func (r *latencyRecorder) record(d time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.interval.add(d)
+	r.total.add(d)
+}
+
+// takeInterval returns the summary of the current interval and starts a new one
+func (r *latencyRecorder) takeInterval() (summary latencySummary) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	summary = r.interval.summary()
+	r.interval = latencySamples{}
+	return
+}
+
+func (r *latencyRecorder) totalSummary() latencySummary {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.total.summary()
+}
+
+// reporter writes periodic and final reports
+type reporter struct {
+	stats *stats
+	out   io.Writer
+
+	lastReport          time.Time
+	lastPacketsSent     int64
+	lastPacketsReceived int64
+}
+
+func newReporter(stats *stats, out io.Writer) *reporter {
+	return &reporter{stats: stats, out: out, lastReport: stats.start}
+}
+
+// report writes a one-line report covering the time since the previous report
+func (r *reporter) report(targetPilots int, targetATC int) {
+	s := r.stats
+	now := time.Now()
+	seconds := now.Sub(r.lastReport).Seconds()
+
+	sent, received := s.packetsSent.Load(), s.packetsReceived.Load()
+	sendRate := float64(sent-r.lastPacketsSent) / seconds
+	receiveRate := float64(received-r.lastPacketsReceived) / seconds
+	r.lastReport, r.lastPacketsSent, r.lastPacketsReceived = now, sent, received
+
+	fmt.Fprintf(r.out, "[%6s] pilots %d/%d atc %d/%d | sent %.0f/s recv %.0f/s | login %s | text %s | fp %s | errors %s\n",
+		now.Sub(s.start).Round(time.Second),
+		s.pilotsConnected.Load(), targetPilots,
+		s.atcConnected.Load(), targetATC,
+		sendRate, receiveRate,
+		s.loginLatency.takeInterval(),
+		s.textLatency.takeInterval(),
+		s.flightPlanLatency.takeInterval(),
+		r.errorSummary(),
+	)
+}
+
+// errorSummary formats the error counters of the whole run
+func (r *reporter) errorSummary() string {
+	s := r.stats
+	return fmt.Sprintf("login=%d send=%d disconnect=%d server=%s",
+		s.loginsFailed.Load(), s.sendErrors.Load(), s.disconnects.Load(), r.serverErrorSummary())
+}
+
+// serverErrorSummary formats the received $ER packets as code:count pairs
+func (r *reporter) serverErrorSummary() string {
+	s := r.stats
+	s.serverErrorsLock.Lock()
+	defer s.serverErrorsLock.Unlock()
+
+	if len(s.serverErrors) == 0 {
+		return "0"
+	}
+
+	codes := make([]int, 0, len(s.serverErrors))
+	for code := range s.serverErrors {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	parts := make([]string, 0, len(codes))
+	for _, code := range codes {
+		parts = append(parts, fmt.Sprintf("%d:%d", code, s.serverErrors[code]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// final writes the summary of the whole run
+func (r *reporter) final() {
+	s := r.stats
+	seconds := time.Since(s.start).Seconds()
+
+	fmt.Fprintf(r.out, "\nSummary after %s\n", time.Since(s.start).Round(time.Second))
+	fmt.Fprintf(r.out, "  logins:       %d succeeded, %d failed\n", s.loginsSucceeded.Load(), s.loginsFailed.Load())
+	fmt.Fprintf(r.out, "  packets:      %d sent (%.0f/s), %d received (%.0f/s)\n",
+		s.packetsSent.Load(), float64(s.packetsSent.Load())/seconds,
+		s.packetsReceived.Load(), float64(s.packetsReceived.Load())/seconds)
+	fmt.Fprintf(r.out, "  text:         %d sent, %d received\n", s.textsSent.Load(), s.textsReceived.Load())
+	fmt.Fprintf(r.out, "  flight plans: %d filed, %d queries, %d responses\n",
+		s.flightPlansFiled.Load(), s.flightPlanQueries.Load(), s.flightPlanResponses.Load())
+	fmt.Fprintf(r.out, "  latency:      login %s\n", s.loginLatency.totalSummary())
+	fmt.Fprintf(r.out, "                text %s\n", s.textLatency.totalSummary())
+	fmt.Fprintf(r.out, "                fp %s\n", s.flightPlanLatency.totalSummary())
+	fmt.Fprintf(r.out, "  errors:       %s\n", r.errorSummary())
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"database/sql"
+)
+
+type PostgresAuditLogRepository struct {
+	db *sql.DB
+}
+
+func (r *PostgresAuditLogRepository) CreateAuditLogEntry(entry *AuditLogEntry) (err error) {
+	row := r.db.QueryRow(`
+		INSERT INTO audit_log
+		(time, actor_cid, action, target, before_value, after_value, source_ip)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		entry.Time, entry.ActorCID, entry.Action, entry.Target,
+		entry.Before, entry.After, entry.SourceIP,
+	)
+	if err = row.Scan(&entry.ID); err != nil {
+		return
+	}
+	return
+}
+
+func (r *PostgresAuditLogRepository) ListAuditLogEntries(limit int, offset int) (entries []AuditLogEntry, err error) {
+	rows, err := r.db.Query(`
+		SELECT
+		id, time, actor_cid, action, target,
+		before_value, after_value, source_ip
+		FROM audit_log
+		ORDER BY time DESC, id DESC
+		LIMIT $1 OFFSET $2`,
+		limit, offset,
+	)
+	if err != nil {
+		return
+	}
+	return scanAuditLogEntries(rows)
+}
+
+func (r *PostgresAuditLogRepository) CountAuditLogEntries() (count int, err error) {
+	err = r.db.QueryRow(`SELECT COUNT(*) FROM audit_log`).Scan(&count)
+	return
+}
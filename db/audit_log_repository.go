@@ -0,0 +1,75 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Audit log actions
+const (
+	AuditActionConfigUpdate   = "config.update"
+	AuditActionSecretKeyReset = "config.reset_secret_key"
+	AuditActionAPITokenCreate = "api_token.create"
+	AuditActionUserCreate     = "user.create"
+	AuditActionUserUpdate     = "user.update"
+	AuditActionConnectionKick = "fsd.kick"
+)
+
+// RedactedValue replaces secrets recorded in the audit log
+const RedactedValue = "[REDACTED]"
+
+// AuditLogEntry is a record of an administrative action.
+type AuditLogEntry struct {
+	ID       int64
+	Time     time.Time
+	ActorCID int
+	Action   string
+	Target   string
+	Before   string // Value before the action, typically JSON. Secrets must be redacted.
+	After    string // Value after the action, typically JSON. Secrets must be redacted.
+	SourceIP string
+}
+
+type AuditLogRepository interface {
+	// CreateAuditLogEntry creates a new AuditLogEntry record.
+	// The ID value is automatically populated in the provided AuditLogEntry struct.
+	CreateAuditLogEntry(*AuditLogEntry) (err error)
+
+	// ListAuditLogEntries retrieves AuditLogEntry records, most recent first.
+	ListAuditLogEntries(limit int, offset int) (entries []AuditLogEntry, err error)
+
+	// CountAuditLogEntries returns the total number of AuditLogEntry records.
+	CountAuditLogEntries() (count int, err error)
+}
+
+// RedactConfigValue returns value, or RedactedValue if key holds a secret.
+func RedactConfigValue(key string, value string) string {
+	if key == ConfigJwtSecretKey {
+		return RedactedValue
+	}
+	return value
+}
+
+func scanAuditLogEntries(rows *sql.Rows) (entries []AuditLogEntry, err error) {
+	defer rows.Close()
+
+	entries = []AuditLogEntry{}
+	for rows.Next() {
+		entry := AuditLogEntry{}
+		if err = rows.Scan(
+			&entry.ID,
+			&entry.Time,
+			&entry.ActorCID,
+			&entry.Action,
+			&entry.Target,
+			&entry.Before,
+			&entry.After,
+			&entry.SourceIP,
+		); err != nil {
+			return
+		}
+		entries = append(entries, entry)
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"database/sql"
+)
+
+type SQLiteAuditLogRepository struct {
+	db *sql.DB
+}
+
+func (r *SQLiteAuditLogRepository) CreateAuditLogEntry(entry *AuditLogEntry) (err error) {
+	row := r.db.QueryRow(`
+		INSERT INTO audit_log
+		(time, actor_cid, action, target, before_value, after_value, source_ip)
+		VALUES
+		(?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		entry.Time.UTC().Format(sqliteTimeFormat), entry.ActorCID, entry.Action, entry.Target,
+		entry.Before, entry.After, entry.SourceIP,
+	)
+	if err = row.Scan(&entry.ID); err != nil {
+		return
+	}
+	return
+}
+
+func (r *SQLiteAuditLogRepository) ListAuditLogEntries(limit int, offset int) (entries []AuditLogEntry, err error) {
+	rows, err := r.db.Query(`
+		SELECT
+		id, time, actor_cid, action, target,
+		before_value, after_value, source_ip
+		FROM audit_log
+		ORDER BY time DESC, id DESC
+		LIMIT ? OFFSET ?`,
+		limit, offset,
+	)
+	if err != nil {
+		return
+	}
+	return scanAuditLogEntries(rows)
+}
+
+func (r *SQLiteAuditLogRepository) CountAuditLogEntries() (count int, err error) {
+	err = r.db.QueryRow(`SELECT COUNT(*) FROM audit_log`).Scan(&count)
+	return
+}
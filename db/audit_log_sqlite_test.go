@@ -0,0 +1,99 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func setupTestAuditLogDB(t *testing.T) (*sql.DB, *SQLiteAuditLogRepository) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	if err = Migrate(db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	return db, &SQLiteAuditLogRepository{db: db}
+}
+
+// TestAuditLogPagination verifies that entries are listed most recent first and paginated.
+func TestAuditLogPagination(t *testing.T) {
+	db, repo := setupTestAuditLogDB(t)
+	defer db.Close()
+
+	start := time.Date(2025, 6, 15, 10, 0, 0, 0, time.UTC)
+	targets := []string{"WELCOME_MESSAGE", "100002", "LAX_TWR"}
+	for i, target := range targets {
+		entry := &AuditLogEntry{
+			Time:     start.Add(time.Duration(i) * time.Minute),
+			ActorCID: 1,
+			Action:   AuditActionConfigUpdate,
+			Target:   target,
+			Before:   `"old"`,
+			After:    `"new"`,
+			SourceIP: "192.0.2.1",
+		}
+		if err := repo.CreateAuditLogEntry(entry); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if entry.ID <= 0 {
+			t.Errorf("expected id > 0, got %d", entry.ID)
+		}
+	}
+
+	count, err := repo.CountAuditLogEntries()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if count != len(targets) {
+		t.Errorf("expected %d entries, got %d", len(targets), count)
+	}
+
+	tests := []struct {
+		name     string
+		limit    int
+		offset   int
+		expected []string
+	}{
+		{"first page", 2, 0, []string{"LAX_TWR", "100002"}},
+		{"second page", 2, 2, []string{"WELCOME_MESSAGE"}},
+		{"past end", 2, 4, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := repo.ListAuditLogEntries(tt.limit, tt.offset)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(entries) != len(tt.expected) {
+				t.Fatalf("expected %d entries, got %d", len(tt.expected), len(entries))
+			}
+			for i, entry := range entries {
+				if entry.Target != tt.expected[i] {
+					t.Errorf("entry %d: expected target %s, got %s", i, tt.expected[i], entry.Target)
+				}
+			}
+		})
+	}
+
+	entries, err := repo.ListAuditLogEntries(1, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := entries[0]; !got.Time.Equal(start.Add(2*time.Minute)) || got.ActorCID != 1 || got.SourceIP != "192.0.2.1" || got.Before != `"old"` {
+		t.Errorf("unexpected entry: %+v", got)
+	}
+}
+
+func TestRedactConfigValue(t *testing.T) {
+	if got := RedactConfigValue(ConfigJwtSecretKey, "secret"); got != RedactedValue {
+		t.Errorf("expected %s, got %s", RedactedValue, got)
+	}
+	if got := RedactConfigValue(ConfigWelcomeMessage, "hello"); got != "hello" {
+		t.Errorf("expected hello, got %s", got)
+	}
+}
@@ -30,6 +30,10 @@ const (
 	ConfigApiServerBaseURL = "API_SERVER_BASE_URL"
 
 	ConfigWelcomeMessage = "WELCOME_MESSAGE"
+
+	ConfigWeatherProfiles = "WEATHER_PROFILES"
+
+	ConfigTransponderCodeRanges = "TRANSPONDER_CODE_RANGES"
 )
 
 var ErrConfigKeyNotFound = errors.New("config: key not found")
@@ -54,6 +58,20 @@ func GetWelcomeMessage(r *ConfigRepository) (msg string) {
 	return
 }
 
+// GetWeatherProfiles returns the JSON-encoded static weather profiles.
+// Returns an empty string if none are configured.
+func GetWeatherProfiles(r *ConfigRepository) (profiles string) {
+	profiles, _ = (*r).Get(ConfigWeatherProfiles)
+	return
+}
+
+// GetTransponderCodeRanges returns the JSON-encoded transponder code allocation ranges.
+// Returns an empty string if none are configured.
+func GetTransponderCodeRanges(r *ConfigRepository) (ranges string) {
+	ranges, _ = (*r).Get(ConfigTransponderCodeRanges)
+	return
+}
+
 func InitDefaultConfig(r *ConfigRepository) (err error) {
 	secretKey, err := GenerateJwtSecretKey()
 	if err != nil {
@@ -61,12 +79,14 @@ func InitDefaultConfig(r *ConfigRepository) (err error) {
 	}
 
 	defaultConfig := map[string]string{
-		ConfigJwtSecretKey:      string(secretKey[:]),
-		ConfigWelcomeMessage:    "Connected to openfsd",
-		ConfigFsdServerHostname: "localhost",
-		ConfigFsdServerIdent:    "OPENFSD",
-		ConfigFsdServerLocation: "Earth",
-		ConfigApiServerBaseURL:  "http://localhost",
+		ConfigJwtSecretKey:          string(secretKey[:]),
+		ConfigWelcomeMessage:        "Connected to openfsd",
+		ConfigFsdServerHostname:     "localhost",
+		ConfigFsdServerIdent:        "OPENFSD",
+		ConfigFsdServerLocation:     "Earth",
+		ConfigApiServerBaseURL:      "http://localhost",
+		ConfigWeatherProfiles:       "{}",
+		ConfigTransponderCodeRanges: "[]",
 	}
 
 	for k, v := range defaultConfig {
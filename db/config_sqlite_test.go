@@ -27,6 +27,7 @@ func setupConfigTestDB(t *testing.T) (*sql.DB, *SQLiteConfigRepository) {
 func TestInitDefault(t *testing.T) {
 	db, repo := setupConfigTestDB(t)
 	defer db.Close()
+	var configRepo ConfigRepository = repo
 
 	// Initially, the key should not exist
 	_, err := repo.Get(ConfigJwtSecretKey)
@@ -35,7 +36,7 @@ func TestInitDefault(t *testing.T) {
 	}
 
 	// Call InitDefault
-	err = repo.InitDefault()
+	err = InitDefaultConfig(&configRepo)
 	if err != nil {
 		t.Errorf("expected no error, got %v", err)
 	}
@@ -50,7 +51,7 @@ func TestInitDefault(t *testing.T) {
 	}
 
 	// Call InitDefault again
-	err = repo.InitDefault()
+	err = InitDefaultConfig(&configRepo)
 	if err != nil {
 		t.Errorf("expected no error, got %v", err)
 	}
@@ -0,0 +1 @@
+drop table public.sessions;
@@ -0,0 +1,18 @@
+create table public.sessions
+(
+    id              bigserial
+        constraint sessions_pk
+        primary key,
+    cid             integer      not null,
+    callsign        varchar(16)  not null,
+    is_atc          boolean      not null,
+    facility        smallint     not null,
+    network_rating  smallint     not null,
+    client_software varchar(255) not null,
+    remote_ip       varchar(45)  not null,
+    login_time      timestamptz  not null,
+    logout_time     timestamptz
+);
+
+create index sessions_cid_login_time_index
+    on public.sessions (cid, login_time);
@@ -0,0 +1,12 @@
+create table public.stats
+(
+    time             timestamptz not null
+        constraint stats_pk
+        primary key,
+    interval_seconds integer     not null,
+    pilots           integer     not null,
+    atc              integer     not null,
+    unique_users     integer     not null,
+    packets_in       bigint      not null,
+    packets_out      bigint      not null
+);
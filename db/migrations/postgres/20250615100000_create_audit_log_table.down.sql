@@ -0,0 +1 @@
+drop table public.audit_log;
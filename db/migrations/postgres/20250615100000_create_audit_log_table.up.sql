@@ -0,0 +1,16 @@
+create table public.audit_log
+(
+    id           bigserial
+        constraint audit_log_pk
+        primary key,
+    time         timestamptz  not null,
+    actor_cid    integer      not null,
+    action       varchar(64)  not null,
+    target       varchar(255) not null,
+    before_value text         not null,
+    after_value  text         not null,
+    source_ip    varchar(45)  not null
+);
+
+create index audit_log_time_index
+    on public.audit_log (time);
@@ -0,0 +1,18 @@
+create table sessions
+(
+    id              integer   not null
+        constraint sessions_pk
+        primary key autoincrement,
+    cid             integer   not null,
+    callsign        text(16)  not null,
+    is_atc          integer   not null,
+    facility        integer   not null,
+    network_rating  integer   not null,
+    client_software text(255) not null,
+    remote_ip       text(45)  not null,
+    login_time      datetime  not null,
+    logout_time     datetime
+);
+
+create index sessions_cid_login_time_index
+    on sessions (cid, login_time);
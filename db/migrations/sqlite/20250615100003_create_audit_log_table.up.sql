@@ -0,0 +1,16 @@
+create table audit_log
+(
+    id           integer   not null
+        constraint audit_log_pk
+        primary key autoincrement,
+    time         datetime  not null,
+    actor_cid    integer   not null,
+    action       text(64)  not null,
+    target       text(255) not null,
+    before_value text      not null,
+    after_value  text      not null,
+    source_ip    text(45)  not null
+);
+
+create index audit_log_time_index
+    on audit_log (time);
@@ -9,8 +9,11 @@ import (
 
 // Repositories bundles all repository interfaces
 type Repositories struct {
-	UserRepo   UserRepository
-	ConfigRepo ConfigRepository
+	UserRepo     UserRepository
+	ConfigRepo   ConfigRepository
+	SessionRepo  SessionRepository
+	StatsRepo    StatsRepository
+	AuditLogRepo AuditLogRepository
 }
 
 // NewUserRepository creates a UserRepository based on the database driver
@@ -37,6 +40,42 @@ func NewConfigRepository(db *sql.DB) (ConfigRepository, error) {
 	}
 }
 
+// NewSessionRepository creates a SessionRepository based on the database driver
+func NewSessionRepository(db *sql.DB) (SessionRepository, error) {
+	switch db.Driver().(type) {
+	case *pq.Driver:
+		return &PostgresSessionRepository{db: db}, nil
+	case *sqlite.Driver:
+		return &SQLiteSessionRepository{db: db}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database")
+	}
+}
+
+// NewStatsRepository creates a StatsRepository based on the database driver
+func NewStatsRepository(db *sql.DB) (StatsRepository, error) {
+	switch db.Driver().(type) {
+	case *pq.Driver:
+		return &PostgresStatsRepository{db: db}, nil
+	case *sqlite.Driver:
+		return &SQLiteStatsRepository{db: db}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database")
+	}
+}
+
+// NewAuditLogRepository creates an AuditLogRepository based on the database driver
+func NewAuditLogRepository(db *sql.DB) (AuditLogRepository, error) {
+	switch db.Driver().(type) {
+	case *pq.Driver:
+		return &PostgresAuditLogRepository{db: db}, nil
+	case *sqlite.Driver:
+		return &SQLiteAuditLogRepository{db: db}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database")
+	}
+}
+
 // NewRepositories creates a Repositories bundle with implementations for the given database
 func NewRepositories(db *sql.DB) (repositories *Repositories, err error) {
 	repositories = &Repositories{}
@@ -46,5 +85,14 @@ func NewRepositories(db *sql.DB) (repositories *Repositories, err error) {
 	if repositories.ConfigRepo, err = NewConfigRepository(db); err != nil {
 		return
 	}
+	if repositories.SessionRepo, err = NewSessionRepository(db); err != nil {
+		return
+	}
+	if repositories.StatsRepo, err = NewStatsRepository(db); err != nil {
+		return
+	}
+	if repositories.AuditLogRepo, err = NewAuditLogRepository(db); err != nil {
+		return
+	}
 	return
 }
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+type PostgresSessionRepository struct {
+	db *sql.DB
+}
+
+func (r *PostgresSessionRepository) CreateSession(session *Session) (err error) {
+	row := r.db.QueryRow(`
+		INSERT INTO sessions
+		(cid, callsign, is_atc, facility, network_rating, client_software, remote_ip, login_time)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		session.CID, session.Callsign, session.IsAtc, session.Facility, session.NetworkRating,
+		session.ClientSoftware, session.RemoteIP, session.LoginTime,
+	)
+	if err = row.Scan(&session.ID); err != nil {
+		return
+	}
+	return
+}
+
+func (r *PostgresSessionRepository) EndSession(id int64, facility int, logoutTime time.Time) (err error) {
+	result, err := r.db.Exec(`
+		UPDATE sessions
+		SET facility = $1, logout_time = $2
+		WHERE id = $3`,
+		facility, logoutTime, id,
+	)
+	if err != nil {
+		return
+	}
+	return checkRowsAffected(result)
+}
+
+func (r *PostgresSessionRepository) EndOpenSessions(logoutTime time.Time) (err error) {
+	_, err = r.db.Exec(`
+		UPDATE sessions
+		SET logout_time = $1
+		WHERE logout_time IS NULL`,
+		logoutTime,
+	)
+	return
+}
+
+func (r *PostgresSessionRepository) ListSessionsByCID(cid int, limit int, offset int) (sessions []Session, err error) {
+	rows, err := r.db.Query(`
+		SELECT
+		id, cid, callsign, is_atc, facility, network_rating,
+		client_software, remote_ip, login_time, logout_time
+		FROM sessions
+		WHERE cid = $1
+		ORDER BY login_time DESC, id DESC
+		LIMIT $2 OFFSET $3`,
+		cid, limit, offset,
+	)
+	if err != nil {
+		return
+	}
+	return scanSessions(rows)
+}
+
+func (r *PostgresSessionRepository) GetPositionHoursByCID(cid int) (hours []PositionHours, err error) {
+	rows, err := r.db.Query(`
+		SELECT
+		callsign, is_atc, COUNT(*),
+		SUM(EXTRACT(EPOCH FROM logout_time - login_time))::double precision AS seconds
+		FROM sessions
+		WHERE cid = $1 AND logout_time IS NOT NULL
+		GROUP BY callsign, is_atc
+		ORDER BY seconds DESC, callsign`,
+		cid,
+	)
+	if err != nil {
+		return
+	}
+	return scanPositionHours(rows)
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Session is a record of a single FSD connection.
+type Session struct {
+	ID             int64
+	CID            int
+	Callsign       string
+	IsAtc          bool
+	Facility       int // ATC facility type. Zero for pilots.
+	NetworkRating  int
+	ClientSoftware string
+	RemoteIP       string
+	LoginTime      time.Time
+	LogoutTime     *time.Time // Nil while the session is ongoing
+}
+
+// PositionHours is the total time a user has logged on a callsign.
+type PositionHours struct {
+	Callsign string
+	IsAtc    bool
+	Sessions int
+	Duration time.Duration
+}
+
+type SessionRepository interface {
+	// CreateSession creates a new Session record.
+	// The ID value is automatically populated in the provided Session struct.
+	CreateSession(*Session) (err error)
+
+	// EndSession sets the logout time and final facility type of a Session.
+	//
+	// Returns sql.ErrNoRows when no Session exists with the given ID.
+	EndSession(id int64, facility int, logoutTime time.Time) (err error)
+
+	// EndOpenSessions sets the logout time of every Session without one.
+	// This closes sessions left open by an unclean shutdown.
+	EndOpenSessions(logoutTime time.Time) (err error)
+
+	// ListSessionsByCID retrieves the Session records of a CID, most recent first.
+	ListSessionsByCID(cid int, limit int, offset int) (sessions []Session, err error)
+
+	// GetPositionHoursByCID totals the completed sessions of a CID per callsign,
+	// ordered by duration descending.
+	GetPositionHoursByCID(cid int) (hours []PositionHours, err error)
+}
+
+func scanSessions(rows *sql.Rows) (sessions []Session, err error) {
+	defer rows.Close()
+
+	sessions = []Session{}
+	for rows.Next() {
+		session := Session{}
+		var logoutTime sql.NullTime
+		if err = rows.Scan(
+			&session.ID,
+			&session.CID,
+			&session.Callsign,
+			&session.IsAtc,
+			&session.Facility,
+			&session.NetworkRating,
+			&session.ClientSoftware,
+			&session.RemoteIP,
+			&session.LoginTime,
+			&logoutTime,
+		); err != nil {
+			return
+		}
+		if logoutTime.Valid {
+			session.LogoutTime = &logoutTime.Time
+		}
+		sessions = append(sessions, session)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanPositionHours(rows *sql.Rows) (hours []PositionHours, err error) {
+	defer rows.Close()
+
+	hours = []PositionHours{}
+	for rows.Next() {
+		position := PositionHours{}
+		var seconds float64
+		if err = rows.Scan(&position.Callsign, &position.IsAtc, &position.Sessions, &seconds); err != nil {
+			return
+		}
+		position.Duration = time.Duration(seconds * float64(time.Second)).Round(time.Second)
+		hours = append(hours, position)
+	}
+	err = rows.Err()
+	return
+}
+
+// checkRowsAffected returns sql.ErrNoRows if a statement did not affect any rows.
+func checkRowsAffected(result sql.Result) (err error) {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if rowsAffected == 0 {
+		err = sql.ErrNoRows
+	}
+	return
+}
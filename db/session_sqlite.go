@@ -0,0 +1,86 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// sqliteTimeFormat is understood by both SQLite date functions and the SQLite driver
+const sqliteTimeFormat = "2006-01-02 15:04:05.000"
+
+type SQLiteSessionRepository struct {
+	db *sql.DB
+}
+
+func (r *SQLiteSessionRepository) CreateSession(session *Session) (err error) {
+	row := r.db.QueryRow(`
+		INSERT INTO sessions
+		(cid, callsign, is_atc, facility, network_rating, client_software, remote_ip, login_time)
+		VALUES
+		(?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		session.CID, session.Callsign, session.IsAtc, session.Facility, session.NetworkRating,
+		session.ClientSoftware, session.RemoteIP, session.LoginTime.UTC().Format(sqliteTimeFormat),
+	)
+	if err = row.Scan(&session.ID); err != nil {
+		return
+	}
+	return
+}
+
+func (r *SQLiteSessionRepository) EndSession(id int64, facility int, logoutTime time.Time) (err error) {
+	result, err := r.db.Exec(`
+		UPDATE sessions
+		SET facility = ?, logout_time = ?
+		WHERE id = ?`,
+		facility, logoutTime.UTC().Format(sqliteTimeFormat), id,
+	)
+	if err != nil {
+		return
+	}
+	return checkRowsAffected(result)
+}
+
+func (r *SQLiteSessionRepository) EndOpenSessions(logoutTime time.Time) (err error) {
+	_, err = r.db.Exec(`
+		UPDATE sessions
+		SET logout_time = ?
+		WHERE logout_time IS NULL`,
+		logoutTime.UTC().Format(sqliteTimeFormat),
+	)
+	return
+}
+
+func (r *SQLiteSessionRepository) ListSessionsByCID(cid int, limit int, offset int) (sessions []Session, err error) {
+	rows, err := r.db.Query(`
+		SELECT
+		id, cid, callsign, is_atc, facility, network_rating,
+		client_software, remote_ip, login_time, logout_time
+		FROM sessions
+		WHERE cid = ?
+		ORDER BY login_time DESC, id DESC
+		LIMIT ? OFFSET ?`,
+		cid, limit, offset,
+	)
+	if err != nil {
+		return
+	}
+	return scanSessions(rows)
+}
+
+func (r *SQLiteSessionRepository) GetPositionHoursByCID(cid int) (hours []PositionHours, err error) {
+	rows, err := r.db.Query(`
+		SELECT
+		callsign, is_atc, COUNT(*),
+		SUM((julianday(logout_time) - julianday(login_time)) * 86400) AS seconds
+		FROM sessions
+		WHERE cid = ? AND logout_time IS NOT NULL
+		GROUP BY callsign, is_atc
+		ORDER BY seconds DESC, callsign`,
+		cid,
+	)
+	if err != nil {
+		return
+	}
+	return scanPositionHours(rows)
+}
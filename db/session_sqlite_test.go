@@ -0,0 +1,162 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func setupTestSessionDB(t *testing.T) (*sql.DB, *SQLiteSessionRepository) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	if err = Migrate(db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	return db, &SQLiteSessionRepository{db: db}
+}
+
+// TestSessionLifecycle verifies that sessions are created, ended and listed most recent first.
+func TestSessionLifecycle(t *testing.T) {
+	db, repo := setupTestSessionDB(t)
+	defer db.Close()
+
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	first := &Session{
+		CID:            100001,
+		Callsign:       "LAX_TWR",
+		IsAtc:          true,
+		NetworkRating:  5,
+		ClientSoftware: "vatSys 1.0",
+		RemoteIP:       "192.0.2.1",
+		LoginTime:      start,
+	}
+	if err := repo.CreateSession(first); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if first.ID <= 0 {
+		t.Errorf("expected id > 0, got %d", first.ID)
+	}
+	if err := repo.EndSession(first.ID, 4, start.Add(90*time.Minute)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	second := &Session{CID: 100001, Callsign: "N123AB", LoginTime: start.Add(2 * time.Hour)}
+	if err := repo.CreateSession(second); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Another user's session is not listed
+	if err := repo.CreateSession(&Session{CID: 100002, Callsign: "DAL1", LoginTime: start}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	sessions, err := repo.ListSessionsByCID(100001, 10, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	if sessions[0].ID != second.ID || sessions[0].LogoutTime != nil {
+		t.Errorf("expected ongoing session %d first, got %+v", second.ID, sessions[0])
+	}
+	ended := sessions[1]
+	if ended.Facility != 4 || ended.ClientSoftware != "vatSys 1.0" || ended.RemoteIP != "192.0.2.1" || !ended.IsAtc {
+		t.Errorf("unexpected session fields: %+v", ended)
+	}
+	if !ended.LoginTime.Equal(start) || ended.LogoutTime == nil || !ended.LogoutTime.Equal(start.Add(90*time.Minute)) {
+		t.Errorf("unexpected session times: %v to %v", ended.LoginTime, ended.LogoutTime)
+	}
+
+	// Pagination
+	sessions, err = repo.ListSessionsByCID(100001, 1, 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != first.ID {
+		t.Errorf("expected session %d on second page, got %+v", first.ID, sessions)
+	}
+
+	if err = repo.EndSession(9999, 0, start); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+// TestGetPositionHoursByCID verifies that completed sessions are totalled per callsign.
+func TestGetPositionHoursByCID(t *testing.T) {
+	db, repo := setupTestSessionDB(t)
+	defer db.Close()
+
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	sessions := []struct {
+		callsign string
+		isAtc    bool
+		duration time.Duration
+	}{
+		{"LAX_TWR", true, time.Hour},
+		{"LAX_TWR", true, 30 * time.Minute},
+		{"LAX_APP", true, 2 * time.Hour},
+		{"N123AB", false, 45 * time.Minute},
+	}
+	for i, s := range sessions {
+		session := &Session{CID: 100001, Callsign: s.callsign, IsAtc: s.isAtc, LoginTime: start.Add(time.Duration(i) * 24 * time.Hour)}
+		if err := repo.CreateSession(session); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.EndSession(session.ID, 0, session.LoginTime.Add(s.duration)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ongoing sessions are not counted
+	if err := repo.CreateSession(&Session{CID: 100001, Callsign: "LAX_TWR", IsAtc: true, LoginTime: start}); err != nil {
+		t.Fatal(err)
+	}
+
+	hours, err := repo.GetPositionHoursByCID(100001)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []PositionHours{
+		{Callsign: "LAX_APP", IsAtc: true, Sessions: 1, Duration: 2 * time.Hour},
+		{Callsign: "LAX_TWR", IsAtc: true, Sessions: 2, Duration: 90 * time.Minute},
+		{Callsign: "N123AB", IsAtc: false, Sessions: 1, Duration: 45 * time.Minute},
+	}
+	if len(hours) != len(expected) {
+		t.Fatalf("expected %d positions, got %+v", len(expected), hours)
+	}
+	for i := range expected {
+		if hours[i] != expected[i] {
+			t.Errorf("position %d: expected %+v, got %+v", i, expected[i], hours[i])
+		}
+	}
+}
+
+// TestEndOpenSessions verifies that sessions left open are closed.
+func TestEndOpenSessions(t *testing.T) {
+	db, repo := setupTestSessionDB(t)
+	defer db.Close()
+
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	if err := repo.CreateSession(&Session{CID: 100001, Callsign: "N123AB", LoginTime: start}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.EndOpenSessions(start.Add(time.Hour)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	sessions, err := repo.ListSessionsByCID(100001, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].LogoutTime == nil || !sessions[0].LogoutTime.Equal(start.Add(time.Hour)) {
+		t.Errorf("expected session to be ended, got %+v", sessions)
+	}
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type PostgresStatsRepository struct {
+	db *sql.DB
+}
+
+func (r *PostgresStatsRepository) CreateStatsSample(sample *StatsSample) (err error) {
+	_, err = r.db.Exec(`
+		INSERT INTO stats
+		(time, interval_seconds, pilots, atc, unique_users, packets_in, packets_out)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7)`,
+		sample.Time, int64(sample.Interval.Seconds()),
+		sample.Pilots, sample.ATC, sample.UniqueUsers, sample.PacketsIn, sample.PacketsOut,
+	)
+	return
+}
+
+func (r *PostgresStatsRepository) GetStatsAggregates(from time.Time, to time.Time, resolution StatsResolution) (aggregates []StatsAggregate, err error) {
+	var bucket string
+	switch resolution {
+	case StatsResolutionRaw:
+		bucket = "time AT TIME ZONE 'UTC'"
+	case StatsResolutionHour:
+		bucket = "date_trunc('hour', time AT TIME ZONE 'UTC')"
+	case StatsResolutionDay:
+		bucket = "date_trunc('day', time AT TIME ZONE 'UTC')"
+	default:
+		err = ErrInvalidStatsResolution
+		return
+	}
+
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT
+		%s AS bucket, COUNT(*),
+		MAX(pilots), MAX(atc), MAX(unique_users),
+		SUM(packets_in), SUM(packets_out), SUM(interval_seconds)
+		FROM stats
+		WHERE time >= $1 AND time < $2
+		GROUP BY bucket
+		ORDER BY bucket`, bucket),
+		from, to,
+	)
+	if err != nil {
+		return
+	}
+	return scanStatsAggregates(rows, func(v any) (t time.Time, err error) {
+		t, ok := v.(time.Time)
+		if !ok {
+			err = fmt.Errorf("unexpected stats bucket type %T", v)
+			return
+		}
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		return
+	})
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// StatsSample is a snapshot of network activity taken at the end of a sampling interval.
+type StatsSample struct {
+	Time        time.Time
+	Interval    time.Duration // Length of the sampling interval
+	Pilots      int
+	ATC         int
+	UniqueUsers int // Number of distinct CIDs connected
+	PacketsIn   int64
+	PacketsOut  int64 // Packets sent during the interval
+}
+
+// StatsResolution is the length of the buckets StatsSample records are aggregated into.
+type StatsResolution string
+
+const (
+	StatsResolutionRaw  StatsResolution = "raw" // One bucket per sample
+	StatsResolutionHour StatsResolution = "hour"
+	StatsResolutionDay  StatsResolution = "day"
+)
+
+var ErrInvalidStatsResolution = errors.New("invalid stats resolution")
+
+// StatsAggregate summarises the StatsSample records within a bucket.
+type StatsAggregate struct {
+	Time            time.Time // Start of the bucket
+	Samples         int
+	PeakPilots      int
+	PeakATC         int
+	PeakUniqueUsers int
+	PacketsIn       int64
+	PacketsOut      int64
+	Duration        time.Duration // Total sampled time, used to compute packet rates
+}
+
+type StatsRepository interface {
+	// CreateStatsSample stores a StatsSample record.
+	CreateStatsSample(*StatsSample) (err error)
+
+	// GetStatsAggregates aggregates the StatsSample records taken within [from, to)
+	// into buckets of the given resolution, ordered by time.
+	//
+	// Returns ErrInvalidStatsResolution for an unknown resolution.
+	GetStatsAggregates(from time.Time, to time.Time, resolution StatsResolution) (aggregates []StatsAggregate, err error)
+}
+
+func scanStatsAggregates(rows *sql.Rows, parseTime func(any) (time.Time, error)) (aggregates []StatsAggregate, err error) {
+	defer rows.Close()
+
+	aggregates = []StatsAggregate{}
+	for rows.Next() {
+		aggregate := StatsAggregate{}
+		var bucket any
+		var seconds int64
+		if err = rows.Scan(
+			&bucket,
+			&aggregate.Samples,
+			&aggregate.PeakPilots,
+			&aggregate.PeakATC,
+			&aggregate.PeakUniqueUsers,
+			&aggregate.PacketsIn,
+			&aggregate.PacketsOut,
+			&seconds,
+		); err != nil {
+			return
+		}
+		if aggregate.Time, err = parseTime(bucket); err != nil {
+			return
+		}
+		aggregate.Duration = time.Duration(seconds) * time.Second
+		aggregates = append(aggregates, aggregate)
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type SQLiteStatsRepository struct {
+	db *sql.DB
+}
+
+func (r *SQLiteStatsRepository) CreateStatsSample(sample *StatsSample) (err error) {
+	_, err = r.db.Exec(`
+		INSERT INTO stats
+		(time, interval_seconds, pilots, atc, unique_users, packets_in, packets_out)
+		VALUES
+		(?, ?, ?, ?, ?, ?, ?)`,
+		sample.Time.UTC().Format(sqliteTimeFormat), int64(sample.Interval.Seconds()),
+		sample.Pilots, sample.ATC, sample.UniqueUsers, sample.PacketsIn, sample.PacketsOut,
+	)
+	return
+}
+
+func (r *SQLiteStatsRepository) GetStatsAggregates(from time.Time, to time.Time, resolution StatsResolution) (aggregates []StatsAggregate, err error) {
+	// Times are stored as sqliteTimeFormat strings, so buckets are string prefixes
+	var bucket string
+	switch resolution {
+	case StatsResolutionRaw:
+		bucket = "time"
+	case StatsResolutionHour:
+		bucket = "substr(time, 1, 13) || ':00:00.000'"
+	case StatsResolutionDay:
+		bucket = "substr(time, 1, 10) || ' 00:00:00.000'"
+	default:
+		err = ErrInvalidStatsResolution
+		return
+	}
+
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT
+		CAST(%s AS TEXT) AS bucket, COUNT(*),
+		MAX(pilots), MAX(atc), MAX(unique_users),
+		SUM(packets_in), SUM(packets_out), SUM(interval_seconds)
+		FROM stats
+		WHERE time >= ? AND time < ?
+		GROUP BY bucket
+		ORDER BY bucket`, bucket),
+		from.UTC().Format(sqliteTimeFormat), to.UTC().Format(sqliteTimeFormat),
+	)
+	if err != nil {
+		return
+	}
+	return scanStatsAggregates(rows, func(v any) (t time.Time, err error) {
+		str, ok := v.(string)
+		if !ok {
+			err = fmt.Errorf("unexpected stats bucket type %T", v)
+			return
+		}
+		return time.ParseInLocation(sqliteTimeFormat, str, time.UTC)
+	})
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestGetStatsAggregates verifies that samples are aggregated into buckets of each resolution.
+func TestGetStatsAggregates(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err = Migrate(db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	repo := &SQLiteStatsRepository{db: db}
+
+	day := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	samples := []StatsSample{
+		{Time: day.Add(10 * time.Hour), Pilots: 10, ATC: 2, UniqueUsers: 11, PacketsIn: 600, PacketsOut: 1200},
+		{Time: day.Add(10*time.Hour + 30*time.Minute), Pilots: 14, ATC: 1, UniqueUsers: 15, PacketsIn: 900, PacketsOut: 1800},
+		{Time: day.Add(11 * time.Hour), Pilots: 8, ATC: 3, UniqueUsers: 10, PacketsIn: 300, PacketsOut: 600},
+		{Time: day.Add(36 * time.Hour), Pilots: 20, ATC: 4, UniqueUsers: 23, PacketsIn: 1000, PacketsOut: 2000},
+	}
+	for _, sample := range samples {
+		sample.Interval = time.Minute
+		if err = repo.CreateStatsSample(&sample); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		from, to   time.Time
+		resolution StatsResolution
+		expected   []StatsAggregate
+	}{
+		{
+			"hour",
+			day, day.Add(24 * time.Hour),
+			StatsResolutionHour,
+			[]StatsAggregate{
+				{Time: day.Add(10 * time.Hour), Samples: 2, PeakPilots: 14, PeakATC: 2, PeakUniqueUsers: 15, PacketsIn: 1500, PacketsOut: 3000, Duration: 2 * time.Minute},
+				{Time: day.Add(11 * time.Hour), Samples: 1, PeakPilots: 8, PeakATC: 3, PeakUniqueUsers: 10, PacketsIn: 300, PacketsOut: 600, Duration: time.Minute},
+			},
+		},
+		{
+			"day",
+			day, day.Add(48 * time.Hour),
+			StatsResolutionDay,
+			[]StatsAggregate{
+				{Time: day, Samples: 3, PeakPilots: 14, PeakATC: 3, PeakUniqueUsers: 15, PacketsIn: 1800, PacketsOut: 3600, Duration: 3 * time.Minute},
+				{Time: day.Add(24 * time.Hour), Samples: 1, PeakPilots: 20, PeakATC: 4, PeakUniqueUsers: 23, PacketsIn: 1000, PacketsOut: 2000, Duration: time.Minute},
+			},
+		},
+		{
+			"raw range end is exclusive",
+			day.Add(10*time.Hour + 30*time.Minute), day.Add(11 * time.Hour),
+			StatsResolutionRaw,
+			[]StatsAggregate{
+				{Time: day.Add(10*time.Hour + 30*time.Minute), Samples: 1, PeakPilots: 14, PeakATC: 1, PeakUniqueUsers: 15, PacketsIn: 900, PacketsOut: 1800, Duration: time.Minute},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			aggregates, err := repo.GetStatsAggregates(tc.from, tc.to, tc.resolution)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(aggregates) != len(tc.expected) {
+				t.Fatalf("expected %d aggregates, got %+v", len(tc.expected), aggregates)
+			}
+			for i := range tc.expected {
+				if !aggregates[i].Time.Equal(tc.expected[i].Time) {
+					t.Errorf("aggregate %d: expected time %v, got %v", i, tc.expected[i].Time, aggregates[i].Time)
+				}
+				aggregates[i].Time = tc.expected[i].Time
+				if aggregates[i] != tc.expected[i] {
+					t.Errorf("aggregate %d: expected %+v, got %+v", i, tc.expected[i], aggregates[i])
+				}
+			}
+		})
+	}
+
+	if _, err = repo.GetStatsAggregates(day, day, "week"); !errors.Is(err, ErrInvalidStatsResolution) {
+		t.Errorf("expected ErrInvalidStatsResolution, got %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package fsd
+
+import (
+	"encoding/json"
+	"github.com/renorris/openfsd/db"
+	"time"
+)
+
+// auditKill records a $!! kill request issued by client against victim in the audit log.
+// Failures are logged rather than returned.
+func (s *Server) auditKill(client *Client, victim *Client) {
+	before, _ := json.Marshal(struct {
+		Callsign string `json:"callsign"`
+		CID      int    `json:"cid"`
+	}{victim.callsign, victim.cid})
+
+	entry := db.AuditLogEntry{
+		Time:     time.Now(),
+		ActorCID: client.cid,
+		Action:   db.AuditActionConnectionKick,
+		Target:   victim.callsign,
+		Before:   string(before),
+		SourceIP: client.transport.remoteIP(),
+	}
+
+	if err := s.dbRepo.AuditLogRepo.CreateAuditLogEntry(&entry); err != nil {
+		client.logger.Error("failed to write audit log entry", "action", entry.Action, "error", err)
+	}
+}
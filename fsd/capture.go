@@ -0,0 +1,275 @@
+package fsd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Packet capture files
+//
+// A capture file is UTF-8 text containing one record per line, terminated by "\n".
+// Each record has five tab-separated fields:
+//
+//	<time> <conn_id> <direction> <callsign> <packet>
+//
+// time is the RFC 3339 UTC timestamp at which the packet was read or written, with nanoseconds.
+// conn_id is the server-assigned connection ID, also found in the server logs.
+// direction is one of the CaptureDirection values below.
+// packet is the raw packet without its trailing CRLF. Packets never contain newlines, but may contain tabs,
+// such as in the text of a #TM message. As the last field, the packet extends to the end of the line.
+//
+// Login records hold the client ident and add packets, with the password/token field of the add packet removed.
+// They are always the first records of a connection. An end record with an empty packet is written when the connection closes.
+//
+// Files are named capture-<UTC time>.log and are rotated once they reach CAPTURE_MAX_FILE_SIZE bytes.
+// Only the newest CAPTURE_MAX_FILES files are kept.
+
+// CaptureDirection identifies the origin of a captured packet.
+type CaptureDirection byte
+
+const (
+	CaptureDirectionLogin  CaptureDirection = 'L' // Login packet sent by the client
+	CaptureDirectionClient CaptureDirection = 'C' // Packet sent by the client to the server
+	CaptureDirectionServer CaptureDirection = 'S' // Packet sent by the server to the client
+	CaptureDirectionEnd    CaptureDirection = 'E' // Connection closed
+)
+
+// CaptureRecord is a single record of a capture file.
+type CaptureRecord struct {
+	Time      time.Time
+	ConnID    uint64
+	Direction CaptureDirection
+	Callsign  string
+	Packet    string // Packet without its trailing CRLF
+}
+
+var ErrInvalidCaptureRecord = errors.New("invalid capture record")
+
+// String formats the record as a capture file line, without the trailing newline.
+func (r *CaptureRecord) String() string {
+	line := strings.Builder{}
+	line.Grow(64 + len(r.Packet))
+	line.WriteString(r.Time.UTC().Format(time.RFC3339Nano))
+	line.WriteByte('\t')
+	line.WriteString(strconv.FormatUint(r.ConnID, 10))
+	line.WriteByte('\t')
+	line.WriteByte(byte(r.Direction))
+	line.WriteByte('\t')
+	line.WriteString(r.Callsign)
+	line.WriteByte('\t')
+	line.WriteString(r.Packet)
+	return line.String()
+}
+
+// ParseCaptureRecord parses a single capture file line.
+func ParseCaptureRecord(line string) (record CaptureRecord, err error) {
+	fields := strings.SplitN(strings.TrimRight(line, "\r\n"), "\t", 5)
+	if len(fields) != 5 || len(fields[2]) != 1 {
+		err = ErrInvalidCaptureRecord
+		return
+	}
+
+	if record.Time, err = time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+		err = ErrInvalidCaptureRecord
+		return
+	}
+	if record.ConnID, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		err = ErrInvalidCaptureRecord
+		return
+	}
+
+	record.Direction = CaptureDirection(fields[2][0])
+	switch record.Direction {
+	case CaptureDirectionLogin, CaptureDirectionClient, CaptureDirectionServer, CaptureDirectionEnd:
+	default:
+		err = ErrInvalidCaptureRecord
+		return
+	}
+
+	record.Callsign = fields[3]
+	record.Packet = fields[4]
+	return
+}
+
+// CaptureReader reads records from a capture file.
+type CaptureReader struct {
+	scanner *bufio.Scanner
+}
+
+// NewCaptureReader creates a CaptureReader reading from r.
+func NewCaptureReader(r io.Reader) *CaptureReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 8192), 8192)
+	return &CaptureReader{scanner: scanner}
+}
+
+// Next returns the next record. Returns io.EOF once all records have been read.
+// Blank lines are skipped.
+func (r *CaptureReader) Next() (record CaptureRecord, err error) {
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if line == "" {
+			continue
+		}
+		return ParseCaptureRecord(line)
+	}
+	if err = r.scanner.Err(); err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+// packetCapture writes captured packets to rotating capture files.
+type packetCapture struct {
+	all       bool
+	callsigns map[string]struct{}
+	listeners map[string]struct{}
+
+	dir         string
+	maxFileSize int64
+	maxFiles    int
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+// newPacketCapture creates a packetCapture from the server configuration.
+// Returns nil if packet capture is disabled.
+func newPacketCapture(cfg *ServerConfig) (p *packetCapture, err error) {
+	if cfg.CaptureDir == "" || (!cfg.CaptureAll && len(cfg.CaptureCallsigns) == 0 && len(cfg.CaptureListeners) == 0) {
+		return
+	}
+
+	if err = os.MkdirAll(cfg.CaptureDir, 0o750); err != nil {
+		return
+	}
+
+	p = &packetCapture{
+		all:         cfg.CaptureAll,
+		callsigns:   make(map[string]struct{}, len(cfg.CaptureCallsigns)),
+		listeners:   make(map[string]struct{}, len(cfg.CaptureListeners)),
+		dir:         cfg.CaptureDir,
+		maxFileSize: cfg.CaptureMaxFileSize,
+		maxFiles:    cfg.CaptureMaxFiles,
+	}
+	for _, callsign := range cfg.CaptureCallsigns {
+		p.callsigns[strings.ToUpper(callsign)] = struct{}{}
+	}
+	for _, addr := range cfg.CaptureListeners {
+		p.listeners[addr] = struct{}{}
+	}
+	return
+}
+
+// matches reports whether a connection with the given listener address and callsign should be captured.
+func (p *packetCapture) matches(listenAddr string, callsign string) bool {
+	if p == nil {
+		return false
+	}
+	if p.all {
+		return true
+	}
+	if _, ok := p.listeners[listenAddr]; ok {
+		return true
+	}
+	_, ok := p.callsigns[strings.ToUpper(callsign)]
+	return ok
+}
+
+// record writes a single packet to the current capture file.
+// Write failures are reported to the caller, and the next record is written to a new file.
+func (p *packetCapture) record(connID uint64, direction CaptureDirection, callsign string, packet []byte) (err error) {
+	record := CaptureRecord{
+		Time:      time.Now(),
+		ConnID:    connID,
+		Direction: direction,
+		Callsign:  callsign,
+		Packet:    string(bytes.TrimRight(packet, "\r\n")),
+	}
+	line := record.String() + "\n"
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.file == nil || (p.maxFileSize > 0 && p.size+int64(len(line)) > p.maxFileSize && p.size > 0) {
+		if err = p.rotate(); err != nil {
+			return
+		}
+	}
+
+	n, err := io.WriteString(p.file, line)
+	p.size += int64(n)
+	if err != nil {
+		p.file.Close()
+		p.file = nil
+	}
+	return
+}
+
+// rotate closes the current capture file, opens a new one and removes the oldest files beyond maxFiles.
+// The caller must hold p.lock.
+func (p *packetCapture) rotate() (err error) {
+	if p.file != nil {
+		p.file.Close()
+		p.file = nil
+	}
+
+	name := fmt.Sprintf("capture-%s.log", time.Now().UTC().Format("20060102T150405.000000000Z"))
+	if p.file, err = os.OpenFile(filepath.Join(p.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640); err != nil {
+		return
+	}
+	p.size = 0
+
+	if p.maxFiles <= 0 {
+		return
+	}
+
+	// Names sort chronologically
+	files, err := filepath.Glob(filepath.Join(p.dir, "capture-*.log"))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	for len(files) > p.maxFiles {
+		os.Remove(files[0])
+		files = files[1:]
+	}
+	return
+}
+
+// capturePacket records a packet sent or received by the client if its connection is being captured.
+func (c *Client) capturePacket(direction CaptureDirection, packet []byte) {
+	if c.capture == nil {
+		return
+	}
+	if err := c.capture.record(c.connID, direction, c.callsign, packet); err != nil {
+		c.logger.Warn("error writing packet capture", "error", err)
+	}
+}
+
+// setAddPacketToken returns a copy of an #AA or #AP add packet with its password/token field replaced.
+func setAddPacketToken(packet []byte, token string) []byte {
+	fields := bytes.Split(bytes.TrimRight(packet, "\r\n"), []byte(":"))
+
+	tokenIndex := 3 // Pilot
+	if bytes.HasPrefix(packet, []byte("#AA")) {
+		tokenIndex = 4
+	}
+	if len(fields) <= tokenIndex {
+		return append([]byte{}, packet...)
+	}
+
+	fields[tokenIndex] = []byte(token)
+	return bytes.Join(fields, []byte(":"))
+}
@@ -1,70 +1,91 @@
 package fsd
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"go.uber.org/atomic"
-	"net"
+	"log/slog"
 	"strconv"
 	"strings"
 )
 
 type Client struct {
-	conn      net.Conn
-	scanner   *bufio.Scanner
-	ctx       context.Context
-	cancelCtx func()
-	sendChan  chan string
+	transport  transport
+	ctx        context.Context
+	cancelCtx  func()
+	sendChan   chan string
+	logger     *slog.Logger // Annotated with the connection ID, remote IP, callsign and CID
+	connID     uint64
+	sessionID  int64           // Session recorded in the database. Zero if not recorded.
+	listenAddr string          // FSD listener the client connected to. Empty for virtual clients.
+	resumed    bool            // Whether the client was handed over by a previous process
+	handover   chan bool       // Receives whether the client was handed over to a new process, once paused for a restart
+	senderDone chan struct{}   // Closed once the sender worker has stopped
+	served     chan struct{}   // Closed once the server has stopped serving the client, and released it unless handed over
+	capture    *packetCapture  // Nil unless this connection is being captured
+	virtual    bool            // Whether the client runs inside the server rather than over a socket
+	hidden     bool            // Whether the client is excluded from the online users datafeed
+	peer       *federationPeer // Linked server the client is connected to. Nil for local clients.
+	upstream   *upstream       // Connection to the upstream server in relay mode. Nil unless relayed.
 
 	coords                        atomic.Value
 	visRange                      atomic.Float64
 	closestVelocityClientDistance float64 // The closest Velocity-compatible client in meters
 
-	flightPlan         atomic.String
-	assignedBeaconCode atomic.String
+	flightPlan atomic.String
 
-	frequency   atomic.String // ATC frequency
-	altitude    atomic.Int32  // Pilot altitude
-	groundspeed atomic.Int32  // Pilot ground speed
-	transponder atomic.String // Active pilot transponder
-	heading     atomic.Int32  // Pilot heading
-	lastUpdated atomic.Time   // Last updated time
+	frequency   atomic.String    // ATC frequency
+	altitude    atomic.Int32     // Pilot altitude
+	groundspeed atomic.Int32     // Pilot ground speed
+	transponder atomic.String    // Active pilot transponder
+	heading     atomic.Int32     // Pilot heading
+	lastUpdated atomic.Time      // Last updated time
+	history     *positionHistory // Recent pilot positions. Nil for ATC.
 
 	facilityType int // ATC facility type. This value is only relevant for ATC
 	loginData
 
-	authState       vatsimAuthState
+	authState       VatsimAuthState
 	sendFastEnabled bool
+	trackStateSent  bool // Whether shared aircraft state has been sent to this ATC client
 }
 
 type LatLon struct {
 	lat, lon float64
 }
 
-func newClient(ctx context.Context, conn net.Conn, scanner *bufio.Scanner, loginData loginData) (client *Client) {
+func newClient(ctx context.Context, transport transport, loginData loginData, logger *slog.Logger) (client *Client) {
 	clientCtx, cancel := context.WithCancel(ctx)
 	client = &Client{
-		conn:      conn,
-		scanner:   scanner,
-		ctx:       clientCtx,
-		cancelCtx: cancel,
-		sendChan:  make(chan string, 32),
-		loginData: loginData,
+		transport:  transport,
+		ctx:        clientCtx,
+		cancelCtx:  cancel,
+		sendChan:   make(chan string, 32),
+		logger:     logger,
+		handover:   make(chan bool),
+		senderDone: make(chan struct{}),
+		served:     make(chan struct{}),
+		loginData:  loginData,
 	}
 	client.setLatLon(0, 0)
 	return
 }
 
-func (c *Client) senderWorker() {
-	defer c.conn.Close()
+// senderWorker writes queued packets to the transport, counting each one in sent.
+func (c *Client) senderWorker(sent *atomic.Uint64) {
+	defer close(c.senderDone)
+	defer c.transport.Close()
 	defer c.cancelCtx()
 
 	for {
 		select {
 		case packet := <-c.sendChan:
-			if _, err := c.conn.Write([]byte(packet)); err != nil {
+			if _, err := c.transport.Write([]byte(packet)); err != nil {
 				return
 			}
+			sent.Inc()
+			c.capturePacket(CaptureDirectionServer, []byte(packet))
+			packetsSent.WithLabelValues(getPacketType([]byte(packet)).String()).Inc()
 		case <-c.ctx.Done():
 			return
 		}
@@ -86,6 +107,8 @@ func (c *Client) sendError(code int, message string) (err error) {
 	packet.WriteString(message)
 	packet.WriteString("\r\n")
 
+	c.logger.Info("sent error packet", "code", code, "message", message)
+	recordErrorPacket(code)
 	return c.send(packet.String())
 }
 
@@ -98,30 +121,48 @@ func (c *Client) send(packet string) (err error) {
 	case c.sendChan <- packet:
 		return
 	case <-c.ctx.Done():
+		sendQueueDrops.Inc()
 		return c.ctx.Err()
 	}
 }
 
-func (s *Server) eventLoop(client *Client) {
+// eventLoop handles packets from the client until it disconnects, or until it is paused and handed over
+// to a new process. Returns whether the client was handed over.
+func (s *Server) eventLoop(client *Client) (handedOver bool) {
 	defer client.cancelCtx()
 
-	go client.senderWorker()
+	go client.senderWorker(&s.packets.out)
 
 	for {
-		if !client.scanner.Scan() {
+		// Reference the next packet
+		packet, err := client.transport.readPacket()
+		if err != nil {
+			// The restart that paused the client decides whether it continues in the new process
+			if errors.Is(err, errTransportPaused) {
+				select {
+				case handedOver = <-client.handover:
+				case <-client.ctx.Done():
+				}
+			}
 			return
 		}
-
-		// Reference the next packet
-		packet := client.scanner.Bytes()
 		packet = append(packet, '\r', '\n') // Re-append delimiter
+		s.packets.in.Inc()
+		client.capturePacket(CaptureDirectionClient, packet)
 
 		// Verify packet and obtain type
 		packetType, ok := verifyPacket(packet, client)
+		packetsReceived.WithLabelValues(packetType.String()).Inc()
 		if !ok {
 			continue
 		}
 
+		// Relayed clients are handled by the upstream server
+		if client.upstream != nil {
+			s.relayPacket(client, packetType, packet)
+			continue
+		}
+
 		// Run handler
 		handler := s.getHandler(packetType)
 		handler(client, packet)
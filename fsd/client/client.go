@@ -0,0 +1,428 @@
+// Package client implements the client side of the FSD protocol spoken by openfsd.
+//
+// It is intended for bots, load generators and integration tests:
+//
+//	c, err := client.Dial(ctx, "localhost:6809", client.Config{
+//		Callsign: "N123AB",
+//		CID:      100001,
+//		Password: "secret", // Or an FSD JWT
+//		RealName: "Test Pilot",
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//
+//	c.SendTextMessage("DAL1", "hello")
+//	for event := range c.Events() {
+//		if msg, ok := event.(*client.TextMessage); ok {
+//			fmt.Println(msg.From, msg.Message)
+//		}
+//	}
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/renorris/openfsd/fsd"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes the identity a Client logs in with.
+type Config struct {
+	Callsign      string
+	CID           int
+	Password      string // Plaintext password or FSD JWT
+	RealName      string
+	NetworkRating fsd.NetworkRating // Requested network rating. Defaults to Observer.
+	IsATC         bool              // Log in as ATC (#AA) rather than as a pilot (#AP)
+	ProtoRevision int               // Protocol revision, 100 or 101. Defaults to 101.
+	SimType       int               // Pilot simulator type. Defaults to 1.
+
+	ClientName         string // Client software name sent in the $ID packet. Defaults to "openfsd-client".
+	ClientVersionMajor int
+	ClientVersionMinor int
+
+	// ClientID is the vatsimauth client ID used for auth challenges, e.g. 35044 for vPilot.
+	// Zero disables auth challenges.
+	ClientID uint16
+}
+
+// Client is a logged-in FSD connection.
+type Client struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	cfg     Config
+
+	events chan Event
+	done   chan struct{}
+	err    error // Reason the connection ended. Valid once done is closed.
+
+	writeLock sync.Mutex
+
+	authEnabled   bool
+	authLock      sync.Mutex // Guards auth
+	auth          fsd.VatsimAuthState
+	verifyLock    sync.Mutex // Serializes VerifyServer calls
+	authResponses chan string
+}
+
+var (
+	ErrUnexpectedPacket     = errors.New("client: unexpected packet from server")
+	ErrAuthDisabled         = errors.New("client: auth challenges require a ClientID")
+	ErrAuthResponseMismatch = errors.New("client: server auth response mismatch")
+	ErrClosed               = errors.New("client: connection closed")
+)
+
+// ServerError is an $ER packet sent by the server.
+// Login failures are returned as a *ServerError.
+type ServerError struct {
+	basePacket
+	Code    int // One of the fsd error codes, e.g. fsd.InvalidLogonError
+	Param   string
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("fsd error %d: %s", e.Code, e.Message)
+}
+
+// eventBufferSize is the capacity of the event channel
+const eventBufferSize = 256
+
+// Dial connects to an FSD server and logs in.
+// The context bounds the connection and login; it does not affect the returned Client afterwards.
+func Dial(ctx context.Context, addr string, cfg Config) (client *Client, err error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return
+	}
+
+	if client, err = Login(ctx, conn, cfg); err != nil {
+		conn.Close()
+	}
+	return
+}
+
+// Login performs the $DI/$ID handshake and logs in over an established connection, such as one end of a net.Pipe.
+// The connection is owned by the returned Client. It is not closed if login fails.
+func Login(ctx context.Context, conn net.Conn, cfg Config) (client *Client, err error) {
+	cfg.setDefaults()
+
+	client = &Client{
+		conn:          conn,
+		scanner:       bufio.NewScanner(conn),
+		cfg:           cfg,
+		events:        make(chan Event, eventBufferSize),
+		done:          make(chan struct{}),
+		authResponses: make(chan string, 1),
+	}
+	client.scanner.Buffer(make([]byte, 4096), 4096)
+
+	// Abort the login once the context is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+
+	err = client.login()
+	if !stop() {
+		// The context ended during the login, and the connection deadline has been set
+		err = ctx.Err()
+	}
+	if err != nil {
+		client = nil
+		return
+	}
+
+	go client.readLoop()
+	return
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.NetworkRating == 0 {
+		cfg.NetworkRating = fsd.NetworkRatingObserver
+	}
+	if cfg.ProtoRevision == 0 {
+		cfg.ProtoRevision = 101
+	}
+	if cfg.SimType == 0 {
+		cfg.SimType = 1
+	}
+	if cfg.ClientName == "" {
+		cfg.ClientName = "openfsd-client"
+	}
+}
+
+// login performs the handshake and waits for the server to accept or reject the login.
+func (c *Client) login() (err error) {
+	// Server ident
+	if !c.scanner.Scan() {
+		return c.readErr()
+	}
+	if !strings.HasPrefix(c.scanner.Text(), "$DI") {
+		return ErrUnexpectedPacket
+	}
+
+	// Client ident
+	var challenge string
+	if c.cfg.ClientID != 0 {
+		if challenge, err = randomChallenge(8); err != nil {
+			return
+		}
+		if err = c.auth.Initialize(c.cfg.ClientID, []byte(challenge)); err != nil {
+			return
+		}
+		c.authEnabled = true
+	}
+	if err = c.write(buildClientIdentPacket(&c.cfg, challenge)); err != nil {
+		return
+	}
+
+	// Add packet
+	if err = c.write(buildAddPacket(&c.cfg)); err != nil {
+		return
+	}
+
+	// The server answers with either an error or its welcome message
+	if !c.scanner.Scan() {
+		return c.readErr()
+	}
+	event := parsePacket(c.scanner.Text())
+	if serverErr, ok := event.(*ServerError); ok {
+		return serverErr
+	}
+	c.events <- event
+	return
+}
+
+// readErr returns the reason the scanner stopped.
+func (c *Client) readErr() error {
+	if err := c.scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// readLoop reads packets until the connection is closed, answering auth challenges and publishing events.
+func (c *Client) readLoop() {
+	defer close(c.done)
+	defer close(c.events)
+	defer c.conn.Close()
+
+	for c.scanner.Scan() {
+		event := parsePacket(c.scanner.Text())
+
+		switch event := event.(type) {
+		case *AuthChallenge:
+			c.answerAuthChallenge(event)
+			continue
+		case *AuthResponse:
+			select {
+			case c.authResponses <- event.Response:
+			default:
+			}
+			continue
+		}
+
+		c.events <- event
+	}
+
+	c.err = c.readErr()
+}
+
+// Events returns the stream of packets received from the server.
+// The channel is closed when the connection ends. Callers must keep receiving from it:
+// the client stops reading from the connection while the channel is full.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Done returns a channel that is closed when the connection has ended.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection ended, or nil while it is still open.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Callsign returns the callsign the client is logged in with.
+func (c *Client) Callsign() string {
+	return c.cfg.Callsign
+}
+
+// Close sends a delete packet and closes the connection.
+// Events already received remain readable from the event channel.
+func (c *Client) Close() (err error) {
+	c.write(buildDeletePacket(&c.cfg))
+	err = c.conn.Close()
+	<-c.done
+	return
+}
+
+// write writes a single packet to the connection. A missing CRLF delimiter is appended.
+func (c *Client) write(packet string) (err error) {
+	if !strings.HasSuffix(packet, "\r\n") {
+		packet += "\r\n"
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if _, err = io.WriteString(c.conn, packet); err != nil {
+		select {
+		case <-c.done:
+			err = ErrClosed
+		default:
+		}
+	}
+	return
+}
+
+// answerAuthChallenge answers a $ZC challenge sent by the server.
+func (c *Client) answerAuthChallenge(challenge *AuthChallenge) {
+	if !c.authEnabled {
+		return
+	}
+
+	c.authLock.Lock()
+	resp := c.auth.GetResponseForChallenge([]byte(challenge.Challenge))
+	c.auth.UpdateState(&resp)
+	c.authLock.Unlock()
+
+	c.write("$ZR" + c.cfg.Callsign + ":" + challenge.From + ":" + string(resp[:]))
+}
+
+// VerifyServer sends a vatsimauth challenge to the server and checks its response.
+// Returns ErrAuthDisabled unless Config.ClientID was set.
+func (c *Client) VerifyServer(ctx context.Context) (err error) {
+	if !c.authEnabled {
+		return ErrAuthDisabled
+	}
+
+	c.verifyLock.Lock()
+	defer c.verifyLock.Unlock()
+
+	challenge, err := randomChallenge(8)
+	if err != nil {
+		return
+	}
+	if err = c.write("$ZC" + c.cfg.Callsign + ":SERVER:" + challenge); err != nil {
+		return
+	}
+
+	var response string
+	select {
+	case response = <-c.authResponses:
+	case <-c.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c.authLock.Lock()
+	expected := c.auth.GetResponseForChallenge([]byte(challenge))
+	c.auth.UpdateState(&expected)
+	c.authLock.Unlock()
+
+	if response != string(expected[:]) {
+		err = ErrAuthResponseMismatch
+	}
+	return
+}
+
+// randomChallenge returns a random hex challenge of n bytes
+func randomChallenge(n int) (challenge string, err error) {
+	buf := make([]byte, n)
+	if _, err = rand.Read(buf); err != nil {
+		return
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// buildClientIdentPacket builds the $ID packet. The vatsimauth fields are only included with a challenge.
+func buildClientIdentPacket(cfg *Config, challenge string) string {
+	packet := strings.Builder{}
+	packet.Grow(96)
+	packet.WriteString("$ID")
+	packet.WriteString(cfg.Callsign)
+	packet.WriteString(":SERVER:")
+	packet.WriteString(fmt.Sprintf("%04x", cfg.ClientID))
+	packet.WriteByte(':')
+	packet.WriteString(cfg.ClientName)
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(cfg.ClientVersionMajor))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(cfg.ClientVersionMinor))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(cfg.CID))
+	packet.WriteString(":0") // System UID
+	if challenge != "" {
+		packet.WriteByte(':')
+		packet.WriteString(challenge)
+	}
+	packet.WriteString("\r\n")
+	return packet.String()
+}
+
+// buildAddPacket builds the #AA or #AP login packet
+func buildAddPacket(cfg *Config) string {
+	packet := strings.Builder{}
+	packet.Grow(128)
+	if cfg.IsATC {
+		packet.WriteString("#AA")
+		packet.WriteString(cfg.Callsign)
+		packet.WriteString(":SERVER:")
+		packet.WriteString(cfg.RealName)
+		packet.WriteByte(':')
+		packet.WriteString(strconv.Itoa(cfg.CID))
+		packet.WriteByte(':')
+		packet.WriteString(cfg.Password)
+		packet.WriteByte(':')
+		packet.WriteString(strconv.Itoa(int(cfg.NetworkRating)))
+		packet.WriteByte(':')
+		packet.WriteString(strconv.Itoa(cfg.ProtoRevision))
+	} else {
+		packet.WriteString("#AP")
+		packet.WriteString(cfg.Callsign)
+		packet.WriteString(":SERVER:")
+		packet.WriteString(strconv.Itoa(cfg.CID))
+		packet.WriteByte(':')
+		packet.WriteString(cfg.Password)
+		packet.WriteByte(':')
+		packet.WriteString(strconv.Itoa(int(cfg.NetworkRating)))
+		packet.WriteByte(':')
+		packet.WriteString(strconv.Itoa(cfg.ProtoRevision))
+		packet.WriteByte(':')
+		packet.WriteString(strconv.Itoa(cfg.SimType))
+		packet.WriteByte(':')
+		packet.WriteString(cfg.RealName)
+	}
+	packet.WriteString("\r\n")
+	return packet.String()
+}
+
+// buildDeletePacket builds the #DA or #DP packet sent when logging off
+func buildDeletePacket(cfg *Config) string {
+	prefix := "#DP"
+	if cfg.IsATC {
+		prefix = "#DA"
+	}
+	return prefix + cfg.Callsign + ":" + strconv.Itoa(cfg.CID) + "\r\n"
+}
@@ -0,0 +1,248 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/renorris/openfsd/fsd"
+	"github.com/renorris/openfsd/fsd/fsdtest"
+	"math"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event of type T, skipping others.
+func nextEvent[T Event](t *testing.T, c *Client) (event T) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e, ok := <-c.Events():
+			if !ok {
+				t.Fatalf("connection closed while waiting for %T: %v", event, c.Err())
+			}
+			if event, ok = e.(T); ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %T", event)
+		}
+	}
+}
+
+func TestClientAgainstServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := fsdtest.NewServer(t)
+	addr := server.Addr
+	user := server.CreateUser(fsd.NetworkRatingController1, "password1")
+
+	// Wrong password
+	_, err := Dial(ctx, addr, Config{Callsign: "N1", CID: user.CID, Password: "wrong"})
+	serverErr := &ServerError{}
+	if !errors.As(err, &serverErr) || serverErr.Code != fsd.InvalidLogonError {
+		t.Fatalf("expected invalid logon error, got %v", err)
+	}
+
+	// Controller logging in with an FSD JWT and vatsimauth
+	atc, err := Dial(ctx, addr, Config{
+		Callsign:      "LAX_TWR",
+		CID:           100002,
+		Password:      server.Token(100002, fsd.NetworkRatingController1),
+		RealName:      "Test Controller",
+		NetworkRating: fsd.NetworkRatingController1,
+		IsATC:         true,
+		ClientID:      35044,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer atc.Close()
+
+	for range 2 {
+		if err = atc.VerifyServer(ctx); err != nil {
+			t.Fatalf("expected server to pass auth challenge, got %v", err)
+		}
+	}
+	if err = atc.SendATCPosition(ATCPosition{Frequency: "20950", Facility: 4, VisRange: 50, Latitude: 33.9425, Longitude: -118.4081}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pilot logging in with a password
+	pilot, err := Dial(ctx, addr, Config{Callsign: "N1", CID: user.CID, Password: "password1", RealName: "Test Pilot"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer pilot.Close()
+
+	if add := nextEvent[*AddClient](t, atc); add.Callsign != "N1" || add.CID != user.CID || add.IsATC {
+		t.Errorf("unexpected add packet: %+v", add)
+	}
+
+	if err = pilot.SendPilotPosition(PilotPosition{Transponder: "1200", Latitude: 33.94, Longitude: -118.40, Altitude: 1200, Groundspeed: 140, Heading: 250}); err != nil {
+		t.Fatal(err)
+	}
+	position := nextEvent[*PilotPosition](t, atc)
+	if position.Callsign != "N1" || position.Transponder != "1200" || position.Altitude != 1200 || position.Groundspeed != 140 || math.Abs(position.Heading-250) > 1 {
+		t.Errorf("unexpected position: %+v", position)
+	}
+
+	if err = pilot.SendTextMessage("LAX_TWR", "ready for departure: runway 25R"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := nextEvent[*TextMessage](t, atc); msg.From != "N1" || msg.To != "LAX_TWR" || msg.Message != "ready for departure: runway 25R" {
+		t.Errorf("unexpected text message: %+v", msg)
+	}
+
+	plan := FlightPlan{
+		Rules: "I", Aircraft: "C172/G", CruiseSpeed: "110", Departure: "KLAX", DepartureTime: "1800",
+		ActualDepartureTime: "1800", Altitude: "5000", Destination: "KSBA", HoursEnroute: "1", MinutesEnroute: "10",
+		HoursFuel: "4", MinutesFuel: "0", Alternate: "KSMX", Remarks: "/v/", Route: "VNY VTU",
+	}
+	if err = pilot.SendFlightPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	if fp := nextEvent[*FlightPlanReceived](t, atc); fp.Callsign != "N1" || fp.Amended || fp.Plan != plan {
+		t.Errorf("unexpected flight plan: %+v", fp)
+	}
+
+	if err = atc.SendClientQuery("N1", "RN"); err != nil {
+		t.Fatal(err)
+	}
+	if query := nextEvent[*ClientQuery](t, pilot); query.From != "LAX_TWR" || query.Type != "RN" {
+		t.Errorf("unexpected client query: %+v", query)
+	}
+
+	// Closing the pilot notifies the controller
+	pilot.Close()
+	if del := nextEvent[*DeleteClient](t, atc); del.Callsign != "N1" || del.IsATC {
+		t.Errorf("unexpected delete packet: %+v", del)
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	tests := []struct {
+		packet   string
+		expected Event
+	}{
+		{
+			"#TMN1:@22800:hello: world\r",
+			&TextMessage{From: "N1", To: "@22800", Message: "hello: world"},
+		},
+		{
+			"%LAX_TWR:20950:4:50:5:33.94250:-118.40810:0",
+			&ATCPosition{Callsign: "LAX_TWR", Frequency: "20950", Facility: 4, VisRange: 50, NetworkRating: 5, Latitude: 33.9425, Longitude: -118.4081},
+		},
+		{
+			"#AALAX_TWR:SERVER:Test Controller:100002::5:101",
+			&AddClient{Callsign: "LAX_TWR", IsATC: true, CID: 100002, RealName: "Test Controller", NetworkRating: 5},
+		},
+		{
+			"#DPN1:SERVER:100001",
+			&DeleteClient{Callsign: "N1"},
+		},
+		{
+			"$CRN1:LAX_TWR:RN:Test Pilot::1",
+			&ClientQueryResponse{From: "N1", To: "LAX_TWR", Type: "RN", Payload: []string{"Test Pilot", "", "1"}},
+		},
+		{
+			"$ARSERVER:N1:METAR:KLAX 151953Z 25012KT 10SM FEW020 21/14 A2992",
+			&WeatherReport{Type: "METAR", Report: "KLAX 151953Z 25012KT 10SM FEW020 21/14 A2992"},
+		},
+		{
+			"$ERserver:unknown:6::Invalid CID/password",
+			&ServerError{Code: fsd.InvalidLogonError, Message: "Invalid CID/password"},
+		},
+		{
+			"^DAL1151:40.6354992:-73.7795597:16.81:8.10:12582828:0.0015:0.0001:0.0005:0.0001:0.0000:-0.0029:-0.40",
+			&FastPilotPosition{
+				Callsign: "DAL1151", Latitude: 40.6354992, Longitude: -73.7795597, Altitude: 16.81, AltitudeAGL: 8.10,
+				VelocityX: 0.0015, VelocityY: 0.0001, VelocityZ: 0.0005, RotationX: 0.0001, RotationZ: -0.0029, NoseGearAngle: -0.40,
+			},
+		},
+		{
+			"$SFSERVER:N1:1",
+			&SendFast{Enabled: true},
+		},
+		{
+			"$FPN1:*A:I:C172:110:KLAX",
+			&UnknownPacket{},
+		},
+		{
+			"$XXN1:SERVER",
+			&UnknownPacket{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.packet, func(t *testing.T) {
+			got := parsePacket(tc.packet)
+			if got.RawPacket() != tc.packet[:len(tc.packet)-countTrailingCR(tc.packet)] {
+				t.Errorf("unexpected raw packet %q", got.RawPacket())
+			}
+			if !eventsEqual(got, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func countTrailingCR(packet string) int {
+	if len(packet) > 0 && packet[len(packet)-1] == '\r' {
+		return 1
+	}
+	return 0
+}
+
+// eventsEqual compares two events, ignoring their raw packets.
+func eventsEqual(a Event, b Event) bool {
+	switch a := a.(type) {
+	case *TextMessage:
+		b, ok := b.(*TextMessage)
+		return ok && a.From == b.From && a.To == b.To && a.Message == b.Message
+	case *FastPilotPosition:
+		// Pitch, bank and heading are compared by TestPackPitchBankHeading
+		b, ok := b.(*FastPilotPosition)
+		a.basePacket = basePacket{}
+		a.Pitch, a.Bank, a.Heading = 0, 0, 0
+		return ok && *a == *b
+	case *SendFast:
+		b, ok := b.(*SendFast)
+		return ok && a.Enabled == b.Enabled
+	case *ATCPosition:
+		b, ok := b.(*ATCPosition)
+		a.basePacket = basePacket{}
+		return ok && *a == *b
+	case *AddClient:
+		b, ok := b.(*AddClient)
+		a.basePacket = basePacket{}
+		return ok && *a == *b
+	case *DeleteClient:
+		b, ok := b.(*DeleteClient)
+		a.basePacket = basePacket{}
+		return ok && *a == *b
+	case *ClientQueryResponse:
+		b, ok := b.(*ClientQueryResponse)
+		if !ok || a.From != b.From || a.To != b.To || a.Type != b.Type || len(a.Payload) != len(b.Payload) {
+			return false
+		}
+		for i := range a.Payload {
+			if a.Payload[i] != b.Payload[i] {
+				return false
+			}
+		}
+		return true
+	case *WeatherReport:
+		b, ok := b.(*WeatherReport)
+		a.basePacket = basePacket{}
+		return ok && *a == *b
+	case *ServerError:
+		b, ok := b.(*ServerError)
+		return ok && a.Code == b.Code && a.Param == b.Param && a.Message == b.Message
+	case *UnknownPacket:
+		_, ok := b.(*UnknownPacket)
+		return ok
+	default:
+		return false
+	}
+}
@@ -0,0 +1,331 @@
+package client
+
+import (
+	"github.com/renorris/openfsd/fsd"
+	"strconv"
+	"strings"
+)
+
+// Event is a packet received from the server.
+//
+// The concrete type is one of *TextMessage, *PilotPosition, *FastPilotPosition, *ATCPosition, *AddClient,
+// *DeleteClient, *ClientQuery, *ClientQueryResponse, *FlightPlanReceived, *WeatherReport, *SendFast,
+// *ServerError or *UnknownPacket.
+type Event interface {
+	// RawPacket returns the packet as received, without its trailing CRLF.
+	RawPacket() string
+}
+
+type basePacket struct {
+	raw string
+}
+
+func (p basePacket) RawPacket() string {
+	return p.raw
+}
+
+// TextMessage is a #TM packet. To is a callsign, a frequency such as "@22800", or a broadcast recipient such as "*".
+type TextMessage struct {
+	basePacket
+	From    string
+	To      string
+	Message string
+}
+
+// PilotPosition is an @ position update from a pilot.
+type PilotPosition struct {
+	basePacket
+	Mode          string // Transponder mode: S (standby), N (normal) or Y (ident). Defaults to N when sending.
+	Callsign      string
+	Transponder   string // Squawk code, e.g. 1200
+	NetworkRating int
+	Latitude      float64
+	Longitude     float64
+	Altitude      int // True altitude in feet
+	Groundspeed   int // Knots
+	Pitch         float64
+	Bank          float64
+	Heading       float64
+	PressureDelta int // Pressure altitude minus true altitude in feet
+}
+
+// FastPilotPosition is a ^ fast position update from a pilot, sent several times per second while
+// the server has enabled fast updates with a SendFast packet.
+type FastPilotPosition struct {
+	basePacket
+	Callsign      string
+	Latitude      float64
+	Longitude     float64
+	Altitude      float64 // True altitude in feet
+	AltitudeAGL   float64 // Feet above ground level
+	Pitch         float64
+	Bank          float64
+	Heading       float64
+	VelocityX     float64 // Positional velocity vector
+	VelocityY     float64
+	VelocityZ     float64
+	RotationX     float64 // Rotational velocity vector
+	RotationY     float64
+	RotationZ     float64
+	NoseGearAngle float64 // Degrees
+}
+
+// ATCPosition is a % position update from a controller.
+type ATCPosition struct {
+	basePacket
+	Callsign      string
+	Frequency     string // Frequency without the leading 1, e.g. 22800 for 122.800
+	Facility      int
+	VisRange      int // Visibility range in nautical miles
+	NetworkRating int
+	Latitude      float64
+	Longitude     float64
+}
+
+// AddClient is an #AA or #AP packet announcing a new connection.
+type AddClient struct {
+	basePacket
+	Callsign      string
+	IsATC         bool
+	CID           int
+	RealName      string
+	NetworkRating int
+}
+
+// DeleteClient is a #DA or #DP packet announcing a disconnection.
+type DeleteClient struct {
+	basePacket
+	Callsign string
+	IsATC    bool
+}
+
+// ClientQuery is a $CQ packet, e.g. a request for capabilities (CAPS) or real name (RN).
+type ClientQuery struct {
+	basePacket
+	From    string
+	To      string
+	Type    string
+	Payload []string
+}
+
+// ClientQueryResponse is a $CR packet answering a ClientQuery.
+type ClientQueryResponse struct {
+	basePacket
+	From    string
+	To      string
+	Type    string
+	Payload []string
+}
+
+// FlightPlanReceived is an $FP or $AM packet.
+type FlightPlanReceived struct {
+	basePacket
+	From     string
+	Callsign string // Callsign of the aircraft the flight plan belongs to
+	Amended  bool   // True for $AM amendments
+	Plan     FlightPlan
+}
+
+// WeatherReport is an $AR METAR or TAF response.
+type WeatherReport struct {
+	basePacket
+	Type   string // METAR or TAF
+	Report string
+}
+
+// SendFast is a $SF packet enabling or disabling fast position updates for the client.
+type SendFast struct {
+	basePacket
+	Enabled bool
+}
+
+// AuthChallenge is a $ZC vatsimauth challenge. It is answered by the Client and not published as an event.
+type AuthChallenge struct {
+	basePacket
+	From      string
+	Challenge string
+}
+
+// AuthResponse is a $ZR vatsimauth response. It is consumed by VerifyServer and not published as an event.
+type AuthResponse struct {
+	basePacket
+	From     string
+	Response string
+}
+
+// UnknownPacket is any packet without a typed representation.
+type UnknownPacket struct {
+	basePacket
+}
+
+// parsePacket converts a packet received from the server into an Event.
+// Malformed packets are returned as *UnknownPacket.
+func parsePacket(packet string) Event {
+	packet = strings.TrimSuffix(packet, "\r")
+	base := basePacket{raw: packet}
+	unknown := &UnknownPacket{base}
+
+	if len(packet) < 3 {
+		return unknown
+	}
+
+	switch packet[0] {
+	case '@':
+		fields := strings.Split(packet[1:], ":")
+		if len(fields) < 9 {
+			return unknown
+		}
+		p := &PilotPosition{
+			basePacket:  base,
+			Mode:        fields[0],
+			Callsign:    fields[1],
+			Transponder: fields[2],
+		}
+		p.NetworkRating, _ = strconv.Atoi(fields[3])
+		p.Latitude, _ = strconv.ParseFloat(fields[4], 64)
+		p.Longitude, _ = strconv.ParseFloat(fields[5], 64)
+		p.Altitude, _ = strconv.Atoi(fields[6])
+		p.Groundspeed, _ = strconv.Atoi(fields[7])
+		pbh, _ := strconv.ParseUint(fields[8], 10, 32)
+		p.Pitch, p.Bank, p.Heading = fsd.PitchBankHeading(uint32(pbh))
+		if len(fields) > 9 {
+			p.PressureDelta, _ = strconv.Atoi(fields[9])
+		}
+		return p
+	case '^':
+		fields := strings.Split(packet[1:], ":")
+		if len(fields) < 13 {
+			return unknown
+		}
+		p := &FastPilotPosition{basePacket: base, Callsign: fields[0]}
+		values := []*float64{
+			&p.Latitude, &p.Longitude, &p.Altitude, &p.AltitudeAGL, nil,
+			&p.VelocityX, &p.VelocityY, &p.VelocityZ, &p.RotationX, &p.RotationY, &p.RotationZ, &p.NoseGearAngle,
+		}
+		for i, value := range values {
+			if value != nil {
+				*value, _ = strconv.ParseFloat(fields[i+1], 64)
+			}
+		}
+		pbh, _ := strconv.ParseUint(fields[5], 10, 32)
+		p.Pitch, p.Bank, p.Heading = fsd.PitchBankHeading(uint32(pbh))
+		return p
+	case '%':
+		fields := strings.Split(packet[1:], ":")
+		if len(fields) < 7 {
+			return unknown
+		}
+		p := &ATCPosition{
+			basePacket: base,
+			Callsign:   fields[0],
+			Frequency:  fields[1],
+		}
+		p.Facility, _ = strconv.Atoi(fields[2])
+		p.VisRange, _ = strconv.Atoi(fields[3])
+		p.NetworkRating, _ = strconv.Atoi(fields[4])
+		p.Latitude, _ = strconv.ParseFloat(fields[5], 64)
+		p.Longitude, _ = strconv.ParseFloat(fields[6], 64)
+		return p
+	}
+
+	prefix := packet[:3]
+	fields := strings.Split(packet[3:], ":")
+
+	switch prefix {
+	case "#TM":
+		parts := strings.SplitN(packet[3:], ":", 3)
+		if len(parts) < 3 {
+			return unknown
+		}
+		return &TextMessage{basePacket: base, From: parts[0], To: parts[1], Message: parts[2]}
+	case "#AA":
+		// #AA<callsign>:SERVER:<real name>:<cid>::<rating>:<protocol>
+		if len(fields) < 6 {
+			return unknown
+		}
+		p := &AddClient{basePacket: base, Callsign: fields[0], IsATC: true, RealName: fields[2]}
+		p.CID, _ = strconv.Atoi(fields[3])
+		p.NetworkRating, _ = strconv.Atoi(fields[5])
+		return p
+	case "#AP":
+		// #AP<callsign>:SERVER:<cid>::<rating>:<protocol>:<sim type>:<real name>
+		if len(fields) < 5 {
+			return unknown
+		}
+		p := &AddClient{basePacket: base, Callsign: fields[0]}
+		p.CID, _ = strconv.Atoi(fields[2])
+		p.NetworkRating, _ = strconv.Atoi(fields[4])
+		if len(fields) > 7 {
+			p.RealName = fields[7]
+		}
+		return p
+	case "#DA", "#DP":
+		return &DeleteClient{basePacket: base, Callsign: fields[0], IsATC: prefix == "#DA"}
+	case "$CQ", "$CR":
+		if len(fields) < 3 {
+			return unknown
+		}
+		if prefix == "$CQ" {
+			return &ClientQuery{basePacket: base, From: fields[0], To: fields[1], Type: fields[2], Payload: fields[3:]}
+		}
+		return &ClientQueryResponse{basePacket: base, From: fields[0], To: fields[1], Type: fields[2], Payload: fields[3:]}
+	case "$FP":
+		// $FP<callsign>:<recipient>:<flight plan>
+		parts := strings.SplitN(packet[3:], ":", 3)
+		if len(parts) < 3 {
+			return unknown
+		}
+		plan, err := ParseFlightPlan(parts[2])
+		if err != nil {
+			return unknown
+		}
+		return &FlightPlanReceived{basePacket: base, From: parts[0], Callsign: parts[0], Plan: plan}
+	case "$AM":
+		// $AM<source>:<recipient>:<callsign>:<flight plan>
+		parts := strings.SplitN(packet[3:], ":", 4)
+		if len(parts) < 4 {
+			return unknown
+		}
+		plan, err := ParseFlightPlan(parts[3])
+		if err != nil {
+			return unknown
+		}
+		return &FlightPlanReceived{basePacket: base, From: parts[0], Callsign: parts[2], Amended: true, Plan: plan}
+	case "$AR":
+		// $ARSERVER:<callsign>:<METAR or TAF>:<report>
+		parts := strings.SplitN(packet[3:], ":", 4)
+		if len(parts) < 4 {
+			return unknown
+		}
+		return &WeatherReport{basePacket: base, Type: parts[2], Report: parts[3]}
+	case "$ER":
+		// $ERserver:<recipient>:<code>:<param>:<message>
+		parts := strings.SplitN(packet[3:], ":", 5)
+		if len(parts) < 5 {
+			return unknown
+		}
+		code, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return unknown
+		}
+		return &ServerError{basePacket: base, Code: code, Param: parts[3], Message: parts[4]}
+	case "$SF":
+		// $SFSERVER:<callsign>:<0 or 1>
+		if len(fields) < 3 {
+			return unknown
+		}
+		return &SendFast{basePacket: base, Enabled: fields[2] == "1"}
+	case "$ZC":
+		if len(fields) < 3 {
+			return unknown
+		}
+		return &AuthChallenge{basePacket: base, From: fields[0], Challenge: fields[2]}
+	case "$ZR":
+		if len(fields) < 3 {
+			return unknown
+		}
+		return &AuthResponse{basePacket: base, From: fields[0], Response: fields[2]}
+	}
+
+	return unknown
+}
@@ -0,0 +1,204 @@
+package client
+
+import (
+	"errors"
+	"github.com/renorris/openfsd/fsd"
+	"strconv"
+	"strings"
+)
+
+// FlightPlan is the flight plan section of $FP and $AM packets.
+// Fields are kept as sent so that flight plans round-trip unchanged.
+type FlightPlan struct {
+	Rules               string // I (IFR), V (VFR), D (DVFR) or S (SVFR)
+	Aircraft            string // Aircraft type, e.g. B738/L
+	CruiseSpeed         string // True airspeed in knots
+	Departure           string
+	DepartureTime       string // Proposed departure time, HHMM
+	ActualDepartureTime string // HHMM
+	Altitude            string // Cruise altitude, e.g. 35000 or FL350
+	Destination         string
+	HoursEnroute        string
+	MinutesEnroute      string
+	HoursFuel           string
+	MinutesFuel         string
+	Alternate           string
+	Remarks             string
+	Route               string
+}
+
+var ErrInvalidFlightPlan = errors.New("client: invalid flight plan")
+
+// flightPlanFields is the number of fields in the flight plan section
+const flightPlanFields = 15
+
+// String formats the flight plan as the colon-separated section of $FP and $AM packets.
+func (p *FlightPlan) String() string {
+	return strings.Join([]string{
+		p.Rules, p.Aircraft, p.CruiseSpeed, p.Departure, p.DepartureTime, p.ActualDepartureTime,
+		p.Altitude, p.Destination, p.HoursEnroute, p.MinutesEnroute, p.HoursFuel, p.MinutesFuel,
+		p.Alternate, p.Remarks, p.Route,
+	}, ":")
+}
+
+// ParseFlightPlan parses the flight plan section of an $FP or $AM packet.
+// The route is the last field and may contain colons.
+func ParseFlightPlan(section string) (plan FlightPlan, err error) {
+	fields := strings.SplitN(strings.TrimSuffix(section, "\r\n"), ":", flightPlanFields)
+	if len(fields) != flightPlanFields {
+		err = ErrInvalidFlightPlan
+		return
+	}
+
+	plan = FlightPlan{
+		Rules:               fields[0],
+		Aircraft:            fields[1],
+		CruiseSpeed:         fields[2],
+		Departure:           fields[3],
+		DepartureTime:       fields[4],
+		ActualDepartureTime: fields[5],
+		Altitude:            fields[6],
+		Destination:         fields[7],
+		HoursEnroute:        fields[8],
+		MinutesEnroute:      fields[9],
+		HoursFuel:           fields[10],
+		MinutesFuel:         fields[11],
+		Alternate:           fields[12],
+		Remarks:             fields[13],
+		Route:               fields[14],
+	}
+	return
+}
+
+// Send sends a raw packet. The CRLF delimiter is appended if missing.
+func (c *Client) Send(packet string) (err error) {
+	return c.write(packet)
+}
+
+// SendPilotPosition sends an @ position update for the client's own aircraft.
+// The callsign and network rating fields are filled in from the Config.
+func (c *Client) SendPilotPosition(p PilotPosition) (err error) {
+	mode := p.Mode
+	if mode == "" {
+		mode = "N"
+	}
+
+	packet := strings.Builder{}
+	packet.Grow(96)
+	packet.WriteByte('@')
+	packet.WriteString(mode)
+	packet.WriteByte(':')
+	packet.WriteString(c.cfg.Callsign)
+	packet.WriteByte(':')
+	packet.WriteString(p.Transponder)
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(int(c.cfg.NetworkRating)))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.FormatFloat(p.Latitude, 'f', 6, 64))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.FormatFloat(p.Longitude, 'f', 6, 64))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(p.Altitude))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(p.Groundspeed))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.FormatUint(uint64(fsd.PackPitchBankHeading(p.Pitch, p.Bank, p.Heading)), 10))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(p.PressureDelta))
+	packet.WriteString("\r\n")
+
+	return c.write(packet.String())
+}
+
+// SendFastPilotPosition sends a ^ fast position update for the client's own aircraft.
+// Clients should only send fast updates while the server has enabled them with a *SendFast event.
+func (c *Client) SendFastPilotPosition(p FastPilotPosition) (err error) {
+	packet := strings.Builder{}
+	packet.Grow(128)
+	packet.WriteByte('^')
+	packet.WriteString(c.cfg.Callsign)
+	for _, value := range []float64{p.Latitude, p.Longitude, p.Altitude, p.AltitudeAGL} {
+		packet.WriteByte(':')
+		packet.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	packet.WriteByte(':')
+	packet.WriteString(strconv.FormatUint(uint64(fsd.PackPitchBankHeading(p.Pitch, p.Bank, p.Heading)), 10))
+	for _, value := range []float64{p.VelocityX, p.VelocityY, p.VelocityZ, p.RotationX, p.RotationY, p.RotationZ, p.NoseGearAngle} {
+		packet.WriteByte(':')
+		packet.WriteString(strconv.FormatFloat(value, 'f', 4, 64))
+	}
+	packet.WriteString("\r\n")
+	return c.write(packet.String())
+}
+
+// SendATCPosition sends a % position update for the client's own controller position.
+// The callsign and network rating fields are filled in from the Config.
+func (c *Client) SendATCPosition(p ATCPosition) (err error) {
+	packet := strings.Builder{}
+	packet.Grow(64)
+	packet.WriteByte('%')
+	packet.WriteString(c.cfg.Callsign)
+	packet.WriteByte(':')
+	packet.WriteString(p.Frequency)
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(p.Facility))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(p.VisRange))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(int(c.cfg.NetworkRating)))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.FormatFloat(p.Latitude, 'f', 6, 64))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.FormatFloat(p.Longitude, 'f', 6, 64))
+	packet.WriteString(":0\r\n") // Altitude
+	return c.write(packet.String())
+}
+
+// SendTextMessage sends a #TM text message.
+// The recipient is a callsign, a frequency such as "@22800", "*" for a server-wide broadcast (SUP only),
+// "*S" for a wallop or "@49999" for ATC chat.
+func (c *Client) SendTextMessage(recipient string, message string) (err error) {
+	return c.write(buildPacket("#TM", c.cfg.Callsign, recipient, message))
+}
+
+// SendFlightPlan files a flight plan for the client's own aircraft.
+func (c *Client) SendFlightPlan(plan FlightPlan) (err error) {
+	return c.write(fsd.BuildFileFlightplanPacket(c.cfg.Callsign, "SERVER", plan.String()))
+}
+
+// AmendFlightPlan amends the flight plan of another aircraft. Only controllers may amend flight plans.
+func (c *Client) AmendFlightPlan(callsign string, plan FlightPlan) (err error) {
+	return c.write(fsd.BuildAmendFlightplanPacket(c.cfg.Callsign, "SERVER", callsign, plan.String()))
+}
+
+// SendClientQuery sends a $CQ client query, e.g. queryType "RN" to request a real name,
+// "CAPS" for capabilities or "FP" (recipient "SERVER") to request a flight plan.
+func (c *Client) SendClientQuery(recipient string, queryType string, payload ...string) (err error) {
+	return c.write(buildPacket("$CQ", c.cfg.Callsign, recipient, append([]string{queryType}, payload...)...))
+}
+
+// SendClientQueryResponse answers a client query with a $CR packet.
+func (c *Client) SendClientQueryResponse(recipient string, queryType string, payload ...string) (err error) {
+	return c.write(buildPacket("$CR", c.cfg.Callsign, recipient, append([]string{queryType}, payload...)...))
+}
+
+// RequestMetar requests the METAR of a station. The server answers with a *WeatherReport event.
+func (c *Client) RequestMetar(icaoCode string) (err error) {
+	return c.write(buildPacket("$AX", c.cfg.Callsign, "SERVER", "METAR", icaoCode))
+}
+
+// buildPacket builds a packet of colon-separated fields: <prefix><source>:<recipient>:<fields...>
+func buildPacket(prefix string, source string, recipient string, fields ...string) string {
+	packet := strings.Builder{}
+	packet.Grow(64)
+	packet.WriteString(prefix)
+	packet.WriteString(source)
+	packet.WriteByte(':')
+	packet.WriteString(recipient)
+	for _, field := range fields {
+		packet.WriteByte(':')
+		packet.WriteString(field)
+	}
+	packet.WriteString("\r\n")
+	return packet.String()
+}
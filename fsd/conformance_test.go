@@ -0,0 +1,228 @@
+// The conformance suite is an external test package because fsdtest imports fsd.
+package fsd_test
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/renorris/openfsd/fsd"
+	"github.com/renorris/openfsd/fsd/fsdtest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Conformance transcripts are stored in testdata/conformance. Each file holds sessions, each starting with a
+// "=== <name>" line, that run against a fresh server. Blank lines and lines starting with # are ignored.
+//
+// Session directives:
+//
+//	metar <ICAO> <observation>                      Serve a METAR observation. Must precede the first login.
+//	login <client> pilot|atc <callsign> <cid> <rating>
+//	                                                Connect a client named <client> and log in with an FSD JWT.
+//	                                                The welcome message is consumed.
+//	<client>> <packet>                              The client sends a packet.
+//	<clients>< <packet>                             The next packet received by each client must equal <packet>.
+//	<clients>~ <regexp>                             The next packet received by each client must match <regexp>.
+//	<clients>!                                      The clients must not receive any packet.
+//	closed <client>                                 The server must close the client's connection.
+//	disconnect <client>                             The client closes its connection.
+//
+// <clients> is a comma-separated list of client names. At the end of a session, every client must have
+// received exactly the expected packets.
+
+// conformanceQuietPeriod is how long a client must stay silent to be considered to receive nothing
+const conformanceQuietPeriod = 50 * time.Millisecond
+
+type transcriptStep struct {
+	line    int
+	clients []string
+	op      string // login, metar, closed, disconnect, or one of > < ~ !
+	args    []string
+	text    string // Packet or regular expression
+}
+
+type transcriptSession struct {
+	name  string
+	line  int
+	steps []transcriptStep
+}
+
+var transcriptPacketStep = regexp.MustCompile(`^([A-Za-z0-9]+(?:,[A-Za-z0-9]+)*)([<>~!])(?: (.*))?$`)
+
+func parseTranscript(path string) (sessions []*transcriptSession, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var session *transcriptSession
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(line, "=== "); ok {
+			session = &transcriptSession{name: name, line: lineNum}
+			sessions = append(sessions, session)
+			continue
+		}
+		if session == nil {
+			return nil, fmt.Errorf("%s:%d: directive outside of a session", path, lineNum)
+		}
+
+		step := transcriptStep{line: lineNum}
+		if match := transcriptPacketStep.FindStringSubmatch(line); match != nil {
+			step.clients = strings.Split(match[1], ",")
+			step.op = match[2]
+			step.text = match[3]
+			if (step.op == ">" && len(step.clients) != 1) || (step.op != "!" && step.text == "") {
+				return nil, fmt.Errorf("%s:%d: invalid step", path, lineNum)
+			}
+		} else {
+			fields := strings.Fields(line)
+			step.op, step.args = fields[0], fields[1:]
+			switch {
+			case step.op == "login" && len(step.args) == 5 && (step.args[1] == "pilot" || step.args[1] == "atc"):
+			case step.op == "metar" && len(step.args) >= 2:
+				step.text = strings.Join(step.args[1:], " ")
+			case (step.op == "closed" || step.op == "disconnect") && len(step.args) == 1:
+			default:
+				return nil, fmt.Errorf("%s:%d: invalid directive %q", path, lineNum, line)
+			}
+		}
+		session.steps = append(session.steps, step)
+	}
+	err = scanner.Err()
+	return
+}
+
+// transcriptT prefixes test failures with the transcript line being run
+type transcriptT struct {
+	testing.TB
+	location string
+}
+
+func (t *transcriptT) Errorf(format string, args ...any) {
+	t.TB.Helper()
+	t.TB.Errorf("%s: "+format, append([]any{t.location}, args...)...)
+}
+
+func (t *transcriptT) Fatalf(format string, args ...any) {
+	t.TB.Helper()
+	t.TB.Fatalf("%s: "+format, append([]any{t.location}, args...)...)
+}
+
+func runTranscriptSession(t *testing.T, path string, session *transcriptSession) {
+	tt := &transcriptT{TB: t, location: fmt.Sprintf("%s:%d", path, session.line)}
+
+	metars := map[string]string{}
+	for _, step := range session.steps {
+		if step.op == "metar" {
+			metars[step.args[0]] = step.text
+		}
+	}
+	server := fsdtest.NewServer(tt, func(cfg *fsd.ServerConfig) {
+		cfg.MetarStaticObservations = metars
+	})
+
+	clients := map[string]*fsdtest.Conn{}
+	client := func(name string) *fsdtest.Conn {
+		c, ok := clients[name]
+		if !ok {
+			tt.Fatalf("unknown client %s", name)
+		}
+		return c
+	}
+
+	for _, step := range session.steps {
+		tt.location = fmt.Sprintf("%s:%d", path, step.line)
+
+		switch step.op {
+		case "metar":
+		case "login":
+			name, kind, callsign := step.args[0], step.args[1], step.args[2]
+			cid, err := strconv.Atoi(step.args[3])
+			if err != nil {
+				tt.Fatalf("invalid CID %q", step.args[3])
+			}
+			rating, err := strconv.Atoi(step.args[4])
+			if err != nil {
+				tt.Fatalf("invalid rating %q", step.args[4])
+			}
+			c := server.Pipe()
+			c.Login(fsdtest.Login{
+				Callsign:      callsign,
+				CID:           cid,
+				Password:      server.Token(cid, fsd.NetworkRating(rating)),
+				NetworkRating: fsd.NetworkRating(rating),
+				ATC:           kind == "atc",
+			})
+			clients[name] = c
+		case "closed":
+			client(step.args[0]).ExpectClosed()
+		case "disconnect":
+			client(step.args[0]).Close()
+		case ">":
+			client(step.clients[0]).Send(step.text)
+		case "<":
+			for _, name := range step.clients {
+				if packet := client(name).Next(); packet != step.text {
+					tt.Errorf("%s: expected %q, got %q", name, step.text, packet)
+				}
+			}
+		case "~":
+			re, err := regexp.Compile("^(?:" + step.text + ")$")
+			if err != nil {
+				tt.Fatalf("invalid regular expression: %v", err)
+			}
+			for _, name := range step.clients {
+				if packet := client(name).Next(); !re.MatchString(packet) {
+					tt.Errorf("%s: expected packet matching %q, got %q", name, step.text, packet)
+				}
+			}
+		case "!":
+			for _, name := range step.clients {
+				client(name).ExpectNothing(conformanceQuietPeriod)
+			}
+		}
+	}
+
+	// Every client must have received exactly the expected packets
+	tt.location = fmt.Sprintf("%s: end of session %q", path, session.name)
+	for _, c := range clients {
+		c.ExpectNothing(conformanceQuietPeriod)
+	}
+}
+
+// TestConformance runs the session transcripts in testdata/conformance against a real server.
+func TestConformance(t *testing.T) {
+	paths, err := filepath.Glob("testdata/conformance/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no transcripts found")
+	}
+
+	for _, path := range paths {
+		sessions, err := parseTranscript(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".txt"), func(t *testing.T) {
+			for _, session := range sessions {
+				t.Run(session.name, func(t *testing.T) {
+					t.Parallel()
+					runTranscriptSession(t, path, session)
+				})
+			}
+		})
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"github.com/renorris/openfsd/db"
 	"io"
+	"log/slog"
 	"net"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"time"
@@ -19,71 +21,146 @@ import (
 //
 // This function must only be used during the login phase,
 // as it synchronously writes the error directly to the
-// connection socket.
-func sendError(conn io.Writer, code int, message string) (err error) {
+// connection socket. Every error sent is logged and counted as a login failure.
+func sendError(logger *slog.Logger, conn io.Writer, code int, message string) (err error) {
+	logger.Info("login rejected", "code", code, "reason", loginFailureReason(code), "message", message)
+	recordErrorPacket(code)
+	recordLoginFailure(code)
+
 	packet := fmt.Sprintf("$ERserver:unknown:%d::%s\r\n", code, message)
 	_, err = conn.Write([]byte(packet))
 	return
 }
 
-// handleConn manages a single Client connection.
+// handleConn manages a single Client connection accepted on listenAddr.
 // If any errors occur during the process, it sends an error to the Client and closes the connection.
-func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
+func (s *Server) handleConn(ctx context.Context, conn net.Conn, listenAddr string) {
+	connID := s.nextConnID.Inc()
+	logger := s.connLogger(connID, remoteIP(conn))
+
 	defer func() {
 		if err := recover(); err != nil {
-			fmt.Println("An FSD connection goroutine panicked:")
-			fmt.Println(err)
+			logger.Error("connection goroutine panicked", "panic", err, "stack", string(debug.Stack()))
 		}
 	}()
 
 	defer conn.Close()
 
 	if err := sendServerIdent(conn); err != nil {
-		fmt.Printf("Error sending server ident: %v\n", err)
+		logger.Warn("error sending server ident", "error", err)
 		return
 	}
 
-	scanner := bufio.NewScanner(conn)
-	buf := make([]byte, 4096)
-	scanner.Buffer(buf, len(buf))
-
-	data, token, err := readLoginPackets(conn, scanner)
+	transport := newConnTransport(conn, nil)
+	data, token, err := readLoginPackets(logger, conn, transport.scanner)
 	if err != nil {
 		return
 	}
+	logger = withLoginData(logger, &data)
 
 	// Check if the requested callsign is OK
 	if !isValidClientCallsign([]byte(data.callsign)) {
-		sendError(conn, CallsignInvalidError, "Callsign invalid")
+		sendError(logger, conn, CallsignInvalidError, "Callsign invalid")
 		return
 	}
 
-	client := newClient(ctx, conn, scanner, data)
+	client := newClient(ctx, transport, data, logger)
+	client.connID = connID
+	client.listenAddr = listenAddr
+	if !client.isAtc {
+		client.history = newPositionHistory(s.cfg.PositionHistorySize)
+	}
+
+	if s.capture.matches(listenAddr, client.callsign) {
+		client.capture = s.capture
+		client.capturePacket(CaptureDirectionLogin, data.identPacket)
+		client.capturePacket(CaptureDirectionLogin, data.addPacket)
+		defer client.capturePacket(CaptureDirectionEnd, nil)
+	}
 
 	// Attempt to authenticate connection
 	if err = s.attemptAuthentication(client, token); err != nil {
 		return
 	}
 
+	// Namespaces may be restricted to users of a minimum rating
+	if client.maxNetworkRating < s.ns.MinRating {
+		sendError(logger, conn, InvalidLogonError, "Network rating too low for this server")
+		return
+	}
+
 	// Attempt to register to post office
 	if err = s.postOffice.register(client); err != nil {
-		if errors.Is(err, ErrCallsignInUse) {
-			sendError(conn, CallsignInUseError, "Callsign already in use")
+		switch {
+		case errors.Is(err, ErrCallsignInUse):
+			sendError(logger, conn, CallsignInUseError, "Callsign already in use")
+		case errors.Is(err, ErrServerFull):
+			sendError(logger, conn, ServerFullError, "Server full")
 		}
 		return
 	}
-	defer s.postOffice.release(client)
 
-	// Send hello message to client
-	if err = s.sendMotd(client); err != nil {
+	// In relay mode, the session is tunnelled to the upstream server
+	if s.relay != nil {
+		if client.upstream, err = s.relay.connect(ctx, client); err != nil {
+			s.postOffice.release(client)
+			logger.Warn("unable to connect to upstream server", "error", err)
+			sendError(logger, conn, ServerFullError, "Upstream server unavailable")
+			return
+		}
+	}
+
+	s.serveClient(client)
+}
+
+// serveClient serves a Client registered to the post office until it disconnects, then releases it.
+// Clients handed over to a new process stay connected to it, so they are not released.
+func (s *Server) serveClient(client *Client) {
+	// Share the client with linked servers, and withdraw it once released
+	s.federation.clientConnected(client)
+
+	client.logger.Info("client connected", "atc", client.isAtc, "network_rating", int(client.networkRating), "client_software", client.clientSoftware, "resumed", client.resumed)
+
+	// Virtual clients are not users, so their sessions are not recorded.
+	// Resumed clients continue the session recorded by the previous process.
+	if !client.virtual && client.sessionID == 0 {
+		client.sessionID, _ = s.startSession(client)
+	}
+
+	handedOver := false
+	defer close(client.served)
+	defer func() {
+		if handedOver {
+			client.logger.Info("client handed over to new process")
+			return
+		}
+		if client.sessionID != 0 {
+			s.endSession(client, client.sessionID)
+		}
+		client.logger.Info("client disconnected")
+		s.postOffice.release(client)
+		s.tracks.release(client)
+		s.federation.clientDisconnected(client)
+	}()
+
+	// Relayed clients are greeted and announced by the upstream server
+	if client.upstream != nil {
+		go s.relayUpstream(client)
+		s.eventLoop(client)
 		return
 	}
 
-	// Broadcast add packet to entire server
-	s.broadcastAddPacket(client)
-	defer s.broadcastDisconnectPacket(client)
+	// Resumed clients were greeted and announced by the previous process
+	if !client.resumed {
+		if err := s.sendMotd(client); err != nil {
+			return
+		}
+		s.broadcastAddPacket(client)
+	}
 
-	s.eventLoop(client)
+	if handedOver = s.eventLoop(client); !handedOver {
+		s.broadcastDisconnectPacket(client)
+	}
 }
 
 // sendServerIdent sends the initial server identification packet to the Client.
@@ -105,7 +182,10 @@ type loginData struct {
 	protoRevision    int           // Protocol revision
 	loginTime        time.Time     // Time of login
 	clientId         uint16        // Client ID
+	clientSoftware   string        // Client name and version
 	isAtc            bool          // True if the Client is an ATC, false if a pilot
+	identPacket      []byte        // Raw client ident packet, retained for packet capture
+	addPacket        []byte        // Add packet with its password/token removed, retained for packet capture and relaying
 }
 
 // ErrInvalidAddPacket is returned when the add packet from the Client is invalid.
@@ -118,11 +198,11 @@ var ErrInvalidIDPacket = errors.New("invalid ID packet")
 // the Client identification packet and the add packet.
 // It parses these packets to extract the Client's data and returns it in a loginData struct.
 // If any errors occur during reading or parsing, it sends an error to the Client and returns an error.
-func readLoginPackets(conn net.Conn, scanner *bufio.Scanner) (data loginData, token string, err error) {
+func readLoginPackets(logger *slog.Logger, conn net.Conn, scanner *bufio.Scanner) (data loginData, token string, err error) {
 	// Client ident
 	if !scanner.Scan() {
 		err = ErrInvalidIDPacket
-		sendError(conn, SyntaxError, "Error reading Client ident packet")
+		sendError(logger, conn, SyntaxError, "Error reading Client ident packet")
 		return
 	}
 	idPacket := append([]byte{}, scanner.Bytes()...)
@@ -130,11 +210,19 @@ func readLoginPackets(conn net.Conn, scanner *bufio.Scanner) (data loginData, to
 	// Add packet
 	if !scanner.Scan() {
 		err = ErrInvalidAddPacket
-		sendError(conn, SyntaxError, "Error reading add packet")
+		sendError(logger, conn, SyntaxError, "Error reading add packet")
 		return
 	}
 	addPacket := append([]byte{}, scanner.Bytes()...)
 
+	data.identPacket = idPacket
+	data.addPacket = setAddPacketToken(addPacket, "") // The password/token is only kept for the duration of the login
+
+	// Extract the client name and version
+	if countFields(idPacket) >= 6 {
+		data.clientSoftware = string(getField(idPacket, 3)) + " " + string(getField(idPacket, 4)) + "." + string(getField(idPacket, 5))
+	}
+
 	// Check if the Client sent a challenge field
 	if countFields(idPacket) == 9 {
 		// Extract the challenge
@@ -145,7 +233,7 @@ func readLoginPackets(conn net.Conn, scanner *bufio.Scanner) (data loginData, to
 		clientId, err = strconv.ParseUint(string(getField(idPacket, 2)), 16, 16)
 		if err != nil {
 			err = ErrInvalidIDPacket
-			sendError(conn, SyntaxError, "Error parsing client ID")
+			sendError(logger, conn, SyntaxError, "Error parsing client ID")
 			return
 		}
 		data.clientId = uint16(clientId)
@@ -153,7 +241,7 @@ func readLoginPackets(conn net.Conn, scanner *bufio.Scanner) (data loginData, to
 
 	if len(addPacket) < 16 {
 		err = ErrInvalidAddPacket
-		sendError(conn, SyntaxError, "Invalid add packet")
+		sendError(logger, conn, SyntaxError, "Invalid add packet")
 		return
 	}
 
@@ -167,20 +255,20 @@ func readLoginPackets(conn net.Conn, scanner *bufio.Scanner) (data loginData, to
 		prefix = "#AP"
 	default:
 		err = ErrInvalidAddPacket
-		sendError(conn, SyntaxError, "Invalid add packet prefix")
+		sendError(logger, conn, SyntaxError, "Invalid add packet prefix")
 		return
 	}
 
 	if data.isAtc {
 		if countFields(addPacket) != 7 {
 			err = ErrInvalidAddPacket
-			sendError(conn, SyntaxError, "Invalid number of fields in ATC add packet")
+			sendError(logger, conn, SyntaxError, "Invalid number of fields in ATC add packet")
 			return
 		}
 	} else {
 		if countFields(addPacket) != 8 {
 			err = ErrInvalidAddPacket
-			sendError(conn, SyntaxError, "Invalid number of fields in pilot add packet")
+			sendError(logger, conn, SyntaxError, "Invalid number of fields in pilot add packet")
 			return
 		}
 	}
@@ -188,7 +276,7 @@ func readLoginPackets(conn net.Conn, scanner *bufio.Scanner) (data loginData, to
 	if callsign, found := bytes.CutPrefix(getField(addPacket, 0), []byte(prefix)); found {
 		data.callsign = string(callsign)
 	} else {
-		sendError(conn, SyntaxError, "Invalid callsign in add packet")
+		sendError(logger, conn, SyntaxError, "Invalid callsign in add packet")
 		err = ErrInvalidAddPacket
 		return
 	}
@@ -197,39 +285,39 @@ func readLoginPackets(conn net.Conn, scanner *bufio.Scanner) (data loginData, to
 		data.realName = string(getField(addPacket, 2))
 		if data.cid, err = strconv.Atoi(string(getField(addPacket, 3))); err != nil {
 			err = ErrInvalidAddPacket
-			sendError(conn, SyntaxError, "Invalid CID in ATC add packet")
+			sendError(logger, conn, SyntaxError, "Invalid CID in ATC add packet")
 			return
 		}
 		token = string(getField(addPacket, 4))
 		var networkRating int
 		if networkRating, err = strconv.Atoi(string(getField(addPacket, 5))); err != nil {
 			err = ErrInvalidAddPacket
-			sendError(conn, SyntaxError, "Invalid network rating in pilot add packet")
+			sendError(logger, conn, SyntaxError, "Invalid network rating in pilot add packet")
 			return
 		}
 		data.networkRating = NetworkRating(networkRating)
 		if data.protoRevision, err = strconv.Atoi(string(getField(addPacket, 6))); err != nil {
 			err = ErrInvalidAddPacket
-			sendError(conn, SyntaxError, "Invalid protocol revision in ATC add packet")
+			sendError(logger, conn, SyntaxError, "Invalid protocol revision in ATC add packet")
 			return
 		}
 	} else {
 		if data.cid, err = strconv.Atoi(string(getField(addPacket, 2))); err != nil {
 			err = ErrInvalidAddPacket
-			sendError(conn, SyntaxError, "Invalid CID in pilot add packet")
+			sendError(logger, conn, SyntaxError, "Invalid CID in pilot add packet")
 			return
 		}
 		token = string(getField(addPacket, 3))
 		var networkRating int
 		if networkRating, err = strconv.Atoi(string(getField(addPacket, 4))); err != nil {
 			err = ErrInvalidAddPacket
-			sendError(conn, SyntaxError, "Invalid network rating in pilot add packet")
+			sendError(logger, conn, SyntaxError, "Invalid network rating in pilot add packet")
 			return
 		}
 		data.networkRating = NetworkRating(networkRating)
 		if data.protoRevision, err = strconv.Atoi(string(getField(addPacket, 5))); err != nil {
 			err = ErrInvalidAddPacket
-			sendError(conn, SyntaxError, "Invalid protocol revision in pilot add packet")
+			sendError(logger, conn, SyntaxError, "Invalid protocol revision in pilot add packet")
 			return
 		}
 		data.realName = string(getField(addPacket, 7))
@@ -237,7 +325,7 @@ func readLoginPackets(conn net.Conn, scanner *bufio.Scanner) (data loginData, to
 
 	if data.protoRevision < 100 || data.protoRevision > 101 {
 		err = ErrInvalidAddPacket
-		sendError(conn, InvalidProtocolRevisionError, "Invalid protocol revision")
+		sendError(logger, conn, InvalidProtocolRevisionError, "Invalid protocol revision")
 		return
 	}
 
@@ -254,7 +342,7 @@ func (s *Server) attemptAuthentication(client *Client, token string) (err error)
 			[]byte(client.clientChallenge),
 		); err != nil {
 			err = ErrInvalidIDPacket
-			sendError(client.conn, UnauthorizedSoftwareError, "Client incompatible with auth challenges")
+			sendError(client.logger, client.transport, UnauthorizedSoftwareError, "Client incompatible with auth challenges")
 			return
 		}
 	}
@@ -271,7 +359,7 @@ func (s *Server) attemptAuthentication(client *Client, token string) (err error)
 		var jwtToken *JwtToken
 		if jwtToken, err = ParseJwtToken(token, []byte(jwtSecret)); err != nil {
 			err = ErrInvalidAddPacket
-			sendError(client.conn, InvalidLogonError, invalidLogonMsg)
+			sendError(client.logger, client.transport, InvalidLogonError, invalidLogonMsg)
 			return
 		}
 
@@ -279,23 +367,23 @@ func (s *Server) attemptAuthentication(client *Client, token string) (err error)
 
 		if claims.TokenType != "fsd" {
 			err = ErrInvalidAddPacket
-			sendError(client.conn, InvalidLogonError, invalidLogonMsg)
+			sendError(client.logger, client.transport, InvalidLogonError, invalidLogonMsg)
 			return
 		}
 
 		if client.cid != claims.CID {
 			err = ErrInvalidAddPacket
-			sendError(client.conn, RequestedLevelTooHighError, invalidLogonMsg)
+			sendError(client.logger, client.transport, RequestedLevelTooHighError, invalidLogonMsg)
 			return
 		}
 		if client.networkRating > claims.NetworkRating {
 			err = ErrInvalidAddPacket
-			sendError(client.conn, RequestedLevelTooHighError, "Requested level too high")
+			sendError(client.logger, client.transport, RequestedLevelTooHighError, "Requested level too high")
 			return
 		}
 		if client.networkRating < NetworkRatingObserver {
 			err = ErrInvalidAddPacket
-			sendError(client.conn, CertificateSuspendedError, "Certificate inactive or suspended")
+			sendError(client.logger, client.transport, CertificateSuspendedError, "Certificate inactive or suspended")
 			return
 		}
 		client.maxNetworkRating = claims.NetworkRating
@@ -310,26 +398,26 @@ func (s *Server) attemptAuthentication(client *Client, token string) (err error)
 	user, err := s.dbRepo.UserRepo.GetUserByCID(client.cid)
 	if err != nil {
 		err = ErrInvalidAddPacket
-		sendError(client.conn, InvalidLogonError, invalidLogonMsg)
+		sendError(client.logger, client.transport, InvalidLogonError, invalidLogonMsg)
 		return
 	}
 
 	// Verify password hash
 	if !s.dbRepo.UserRepo.VerifyPasswordHash(password, user.Password) {
 		err = ErrInvalidAddPacket
-		sendError(client.conn, InvalidLogonError, invalidLogonMsg)
+		sendError(client.logger, client.transport, InvalidLogonError, invalidLogonMsg)
 		return
 	}
 
 	// Verify network rating
 	if client.networkRating > NetworkRating(user.NetworkRating) {
 		err = ErrInvalidAddPacket
-		sendError(client.conn, RequestedLevelTooHighError, "Requested level too high")
+		sendError(client.logger, client.transport, RequestedLevelTooHighError, "Requested level too high")
 		return
 	}
 	if client.networkRating < NetworkRatingObserver {
 		err = ErrInvalidAddPacket
-		sendError(client.conn, CertificateSuspendedError, "Certificate inactive or suspended")
+		sendError(client.logger, client.transport, CertificateSuspendedError, "Certificate inactive or suspended")
 		return
 	}
 	client.maxNetworkRating = NetworkRating(user.NetworkRating)
@@ -357,7 +445,8 @@ func (s *Server) broadcastAddPacket(client *Client) {
 			client.realName)
 	}
 
-	broadcastAll(s.postOffice, client, []byte(packet))
+	// Linked servers announce clients to their own clients
+	broadcastAllLocal(s.postOffice, client, []byte(packet))
 }
 
 func (s *Server) broadcastDisconnectPacket(client *Client) {
@@ -373,11 +462,15 @@ func (s *Server) broadcastDisconnectPacket(client *Client) {
 	packet.WriteString(strconv.Itoa(client.cid))
 	packet.WriteString("\r\n")
 
-	broadcastAll(s.postOffice, client, []byte(packet.String()))
+	broadcastAllLocal(s.postOffice, client, []byte(packet.String()))
 }
 
 func (s *Server) sendMotd(client *Client) (err error) {
-	welcomeMsg := db.GetWelcomeMessage(&s.dbRepo.ConfigRepo)
+	// Namespaces may override the welcome message configured in the database
+	welcomeMsg := s.ns.Motd
+	if welcomeMsg == "" {
+		welcomeMsg = db.GetWelcomeMessage(&s.dbRepo.ConfigRepo)
+	}
 	if welcomeMsg != "" {
 		lines := strings.Split(welcomeMsg, "\n")
 		for i := range lines {
@@ -393,16 +486,12 @@ func (s *Server) sendMotd(client *Client) (err error) {
 	return
 }
 
-// sendServerTextMessage synchronously sends a server #TM to the client's socket
+// sendServerTextMessage synchronously sends a server #TM to the client's transport
 func (s *Server) sendServerTextMessage(client *Client, msg string) (err error) {
-	packet := strings.Builder{}
-	packet.Grow(32 + len(msg))
-	packet.WriteString("#TMserver:")
-	packet.WriteString(client.callsign)
-	packet.WriteByte(':')
-	packet.WriteString(msg)
-	packet.WriteString("\r\n")
-
-	_, err = client.conn.Write([]byte(packet.String()))
+	packet := buildServerTextMessagePacket(client.callsign, msg)
+	if _, err = client.transport.Write([]byte(packet)); err != nil {
+		return
+	}
+	client.capturePacket(CaptureDirectionServer, []byte(packet))
 	return
 }
@@ -2,26 +2,98 @@ package fsd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/sethvargo/go-envconfig"
+	"time"
 )
 
 type ServerConfig struct {
 	FsdListenAddrs []string `env:"FSD_LISTEN_ADDRS, default=:6809"` // FSD listen addresses
+	FsdMaxClients  int      `env:"FSD_MAX_CLIENTS"`                 // Maximum number of clients connected to FSD_LISTEN_ADDRS. Zero allows any number.
+	NamespacesFile string   `env:"NAMESPACES_FILE"`                 // JSON file of additional namespaces, such as sweatboxes, each with its own listeners
+
+	LogFormat string `env:"LOG_FORMAT, default=text"` // Log output format: text or json
+	LogLevel  string `env:"LOG_LEVEL, default=info"`  // Minimum log level: debug, info, warn or error
+	LogDebug  bool   `env:"LOG_DEBUG"`                // Deprecated: use LOG_LEVEL=debug
 
 	DatabaseDriver      string `env:"DATABASE_DRIVER, default=sqlite"`        // Golang sql database driver name
 	DatabaseSourceName  string `env:"DATABASE_SOURCE_NAME, default=:memory:"` // Golang sql database source name
 	DatabaseAutoMigrate bool   `env:"DATABASE_AUTO_MIGRATE, default=false"`   // Whether to automatically run database migrations on startup
 	DatabaseMaxConns    int    `env:"DATABASE_MAX_CONNS, default=1"`          // Max number of database connections
 
-	NumMetarWorkers int `env:"NUM_METAR_WORKERS, default=4"` // Number of METAR fetch workers to run
+	NumMetarWorkers         int               `env:"NUM_METAR_WORKERS, default=4"`         // Number of METAR fetch workers to run
+	MetarProvider           string            `env:"METAR_PROVIDER, default=noaa"`         // METAR provider: noaa, url, file or static
+	MetarURLTemplate        string            `env:"METAR_URL_TEMPLATE"`                   // URL template containing an {icao} placeholder (url provider)
+	TafURLTemplate          string            `env:"TAF_URL_TEMPLATE"`                     // URL template containing an {icao} placeholder for TAFs (url provider)
+	MetarFilePath           string            `env:"METAR_FILE_PATH"`                      // Directory of <ICAO>.TXT station files or a metars.cache.csv file (file provider)
+	MetarStaticObservations map[string]string `env:"METAR_STATIC_OBSERVATIONS"`            // Comma-separated ICAO:METAR pairs (static provider)
+	MetarFetchTimeout       time.Duration     `env:"METAR_FETCH_TIMEOUT, default=10s"`     // Maximum duration of a single METAR fetch
+	MetarCacheTTL           time.Duration     `env:"METAR_CACHE_TTL, default=5m"`          // How long fetched METARs are cached
+	MetarNegativeCacheTTL   time.Duration     `env:"METAR_NEGATIVE_CACHE_TTL, default=1m"` // How long failed METAR lookups are cached
+	MetarStationsFile       string            `env:"METAR_STATIONS_FILE"`                  // CSV file of station coordinates (e.g. metars.cache.csv) used to find the nearest QNH
+
+	HandoffTimeout         time.Duration `env:"HANDOFF_TIMEOUT, default=2m"`          // How long a handoff request may remain unanswered. Zero disables expiry.
+	SquawkMismatchDuration time.Duration `env:"SQUAWK_MISMATCH_DURATION, default=1m"` // How long a pilot may squawk a code other than their assigned code before ATC is alerted
+	PositionHistorySize    int           `env:"POSITION_HISTORY_SIZE, default=720"`   // Number of position reports kept per pilot connection for track export
+
+	ScenarioFile             string        `env:"SCENARIO_FILE"`                          // JSON sweatbox scenario of server-controlled aircraft. Empty disables scenarios.
+	ScenarioInstructorRating NetworkRating `env:"SCENARIO_INSTRUCTOR_RATING, default=8"`  // Minimum network rating allowed to command scenario aircraft (8 = I1)
+	ScenarioPositionInterval time.Duration `env:"SCENARIO_POSITION_INTERVAL, default=5s"` // How often scenario aircraft move and send position updates
+	ScenarioHidden           bool          `env:"SCENARIO_HIDDEN"`                        // Hide scenario aircraft from the online users datafeed
+	ScenarioNamespace        string        `env:"SCENARIO_NAMESPACE, default=live"`       // Namespace the scenario aircraft connect to
+
+	FederationNodeName      string        `env:"FEDERATION_NODE_NAME"`                  // Name of this server in a federated network. Defaults to the hostname.
+	FederationListenAddr    string        `env:"FEDERATION_LISTEN_ADDR"`                // Address to accept links from other servers on. Empty disables incoming links.
+	FederationPeers         []string      `env:"FEDERATION_PEERS"`                      // Comma-separated addresses of servers to link to
+	FederationSecret        string        `env:"FEDERATION_SECRET"`                     // Shared secret required of every server in the network
+	FederationRetryInterval time.Duration `env:"FEDERATION_RETRY_INTERVAL, default=5s"` // How long to wait before redialing a server after a failed or lost link
+
+	RelayUpstreamAddr     string `env:"RELAY_UPSTREAM_ADDR"`     // Upstream FSD server to relay client sessions to. Empty disables relay mode.
+	RelayUpstreamPassword string `env:"RELAY_UPSTREAM_PASSWORD"` // Password every relayed CID logs in upstream with. Required in relay mode. Tokens are refused.
+
+	RestartTimeout time.Duration `env:"RESTART_TIMEOUT, default=30s"` // How long a new process may take to start serving during a restart before it is abandoned
+	RestartPidFile string        `env:"RESTART_PID_FILE"`             // File the PID of the new process is written to after a restart, e.g. for systemd's PIDFile
+
+	StatsSampleInterval time.Duration `env:"STATS_SAMPLE_INTERVAL, default=1m"` // How often network statistics are stored. Zero disables collection.
+
+	CaptureDir         string   `env:"CAPTURE_DIR"`                             // Directory to write packet capture files to. Empty disables packet capture.
+	CaptureAll         bool     `env:"CAPTURE_ALL"`                             // Capture every connection
+	CaptureCallsigns   []string `env:"CAPTURE_CALLSIGNS"`                       // Comma-separated callsigns to capture
+	CaptureListeners   []string `env:"CAPTURE_LISTENERS"`                       // Comma-separated FSD_LISTEN_ADDRS entries whose connections are captured
+	CaptureMaxFileSize int64    `env:"CAPTURE_MAX_FILE_SIZE, default=67108864"` // Size in bytes at which capture files are rotated
+	CaptureMaxFiles    int      `env:"CAPTURE_MAX_FILES, default=10"`           // Number of capture files to keep. Zero keeps every file.
 
 	ServiceHTTPListenAddr string `env:"SERVICE_HTTP_LISTEN_ADDR, default=:13618"`
+	MetricsBearerToken    string `env:"METRICS_BEARER_TOKEN"` // Bearer token required to scrape /metrics on the service HTTP server. Empty allows unauthenticated scrapes.
 }
 
-func loadServerConfig(ctx context.Context) (config *ServerConfig, err error) {
+var ErrInvalidServerConfig = errors.New("invalid server config")
+
+// LoadServerConfig loads the server configuration from environment variables.
+func LoadServerConfig(ctx context.Context) (config *ServerConfig, err error) {
 	config = &ServerConfig{}
 	if err = envconfig.Process(ctx, config); err != nil {
 		return
 	}
+	err = config.validate()
+	return
+}
+
+// validate checks settings which cannot be checked by their type alone
+func (config *ServerConfig) validate() (err error) {
+	if config.PositionHistorySize < 0 {
+		return fmt.Errorf("%w: POSITION_HISTORY_SIZE must not be negative", ErrInvalidServerConfig)
+	}
+	return
+}
+
+// DefaultServerConfig returns the server configuration used when no environment variables are set.
+func DefaultServerConfig() (config *ServerConfig, err error) {
+	config = &ServerConfig{}
+	err = envconfig.ProcessWith(context.Background(), &envconfig.Config{
+		Target:   config,
+		Lookuper: envconfig.MapLookuper(nil),
+	})
 	return
 }
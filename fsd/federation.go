@@ -0,0 +1,356 @@
+package fsd
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"go.uber.org/atomic"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// federation links this server to the other servers of a federated network.
+//
+// Servers form a full mesh: every server links to every other server and only shares its own clients,
+// so messages received over a link are never forwarded to another link. The clients of other servers
+// are registered to the local post office as proxies, which relay the packets sent to them over their
+// server's link.
+type federation struct {
+	server        *Server
+	name          string
+	secret        string
+	listenAddr    string
+	peerAddrs     []string
+	retryInterval time.Duration
+
+	lock    sync.Mutex
+	peers   map[string]*federationPeer // Server name -> link
+	pending map[string]*federationPeer // Callsign -> server whose client waits for a duplicate callsign to disconnect
+}
+
+// federationPeer is a link to another server of the network
+type federationPeer struct {
+	name    string
+	conn    net.Conn
+	dialed  bool // Whether this server dialed the link
+	ctx     context.Context
+	cancel  func()
+	outbox  chan string
+	proxies map[string]*Client // Callsign -> proxy of the server's client. Guarded by federation.lock.
+	relayed atomic.Uint64      // Packets relayed to the server's clients
+	logger  *slog.Logger
+}
+
+var ErrInvalidFederationConfig = errors.New("invalid federation config")
+var ErrFederationHandshake = errors.New("federation handshake failed")
+
+const (
+	federationHandshakeTimeout = 10 * time.Second
+	federationOutboxSize       = 4096 // Messages queued per link before the link is closed
+	federationMaxMessageLength = 8192
+)
+
+// newFederation creates the federation described by the config, or returns nil if federation is disabled.
+func newFederation(s *Server, cfg *ServerConfig) (f *federation, err error) {
+	if cfg.FederationListenAddr == "" && len(cfg.FederationPeers) == 0 {
+		return
+	}
+
+	name := cfg.FederationNodeName
+	if name == "" {
+		if name, err = os.Hostname(); err != nil {
+			return
+		}
+	}
+	if strings.ContainsAny(name, ": \r\n") {
+		err = fmt.Errorf("%w: invalid node name %q", ErrInvalidFederationConfig, name)
+		return
+	}
+	if cfg.FederationSecret == "" || strings.ContainsAny(cfg.FederationSecret, ":\r\n") {
+		err = fmt.Errorf("%w: a secret without colons or line breaks is required", ErrInvalidFederationConfig)
+		return
+	}
+	if cfg.FederationRetryInterval <= 0 {
+		err = fmt.Errorf("%w: retry interval must be positive", ErrInvalidFederationConfig)
+		return
+	}
+
+	f = &federation{
+		server:        s,
+		name:          name,
+		secret:        cfg.FederationSecret,
+		listenAddr:    cfg.FederationListenAddr,
+		peerAddrs:     cfg.FederationPeers,
+		retryInterval: cfg.FederationRetryInterval,
+		peers:         make(map[string]*federationPeer),
+		pending:       make(map[string]*federationPeer),
+	}
+	return
+}
+
+// start accepts links on the federation listen address, if configured, and dials every configured peer.
+func (f *federation) start(ctx context.Context) (err error) {
+	if f.listenAddr != "" {
+		var listener net.Listener
+		if listener, err = f.server.restart.listen(ctx, f.listenAddr); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", f.listenAddr, err)
+		}
+		slog.Info("accepting federation links", "addr", f.listenAddr, "node", f.name)
+		go f.accept(ctx, listener)
+	}
+
+	for _, addr := range f.peerAddrs {
+		go f.dial(ctx, addr)
+	}
+	return
+}
+
+func (f *federation) accept(ctx context.Context, listener net.Listener) {
+	defer listener.Close()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Warn("error accepting federation link", "addr", f.listenAddr, "error", err)
+			continue
+		}
+		go f.serveLink(ctx, conn, false)
+	}
+}
+
+// dial maintains a link to the server at addr, redialing whenever it is lost.
+func (f *federation) dial(ctx context.Context, addr string) {
+	dialer := net.Dialer{Timeout: federationHandshakeTimeout}
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp4", addr)
+		if err != nil {
+			slog.Warn("unable to dial federated server", "addr", addr, "error", err)
+		} else if existing := f.serveLink(ctx, conn, true); existing != nil {
+			// Another link to the same server is preferred. Only redial once it is lost.
+			select {
+			case <-existing.ctx.Done():
+			case <-ctx.Done():
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(f.retryInterval):
+		}
+	}
+}
+
+// serveLink authenticates a new link and handles its messages until it is lost.
+// If another link to the same server is preferred, the new link is closed and the other link is returned.
+func (f *federation) serveLink(ctx context.Context, conn net.Conn, dialed bool) (existing *federationPeer) {
+	defer conn.Close()
+	logger := slog.With("addr", conn.RemoteAddr().String())
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, federationMaxMessageLength), federationMaxMessageLength)
+
+	name, err := f.handshake(conn, scanner, dialed)
+	if err != nil {
+		logger.Warn("federation handshake failed", "error", err)
+		return
+	}
+	logger = logger.With("server", name)
+
+	linkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	peer := &federationPeer{
+		name:    name,
+		conn:    conn,
+		dialed:  dialed,
+		ctx:     linkCtx,
+		cancel:  cancel,
+		outbox:  make(chan string, federationOutboxSize),
+		proxies: make(map[string]*Client),
+		logger:  logger,
+	}
+
+	if existing = f.link(peer); existing != nil {
+		logger.Info("closing duplicate federation link")
+		return
+	}
+	defer f.unlink(peer)
+
+	logger.Info("federation link established")
+	defer logger.Info("federation link lost")
+
+	go peer.writeLoop()
+	go func() {
+		<-linkCtx.Done()
+		conn.Close()
+	}()
+
+	for scanner.Scan() {
+		f.handleMessage(peer, scanner.Text())
+	}
+	return
+}
+
+// handshake exchanges HELLO messages carrying the server names and the shared secret.
+// The dialing server identifies itself first, so the secret is never revealed to unauthenticated clients.
+func (f *federation) handshake(conn net.Conn, scanner *bufio.Scanner, dialed bool) (name string, err error) {
+	conn.SetDeadline(time.Now().Add(federationHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	hello := buildFederationMessage("HELLO", f.name, f.secret)
+	if dialed {
+		if _, err = io.WriteString(conn, hello); err != nil {
+			return
+		}
+	}
+
+	if !scanner.Scan() {
+		err = fmt.Errorf("%w: connection closed", ErrFederationHandshake)
+		return
+	}
+	fields := strings.Split(scanner.Text(), ":")
+	if len(fields) != 3 || fields[0] != "HELLO" || subtle.ConstantTimeCompare([]byte(fields[2]), []byte(f.secret)) != 1 {
+		err = fmt.Errorf("%w: invalid HELLO", ErrFederationHandshake)
+		return
+	}
+	if name = fields[1]; name == "" || name == f.name {
+		err = fmt.Errorf("%w: invalid server name %q", ErrFederationHandshake, name)
+		return
+	}
+
+	if !dialed {
+		_, err = io.WriteString(conn, hello)
+	}
+	return
+}
+
+// link registers an authenticated link and shares every local client over it.
+//
+// Of two links between the same servers, the one dialed by the server with the lower name is kept.
+// If the existing link is kept, the new link is not registered and the existing link is returned.
+func (f *federation) link(peer *federationPeer) (existing *federationPeer) {
+	f.lock.Lock()
+	other, ok := f.peers[peer.name]
+	f.lock.Unlock()
+
+	if ok {
+		if other.dialed == peer.dialed || peer.dialed != (f.name < peer.name) {
+			return other
+		}
+		f.unlink(other)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.peers[peer.name] = peer
+	f.server.postOffice.all(nil, func(client *Client) bool {
+		if client.peer == nil {
+			f.shareClient(peer, client)
+		}
+		return true
+	})
+	return
+}
+
+// unlink removes a lost link, disconnecting the proxies of the server's clients.
+func (f *federation) unlink(peer *federationPeer) {
+	peer.cancel()
+
+	f.lock.Lock()
+	if f.peers[peer.name] == peer {
+		delete(f.peers, peer.name)
+	}
+	for callsign, pendingPeer := range f.pending {
+		if pendingPeer == peer {
+			delete(f.pending, callsign)
+		}
+	}
+	proxies := peer.proxies
+	peer.proxies = make(map[string]*Client)
+	f.lock.Unlock()
+
+	for _, proxy := range proxies {
+		f.releaseProxy(proxy)
+	}
+}
+
+// send queues a message on the link. The link is closed if the other server falls too far behind.
+func (p *federationPeer) send(message string) {
+	select {
+	case p.outbox <- message:
+	default:
+		if p.ctx.Err() == nil {
+			p.logger.Warn("federation link overflowed")
+			p.cancel()
+		}
+	}
+}
+
+func (p *federationPeer) writeLoop() {
+	defer p.cancel()
+
+	for {
+		select {
+		case message := <-p.outbox:
+			if _, err := io.WriteString(p.conn, message); err != nil {
+				return
+			}
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// peerTransport is the transport of a proxy for a client of another server.
+// Packets written to it are relayed over the server's link.
+type peerTransport struct {
+	peer     *federationPeer
+	callsign string
+}
+
+func (t *peerTransport) Write(packet []byte) (n int, err error) {
+	t.peer.send(buildFederationMessage("MC", t.callsign, strings.TrimSuffix(string(packet), "\r\n")))
+	return len(packet), nil
+}
+
+func (t *peerTransport) Close() error {
+	return nil
+}
+
+// readPacket blocks until the link is lost, as packets from proxies are handled by their own server.
+func (t *peerTransport) readPacket() (packet []byte, err error) {
+	<-t.peer.ctx.Done()
+	return nil, io.EOF
+}
+
+func (t *peerTransport) remoteIP() string {
+	return remoteIP(t.peer.conn)
+}
+
+// buildFederationMessage builds a server link message from its command and fields
+func buildFederationMessage(command string, fields ...string) string {
+	message := strings.Builder{}
+	message.WriteString(command)
+	for _, field := range fields {
+		message.WriteByte(':')
+		message.WriteString(field)
+	}
+	message.WriteString("\r\n")
+	return message.String()
+}
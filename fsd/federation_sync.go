@@ -0,0 +1,419 @@
+package fsd
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Messages exchanged over server links. Every message is one CRLF-terminated line of colon-delimited fields:
+//
+//	HELLO:<server name>:<secret>
+//	ADDCLIENT:<callsign>:<A|P>:<cid>:<rating>:<max rating>:<protocol revision>:<facility>:<login time>:<real name>
+//	RMCLIENT:<callsign>
+//	PD:<callsign>:<lat>:<lon>:<visibility range>:<altitude>:<ground speed>:<heading>:<transponder>
+//	AD:<callsign>:<lat>:<lon>:<visibility range>:<facility>:<frequency>
+//	PLAN:<callsign>:<flight plan>
+//	TRACK:<callsign>:<tracking controller>:<handoff from>:<handoff to>:<handoff status>:<handoff expiry>:<scratchpad>:<temporary altitude>:<final altitude>:<beacon code>
+//	MC:<recipient callsign>:<packet>
+//	KILL:<callsign>
+//	SYNC:<callsign>
+//
+// Login times and handoff expiries are Unix times in nanoseconds, and visibility ranges are in meters.
+// MC delivers a packet to a client of the receiving server. KILL disconnects a client of the receiving
+// server, and SYNC asks the receiving server to share one of its clients again.
+
+// clientConnected shares a newly registered local client with every linked server.
+func (f *federation) clientConnected(client *Client) {
+	if f == nil {
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, peer := range f.peers {
+		f.shareClient(peer, client)
+	}
+}
+
+// clientDisconnected withdraws a released local client from every linked server.
+func (f *federation) clientDisconnected(client *Client) {
+	if f == nil {
+		return
+	}
+
+	f.lock.Lock()
+	message := buildFederationMessage("RMCLIENT", client.callsign)
+	for _, peer := range f.peers {
+		peer.send(message)
+	}
+	f.lock.Unlock()
+
+	f.resolvePending(client.callsign)
+}
+
+// clientUpdated shares the position of a local client with every linked server.
+func (f *federation) clientUpdated(client *Client) {
+	if f == nil {
+		return
+	}
+
+	message := buildClientDataMessage(client)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, peer := range f.peers {
+		peer.send(message)
+	}
+}
+
+// flightPlanUpdated shares the flight plan of a local or remote client with every linked server.
+func (f *federation) flightPlanUpdated(client *Client) {
+	if f == nil {
+		return
+	}
+
+	message := buildFederationMessage("PLAN", client.callsign, client.flightPlan.Load())
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, peer := range f.peers {
+		peer.send(message)
+	}
+}
+
+// trackChanged shares the ATC state of an aircraft with every linked server.
+func (f *federation) trackChanged(callsign string, state aircraftState) {
+	if f == nil {
+		return
+	}
+
+	message := buildTrackMessage(callsign, state)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, peer := range f.peers {
+		peer.send(message)
+	}
+}
+
+// shareClient sends a local client and its state to a linked server. The lock must be held.
+func (f *federation) shareClient(peer *federationPeer, client *Client) {
+	clientType := "P"
+	if client.isAtc {
+		clientType = "A"
+	}
+	peer.send(buildFederationMessage(
+		"ADDCLIENT",
+		client.callsign,
+		clientType,
+		strconv.Itoa(client.cid),
+		strconv.Itoa(int(client.networkRating)),
+		strconv.Itoa(int(client.maxNetworkRating)),
+		strconv.Itoa(client.protoRevision),
+		strconv.Itoa(client.facilityType),
+		strconv.FormatInt(client.loginTime.UnixNano(), 10),
+		client.realName,
+	))
+	peer.send(buildClientDataMessage(client))
+
+	if fp := client.flightPlan.Load(); fp != "" {
+		peer.send(buildFederationMessage("PLAN", client.callsign, fp))
+	}
+	if state, ok := f.server.tracks.get(client.callsign); ok && !client.isAtc {
+		peer.send(buildTrackMessage(client.callsign, state))
+	}
+}
+
+// resolvePending asks for a remote client waiting on a callsign, now that the callsign is free.
+func (f *federation) resolvePending(callsign string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if peer, ok := f.pending[callsign]; ok {
+		delete(f.pending, callsign)
+		peer.send(buildFederationMessage("SYNC", callsign))
+	}
+}
+
+// handleMessage handles a message received over a link
+func (f *federation) handleMessage(peer *federationPeer, message string) {
+	command, rest, _ := strings.Cut(message, ":")
+	switch command {
+	case "ADDCLIENT":
+		f.handleAddClient(peer, strings.SplitN(rest, ":", 9))
+	case "RMCLIENT":
+		f.handleRemoveClient(peer, rest)
+	case "PD", "AD":
+		f.handleClientData(peer, command, strings.Split(rest, ":"))
+	case "PLAN":
+		f.handlePlan(strings.SplitN(rest, ":", 2))
+	case "TRACK":
+		f.handleTrack(strings.Split(rest, ":"))
+	case "MC":
+		f.handleMulticast(strings.SplitN(rest, ":", 2))
+	case "KILL":
+		if client, err := f.server.postOffice.find(rest); err == nil && client.peer == nil {
+			client.logger.Info("client kicked", "by", peer.name)
+			client.cancelCtx()
+		}
+	case "SYNC":
+		f.lock.Lock()
+		if client, err := f.server.postOffice.find(rest); err == nil && client.peer == nil {
+			f.shareClient(peer, client)
+		}
+		f.lock.Unlock()
+	default:
+		peer.logger.Debug("ignoring unknown federation message", "command", command)
+	}
+}
+
+// handleAddClient registers a proxy for a client of a linked server.
+//
+// If the callsign is already in use, the client which logged in first keeps it. A local client which logged in
+// later is disconnected, and the remote client is requested again with SYNC once the callsign is free.
+func (f *federation) handleAddClient(peer *federationPeer, fields []string) {
+	if len(fields) != 9 || !isValidClientCallsign([]byte(fields[0])) || (fields[1] != "A" && fields[1] != "P") {
+		peer.logger.Warn("invalid ADDCLIENT message", "fields", fields)
+		return
+	}
+	data := loginData{
+		callsign: fields[0],
+		isAtc:    fields[1] == "A",
+		realName: fields[8],
+	}
+	var networkRating, maxNetworkRating, facilityType int
+	var loginTime int64
+	var err error
+	for _, field := range []struct {
+		value string
+		dest  *int
+	}{
+		{fields[2], &data.cid},
+		{fields[3], &networkRating},
+		{fields[4], &maxNetworkRating},
+		{fields[5], &data.protoRevision},
+		{fields[6], &facilityType},
+	} {
+		if *field.dest, err = strconv.Atoi(field.value); err != nil {
+			peer.logger.Warn("invalid ADDCLIENT message", "fields", fields)
+			return
+		}
+	}
+	if loginTime, err = strconv.ParseInt(fields[7], 10, 64); err != nil {
+		peer.logger.Warn("invalid ADDCLIENT message", "fields", fields)
+		return
+	}
+	data.networkRating = NetworkRating(networkRating)
+	data.maxNetworkRating = NetworkRating(maxNetworkRating)
+	data.loginTime = time.Unix(0, loginTime)
+
+	f.lock.Lock()
+	if _, exists := peer.proxies[data.callsign]; exists || peer.ctx.Err() != nil {
+		f.lock.Unlock()
+		return
+	}
+
+	proxy := newClient(peer.ctx, &peerTransport{peer: peer, callsign: data.callsign}, data, withLoginData(peer.logger, &data))
+	proxy.peer = peer
+	proxy.facilityType = facilityType
+
+	if err = f.server.postOffice.register(proxy); err != nil {
+		proxy.cancelCtx()
+		existing, findErr := f.server.postOffice.find(data.callsign)
+		remoteFirst := findErr == nil && existing.peer == nil &&
+			(data.loginTime.Before(existing.loginTime) || (data.loginTime.Equal(existing.loginTime) && peer.name < f.name))
+		switch {
+		case findErr != nil:
+			// Released in the meantime
+			peer.send(buildFederationMessage("SYNC", data.callsign))
+		case existing.peer != nil || remoteFirst:
+			f.pending[data.callsign] = peer
+		}
+		f.lock.Unlock()
+
+		if remoteFirst {
+			existing.logger.Info("disconnecting duplicate callsign", "server", peer.name)
+			existing.sendError(CallsignInUseError, "Callsign already in use")
+			existing.cancelCtx()
+		}
+		return
+	}
+	peer.proxies[data.callsign] = proxy
+	f.lock.Unlock()
+
+	go proxy.senderWorker(&peer.relayed)
+	go f.watchProxy(peer, proxy)
+
+	f.server.broadcastAddPacket(proxy)
+}
+
+// handleRemoveClient releases the proxy of a client which disconnected from a linked server.
+func (f *federation) handleRemoveClient(peer *federationPeer, callsign string) {
+	f.lock.Lock()
+	if f.pending[callsign] == peer {
+		delete(f.pending, callsign)
+	}
+	proxy, ok := peer.proxies[callsign]
+	delete(peer.proxies, callsign)
+	f.lock.Unlock()
+
+	if ok {
+		f.releaseProxy(proxy)
+	}
+}
+
+// releaseProxy removes a proxy from the post office and notifies local clients of the disconnect.
+func (f *federation) releaseProxy(proxy *Client) {
+	f.server.postOffice.release(proxy)
+	f.server.tracks.release(proxy)
+	f.server.broadcastDisconnectPacket(proxy)
+	proxy.cancelCtx()
+
+	f.resolvePending(proxy.callsign)
+}
+
+// watchProxy asks a linked server to disconnect its client if the client's proxy is kicked locally.
+// The proxy remains registered until the server confirms the disconnect with RMCLIENT.
+func (f *federation) watchProxy(peer *federationPeer, proxy *Client) {
+	<-proxy.ctx.Done()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if peer.ctx.Err() == nil && peer.proxies[proxy.callsign] == proxy {
+		peer.send(buildFederationMessage("KILL", proxy.callsign))
+	}
+}
+
+// handleClientData updates the position of a proxy from a PD or AD message.
+func (f *federation) handleClientData(peer *federationPeer, command string, fields []string) {
+	if (command == "PD" && len(fields) != 8) || (command == "AD" && len(fields) != 6) {
+		peer.logger.Warn("invalid client data message", "command", command, "fields", fields)
+		return
+	}
+
+	f.lock.Lock()
+	proxy, ok := peer.proxies[fields[0]]
+	f.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	lat, errLat := strconv.ParseFloat(fields[1], 64)
+	lon, errLon := strconv.ParseFloat(fields[2], 64)
+	visRange, errVisRange := strconv.ParseFloat(fields[3], 64)
+	if errLat != nil || errLon != nil || errVisRange != nil || !validLatLon(lat, lon) {
+		peer.logger.Warn("invalid client data message", "command", command, "fields", fields)
+		return
+	}
+	f.server.postOffice.updatePosition(proxy, [2]float64{lat, lon}, visRange)
+
+	if command == "PD" {
+		altitude, _ := strconv.Atoi(fields[4])
+		groundspeed, _ := strconv.Atoi(fields[5])
+		heading, _ := strconv.Atoi(fields[6])
+		proxy.altitude.Store(int32(altitude))
+		proxy.groundspeed.Store(int32(groundspeed))
+		proxy.heading.Store(int32(heading))
+		proxy.transponder.Store(fields[7])
+	} else {
+		proxy.facilityType, _ = strconv.Atoi(fields[4])
+		proxy.frequency.Store(fields[5])
+	}
+	proxy.lastUpdated.Store(time.Now())
+}
+
+// handlePlan stores a flight plan filed by a remote client, or amended by a remote controller.
+func (f *federation) handlePlan(fields []string) {
+	if len(fields) != 2 {
+		return
+	}
+	if client, err := f.server.postOffice.find(fields[0]); err == nil {
+		client.flightPlan.Store(fields[1])
+	}
+}
+
+// handleTrack stores the ATC state of an aircraft changed on a linked server.
+func (f *federation) handleTrack(fields []string) {
+	if len(fields) != 10 {
+		return
+	}
+	if target, err := f.server.postOffice.find(fields[0]); err != nil || target.isAtc {
+		return
+	}
+
+	state := aircraftState{
+		trackingController: fields[1],
+		handoff: handoffState{
+			from:   fields[2],
+			to:     fields[3],
+			status: handoffStatus(fields[4]),
+		},
+		scratchpad:    fields[6],
+		tempAltitude:  fields[7],
+		finalAltitude: fields[8],
+		beaconCode:    fields[9],
+	}
+	if expires, err := strconv.ParseInt(fields[5], 10, 64); err == nil && expires != 0 {
+		state.handoff.expires = time.Unix(0, expires)
+	}
+	f.server.tracks.replace(fields[0], state)
+}
+
+// handleMulticast delivers a packet relayed by a linked server to a local client.
+func (f *federation) handleMulticast(fields []string) {
+	if len(fields) != 2 {
+		return
+	}
+	if recipient, err := f.server.postOffice.find(fields[0]); err == nil && recipient.peer == nil {
+		recipient.send(fields[1] + "\r\n")
+	}
+}
+
+// buildClientDataMessage builds the PD or AD message describing the position of a local client.
+func buildClientDataMessage(client *Client) string {
+	latLon := client.latLon()
+	lat := strconv.FormatFloat(latLon[0], 'f', -1, 64)
+	lon := strconv.FormatFloat(latLon[1], 'f', -1, 64)
+	visRange := strconv.FormatFloat(client.visRange.Load(), 'f', -1, 64)
+
+	if client.isAtc {
+		return buildFederationMessage("AD", client.callsign, lat, lon, visRange, strconv.Itoa(client.facilityType), client.frequency.Load())
+	}
+	return buildFederationMessage(
+		"PD",
+		client.callsign,
+		lat,
+		lon,
+		visRange,
+		strconv.Itoa(int(client.altitude.Load())),
+		strconv.Itoa(int(client.groundspeed.Load())),
+		strconv.Itoa(int(client.heading.Load())),
+		client.transponder.Load(),
+	)
+}
+
+func buildTrackMessage(callsign string, state aircraftState) string {
+	var expires int64
+	if !state.handoff.expires.IsZero() {
+		expires = state.handoff.expires.UnixNano()
+	}
+	return buildFederationMessage(
+		"TRACK",
+		callsign,
+		state.trackingController,
+		state.handoff.from,
+		state.handoff.to,
+		string(state.handoff.status),
+		strconv.FormatInt(expires, 10),
+		state.scratchpad,
+		state.tempAltitude,
+		state.finalAltitude,
+		state.beaconCode,
+	)
+}
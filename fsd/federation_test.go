@@ -0,0 +1,254 @@
+package fsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// newFederatedTestServer creates a server with federation enabled but not yet linked to anything.
+func newFederatedTestServer(t *testing.T, name string) *Server {
+	s := newTestDatabaseServer(t, &ServerConfig{
+		PositionHistorySize:     10,
+		FederationNodeName:      name,
+		FederationListenAddr:    "127.0.0.1:0",
+		FederationSecret:        "hunter2",
+		FederationRetryInterval: time.Second,
+	})
+	if s.federation == nil {
+		t.Fatal("expected federation to be enabled")
+	}
+	return s
+}
+
+// linkTestServers links two servers over an in-memory pipe, returning a function which severs the link.
+func linkTestServers(ctx context.Context, dialer, acceptor *Server) (sever func()) {
+	c1, c2 := net.Pipe()
+	go dialer.federation.serveLink(ctx, c1, true)
+	go acceptor.federation.serveLink(ctx, c2, false)
+	return func() {
+		c1.Close()
+		c2.Close()
+	}
+}
+
+// waitUntil polls cond until it holds, failing the test after a second.
+func waitUntil(t *testing.T, description string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", description)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func testVirtualLogin(t *testing.T, ctx context.Context, s *Server, data loginData) *virtualClient {
+	t.Helper()
+	if data.protoRevision == 0 {
+		data.protoRevision = 101
+	}
+	if data.loginTime.IsZero() {
+		data.loginTime = time.Now()
+	}
+	vc, err := s.connectVirtualClient(ctx, data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectVirtualPacket(t, vc, "#TMserver:"+data.callsign+":Connected to openfsd")
+	return vc
+}
+
+func TestNewFederation(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ServerConfig
+		enabled bool
+		wantErr bool
+	}{
+		{"disabled", ServerConfig{FederationSecret: "secret"}, false, false},
+		{"listener", ServerConfig{FederationListenAddr: ":6810", FederationNodeName: "alpha", FederationSecret: "secret", FederationRetryInterval: time.Second}, true, false},
+		{"peers", ServerConfig{FederationPeers: []string{"bravo:6810"}, FederationNodeName: "alpha", FederationSecret: "secret", FederationRetryInterval: time.Second}, true, false},
+		{"missing secret", ServerConfig{FederationListenAddr: ":6810", FederationNodeName: "alpha", FederationRetryInterval: time.Second}, false, true},
+		{"secret with colon", ServerConfig{FederationListenAddr: ":6810", FederationNodeName: "alpha", FederationSecret: "a:b", FederationRetryInterval: time.Second}, false, true},
+		{"invalid name", ServerConfig{FederationListenAddr: ":6810", FederationNodeName: "al:pha", FederationSecret: "secret", FederationRetryInterval: time.Second}, false, true},
+		{"no retry interval", ServerConfig{FederationListenAddr: ":6810", FederationNodeName: "alpha", FederationSecret: "secret"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newFederation(nil, &tt.cfg)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidFederationConfig) {
+					t.Errorf("expected ErrInvalidFederationConfig, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (f != nil) != tt.enabled {
+				t.Errorf("expected enabled = %v, got %v", tt.enabled, f != nil)
+			}
+		})
+	}
+}
+
+func TestFederationHandshake(t *testing.T) {
+	alpha := newFederatedTestServer(t, "alpha")
+	bravo := newFederatedTestServer(t, "bravo")
+	bravo.federation.secret = "wrong"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c1, c2 := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		alpha.federation.serveLink(ctx, c1, true)
+		close(done)
+	}()
+	bravo.federation.serveLink(ctx, c2, false)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the link to be closed")
+	}
+	if len(alpha.federation.peers) != 0 || len(bravo.federation.peers) != 0 {
+		t.Error("expected no link to be established")
+	}
+}
+
+func TestFederation(t *testing.T) {
+	alpha := newFederatedTestServer(t, "alpha")
+	bravo := newFederatedTestServer(t, "bravo")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	atc := testVirtualLogin(t, ctx, alpha, loginData{
+		callsign:      "LAX_TWR",
+		cid:           1,
+		realName:      "Alpha Tower",
+		networkRating: NetworkRatingController1,
+		isAtc:         true,
+	})
+	atc.send("%LAX_TWR:18000:4:50:5:33.94250:-118.40810:0")
+	pilot := testVirtualLogin(t, ctx, bravo, loginData{
+		callsign:      "N123AB",
+		cid:           2,
+		realName:      "Bravo Pilot",
+		networkRating: NetworkRatingObserver,
+	})
+
+	sever := linkTestServers(ctx, alpha, bravo)
+	defer sever()
+
+	// Clients are announced to the clients of the other server
+	expectVirtualPacket(t, atc, "#APN123AB:SERVER:2::1:101:1:Bravo Pilot")
+	expectVirtualPacket(t, pilot, "#AALAX_TWR:SERVER:Alpha Tower:1::")
+	waitUntil(t, "the tower position is shared", func() bool {
+		proxy, err := bravo.postOffice.find("LAX_TWR")
+		return err == nil && proxy.latLon()[0] != 0
+	})
+
+	// Callsigns are unique across the network
+	if _, err := bravo.connectVirtualClient(ctx, loginData{callsign: "LAX_TWR"}, false); !errors.Is(err, ErrCallsignInUse) {
+		t.Errorf("expected ErrCallsignInUse, got %v", err)
+	}
+
+	// Broadcasts and direct messages reach the clients of the other server
+	pilot.send("@N:N123AB:1200:1:33.94000:-118.40000:100:0:0:0")
+	expectVirtualPacket(t, atc, "@N:N123AB:1200:1:33.94000:-118.40000:100:0:0:0")
+	atc.send("#TMLAX_TWR:N123AB:cleared for takeoff")
+	expectVirtualPacket(t, pilot, "#TMLAX_TWR:N123AB:cleared for takeoff")
+
+	// Flight plans are answered by the local server
+	pilot.send("$FPN123AB:*A:I:B738/L:450:KLAX:1800:1800:FL350:KLAS:0:0:0:0:::DCT")
+	waitUntil(t, "the flight plan is shared", func() bool {
+		proxy, err := alpha.postOffice.find("N123AB")
+		return err == nil && proxy.flightPlan.Load() != ""
+	})
+	atc.send("$CQLAX_TWR:SERVER:FP:N123AB")
+	expectVirtualPacket(t, atc, "$FPN123AB:*A:I:B738/L:450:KLAX:1800:1800:FL350:KLAS:0:0:0:0:::DCT")
+
+	// Track state is shared
+	atc.send("$CQLAX_TWR:@94835:IT:N123AB")
+	waitUntil(t, "the track is shared", func() bool {
+		state, ok := bravo.tracks.get("N123AB")
+		return ok && state.trackingController == "LAX_TWR"
+	})
+
+	// Disconnects are announced to the clients of the other server
+	pilot.close()
+	expectVirtualPacket(t, atc, "#DPN123AB:SERVER:2")
+	if _, err := alpha.postOffice.find("N123AB"); err == nil {
+		t.Error("expected the pilot's proxy to be released")
+	}
+
+	// Losing the link releases every proxy
+	sever()
+	waitUntil(t, "the tower's proxy is released", func() bool {
+		_, err := bravo.postOffice.find("LAX_TWR")
+		return err != nil
+	})
+}
+
+func TestFederationDuplicateCallsign(t *testing.T) {
+	alpha := newFederatedTestServer(t, "alpha")
+	bravo := newFederatedTestServer(t, "bravo")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The same callsign logs in to both servers while they are not linked
+	first := testVirtualLogin(t, ctx, alpha, loginData{
+		callsign:      "DAL1",
+		cid:           1,
+		networkRating: NetworkRatingObserver,
+		loginTime:     time.Now().Add(-time.Minute),
+	})
+	second := testVirtualLogin(t, ctx, bravo, loginData{
+		callsign:      "DAL1",
+		cid:           2,
+		networkRating: NetworkRatingObserver,
+	})
+	observer := testVirtualLogin(t, ctx, bravo, loginData{
+		callsign:      "BRAVO_OBS",
+		cid:           3,
+		networkRating: NetworkRatingObserver,
+		isAtc:         true,
+	})
+
+	sever := linkTestServers(ctx, alpha, bravo)
+	defer sever()
+
+	// The later login is disconnected, and replaced by the proxy of the first
+	timeout := time.After(time.Second)
+	for disconnected := false; !disconnected; {
+		select {
+		case <-second.packets():
+		case <-second.done():
+			disconnected = true
+		case <-timeout:
+			t.Fatal("expected the later login to be disconnected")
+		}
+	}
+	expectVirtualPacket(t, observer, "#DPDAL1:SERVER:2")
+	expectVirtualPacket(t, observer, "#APDAL1:SERVER:1:")
+	waitUntil(t, "the first login is shared", func() bool {
+		proxy, err := bravo.postOffice.find("DAL1")
+		return err == nil && proxy.peer != nil
+	})
+
+	// The first login is unaffected
+	select {
+	case <-first.done():
+		t.Fatal("expected the first login to remain connected")
+	default:
+	}
+}
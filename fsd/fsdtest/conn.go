@@ -0,0 +1,219 @@
+package fsdtest
+
+import (
+	"bufio"
+	"github.com/renorris/openfsd/fsd"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout is how long a Conn waits for an expected packet
+const DefaultTimeout = 5 * time.Second
+
+// Conn is a scripted client connection exchanging raw packets with the server.
+// Packets are passed without their trailing CRLF.
+//
+// Methods fail the test on errors and timeouts, so they must be called from the test's goroutine.
+type Conn struct {
+	Timeout time.Duration // How long to wait for packets. Defaults to DefaultTimeout.
+
+	t       testing.TB
+	conn    net.Conn
+	packets chan string // Packets received from the server. Closed when the connection ends.
+	readErr error       // Reason the connection ended. Valid once packets is closed.
+	closed  sync.Once
+}
+
+// packetBufferSize is the number of received packets buffered before the server is blocked
+const packetBufferSize = 1024
+
+func newConn(t testing.TB, conn net.Conn) (c *Conn) {
+	c = &Conn{
+		Timeout: DefaultTimeout,
+		t:       t,
+		conn:    conn,
+		packets: make(chan string, packetBufferSize),
+	}
+	go c.readLoop()
+	return
+}
+
+func (c *Conn) readLoop() {
+	defer close(c.packets)
+
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		c.packets <- strings.TrimSuffix(scanner.Text(), "\r")
+	}
+	c.readErr = scanner.Err()
+	if c.readErr == nil {
+		c.readErr = io.EOF
+	}
+}
+
+// Close closes the connection without logging off. It is called automatically when the test ends.
+func (c *Conn) Close() {
+	c.closed.Do(func() {
+		c.conn.Close()
+	})
+}
+
+// Send sends a packet. The CRLF delimiter is appended if missing.
+func (c *Conn) Send(packet string) {
+	c.t.Helper()
+
+	if !strings.HasSuffix(packet, "\r\n") {
+		packet += "\r\n"
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+	if _, err := io.WriteString(c.conn, packet); err != nil {
+		c.t.Fatalf("fsdtest: failed to send %q: %v", strings.TrimSuffix(packet, "\r\n"), err)
+	}
+}
+
+// Next returns the next packet received from the server.
+func (c *Conn) Next() string {
+	c.t.Helper()
+	return c.Expect("any packet", func(string) bool { return true })
+}
+
+// Expect returns the first received packet accepted by match, discarding packets received before it.
+// The description names the expected packet in failure messages.
+func (c *Conn) Expect(description string, match func(packet string) bool) string {
+	c.t.Helper()
+
+	var skipped []string
+	timeout := time.NewTimer(c.Timeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case packet, ok := <-c.packets:
+			if !ok {
+				c.t.Fatalf("fsdtest: connection closed (%v) while waiting for %s; received %q", c.readErr, description, skipped)
+			}
+			if match(packet) {
+				return packet
+			}
+			skipped = append(skipped, packet)
+		case <-timeout.C:
+			c.t.Fatalf("fsdtest: timed out waiting for %s; received %q", description, skipped)
+		}
+	}
+}
+
+// ExpectPrefix returns the first received packet starting with prefix.
+func (c *Conn) ExpectPrefix(prefix string) string {
+	c.t.Helper()
+	return c.Expect("packet starting with "+strconv.Quote(prefix), func(packet string) bool {
+		return strings.HasPrefix(packet, prefix)
+	})
+}
+
+// ExpectMatch returns the submatches of the first received packet matching a regular expression.
+func (c *Conn) ExpectMatch(expr string) (submatches []string) {
+	c.t.Helper()
+
+	re := regexp.MustCompile(expr)
+	c.Expect("packet matching "+strconv.Quote(expr), func(packet string) bool {
+		submatches = re.FindStringSubmatch(packet)
+		return submatches != nil
+	})
+	return
+}
+
+// ExpectError returns the first received $ER error packet, failing the test unless it carries the given error code.
+func (c *Conn) ExpectError(code int) string {
+	c.t.Helper()
+
+	packet := c.ExpectPrefix("$ER")
+	if fields := strings.Split(packet, ":"); len(fields) < 3 || fields[2] != strconv.Itoa(code) {
+		c.t.Fatalf("fsdtest: expected error code %d, got %q", code, packet)
+	}
+	return packet
+}
+
+// ExpectNothing fails the test if a packet is received within d.
+func (c *Conn) ExpectNothing(d time.Duration) {
+	c.t.Helper()
+
+	select {
+	case packet, ok := <-c.packets:
+		if ok {
+			c.t.Fatalf("fsdtest: expected no packet, received %q", packet)
+		}
+	case <-time.After(d):
+	}
+}
+
+// ExpectClosed waits for the server to close the connection, discarding any packets received before.
+func (c *Conn) ExpectClosed() {
+	c.t.Helper()
+
+	timeout := time.NewTimer(c.Timeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case _, ok := <-c.packets:
+			if !ok {
+				return
+			}
+		case <-timeout.C:
+			c.t.Fatalf("fsdtest: timed out waiting for the server to close the connection")
+		}
+	}
+}
+
+// Login describes the login packets sent by a client.
+type Login struct {
+	Callsign      string
+	CID           int
+	Password      string            // Plaintext password or FSD JWT, e.g. from Server.Token
+	NetworkRating fsd.NetworkRating // Requested network rating. Defaults to Observer.
+	ATC           bool              // Log in as a controller (#AA) rather than a pilot (#AP)
+	RealName      string            // Defaults to the callsign
+}
+
+// SendLogin reads the server's $DI ident and sends the $ID client ident and add packets.
+// The server's answer is left to be expected by the caller.
+func (c *Conn) SendLogin(login Login) {
+	c.t.Helper()
+
+	if login.NetworkRating == 0 {
+		login.NetworkRating = fsd.NetworkRatingObserver
+	}
+	if login.RealName == "" {
+		login.RealName = login.Callsign
+	}
+	cid := strconv.Itoa(login.CID)
+	rating := strconv.Itoa(int(login.NetworkRating))
+
+	if packet := c.Next(); !strings.HasPrefix(packet, "$DI") {
+		c.t.Fatalf("fsdtest: expected server ident, got %q", packet)
+	}
+	c.Send("$ID" + login.Callsign + ":SERVER:0000:fsdtest:1:0:" + cid + ":0")
+	if login.ATC {
+		c.Send("#AA" + login.Callsign + ":SERVER:" + login.RealName + ":" + cid + ":" + login.Password + ":" + rating + ":101")
+	} else {
+		c.Send("#AP" + login.Callsign + ":SERVER:" + cid + ":" + login.Password + ":" + rating + ":101:1:" + login.RealName)
+	}
+}
+
+// Login logs in and fails the test unless the server accepts the login.
+// It returns the first packet received after logging in, the server's welcome message.
+func (c *Conn) Login(login Login) (welcome string) {
+	c.t.Helper()
+
+	c.SendLogin(login)
+	if welcome = c.Next(); strings.HasPrefix(welcome, "$ER") {
+		c.t.Fatalf("fsdtest: login as %s rejected: %q", login.Callsign, welcome)
+	}
+	return
+}
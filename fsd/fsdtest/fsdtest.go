@@ -0,0 +1,253 @@
+// Package fsdtest runs an in-process openfsd server for end-to-end tests.
+//
+// A Server uses an in-memory SQLite database and accepts connections on a random local port
+// or over net.Pipe. Conn is a scripted client exchanging raw packets with the server:
+//
+//	func TestTextMessage(t *testing.T) {
+//		s := fsdtest.NewServer(t)
+//		user := s.CreateUser(fsd.NetworkRatingController1, "secret")
+//
+//		atc := s.ATC("LAX_TWR", user)
+//		pilot := s.Pilot("N123AB", user)
+//		atc.ExpectPrefix("#APN123AB:")
+//
+//		pilot.Send("#TMN123AB:LAX_TWR:ready for departure")
+//		atc.ExpectPrefix("#TMN123AB:LAX_TWR:ready")
+//	}
+//
+// Servers and connections are closed when the test ends.
+package fsdtest
+
+import (
+	"context"
+	"database/sql"
+	"github.com/renorris/openfsd/db"
+	"github.com/renorris/openfsd/fsd"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server is an in-process openfsd server.
+type Server struct {
+	FSD    *fsd.Server
+	Config *fsd.ServerConfig
+	DB     *db.Repositories
+	Addr   string // Address of the FSD listener on 127.0.0.1
+
+	t        testing.TB
+	sqlDb    *sql.DB
+	ctx      context.Context
+	cancel   context.CancelFunc
+	listener net.Listener
+	served   sync.WaitGroup // Connections being served
+	runDone  chan struct{}
+	runErr   error // Valid once runDone is closed
+	closed   sync.Once
+
+	connsLock sync.Mutex
+	conns     []*Conn
+}
+
+// NewServer starts a server with an in-memory database. It is closed when the test ends.
+//
+// The server uses the default configuration without its environment variables, except that it does not fetch
+// METARs or collect statistics and that its service HTTP server listens on a random local port.
+// The configuration can be modified by passing functions that are applied before the server is created.
+func NewServer(t testing.TB, configure ...func(cfg *fsd.ServerConfig)) (s *Server) {
+	t.Helper()
+
+	cfg, err := fsd.DefaultServerConfig()
+	if err != nil {
+		t.Fatalf("fsdtest: failed to load default config: %v", err)
+	}
+	cfg.FsdListenAddrs = nil
+	cfg.ServiceHTTPListenAddr = "127.0.0.1:0"
+	cfg.MetarProvider = fsd.MetarProviderStatic
+	cfg.StatsSampleInterval = 0
+	for _, f := range configure {
+		f(cfg)
+	}
+
+	s = &Server{
+		Config:  cfg,
+		t:       t,
+		runDone: make(chan struct{}),
+	}
+
+	if s.sqlDb, err = sql.Open("sqlite", ":memory:"); err != nil {
+		t.Fatalf("fsdtest: failed to open database: %v", err)
+	}
+	// Every connection to :memory: opens a separate database
+	s.sqlDb.SetMaxOpenConns(1)
+
+	if err = db.Migrate(s.sqlDb); err != nil {
+		s.sqlDb.Close()
+		t.Fatalf("fsdtest: failed to migrate database: %v", err)
+	}
+	if s.DB, err = db.NewRepositories(s.sqlDb); err != nil {
+		s.sqlDb.Close()
+		t.Fatalf("fsdtest: failed to create repositories: %v", err)
+	}
+	if err = db.InitDefaultConfig(&s.DB.ConfigRepo); err != nil {
+		s.sqlDb.Close()
+		t.Fatalf("fsdtest: failed to initialize config: %v", err)
+	}
+
+	if s.FSD, err = fsd.NewServer(cfg, s.DB, 1); err != nil {
+		s.sqlDb.Close()
+		t.Fatalf("fsdtest: failed to create server: %v", err)
+	}
+
+	if s.listener, err = net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		s.sqlDb.Close()
+		t.Fatalf("fsdtest: failed to listen: %v", err)
+	}
+	s.Addr = s.listener.Addr().String()
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	go func() {
+		defer close(s.runDone)
+		s.runErr = s.FSD.Run(s.ctx)
+	}()
+	go s.accept()
+
+	t.Cleanup(s.Close)
+	return
+}
+
+// accept serves connections to the listener until it is closed
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.serve(conn)
+	}
+}
+
+// serve serves the server end of a connection in a new goroutine
+func (s *Server) serve(conn net.Conn) {
+	s.served.Add(1)
+	go func() {
+		defer s.served.Done()
+		s.FSD.ServeConn(s.ctx, conn)
+	}()
+}
+
+// Close closes all connections and stops the server. It is called automatically when the test ends.
+func (s *Server) Close() {
+	s.closed.Do(func() {
+		s.cancel()
+		s.listener.Close()
+
+		s.connsLock.Lock()
+		conns := s.conns
+		s.conns = nil
+		s.connsLock.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+
+		s.served.Wait()
+		<-s.runDone
+		s.sqlDb.Close()
+
+		if s.runErr != nil {
+			s.t.Errorf("fsdtest: server stopped with error: %v", s.runErr)
+		}
+	})
+}
+
+// CreateUser creates a user with a network rating and password. The returned user holds the assigned CID.
+func (s *Server) CreateUser(rating fsd.NetworkRating, password string) (user *db.User) {
+	s.t.Helper()
+
+	user = &db.User{Password: password, NetworkRating: int(rating)}
+	if err := s.DB.UserRepo.CreateUser(user); err != nil {
+		s.t.Fatalf("fsdtest: failed to create user: %v", err)
+	}
+	return
+}
+
+// Token returns an FSD JWT, as issued by the web server's /api/v1/fsd-jwt endpoint, valid for an hour.
+func (s *Server) Token(cid int, rating fsd.NetworkRating) string {
+	s.t.Helper()
+
+	secretKey, err := s.DB.ConfigRepo.Get(db.ConfigJwtSecretKey)
+	if err != nil {
+		s.t.Fatalf("fsdtest: failed to get JWT secret key: %v", err)
+	}
+	token, err := fsd.MakeJwtToken(&fsd.CustomFields{
+		TokenType:     "fsd",
+		CID:           cid,
+		NetworkRating: rating,
+	}, time.Hour)
+	if err != nil {
+		s.t.Fatalf("fsdtest: failed to make JWT: %v", err)
+	}
+	signed, err := token.SignedString([]byte(secretKey))
+	if err != nil {
+		s.t.Fatalf("fsdtest: failed to sign JWT: %v", err)
+	}
+	return signed
+}
+
+// Dial opens a TCP connection to the server. The server's $DI ident is the first packet received.
+func (s *Server) Dial() *Conn {
+	s.t.Helper()
+
+	conn, err := net.Dial("tcp4", s.Addr)
+	if err != nil {
+		s.t.Fatalf("fsdtest: failed to dial: %v", err)
+	}
+	return s.track(conn)
+}
+
+// Pipe opens a connection to the server over net.Pipe. The server's $DI ident is the first packet received.
+func (s *Server) Pipe() *Conn {
+	clientConn, serverConn := net.Pipe()
+	s.serve(serverConn)
+	return s.track(clientConn)
+}
+
+// track wraps a client connection so that it is closed with the server
+func (s *Server) track(conn net.Conn) (c *Conn) {
+	c = newConn(s.t, conn)
+
+	s.connsLock.Lock()
+	defer s.connsLock.Unlock()
+	s.conns = append(s.conns, c)
+	return
+}
+
+// Pilot connects over net.Pipe and logs in as a pilot with the user's CID and network rating,
+// failing the test unless the server accepts the login.
+func (s *Server) Pilot(callsign string, user *db.User) *Conn {
+	s.t.Helper()
+	return s.login(callsign, user, false)
+}
+
+// ATC connects over net.Pipe and logs in as a controller with the user's CID and network rating,
+// failing the test unless the server accepts the login.
+func (s *Server) ATC(callsign string, user *db.User) *Conn {
+	s.t.Helper()
+	return s.login(callsign, user, true)
+}
+
+func (s *Server) login(callsign string, user *db.User, atc bool) (c *Conn) {
+	s.t.Helper()
+
+	rating := fsd.NetworkRating(user.NetworkRating)
+	c = s.Pipe()
+	c.Login(Login{
+		Callsign:      callsign,
+		CID:           user.CID,
+		Password:      s.Token(user.CID, rating),
+		NetworkRating: rating,
+		ATC:           atc,
+	})
+	return
+}
@@ -0,0 +1,50 @@
+package fsdtest
+
+import (
+	"github.com/renorris/openfsd/fsd"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	const metar = "KLAX 151953Z 25012KT 10SM FEW020 21/14 A2992"
+	s := NewServer(t, func(cfg *fsd.ServerConfig) {
+		cfg.MetarStaticObservations = map[string]string{"KLAX": metar}
+	})
+	user := s.CreateUser(fsd.NetworkRatingController1, "secret")
+
+	atc := s.ATC("LAX_TWR", user)
+	atc.Send("%LAX_TWR:20950:4:50:5:33.94250:-118.40810:0")
+
+	// Pilot logging in over TCP with a password
+	pilot := s.Dial()
+	if welcome := pilot.Login(Login{Callsign: "N123AB", CID: user.CID, Password: "secret"}); !strings.HasPrefix(welcome, "#TM") {
+		t.Errorf("expected welcome message, got %q", welcome)
+	}
+	atc.ExpectPrefix("#APN123AB:SERVER:")
+
+	pilot.Send("#TMN123AB:LAX_TWR:ready for departure")
+	atc.ExpectPrefix("#TMN123AB:LAX_TWR:ready for departure")
+
+	pilot.Send("@N:N123AB:1200:1:33.94000:-118.40000:100:0:0:0")
+	if fields := atc.ExpectMatch(`^@N:N123AB:1200:1:([0-9.]+):`); fields[1] != "33.94000" {
+		t.Errorf("unexpected latitude %s", fields[1])
+	}
+
+	pilot.Send("$AXN123AB:SERVER:METAR:KLAX")
+	if report := pilot.ExpectPrefix("$AR"); !strings.HasSuffix(report, metar) {
+		t.Errorf("unexpected METAR response %q", report)
+	}
+
+	// Wrong password
+	rejected := s.Pipe()
+	rejected.SendLogin(Login{Callsign: "N2", CID: user.CID, Password: "wrong"})
+	rejected.ExpectError(fsd.InvalidLogonError)
+	rejected.ExpectClosed()
+	atc.ExpectNothing(50 * time.Millisecond)
+
+	// Disconnecting is broadcast to the remaining clients
+	pilot.Close()
+	atc.ExpectPrefix("#DPN123AB")
+}
@@ -3,10 +3,11 @@ package fsd
 import (
 	"bytes"
 	"fmt"
-	"log/slog"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/renorris/openfsd/db"
 )
 
 func (s *Server) getHandler(packetType PacketType) handlerFunc {
@@ -35,6 +36,8 @@ func (s *Server) getHandler(packetType PacketType) handlerFunc {
 		return s.handleHandoff
 	case PacketTypeMetarRequest:
 		return s.handleMetarRequest
+	case PacketTypeWeatherRequest:
+		return s.handleWeatherRequest
 	case PacketTypeFlightPlan:
 		return s.handleFileFlightplan
 	case PacketTypeFlightPlanAmendment:
@@ -45,7 +48,7 @@ func (s *Server) getHandler(packetType PacketType) handlerFunc {
 }
 
 func (s *Server) emptyHandler(client *Client, packet []byte) {
-	slog.Error("empty handler called")
+	client.logger.Error("empty handler called")
 	return
 }
 
@@ -88,7 +91,7 @@ func (s *Server) handleTextMessage(client *Client, packet []byte) {
 	}
 
 	if string(recipient) == "SERVER" {
-		// TODO: handle SERVER
+		s.handleScenarioCommand(client, textMessageBody(packet))
 		return
 	}
 
@@ -104,7 +107,7 @@ func (s *Server) handleATCPosition(client *Client, packet []byte) {
 		return
 	}
 
-	if !isAllowedFacilityType(client.networkRating, int(facilityType)) {
+	if !s.ns.allowsPosition(client.networkRating, int(facilityType)) {
 		client.sendError(InvalidPositionForRatingError, "Invalid position for rating")
 		client.cancelCtx()
 		return
@@ -131,6 +134,13 @@ func (s *Server) handleATCPosition(client *Client, packet []byte) {
 	broadcastRanged(s.postOffice, client, packet)
 
 	client.lastUpdated.Store(time.Now())
+	s.federation.clientUpdated(client)
+
+	// Bring the controller up to date with aircraft state once its position is known
+	if !client.trackStateSent {
+		client.trackStateSent = true
+		s.sendTrackState(client)
+	}
 }
 
 // handlePilotPosition handles logic for 0.2hz `@` pilot position updates
@@ -159,10 +169,24 @@ func (s *Server) handlePilotPosition(client *Client, packet []byte) {
 	client.altitude.Store(int32(altitude))
 
 	pbhUint, _ := strconv.ParseUint(string(getField(packet, 8)), 10, 32)
-	_, _, heading := pitchBankHeading(uint32(pbhUint))
+	_, _, heading := PitchBankHeading(uint32(pbhUint))
 	client.heading.Store(int32(heading))
 
-	client.lastUpdated.Store(time.Now())
+	now := time.Now()
+	client.lastUpdated.Store(now)
+
+	if client.history != nil {
+		client.history.add(PositionSample{
+			Time:        now,
+			Latitude:    lat,
+			Longitude:   lon,
+			Altitude:    altitude,
+			Groundspeed: groundspeed,
+			Heading:     int(heading),
+			Squawk:      client.transponder.Load(),
+		})
+	}
+	s.federation.clientUpdated(client)
 
 	// Check if we need to update the sendfast state
 	if client.protoRevision == 101 {
@@ -238,7 +262,6 @@ func (s *Server) handleProcontroller(client *Client, packet []byte) {
 		"FA", // Set final altitude
 		"VT", // Set voice type
 		"BC", // Set beacon code
-		"HC", // Cancel handoff
 		"PT", // Pointout
 		"DP", // Push to departure list
 		"ST": // Set flight strip
@@ -248,11 +271,27 @@ func (s *Server) handleProcontroller(client *Client, packet []byte) {
 			client.sendError(InvalidControlError, "Invalid control")
 			return
 		}
+		if err := s.recordProControllerTrackState(client, packet); err != nil {
+			client.sendError(InvalidControlError, "Invalid control for "+string(getField(packet, 4))+": "+err.Error())
+			return
+		}
 		if recipient[0] == '@' {
 			broadcastRangedAtcOnly(s.postOffice, client, packet)
 		} else {
 			sendDirectOrErr(s.postOffice, client, recipient, packet)
 		}
+
+	case "HC": // Cancel handoff
+		if client.facilityType <= 0 || countFields(packet) < 5 {
+			client.sendError(InvalidControlError, "Invalid control")
+			return
+		}
+		targetCallsign := string(getField(packet, 4))
+		if err := s.cancelHandoff(client.callsign, string(recipient), targetCallsign); err != nil {
+			client.sendError(InvalidControlError, "Invalid handoff for "+targetCallsign+": "+err.Error())
+			return
+		}
+		sendDirectOrErr(s.postOffice, client, recipient, packet)
 	}
 }
 
@@ -269,6 +308,8 @@ func (s *Server) handleClientQuery(client *Client, packet []byte) {
 			s.handleClientQueryIPRequest(client, packet)
 		case "FP":
 			s.handleClientQueryFlightplanRequest(client, packet)
+		case "BC":
+			s.handleClientQueryBeaconCodeRequest(client, packet)
 		}
 		return
 	}
@@ -311,6 +352,10 @@ func (s *Server) handleClientQuery(client *Client, packet []byte) {
 			client.sendError(InvalidControlError, "Invalid control")
 			return
 		}
+		if err := s.recordClientQueryTrackState(client, packet); err != nil {
+			client.sendError(InvalidControlError, "Invalid control for "+string(getField(packet, 3))+": "+err.Error())
+			return
+		}
 		forwardClientQuery(s.postOffice, client, packet)
 
 	// Allow aircraft configuration queries from any client
@@ -357,8 +402,7 @@ func (s *Server) handleClientQueryATCRequest(client *Client, packet []byte) {
 }
 
 func (s *Server) handleClientQueryIPRequest(client *Client, packet []byte) {
-	ip := strings.SplitN(client.conn.RemoteAddr().String(), ":", 2)[0]
-	p := fmt.Sprintf("$CRSERVER:%s:IP:%s\r\n", client.callsign, ip)
+	p := fmt.Sprintf("$CRSERVER:%s:IP:%s\r\n", client.callsign, client.transport.remoteIP())
 	client.send(p)
 }
 
@@ -384,13 +428,13 @@ func (s *Server) handleClientQueryFlightplanRequest(client *Client, packet []byt
 		return
 	}
 
-	beaconCode := targetClient.assignedBeaconCode.Load()
-	if beaconCode == "" {
-		beaconCode = "0"
+	beaconCode := "0"
+	if state, ok := s.tracks.get(targetCallsign); ok && state.beaconCode != "" {
+		beaconCode = state.beaconCode
 	}
 
 	// Send flightplan packet
-	fplPacket := buildFileFlightplanPacket(targetCallsign, "*A", fplInfo)
+	fplPacket := BuildFileFlightplanPacket(targetCallsign, "*A", fplInfo)
 	client.send(fplPacket)
 
 	// Send assigned beacon code
@@ -400,16 +444,70 @@ func (s *Server) handleClientQueryFlightplanRequest(client *Client, packet []byt
 	// TODO: research any other data that should be sent here
 }
 
+// handleClientQueryBeaconCodeRequest allocates a transponder code to an aircraft on behalf of a controller.
+// The assigned code is broadcast to in-range ATC as a #PC BC packet.
+func (s *Server) handleClientQueryBeaconCodeRequest(client *Client, packet []byte) {
+	if !client.isAtc || client.facilityType <= 0 {
+		client.sendError(InvalidControlError, "Invalid control")
+		return
+	}
+
+	if countFields(packet) != 4 {
+		client.sendError(SyntaxError, "Invalid beacon code request syntax")
+		return
+	}
+
+	targetCallsign := string(getField(packet, 3))
+	targetClient, err := s.postOffice.find(targetCallsign)
+	if err != nil || targetClient.isAtc {
+		client.sendError(NoSuchCallsignError, "No such callsign: "+targetCallsign)
+		return
+	}
+
+	ranges, err := parseTransponderCodeRanges(db.GetTransponderCodeRanges(&s.dbRepo.ConfigRepo))
+	if err != nil {
+		client.logger.Error("invalid transponder code range configuration", "error", err)
+	}
+	codeRange := selectTransponderCodeRange(ranges, client.callsign, client.facilityType)
+
+	beaconCode, err := s.allocateTransponderCode(targetCallsign, codeRange)
+	if err != nil {
+		client.sendError(InvalidControlError, "Unable to assign beacon code for "+targetCallsign+": "+err.Error())
+		return
+	}
+
+	client.send(buildBeaconCodePacket("server", client.callsign, targetCallsign, beaconCode))
+	broadcastRangedAtcOnly(s.postOffice, client, []byte(buildBeaconCodePacket("server", "@94835", targetCallsign, beaconCode)))
+}
+
+// handleMetarRequest handles logic for METAR and TAF `$AX` requests
 func (s *Server) handleMetarRequest(client *Client, packet []byte) {
 	recipient := getField(packet, 1)
-	staticField := getField(packet, 2)
+	reportType := getField(packet, 2)
 	icaoCode := getField(packet, 3)
 
-	if string(recipient) != "SERVER" || string(staticField) != "METAR" {
+	if string(recipient) != "SERVER" {
 		return
 	}
 
-	s.metarService.fetchAndSendMetar(client.ctx, client, string(icaoCode))
+	switch string(reportType) {
+	case "METAR":
+		s.metarService.fetchAndSendMetar(client, string(icaoCode))
+	case "TAF":
+		s.metarService.fetchAndSendTaf(client, string(icaoCode))
+	}
+}
+
+// handleWeatherRequest handles logic for classic FSD weather profile `#WX` requests
+func (s *Server) handleWeatherRequest(client *Client, packet []byte) {
+	icaoCode := string(getField(packet, 2))
+
+	staticProfiles, err := parseStaticWeatherProfiles(db.GetWeatherProfiles(&s.dbRepo.ConfigRepo))
+	if err != nil {
+		client.logger.Error("invalid static weather profile configuration", "error", err)
+	}
+
+	s.metarService.fetchAndSendWeatherProfile(client, icaoCode, staticProfiles)
 }
 
 func (s *Server) handleKillRequest(client *Client, packet []byte) {
@@ -426,6 +524,8 @@ func (s *Server) handleKillRequest(client *Client, packet []byte) {
 	}
 
 	// Closing the context of the victim client will eventually cause it to disconnect
+	victim.logger.Info("client kicked", "by", client.callsign)
+	s.auditKill(client, victim)
 	victim.cancelCtx()
 }
 
@@ -456,14 +556,33 @@ func (s *Server) handleHandoff(client *Client, packet []byte) {
 	}
 
 	recipient := getField(packet, 1)
+	targetCallsign := string(getField(packet, 2))
+
+	if recipientClient, err := s.postOffice.find(string(recipient)); err != nil || !recipientClient.isAtc {
+		client.sendError(NoSuchCallsignError, "No such callsign")
+		return
+	}
+
+	var err error
+	if getPacketType(packet) == PacketTypeHandoffRequest {
+		err = s.requestHandoff(client.callsign, string(recipient), targetCallsign)
+	} else {
+		err = s.acceptHandoff(client.callsign, string(recipient), targetCallsign)
+	}
+	if err != nil {
+		client.sendError(InvalidControlError, "Invalid handoff for "+targetCallsign+": "+err.Error())
+		return
+	}
+
 	sendDirectOrErr(s.postOffice, client, recipient, packet)
 }
 
 func (s *Server) handleFileFlightplan(client *Client, packet []byte) {
 	fplInfo := extractFlightplanInfoSection(packet)
 	client.flightPlan.Store(fplInfo)
+	s.federation.flightPlanUpdated(client)
 
-	broadcastPacket := buildFileFlightplanPacket(client.callsign, "*A", fplInfo)
+	broadcastPacket := BuildFileFlightplanPacket(client.callsign, "*A", fplInfo)
 	broadcastAllATC(s.postOffice, client, []byte(broadcastPacket))
 }
 
@@ -481,7 +600,8 @@ func (s *Server) handleAmendFlightplan(client *Client, packet []byte) {
 		return
 	}
 	targetClient.flightPlan.Store(fplInfo)
+	s.federation.flightPlanUpdated(targetClient)
 
-	broadcastPacket := buildAmendFlightplanPacket(client.callsign, "*A", targetCallsign, fplInfo)
+	broadcastPacket := BuildAmendFlightplanPacket(client.callsign, "*A", targetCallsign, fplInfo)
 	broadcastAllATC(s.postOffice, client, []byte(broadcastPacket))
 }
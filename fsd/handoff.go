@@ -0,0 +1,114 @@
+package fsd
+
+import (
+	"errors"
+	"time"
+)
+
+// handoffStatus is the status of a handoff of an aircraft between two controllers
+type handoffStatus string
+
+const (
+	handoffRequested handoffStatus = "requested"
+	handoffAccepted  handoffStatus = "accepted"
+	handoffCancelled handoffStatus = "cancelled"
+	handoffExpired   handoffStatus = "expired"
+)
+
+// handoffState is a handoff of an aircraft between two controllers
+type handoffState struct {
+	from    string // Controller handing off the aircraft
+	to      string // Controller receiving the aircraft
+	status  handoffStatus
+	expires time.Time // When a requested handoff expires. Zero if it never expires.
+}
+
+var (
+	ErrNotTrackingAircraft      = errors.New("not tracking aircraft")
+	ErrNoPendingHandoff         = errors.New("no pending handoff")
+	ErrHandoffExpired           = errors.New("handoff expired")
+	ErrTrackedByOtherController = errors.New("tracked by another controller")
+)
+
+// currentStatus returns the status of the handoff at a given time, accounting for expiry.
+func (h *handoffState) currentStatus(now time.Time) handoffStatus {
+	if h.status == handoffRequested && !h.expires.IsZero() && now.After(h.expires) {
+		return handoffExpired
+	}
+	return h.status
+}
+
+// pending returns whether the handoff is awaiting a response at a given time.
+func (h *handoffState) pending(now time.Time) bool {
+	return h.currentStatus(now) == handoffRequested
+}
+
+// involves returns whether a given controller is a party to a requested handoff.
+func (h *handoffState) involves(callsign string) bool {
+	return h.status == handoffRequested && (h.from == callsign || h.to == callsign)
+}
+
+// requestHandoff records a handoff request. The requesting controller must be tracking the aircraft.
+func (s *Server) requestHandoff(from, to, targetCallsign string) error {
+	return s.tracks.update(targetCallsign, func(state *aircraftState) error {
+		if state.trackingController != from {
+			return ErrNotTrackingAircraft
+		}
+
+		state.handoff = handoffState{from: from, to: to, status: handoffRequested}
+		if s.cfg.HandoffTimeout > 0 {
+			state.handoff.expires = time.Now().Add(s.cfg.HandoffTimeout)
+		}
+		return nil
+	})
+}
+
+// acceptHandoff accepts a pending handoff request, transferring the track to the accepting controller.
+func (s *Server) acceptHandoff(accepter, from, targetCallsign string) error {
+	return s.tracks.update(targetCallsign, func(state *aircraftState) error {
+		if state.handoff.from != from {
+			return ErrNoPendingHandoff
+		}
+		return state.acceptHandoff(accepter, time.Now())
+	})
+}
+
+// acceptHandoff transfers the track to the accepting controller if a handoff to it is pending.
+func (state *aircraftState) acceptHandoff(accepter string, now time.Time) error {
+	if state.handoff.status != handoffRequested || state.handoff.to != accepter {
+		return ErrNoPendingHandoff
+	}
+	if !state.handoff.pending(now) {
+		return ErrHandoffExpired
+	}
+
+	state.handoff.status = handoffAccepted
+	state.trackingController = accepter
+	return nil
+}
+
+// cancelHandoff cancels a pending handoff request.
+func (s *Server) cancelHandoff(from, to, targetCallsign string) error {
+	return s.tracks.update(targetCallsign, func(state *aircraftState) error {
+		if !state.handoff.pending(time.Now()) || state.handoff.from != from || state.handoff.to != to {
+			return ErrNoPendingHandoff
+		}
+
+		state.handoff.status = handoffCancelled
+		return nil
+	})
+}
+
+// onlineUserHandoff returns the most recent handoff of an aircraft, or nil if it has none.
+func (s *Server) onlineUserHandoff(callsign string) *OnlineUserHandoff {
+	state, ok := s.tracks.get(callsign)
+	if !ok || state.handoff.status == "" {
+		return nil
+	}
+
+	return &OnlineUserHandoff{
+		From:   state.handoff.from,
+		To:     state.handoff.to,
+		Status: string(state.handoff.currentStatus(time.Now())),
+	}
+}
@@ -0,0 +1,152 @@
+package fsd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHandoff_StateMachine verifies handoff request, accept and cancel transitions.
+func TestHandoff_StateMachine(t *testing.T) {
+	tests := []struct {
+		name       string
+		steps      func(s *Server) error
+		wantErr    error
+		wantStatus handoffStatus
+		wantTrack  string
+	}{
+		{
+			name:       "Request",
+			steps:      func(s *Server) error { return s.requestHandoff("SCT_APP", "LAX_CTR", "ROU1887") },
+			wantStatus: handoffRequested,
+			wantTrack:  "SCT_APP",
+		},
+		{
+			name:      "Request without track",
+			steps:     func(s *Server) error { return s.requestHandoff("LAX_CTR", "SCT_APP", "ROU1887") },
+			wantErr:   ErrNotTrackingAircraft,
+			wantTrack: "SCT_APP",
+		},
+		{
+			name: "Accept",
+			steps: func(s *Server) error {
+				if err := s.requestHandoff("SCT_APP", "LAX_CTR", "ROU1887"); err != nil {
+					return err
+				}
+				return s.acceptHandoff("LAX_CTR", "SCT_APP", "ROU1887")
+			},
+			wantStatus: handoffAccepted,
+			wantTrack:  "LAX_CTR",
+		},
+		{
+			name:      "Accept without request",
+			steps:     func(s *Server) error { return s.acceptHandoff("LAX_CTR", "SCT_APP", "ROU1887") },
+			wantErr:   ErrNoPendingHandoff,
+			wantTrack: "SCT_APP",
+		},
+		{
+			name: "Accept by wrong controller",
+			steps: func(s *Server) error {
+				if err := s.requestHandoff("SCT_APP", "LAX_CTR", "ROU1887"); err != nil {
+					return err
+				}
+				return s.acceptHandoff("SAN_TWR", "SCT_APP", "ROU1887")
+			},
+			wantErr:    ErrNoPendingHandoff,
+			wantStatus: handoffRequested,
+			wantTrack:  "SCT_APP",
+		},
+		{
+			name: "Accept expired",
+			steps: func(s *Server) error {
+				if err := s.requestHandoff("SCT_APP", "LAX_CTR", "ROU1887"); err != nil {
+					return err
+				}
+				s.tracks.update("ROU1887", func(state *aircraftState) error {
+					state.handoff.expires = time.Now().Add(-time.Second)
+					return nil
+				})
+				return s.acceptHandoff("LAX_CTR", "SCT_APP", "ROU1887")
+			},
+			wantErr:    ErrHandoffExpired,
+			wantStatus: handoffExpired,
+			wantTrack:  "SCT_APP",
+		},
+		{
+			name: "Cancel",
+			steps: func(s *Server) error {
+				if err := s.requestHandoff("SCT_APP", "LAX_CTR", "ROU1887"); err != nil {
+					return err
+				}
+				return s.cancelHandoff("SCT_APP", "LAX_CTR", "ROU1887")
+			},
+			wantStatus: handoffCancelled,
+			wantTrack:  "SCT_APP",
+		},
+		{
+			name: "Accept cancelled",
+			steps: func(s *Server) error {
+				if err := s.requestHandoff("SCT_APP", "LAX_CTR", "ROU1887"); err != nil {
+					return err
+				}
+				if err := s.cancelHandoff("SCT_APP", "LAX_CTR", "ROU1887"); err != nil {
+					return err
+				}
+				return s.acceptHandoff("LAX_CTR", "SCT_APP", "ROU1887")
+			},
+			wantErr:    ErrNoPendingHandoff,
+			wantStatus: handoffCancelled,
+			wantTrack:  "SCT_APP",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, atc1, _ := newTrackStateTestServer(t)
+			s.recordClientQueryTrackState(atc1.Client, []byte("$CQSCT_APP:@94835:IT:ROU1887\r\n"))
+
+			if err := tt.steps(s); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			state, _ := s.tracks.get("ROU1887")
+			if status := state.handoff.currentStatus(time.Now()); status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q", tt.wantStatus, status)
+			}
+			if state.trackingController != tt.wantTrack {
+				t.Errorf("expected tracking controller %q, got %q", tt.wantTrack, state.trackingController)
+			}
+		})
+	}
+}
+
+// TestHandleHandoff verifies that handoff packets are validated before being forwarded.
+func TestHandleHandoff(t *testing.T) {
+	s, _, atc1, atc2 := newTrackStateTestServer(t)
+	s.recordClientQueryTrackState(atc1.Client, []byte("$CQSCT_APP:@94835:IT:ROU1887\r\n"))
+
+	// LAX_CTR does not track the aircraft
+	s.handleHandoff(atc2.Client, []byte("$HOLAX_CTR:SCT_APP:ROU1887\r\n"))
+	packets := atc2.collectPackets()
+	if len(packets) != 1 || !strings.HasPrefix(packets[0], "$ERserver:unknown:14::") {
+		t.Fatalf("expected invalid control error, got %q", packets)
+	}
+	if packets := atc1.collectPackets(); len(packets) != 0 {
+		t.Fatalf("expected nothing forwarded, got %q", packets)
+	}
+
+	s.handleHandoff(atc1.Client, []byte("$HOSCT_APP:LAX_CTR:ROU1887\r\n"))
+	if packets := atc2.collectPackets(); len(packets) != 1 || packets[0] != "$HOSCT_APP:LAX_CTR:ROU1887\r\n" {
+		t.Fatalf("expected handoff request forwarded, got %q", packets)
+	}
+
+	s.handleHandoff(atc2.Client, []byte("$HALAX_CTR:SCT_APP:ROU1887\r\n"))
+	if packets := atc1.collectPackets(); len(packets) != 1 || packets[0] != "$HALAX_CTR:SCT_APP:ROU1887\r\n" {
+		t.Fatalf("expected handoff accept forwarded, got %q", packets)
+	}
+
+	handoff := s.onlineUserHandoff("ROU1887")
+	if handoff == nil || *handoff != (OnlineUserHandoff{From: "SCT_APP", To: "LAX_CTR", Status: "accepted"}) {
+		t.Errorf("unexpected online user handoff %+v", handoff)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/renorris/openfsd/db"
 	"log/slog"
 	"maps"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -17,18 +18,31 @@ import (
 // internal communication between the API HTTP server and this FSD server.
 func (s *Server) runServiceHTTP(ctx context.Context) {
 	e := s.setupRoutes()
-	if err := e.Run(s.cfg.ServiceHTTPListenAddr); err != nil {
-		slog.Error(err.Error())
+	listener, err := s.restart.listen(ctx, s.cfg.ServiceHTTPListenAddr)
+	if err != nil {
+		slog.Error("service HTTP server failed", "error", err)
+		return
+	}
+	// The listener is closed once a new process takes over
+	if err = e.RunListener(listener); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Error("service HTTP server failed", "error", err)
 	}
 }
 
 func (s *Server) setupRoutes() (e *gin.Engine) {
 	e = gin.New()
 
+	// Prometheus metrics use their own bearer token
+	e.GET("/metrics", s.metricsAuthMiddleware, s.handleGetMetrics())
+
 	// Verify administrator service JWT
 	e.Use(s.authMiddleware)
-	e.GET("/online_users", s.handleGetOnlineUsers)
-	e.POST("/kick_user", s.handleKickUser)
+	e.GET("/namespaces", s.handleGetNamespaces)
+	e.GET("/online_users", s.namespaced((*Server).handleGetOnlineUsers))
+	e.POST("/kick_user", s.namespaced((*Server).handleKickUser))
+	e.GET("/metar/:icao", s.handleGetMetar)
+	e.GET("/squawk_alerts", s.namespaced((*Server).handleGetSquawkAlerts))
+	e.GET("/track/:callsign", s.namespaced((*Server).handleGetTrack))
 
 	return
 }
@@ -42,7 +56,7 @@ func (s *Server) authMiddleware(c *gin.Context) {
 
 	jwtSecret, err := s.dbRepo.ConfigRepo.Get(db.ConfigJwtSecretKey)
 	if err != nil {
-		slog.Error(err.Error())
+		slog.Error("error loading JWT secret key", "error", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
@@ -76,10 +90,21 @@ type OnlineUserGeneralData struct {
 
 type OnlineUserPilot struct {
 	OnlineUserGeneralData
-	Altitude    int    `json:"altitude"`
-	Groundspeed int    `json:"groundspeed"`
-	Heading     int    `json:"heading"`
-	Transponder string `json:"transponder"`
+	Altitude    int     `json:"altitude"`
+	Groundspeed int     `json:"groundspeed"`
+	Heading     int     `json:"heading"`
+	Transponder string  `json:"transponder"`
+	QnhIHg      float64 `json:"qnh_i_hg"` // Altimeter setting at the nearest reporting station
+	QnhMb       int     `json:"qnh_mb"`   // Altimeter setting at the nearest reporting station
+
+	AssignedTransponder string             `json:"assigned_transponder,omitempty"` // Transponder code assigned by ATC
+	Handoff             *OnlineUserHandoff `json:"handoff,omitempty"`              // Most recent handoff between controllers
+}
+
+type OnlineUserHandoff struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Status string `json:"status"` // requested, accepted, cancelled or expired
 }
 
 type OnlineUserATC struct {
@@ -111,6 +136,10 @@ func (s *Server) handleGetOnlineUsers(c *gin.Context) {
 	}
 
 	for _, client := range clientMap {
+		if client.hidden {
+			continue
+		}
+
 		latLon := client.latLon()
 		genData := OnlineUserGeneralData{
 			Callsign:         client.callsign,
@@ -139,7 +168,17 @@ func (s *Server) handleGetOnlineUsers(c *gin.Context) {
 				Groundspeed:           int(client.groundspeed.Load()),
 				Heading:               int(client.heading.Load()),
 				Transponder:           client.transponder.Load(),
+				QnhIHg:                29.92,
+				QnhMb:                 1013,
+			}
+			if qnhInHg, qnhMb, ok := s.nearestQnh(latLon[0], latLon[1]); ok {
+				pilot.QnhIHg = qnhInHg
+				pilot.QnhMb = qnhMb
+			}
+			if state, ok := s.tracks.get(client.callsign); ok {
+				pilot.AssignedTransponder = state.beaconCode
 			}
+			pilot.Handoff = s.onlineUserHandoff(client.callsign)
 			resData.Pilots = append(resData.Pilots, pilot)
 		}
 	}
@@ -157,6 +196,7 @@ func (s *Server) handleKickUser(c *gin.Context) {
 	var reqBody RequestBody
 	if err := c.ShouldBindJSON(&reqBody); err != nil {
 		c.AbortWithStatus(http.StatusBadRequest)
+		return
 	}
 
 	client, err := s.postOffice.find(reqBody.Callsign)
@@ -170,7 +210,99 @@ func (s *Server) handleKickUser(c *gin.Context) {
 	}
 
 	// Cancelling the context will cause the client's event loop to close
+	client.logger.Info("client kicked", "by", "service_api")
 	client.cancelCtx()
 
 	c.AbortWithStatus(http.StatusNoContent)
 }
+
+// MetarResponseData is a decoded METAR observation returned by the service HTTP API.
+type MetarResponseData struct {
+	Metar
+	AltimeterHpa           int     `json:"altimeter_hpa"`
+	VisibilityStatuteMiles float64 `json:"visibility_statute_miles"`
+}
+
+func (s *Server) handleGetMetar(c *gin.Context) {
+	icaoCode := strings.ToUpper(c.Param("icao"))
+
+	type fetchResult struct {
+		report string
+		err    error
+	}
+	resultChan := make(chan fetchResult, 1)
+	s.metarService.fetch(weatherKey{weatherReportMetar, icaoCode}, func(report string, err error) {
+		resultChan <- fetchResult{report, err}
+	})
+
+	var result fetchResult
+	select {
+	case result = <-resultChan:
+	case <-c.Request.Context().Done():
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+
+	if result.err != nil {
+		switch {
+		case errors.Is(result.err, ErrMetarNotFound):
+			c.AbortWithStatus(http.StatusNotFound)
+		case errors.Is(result.err, ErrMetarServiceBusy):
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+		default:
+			c.AbortWithStatus(http.StatusBadGateway)
+		}
+		return
+	}
+
+	metar, err := ParseMetar(result.report)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+
+	resData := MetarResponseData{
+		Metar:                  *metar,
+		AltimeterHpa:           metar.AltimeterHpa(),
+		VisibilityStatuteMiles: metar.VisibilityStatuteMiles(),
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	json.NewEncoder(c.Writer).Encode(&resData)
+}
+
+type SquawkAlertsResponseData struct {
+	Alerts []SquawkAlert `json:"alerts"`
+}
+
+func (s *Server) handleGetSquawkAlerts(c *gin.Context) {
+	resData := SquawkAlertsResponseData{
+		Alerts: s.squawks.activeAlerts(),
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	json.NewEncoder(c.Writer).Encode(&resData)
+}
+
+// handleGetTrack exports the recorded track of a connected pilot.
+// The format query parameter selects geojson (default), kml or gpx.
+func (s *Server) handleGetTrack(c *gin.Context) {
+	format := c.DefaultQuery("format", TrackFormatGeoJSON)
+	contentType, err := trackContentType(format)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	client, err := s.postOffice.find(c.Param("callsign"))
+	if err != nil || client.history == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", contentType)
+	c.Writer.WriteHeader(http.StatusOK)
+	writeTrack(c.Writer, format, client.callsign, client.history.snapshot())
+}
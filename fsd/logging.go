@@ -0,0 +1,61 @@
+package fsd
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Log output formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+var ErrInvalidLogFormat = errors.New("invalid log format")
+
+// newLogger creates a logger writing to w in the configured format and at the configured level.
+func newLogger(w io.Writer, cfg *ServerConfig) (logger *slog.Logger, err error) {
+	level := slog.LevelInfo
+	if cfg.LogLevel != "" {
+		if err = level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+			return
+		}
+	}
+	if cfg.LogDebug {
+		level = slog.LevelDebug
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.LogFormat) {
+	case LogFormatText, "":
+		logger = slog.New(slog.NewTextHandler(w, opts))
+	case LogFormatJSON:
+		logger = slog.New(slog.NewJSONHandler(w, opts))
+	default:
+		err = ErrInvalidLogFormat
+	}
+	return
+}
+
+// connLogger returns a logger annotated with the connection ID and remote IP of a new connection.
+// Connections to namespaces other than the default are also annotated with the namespace.
+func (s *Server) connLogger(connID uint64, remoteIP string) *slog.Logger {
+	logger := slog.Default().With(
+		slog.Uint64("conn_id", connID),
+		slog.String("remote_ip", remoteIP),
+	)
+	if s.ns != nil && s.ns.Name != DefaultNamespace {
+		logger = logger.With(slog.String("namespace", s.ns.Name))
+	}
+	return logger
+}
+
+// withLoginData annotates a connection logger with the callsign and CID sent by the client.
+func withLoginData(logger *slog.Logger, data *loginData) *slog.Logger {
+	return logger.With(
+		slog.String("callsign", data.callsign),
+		slog.Int("cid", data.cid),
+	)
+}
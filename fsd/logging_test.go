@@ -0,0 +1,55 @@
+package fsd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         ServerConfig
+		expectErr   error
+		expectDebug bool
+		expectJSON  bool
+	}{
+		{"defaults", ServerConfig{}, nil, false, false},
+		{"json", ServerConfig{LogFormat: "json", LogLevel: "info"}, nil, false, true},
+		{"debug level", ServerConfig{LogFormat: "text", LogLevel: "debug"}, nil, true, false},
+		{"deprecated debug flag", ServerConfig{LogLevel: "warn", LogDebug: true}, nil, true, false},
+		{"unknown format", ServerConfig{LogFormat: "xml"}, ErrInvalidLogFormat, false, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			logger, err := newLogger(&buf, &tc.cfg)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			logger.Debug("debug message")
+			if got := strings.Contains(buf.String(), "debug message"); got != tc.expectDebug {
+				t.Errorf("expected debug output %v, got %q", tc.expectDebug, buf.String())
+			}
+
+			buf.Reset()
+			logger.Info("info message", "callsign", "DAL1")
+			entry := map[string]any{}
+			isJSON := json.Unmarshal(buf.Bytes(), &entry) == nil
+			if isJSON != tc.expectJSON {
+				t.Errorf("expected JSON output %v, got %q", tc.expectJSON, buf.String())
+			}
+		})
+	}
+
+	if _, err := newLogger(&bytes.Buffer{}, &ServerConfig{LogLevel: "loud"}); err == nil {
+		t.Error("expected error for unknown log level")
+	}
+}
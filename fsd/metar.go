@@ -1,30 +1,70 @@
 package fsd
 
 import (
-	"bytes"
 	"context"
-	"fmt"
-	"io"
-	"net/http"
+	"errors"
+	"log/slog"
 	"strings"
+	"sync"
+	"time"
 )
 
 type metarService struct {
-	numWorkers    int
-	httpClient    *http.Client
-	metarRequests chan metarRequest
+	numWorkers       int
+	provider         MetarProvider
+	fetchTimeout     time.Duration   // Maximum duration of a single provider fetch. Zero disables the timeout.
+	cacheTTL         time.Duration   // How long successful reports are cached
+	negativeCacheTTL time.Duration   // How long failed lookups are cached
+	metarRequests    chan weatherKey // Queue of reports to fetch
+
+	lock     sync.Mutex
+	cache    map[weatherKey]metarCacheEntry        // Cached results
+	inflight map[weatherKey][]weatherResultHandler // Handlers waiting on an in-flight fetch
 }
 
-type metarRequest struct {
-	client   *Client
-	icaoCode string
+// weatherReportType is the type of weather report fetched from a MetarProvider
+type weatherReportType int
+
+const (
+	weatherReportMetar weatherReportType = iota
+	weatherReportTaf
+)
+
+func (t weatherReportType) String() string {
+	if t == weatherReportTaf {
+		return "taf"
+	}
+	return "metar"
 }
 
-func newMetarService(numWorkers int) *metarService {
+// weatherKey identifies a single weather report
+type weatherKey struct {
+	reportType weatherReportType
+	icaoCode   string
+}
+
+// weatherResultHandler is called once a requested weather report is available
+type weatherResultHandler func(report string, err error)
+
+type metarCacheEntry struct {
+	report  string
+	err     error
+	expires time.Time
+}
+
+// ErrMetarServiceBusy is returned when the METAR fetch queue is full.
+var ErrMetarServiceBusy = errors.New("metar: service busy")
+
+func newMetarService(numWorkers int, provider MetarProvider, fetchTimeout, cacheTTL, negativeCacheTTL time.Duration) *metarService {
 	return &metarService{
-		numWorkers:    numWorkers,
-		httpClient:    &http.Client{},
-		metarRequests: make(chan metarRequest, 128),
+		numWorkers:       numWorkers,
+		provider:         provider,
+		fetchTimeout:     fetchTimeout,
+		cacheTTL:         cacheTTL,
+		negativeCacheTTL: negativeCacheTTL,
+		metarRequests:    make(chan weatherKey, 128),
+		cache:            make(map[weatherKey]metarCacheEntry, 256),
+		inflight:         make(map[weatherKey][]weatherResultHandler, 32),
 	}
 }
 
@@ -32,6 +72,7 @@ func (s *metarService) run(ctx context.Context) {
 	for range s.numWorkers {
 		go s.worker(ctx)
 	}
+	go s.cacheJanitor(ctx)
 }
 
 func (s *metarService) worker(ctx context.Context) {
@@ -39,47 +80,193 @@ func (s *metarService) worker(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case req := <-s.metarRequests:
-			s.handleMetarRequest(&req)
+		case key := <-s.metarRequests:
+			s.handleMetarRequest(ctx, key)
 		}
 	}
 }
 
-func (s *metarService) handleMetarRequest(req *metarRequest) {
-	url := buildMetarRequestURL(req.icaoCode)
-	res, err := s.httpClient.Get(url)
-	if err != nil {
-		sendMetarServiceError(req)
+// cacheJanitor periodically evicts expired cache entries
+func (s *metarService) cacheJanitor(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.lock.Lock()
+			for key, entry := range s.cache {
+				if now.After(entry.expires) {
+					delete(s.cache, key)
+				}
+			}
+			s.lock.Unlock()
+		}
+	}
+}
+
+// handleMetarRequest fetches a report from the provider and
+// distributes the result to every handler waiting on it.
+func (s *metarService) handleMetarRequest(ctx context.Context, key weatherKey) {
+	fetchCtx, cancel := ctx, func() {}
+	if s.fetchTimeout > 0 {
+		fetchCtx, cancel = context.WithTimeout(ctx, s.fetchTimeout)
+	}
+	start := time.Now()
+	report, err := s.fetchReport(fetchCtx, key)
+	cancel()
+	recordMetarFetch(key.reportType, time.Since(start).Seconds(), err)
+	if err != nil && !errors.Is(err, ErrMetarNotFound) {
+		slog.Warn("weather report fetch failed", "icao", key.icaoCode, "report", key.reportType.String(), "error", err)
+	}
+
+	s.complete(key, report, err, true)
+}
+
+func (s *metarService) fetchReport(ctx context.Context, key weatherKey) (report string, err error) {
+	switch key.reportType {
+	case weatherReportTaf:
+		tafProvider, ok := s.provider.(TafProvider)
+		if !ok {
+			err = ErrMetarNotFound
+			return
+		}
+		return tafProvider.FetchTaf(ctx, key.icaoCode)
+	default:
+		return s.provider.FetchMetar(ctx, key.icaoCode)
+	}
+}
+
+// complete resolves an in-flight fetch, optionally caching the result.
+func (s *metarService) complete(key weatherKey, report string, err error, cacheable bool) {
+	s.lock.Lock()
+	if cacheable {
+		ttl := s.cacheTTL
+		if err != nil {
+			ttl = s.negativeCacheTTL
+		}
+		if ttl > 0 {
+			s.cache[key] = metarCacheEntry{report: report, err: err, expires: time.Now().Add(ttl)}
+		}
+	}
+	handlers := s.inflight[key]
+	delete(s.inflight, key)
+	s.lock.Unlock()
+
+	for _, handler := range handlers {
+		handler(report, err)
+	}
+}
+
+// fetch obtains a weather report and calls handler once it is available.
+//
+// Cached reports are handled immediately. Concurrent requests for the same report are
+// merged into a single provider fetch. This function never blocks on the fetch queue:
+// if the queue is full, handler is called with ErrMetarServiceBusy.
+func (s *metarService) fetch(key weatherKey, handler weatherResultHandler) {
+	if !isValidIcaoCode(key.icaoCode) {
+		handler("", ErrMetarNotFound)
 		return
 	}
-	if res.StatusCode != http.StatusOK {
-		sendMetarServiceError(req)
+
+	s.lock.Lock()
+	if entry, ok := s.cache[key]; ok && time.Now().Before(entry.expires) {
+		s.lock.Unlock()
+		handler(entry.report, entry.err)
 		return
 	}
 
-	bufBytes := make([]byte, 512)
-	buf := bytes.NewBuffer(bufBytes)
-	if _, err = io.Copy(buf, res.Body); err != nil {
-		sendMetarServiceError(req)
+	// Join an in-flight fetch if one exists
+	if handlers, ok := s.inflight[key]; ok {
+		s.inflight[key] = append(handlers, handler)
+		s.lock.Unlock()
 		return
 	}
+	s.inflight[key] = []weatherResultHandler{handler}
+	s.lock.Unlock()
 
-	resBody := buf.Bytes()
+	select {
+	case s.metarRequests <- key:
+	default:
+		s.complete(key, "", ErrMetarServiceBusy, false)
+	}
+}
 
-	if bytes.Count(resBody, []byte("\n")) != 2 {
-		fmt.Println("NOAA METAR response was invalid")
-		sendMetarServiceError(req)
+// cachedMetar returns the cached METAR for a given ICAO code without waiting on a fetch.
+// If no report is cached, a background fetch is started so that it is available to later calls.
+func (s *metarService) cachedMetar(icaoCode string) (metar string, ok bool) {
+	key := weatherKey{weatherReportMetar, icaoCode}
+
+	s.lock.Lock()
+	entry, found := s.cache[key]
+	s.lock.Unlock()
+
+	if found && time.Now().Before(entry.expires) {
+		return entry.report, entry.err == nil
+	}
+
+	s.fetch(key, func(string, error) {})
+	return
+}
+
+// fetchAndSendMetar fetches a METAR observation for a given ICAO code and sends it to the client once received.
+// This function never blocks on the fetch.
+func (s *metarService) fetchAndSendMetar(client *Client, icaoCode string) {
+	s.fetch(weatherKey{weatherReportMetar, icaoCode}, func(metar string, err error) {
+		if err != nil {
+			sendMetarServiceError(client, icaoCode)
+			return
+		}
+		client.send(buildMetarResponsePacket(client.callsign, []byte(metar)))
+	})
+}
+
+// fetchAndSendTaf fetches a TAF forecast for a given ICAO code and sends it to the client once received.
+// This function never blocks on the fetch.
+func (s *metarService) fetchAndSendTaf(client *Client, icaoCode string) {
+	s.fetch(weatherKey{weatherReportTaf, icaoCode}, func(taf string, err error) {
+		if err != nil {
+			client.sendError(NoWeatherProfileError, "Error fetching TAF for "+icaoCode)
+			return
+		}
+		client.send(buildTafResponsePacket(client.callsign, taf))
+	})
+}
+
+// fetchAndSendWeatherProfile sends a classic FSD weather profile for a given ICAO code.
+//
+// A matching static profile is sent immediately. Otherwise, a profile is
+// derived from the station's METAR once it is received.
+func (s *metarService) fetchAndSendWeatherProfile(client *Client, icaoCode string, staticProfiles map[string]*WeatherProfile) {
+	if profile := lookupStaticWeatherProfile(staticProfiles, icaoCode); profile != nil {
+		sendWeatherProfile(client, profile)
 		return
 	}
 
-	// First line is timestamp
-	resBody = resBody[bytes.IndexByte(resBody, '\n')+1:]
+	s.fetch(weatherKey{weatherReportMetar, icaoCode}, func(rawMetar string, err error) {
+		if err != nil {
+			sendNoWeatherProfileError(client, icaoCode)
+			return
+		}
+		metar, err := ParseMetar(rawMetar)
+		if err != nil {
+			sendNoWeatherProfileError(client, icaoCode)
+			return
+		}
+		sendWeatherProfile(client, newWeatherProfileFromMetar(metar))
+	})
+}
 
-	// Second line is METAR and ends with \n
-	resBody = resBody[:bytes.IndexByte(resBody, '\n')+1]
+func sendWeatherProfile(client *Client, profile *WeatherProfile) {
+	for _, packet := range buildWeatherProfilePackets(client.callsign, profile) {
+		client.send(packet)
+	}
+}
 
-	packet := buildMetarResponsePacket(req.client.callsign, resBody)
-	req.client.send(packet)
+func sendNoWeatherProfileError(client *Client, icaoCode string) {
+	client.sendError(NoWeatherProfileError, "No weather profile for "+icaoCode)
 }
 
 func buildMetarResponsePacket(callsign string, metar []byte) string {
@@ -92,6 +279,16 @@ func buildMetarResponsePacket(callsign string, metar []byte) string {
 	return packet.String()
 }
 
+func buildTafResponsePacket(callsign string, taf string) string {
+	packet := strings.Builder{}
+	packet.WriteString("$ARSERVER:")
+	packet.WriteString(callsign)
+	packet.WriteString(":TAF:")
+	packet.WriteString(taf)
+	packet.WriteString("\r\n")
+	return packet.String()
+}
+
 func buildMetarRequestURL(icaoCode string) string {
 	url := strings.Builder{}
 	url.WriteString("https://tgftp.nws.noaa.gov/data/observations/metar/stations/")
@@ -100,8 +297,16 @@ func buildMetarRequestURL(icaoCode string) string {
 	return url.String()
 }
 
-func sendMetarServiceError(req *metarRequest) {
-	req.client.sendError(NoWeatherProfileError, metarServiceErrString(req.icaoCode))
+func buildTafRequestURL(icaoCode string) string {
+	url := strings.Builder{}
+	url.WriteString("https://tgftp.nws.noaa.gov/data/forecasts/taf/stations/")
+	url.WriteString(icaoCode)
+	url.WriteString(".TXT")
+	return url.String()
+}
+
+func sendMetarServiceError(client *Client, icaoCode string) {
+	client.sendError(NoWeatherProfileError, metarServiceErrString(icaoCode))
 }
 
 func metarServiceErrString(icaoCode string) string {
@@ -111,12 +316,3 @@ func metarServiceErrString(icaoCode string) string {
 
 	return msg.String()
 }
-
-// fetchAndSendMetar fetches a METAR observation for a given ICAO code and sends it to the client once received.
-// This function returns immediately once the request has been queued.
-func (s *metarService) fetchAndSendMetar(ctx context.Context, client *Client, icaoCode string) {
-	select {
-	case <-ctx.Done():
-	case s.metarRequests <- metarRequest{client: client, icaoCode: icaoCode}:
-	}
-}
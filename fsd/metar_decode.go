@@ -0,0 +1,263 @@
+package fsd
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Metar is a decoded METAR observation.
+//
+// Only the fields relevant to FSD are decoded. Fields which are not present in the
+// report are left as their zero value, with the corresponding Has* flag unset.
+type Metar struct {
+	Raw     string `json:"raw"`
+	Station string `json:"station"`
+
+	WindDirection int  `json:"wind_direction"` // Degrees true. Zero when variable or calm.
+	WindVariable  bool `json:"wind_variable"`  // Wind direction is variable (VRB)
+	WindSpeed     int  `json:"wind_speed"`     // Knots
+	WindGust      int  `json:"wind_gust"`      // Knots. Zero when not gusting.
+
+	VisibilityMeters int  `json:"visibility_meters"` // Prevailing visibility in meters
+	HasVisibility    bool `json:"has_visibility"`    // Whether a visibility group was decoded
+
+	Clouds       []MetarCloudLayer `json:"clouds"`
+	Thunderstorm bool              `json:"thunderstorm"` // TS weather or CB clouds were reported
+
+	Temperature    int  `json:"temperature"`     // Degrees Celsius
+	Dewpoint       int  `json:"dewpoint"`        // Degrees Celsius
+	HasTemperature bool `json:"has_temperature"` // Whether a temperature/dewpoint group was decoded
+
+	AltimeterInHg float64 `json:"altimeter_in_hg"` // Altimeter setting in inches of mercury
+	HasAltimeter  bool    `json:"has_altimeter"`   // Whether an altimeter group was decoded
+}
+
+// MetarCloudLayer is a single reported cloud layer.
+type MetarCloudLayer struct {
+	Coverage string `json:"coverage"`       // FEW, SCT, BKN, OVC or VV
+	BaseFeet int    `json:"base_feet"`      // Base of the layer in feet AGL
+	Type     string `json:"type,omitempty"` // CB, TCU or empty
+}
+
+// ErrInvalidMetar is returned by ParseMetar when a report cannot be decoded.
+var ErrInvalidMetar = errors.New("metar: invalid report")
+
+const (
+	metersPerStatuteMile = 1609.344
+	hpaPerInHg           = 33.8639
+)
+
+// ParseMetar decodes a raw METAR report.
+func ParseMetar(raw string) (metar *Metar, err error) {
+	fields := strings.Fields(raw)
+
+	// Skip report type
+	if len(fields) > 0 && (fields[0] == "METAR" || fields[0] == "SPECI") {
+		fields = fields[1:]
+	}
+	if len(fields) < 2 || !isValidIcaoCode(fields[0]) {
+		err = ErrInvalidMetar
+		return
+	}
+
+	metar = &Metar{
+		Raw:     strings.TrimSpace(raw),
+		Station: fields[0],
+	}
+
+	for i := 1; i < len(fields); i++ {
+		field := fields[i]
+
+		// Stop at trends and remarks
+		if field == "RMK" || field == "TEMPO" || field == "BECMG" || field == "NOSIG" {
+			break
+		}
+
+		switch {
+		case strings.HasSuffix(field, "KT") || strings.HasSuffix(field, "MPS"):
+			metar.parseWind(field)
+		case field == "CAVOK":
+			metar.VisibilityMeters = 10000
+			metar.HasVisibility = true
+		case strings.HasSuffix(field, "SM"):
+			// Statute miles, possibly split across two fields, e.g. "1 1/2SM"
+			whole := 0.0
+			if i > 1 && !metar.HasVisibility {
+				if n, convErr := strconv.Atoi(fields[i-1]); convErr == nil && n < 10 {
+					whole = float64(n)
+				}
+			}
+			if miles, ok := parseStatuteMiles(strings.TrimSuffix(field, "SM")); ok {
+				metar.VisibilityMeters = int((whole + miles) * metersPerStatuteMile)
+				metar.HasVisibility = true
+			}
+		case len(field) == 4 && isDigits(field) && !metar.HasVisibility:
+			metar.VisibilityMeters, _ = strconv.Atoi(field)
+			metar.HasVisibility = true
+		case isCloudGroup(field):
+			metar.parseCloud(field)
+		case strings.Contains(field, "TS"):
+			metar.Thunderstorm = true
+		case isTemperatureGroup(field):
+			metar.parseTemperature(field)
+		case len(field) == 5 && (field[0] == 'A' || field[0] == 'Q') && isDigits(field[1:]):
+			metar.parseAltimeter(field)
+		}
+	}
+
+	return
+}
+
+// AltimeterHpa returns the altimeter setting in hectopascals.
+func (m *Metar) AltimeterHpa() int {
+	return int(m.AltimeterInHg*hpaPerInHg + 0.5)
+}
+
+// VisibilityStatuteMiles returns the prevailing visibility in statute miles.
+func (m *Metar) VisibilityStatuteMiles() float64 {
+	return float64(m.VisibilityMeters) / metersPerStatuteMile
+}
+
+func (m *Metar) parseWind(field string) {
+	mps := strings.HasSuffix(field, "MPS")
+	field = strings.TrimSuffix(strings.TrimSuffix(field, "KT"), "MPS")
+	if len(field) < 5 {
+		return
+	}
+
+	if strings.HasPrefix(field, "VRB") {
+		m.WindVariable = true
+	} else if dir, err := strconv.Atoi(field[:3]); err == nil {
+		m.WindDirection = dir
+	} else {
+		return
+	}
+	field = field[3:]
+
+	speedStr, gustStr, _ := strings.Cut(field, "G")
+	speed, err := strconv.Atoi(speedStr)
+	if err != nil {
+		return
+	}
+	gust, _ := strconv.Atoi(gustStr)
+
+	if mps {
+		speed = int(float64(speed)*1.94384 + 0.5)
+		gust = int(float64(gust)*1.94384 + 0.5)
+	}
+	m.WindSpeed = speed
+	m.WindGust = gust
+}
+
+func (m *Metar) parseCloud(field string) {
+	layer := MetarCloudLayer{}
+	if strings.HasPrefix(field, "VV") {
+		layer.Coverage = "VV"
+		field = field[2:]
+	} else {
+		layer.Coverage = field[:3]
+		field = field[3:]
+	}
+	if len(field) >= 3 {
+		if base, err := strconv.Atoi(field[:3]); err == nil {
+			layer.BaseFeet = base * 100
+		}
+		layer.Type = field[3:]
+	}
+	if layer.Type == "CB" {
+		m.Thunderstorm = true
+	}
+	m.Clouds = append(m.Clouds, layer)
+}
+
+func (m *Metar) parseTemperature(field string) {
+	tempStr, dewStr, _ := strings.Cut(field, "/")
+	temp, ok := parseMetarTemperature(tempStr)
+	if !ok {
+		return
+	}
+	m.Temperature = temp
+	m.Dewpoint, _ = parseMetarTemperature(dewStr)
+	m.HasTemperature = true
+}
+
+func (m *Metar) parseAltimeter(field string) {
+	value, _ := strconv.Atoi(field[1:])
+	if field[0] == 'A' {
+		m.AltimeterInHg = float64(value) / 100.0
+	} else {
+		m.AltimeterInHg = float64(value) / hpaPerInHg
+	}
+	m.HasAltimeter = true
+}
+
+func parseMetarTemperature(str string) (temp int, ok bool) {
+	negative := strings.HasPrefix(str, "M")
+	str = strings.TrimPrefix(str, "M")
+	if len(str) != 2 || !isDigits(str) {
+		return
+	}
+	temp, _ = strconv.Atoi(str)
+	if negative {
+		temp = -temp
+	}
+	ok = true
+	return
+}
+
+func parseStatuteMiles(str string) (miles float64, ok bool) {
+	str = strings.TrimPrefix(strings.TrimPrefix(str, "P"), "M")
+	if num, den, found := strings.Cut(str, "/"); found {
+		n, err1 := strconv.Atoi(num)
+		d, err2 := strconv.Atoi(den)
+		if err1 != nil || err2 != nil || d == 0 {
+			return
+		}
+		return float64(n) / float64(d), true
+	}
+	n, err := strconv.Atoi(str)
+	if err != nil {
+		return
+	}
+	return float64(n), true
+}
+
+func isCloudGroup(field string) bool {
+	if strings.HasPrefix(field, "VV") && len(field) == 5 {
+		return true
+	}
+	if len(field) < 6 {
+		return false
+	}
+	switch field[:3] {
+	case "FEW", "SCT", "BKN", "OVC":
+		return isDigits(field[3:6])
+	}
+	return false
+}
+
+func isTemperatureGroup(field string) bool {
+	tempStr, dewStr, found := strings.Cut(field, "/")
+	if !found {
+		return false
+	}
+	_, ok := parseMetarTemperature(tempStr)
+	if !ok {
+		return false
+	}
+	_, ok = parseMetarTemperature(dewStr)
+	return ok || dewStr == "" || dewStr == "//"
+}
+
+func isDigits(str string) bool {
+	if str == "" {
+		return false
+	}
+	for i := range str {
+		if str[i] < '0' || str[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package fsd
+
+import (
+	"math"
+	"testing"
+)
+
+// TestParseMetar verifies decoding of the METAR groups used by the server.
+func TestParseMetar(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want Metar
+	}{
+		{
+			name: "US METAR",
+			raw:  "KJFK 301951Z 18010G18KT 10SM FEW025 BKN250 29/19 A2992 RMK AO2 SLP132",
+			want: Metar{
+				Station:   "KJFK",
+				WindSpeed: 10, WindDirection: 180, WindGust: 18,
+				VisibilityMeters: 16093, HasVisibility: true,
+				Clouds:      []MetarCloudLayer{{Coverage: "FEW", BaseFeet: 2500}, {Coverage: "BKN", BaseFeet: 25000}},
+				Temperature: 29, Dewpoint: 19, HasTemperature: true,
+				AltimeterInHg: 29.92, HasAltimeter: true,
+			},
+		},
+		{
+			name: "ICAO METAR",
+			raw:  "METAR EGLL 301950Z VRB03KT 0800 +TSRA SCT015CB M02/M04 Q0998 NOSIG",
+			want: Metar{
+				Station:      "EGLL",
+				WindVariable: true, WindSpeed: 3,
+				VisibilityMeters: 800, HasVisibility: true,
+				Clouds:       []MetarCloudLayer{{Coverage: "SCT", BaseFeet: 1500, Type: "CB"}},
+				Thunderstorm: true,
+				Temperature:  -2, Dewpoint: -4, HasTemperature: true,
+				AltimeterInHg: 998 / hpaPerInHg, HasAltimeter: true,
+			},
+		},
+		{
+			name: "Fractional visibility",
+			raw:  "KSFO 301956Z 28015KT 1 1/2SM BR OVC004 12/11 A3001",
+			want: Metar{
+				Station:       "KSFO",
+				WindDirection: 280, WindSpeed: 15,
+				VisibilityMeters: 2414, HasVisibility: true,
+				Clouds:      []MetarCloudLayer{{Coverage: "OVC", BaseFeet: 400}},
+				Temperature: 12, Dewpoint: 11, HasTemperature: true,
+				AltimeterInHg: 30.01, HasAltimeter: true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMetar(tt.raw)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			want := tt.want
+			if got.Station != want.Station ||
+				got.WindDirection != want.WindDirection || got.WindVariable != want.WindVariable ||
+				got.WindSpeed != want.WindSpeed || got.WindGust != want.WindGust ||
+				got.VisibilityMeters != want.VisibilityMeters || got.HasVisibility != want.HasVisibility ||
+				got.Thunderstorm != want.Thunderstorm ||
+				got.Temperature != want.Temperature || got.Dewpoint != want.Dewpoint || got.HasTemperature != want.HasTemperature ||
+				math.Abs(got.AltimeterInHg-want.AltimeterInHg) > 0.001 || got.HasAltimeter != want.HasAltimeter {
+				t.Errorf("ParseMetar(%q) = %+v, want %+v", tt.raw, *got, want)
+			}
+			if len(got.Clouds) != len(want.Clouds) {
+				t.Fatalf("expected %d cloud layers, got %d", len(want.Clouds), len(got.Clouds))
+			}
+			for i := range want.Clouds {
+				if got.Clouds[i] != want.Clouds[i] {
+					t.Errorf("cloud layer %d = %+v, want %+v", i, got.Clouds[i], want.Clouds[i])
+				}
+			}
+		})
+	}
+}
+
+// TestParseMetar_Invalid verifies that garbage input is rejected.
+func TestParseMetar_Invalid(t *testing.T) {
+	for _, raw := range []string{"", "METAR", "not a metar"} {
+		if _, err := ParseMetar(raw); err == nil {
+			t.Errorf("expected error for %q", raw)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package fsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetarProvider fetches raw METAR observations for the METAR service.
+type MetarProvider interface {
+	// FetchMetar returns the latest raw METAR observation for a given ICAO code.
+	//
+	// Returns ErrMetarNotFound if no observation exists for the station.
+	FetchMetar(ctx context.Context, icaoCode string) (metar string, err error)
+}
+
+// TafProvider is implemented by MetarProviders which can also supply TAF forecasts.
+type TafProvider interface {
+	// FetchTaf returns the latest raw TAF forecast for a given ICAO code, joined into a single line.
+	//
+	// Returns ErrMetarNotFound if no forecast exists for the station.
+	FetchTaf(ctx context.Context, icaoCode string) (taf string, err error)
+}
+
+// ErrMetarNotFound is returned by a MetarProvider when no observation exists for a station.
+var ErrMetarNotFound = errors.New("metar: no observation found")
+
+// ErrInvalidMetarResponse is returned by a MetarProvider when an upstream response could not be parsed.
+var ErrInvalidMetarResponse = errors.New("metar: invalid response")
+
+// METAR provider names accepted by ServerConfig.MetarProvider
+const (
+	MetarProviderNoaa   = "noaa"
+	MetarProviderURL    = "url"
+	MetarProviderFile   = "file"
+	MetarProviderStatic = "static"
+)
+
+// newMetarProvider builds the MetarProvider selected in the server configuration.
+func newMetarProvider(cfg *ServerConfig) (provider MetarProvider, err error) {
+	switch cfg.MetarProvider {
+	case MetarProviderNoaa, "":
+		provider = NewNoaaMetarProvider(&http.Client{})
+	case MetarProviderURL:
+		if !strings.Contains(cfg.MetarURLTemplate, icaoPlaceholder) {
+			err = fmt.Errorf("METAR URL template must contain %s", icaoPlaceholder)
+			return
+		}
+		provider = NewURLMetarProvider(&http.Client{}, cfg.MetarURLTemplate, cfg.TafURLTemplate)
+	case MetarProviderFile:
+		if cfg.MetarFilePath == "" {
+			err = errors.New("METAR file path must be provided for the file provider")
+			return
+		}
+		provider = NewFileMetarProvider(cfg.MetarFilePath)
+	case MetarProviderStatic:
+		provider = NewStaticMetarProvider(cfg.MetarStaticObservations)
+	default:
+		err = fmt.Errorf("unknown METAR provider: %s", cfg.MetarProvider)
+	}
+	return
+}
+
+// maxMetarResponseSize is the maximum number of bytes read from a single upstream METAR response.
+const maxMetarResponseSize = 4096
+
+// NoaaMetarProvider fetches observations from the NOAA tgftp station files.
+type NoaaMetarProvider struct {
+	httpClient *http.Client
+}
+
+// NewNoaaMetarProvider creates a NoaaMetarProvider using the provided HTTP client.
+func NewNoaaMetarProvider(httpClient *http.Client) *NoaaMetarProvider {
+	return &NoaaMetarProvider{httpClient: httpClient}
+}
+
+func (p *NoaaMetarProvider) FetchMetar(ctx context.Context, icaoCode string) (metar string, err error) {
+	body, err := httpGetMetarBody(ctx, p.httpClient, buildMetarRequestURL(icaoCode))
+	if err != nil {
+		return
+	}
+	return parseNoaaStationFile(body)
+}
+
+func (p *NoaaMetarProvider) FetchTaf(ctx context.Context, icaoCode string) (taf string, err error) {
+	body, err := httpGetMetarBody(ctx, p.httpClient, buildTafRequestURL(icaoCode))
+	if err != nil {
+		return
+	}
+	return parseNoaaTafFile(body)
+}
+
+// parseNoaaStationFile parses a NOAA station file, which consists of a
+// timestamp line followed by a single line containing the METAR.
+func parseNoaaStationFile(body []byte) (metar string, err error) {
+	if bytes.Count(body, []byte("\n")) != 2 {
+		err = ErrInvalidMetarResponse
+		return
+	}
+
+	// First line is timestamp
+	body = body[bytes.IndexByte(body, '\n')+1:]
+
+	// Second line is METAR and ends with \n
+	body = body[:bytes.IndexByte(body, '\n')]
+
+	metar = strings.TrimSpace(string(body))
+	if metar == "" {
+		err = ErrInvalidMetarResponse
+	}
+	return
+}
+
+// parseNoaaTafFile parses a NOAA TAF station file, which consists of a
+// timestamp line followed by a multi-line TAF.
+func parseNoaaTafFile(body []byte) (taf string, err error) {
+	_, forecast, found := bytes.Cut(body, []byte("\n"))
+	if !found {
+		err = ErrInvalidMetarResponse
+		return
+	}
+
+	taf = joinReportLines(string(forecast))
+	if taf == "" {
+		err = ErrInvalidMetarResponse
+	}
+	return
+}
+
+// joinReportLines joins a multi-line report into a single line, collapsing whitespace.
+func joinReportLines(report string) string {
+	return strings.Join(strings.Fields(report), " ")
+}
+
+// icaoPlaceholder is substituted with the requested ICAO code in URL templates.
+const icaoPlaceholder = "{icao}"
+
+// URLMetarProvider fetches observations from an arbitrary HTTP endpoint.
+//
+// The URL template must contain an {icao} placeholder. The endpoint may return either
+// a bare METAR, or several lines of which the first one beginning with the ICAO code is used.
+type URLMetarProvider struct {
+	httpClient     *http.Client
+	urlTemplate    string
+	tafURLTemplate string
+}
+
+// NewURLMetarProvider creates a URLMetarProvider using the provided HTTP client and URL template.
+//
+// TAFs are fetched from tafURLTemplate, which may be empty if the endpoint does not serve TAFs.
+func NewURLMetarProvider(httpClient *http.Client, urlTemplate string, tafURLTemplate string) *URLMetarProvider {
+	return &URLMetarProvider{httpClient: httpClient, urlTemplate: urlTemplate, tafURLTemplate: tafURLTemplate}
+}
+
+func (p *URLMetarProvider) FetchMetar(ctx context.Context, icaoCode string) (metar string, err error) {
+	url := strings.ReplaceAll(p.urlTemplate, icaoPlaceholder, icaoCode)
+	body, err := httpGetMetarBody(ctx, p.httpClient, url)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	for i := range lines {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, icaoCode+" ") {
+			metar = line
+			return
+		}
+	}
+
+	// Fall back to a single-line response body
+	if len(lines) == 1 && lines[0] != "" {
+		metar = strings.TrimSpace(lines[0])
+		return
+	}
+
+	err = ErrMetarNotFound
+	return
+}
+
+func (p *URLMetarProvider) FetchTaf(ctx context.Context, icaoCode string) (taf string, err error) {
+	if p.tafURLTemplate == "" {
+		err = ErrMetarNotFound
+		return
+	}
+
+	url := strings.ReplaceAll(p.tafURLTemplate, icaoPlaceholder, icaoCode)
+	body, err := httpGetMetarBody(ctx, p.httpClient, url)
+	if err != nil {
+		return
+	}
+
+	// Skip anything preceding the forecast, such as a timestamp line
+	forecast := string(body)
+	lines := strings.Split(forecast, "\n")
+	for i := range lines {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "TAF") || strings.HasPrefix(line, icaoCode+" ") {
+			forecast = strings.Join(lines[i:], "\n")
+			break
+		}
+	}
+
+	taf = joinReportLines(forecast)
+	if taf == "" {
+		err = ErrMetarNotFound
+	}
+	return
+}
+
+// httpGetMetarBody performs an HTTP GET and returns the response body.
+// Returns ErrMetarNotFound for 404 responses.
+func httpGetMetarBody(ctx context.Context, httpClient *http.Client, url string) (body []byte, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		err = ErrMetarNotFound
+		return
+	default:
+		err = fmt.Errorf("metar: unexpected HTTP status %d", res.StatusCode)
+		return
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, maxMetarResponseSize))
+}
+
+// FileMetarProvider reads observations from the local filesystem.
+//
+// The path may either be a directory of NOAA-style <ICAO>.TXT station files,
+// or a single NOAA cycle file such as metars.cache.csv. Cycle files are
+// re-read whenever their modification time changes.
+//
+// In directory mode, TAFs are read from NOAA-style <ICAO>.TXT files in a taf subdirectory.
+type FileMetarProvider struct {
+	path string
+
+	lock    sync.Mutex
+	modTime time.Time
+	metars  map[string]string // ICAO -> METAR
+}
+
+// NewFileMetarProvider creates a FileMetarProvider reading from the provided path.
+func NewFileMetarProvider(path string) *FileMetarProvider {
+	return &FileMetarProvider{path: path}
+}
+
+func (p *FileMetarProvider) FetchMetar(_ context.Context, icaoCode string) (metar string, err error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return
+	}
+
+	if info.IsDir() {
+		return p.readStationFile(icaoCode)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.metars == nil || !info.ModTime().Equal(p.modTime) {
+		if err = p.loadCycleFile(); err != nil {
+			return
+		}
+		p.modTime = info.ModTime()
+	}
+
+	metar, ok := p.metars[icaoCode]
+	if !ok {
+		err = ErrMetarNotFound
+	}
+	return
+}
+
+func (p *FileMetarProvider) FetchTaf(_ context.Context, icaoCode string) (taf string, err error) {
+	body, err := readStationFile(filepath.Join(p.path, "taf"), icaoCode)
+	if err != nil {
+		return
+	}
+	return parseNoaaTafFile(body)
+}
+
+func (p *FileMetarProvider) readStationFile(icaoCode string) (metar string, err error) {
+	body, err := readStationFile(p.path, icaoCode)
+	if err != nil {
+		return
+	}
+	return parseNoaaStationFile(body)
+}
+
+// readStationFile reads a NOAA-style <ICAO>.TXT station file from a directory.
+func readStationFile(dir string, icaoCode string) (body []byte, err error) {
+	if !isValidIcaoCode(icaoCode) {
+		err = ErrMetarNotFound
+		return
+	}
+
+	body, err = os.ReadFile(filepath.Join(dir, icaoCode+".TXT"))
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		err = ErrMetarNotFound
+	}
+	return
+}
+
+// loadCycleFile loads a NOAA metars.cache.csv file into memory.
+func (p *FileMetarProvider) loadCycleFile() (err error) {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	metars, err := parseMetarCycleFile(f)
+	if err != nil {
+		return
+	}
+	p.metars = metars
+	return
+}
+
+// parseMetarCycleFile parses a NOAA metars.cache.csv file.
+// Any preamble lines preceding the raw_text,station_id,... header are skipped.
+func parseMetarCycleFile(r io.Reader) (metars map[string]string, err error) {
+	reader := bufio.NewReader(r)
+
+	// Skip the preamble
+	for {
+		var line string
+		if line, err = reader.ReadString('\n'); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = ErrInvalidMetarResponse
+			}
+			return
+		}
+		if strings.HasPrefix(line, "raw_text,") {
+			break
+		}
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+
+	metars = make(map[string]string, 4096)
+	for {
+		var record []string
+		if record, err = csvReader.Read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return
+		}
+		if len(record) < 2 || record[0] == "" {
+			continue
+		}
+		metars[record[1]] = record[0]
+	}
+}
+
+// StaticMetarProvider serves observations from memory. It is intended for tests and offline networks.
+type StaticMetarProvider struct {
+	lock   sync.RWMutex
+	metars map[string]string // ICAO -> METAR
+	tafs   map[string]string // ICAO -> TAF
+}
+
+// NewStaticMetarProvider creates a StaticMetarProvider pre-populated with the provided observations.
+func NewStaticMetarProvider(metars map[string]string) *StaticMetarProvider {
+	p := &StaticMetarProvider{
+		metars: make(map[string]string, len(metars)),
+		tafs:   make(map[string]string),
+	}
+	for icaoCode, metar := range metars {
+		p.metars[icaoCode] = metar
+	}
+	return p
+}
+
+// Set sets the observation for a given ICAO code.
+func (p *StaticMetarProvider) Set(icaoCode string, metar string) {
+	p.lock.Lock()
+	p.metars[icaoCode] = metar
+	p.lock.Unlock()
+}
+
+// SetTaf sets the forecast for a given ICAO code.
+func (p *StaticMetarProvider) SetTaf(icaoCode string, taf string) {
+	p.lock.Lock()
+	p.tafs[icaoCode] = taf
+	p.lock.Unlock()
+}
+
+func (p *StaticMetarProvider) FetchTaf(_ context.Context, icaoCode string) (taf string, err error) {
+	p.lock.RLock()
+	taf, ok := p.tafs[icaoCode]
+	p.lock.RUnlock()
+
+	if !ok {
+		err = ErrMetarNotFound
+	}
+	return
+}
+
+func (p *StaticMetarProvider) FetchMetar(_ context.Context, icaoCode string) (metar string, err error) {
+	p.lock.RLock()
+	metar, ok := p.metars[icaoCode]
+	p.lock.RUnlock()
+
+	if !ok {
+		err = ErrMetarNotFound
+	}
+	return
+}
+
+// isValidIcaoCode returns whether a given string looks like an ICAO location indicator
+func isValidIcaoCode(icaoCode string) bool {
+	if len(icaoCode) < 3 || len(icaoCode) > 4 {
+		return false
+	}
+	for i := range icaoCode {
+		b := icaoCode[i]
+		if (b >= '0' && b <= '9') || (b >= 'A' && b <= 'Z') {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package fsd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestURLMetarProvider verifies that URLMetarProvider substitutes the ICAO code and extracts the METAR line.
+func TestURLMetarProvider(t *testing.T) {
+	var requestedURL string
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requestedURL = req.URL.String()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("2023/04/30 19:51\nKJFK 301951Z 18010KT 10SM FEW250 29/19 A2992\n")),
+		}, nil
+	})
+
+	provider := NewURLMetarProvider(&http.Client{Transport: transport}, "http://wx.local/metar?station={icao}", "")
+	metar, err := provider.FetchMetar(context.Background(), "KJFK")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if requestedURL != "http://wx.local/metar?station=KJFK" {
+		t.Errorf("unexpected request URL %q", requestedURL)
+	}
+	if metar != "KJFK 301951Z 18010KT 10SM FEW250 29/19 A2992" {
+		t.Errorf("unexpected METAR %q", metar)
+	}
+}
+
+// TestURLMetarProvider_NotFound verifies that a 404 response maps to ErrMetarNotFound.
+func TestURLMetarProvider_NotFound(t *testing.T) {
+	transport := &mockTransport{response: &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       io.NopCloser(bytes.NewReader(nil)),
+	}}
+
+	provider := NewURLMetarProvider(&http.Client{Transport: transport}, "http://wx.local/{icao}", "")
+	if _, err := provider.FetchMetar(context.Background(), "ZZZZ"); !errors.Is(err, ErrMetarNotFound) {
+		t.Errorf("expected ErrMetarNotFound, got %v", err)
+	}
+}
+
+// TestFileMetarProvider_Directory verifies reading NOAA-style station files from a directory.
+func TestFileMetarProvider_Directory(t *testing.T) {
+	dir := t.TempDir()
+	stationFile := "2023/04/30 19:50\nEGLL 301950Z 24008KT 9999 FEW040 18/12 Q1015\n"
+	if err := os.WriteFile(filepath.Join(dir, "EGLL.TXT"), []byte(stationFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewFileMetarProvider(dir)
+	metar, err := provider.FetchMetar(context.Background(), "EGLL")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if metar != "EGLL 301950Z 24008KT 9999 FEW040 18/12 Q1015" {
+		t.Errorf("unexpected METAR %q", metar)
+	}
+
+	if _, err = provider.FetchMetar(context.Background(), "KJFK"); !errors.Is(err, ErrMetarNotFound) {
+		t.Errorf("expected ErrMetarNotFound, got %v", err)
+	}
+	if _, err = provider.FetchMetar(context.Background(), "../EGLL"); !errors.Is(err, ErrMetarNotFound) {
+		t.Errorf("expected ErrMetarNotFound for invalid ICAO code, got %v", err)
+	}
+}
+
+// TestFileMetarProvider_CycleFile verifies reading a NOAA metars.cache.csv cycle file.
+func TestFileMetarProvider_CycleFile(t *testing.T) {
+	cycleFile := `No errors
+No warnings
+4 ms
+data source=metars
+2 results
+raw_text,station_id,observation_time,latitude,longitude
+KJFK 301951Z 18010KT 10SM FEW250 29/19 A2992,KJFK,2023-04-30T19:51:00Z,40.64,-73.76
+EGLL 301950Z 24008KT 9999 FEW040 18/12 Q1015,EGLL,2023-04-30T19:50:00Z,51.48,-0.45
+`
+	path := filepath.Join(t.TempDir(), "metars.cache.csv")
+	if err := os.WriteFile(path, []byte(cycleFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewFileMetarProvider(path)
+	metar, err := provider.FetchMetar(context.Background(), "EGLL")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if metar != "EGLL 301950Z 24008KT 9999 FEW040 18/12 Q1015" {
+		t.Errorf("unexpected METAR %q", metar)
+	}
+
+	if _, err = provider.FetchMetar(context.Background(), "KLAX"); !errors.Is(err, ErrMetarNotFound) {
+		t.Errorf("expected ErrMetarNotFound, got %v", err)
+	}
+}
+
+// TestStaticMetarProvider verifies the in-memory provider.
+func TestStaticMetarProvider(t *testing.T) {
+	provider := NewStaticMetarProvider(map[string]string{
+		"KJFK": "KJFK 301951Z 18010KT 10SM FEW250 29/19 A2992",
+	})
+
+	metar, err := provider.FetchMetar(context.Background(), "KJFK")
+	if err != nil || metar != "KJFK 301951Z 18010KT 10SM FEW250 29/19 A2992" {
+		t.Errorf("unexpected result %q, %v", metar, err)
+	}
+
+	if _, err = provider.FetchMetar(context.Background(), "EGLL"); !errors.Is(err, ErrMetarNotFound) {
+		t.Errorf("expected ErrMetarNotFound, got %v", err)
+	}
+
+	provider.Set("EGLL", "EGLL 301950Z 24008KT 9999 FEW040 18/12 Q1015")
+	if _, err = provider.FetchMetar(context.Background(), "EGLL"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestNewMetarProvider verifies provider selection from the server configuration.
+func TestNewMetarProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ServerConfig
+		wantErr bool
+	}{
+		{name: "Default", cfg: ServerConfig{}},
+		{name: "NOAA", cfg: ServerConfig{MetarProvider: MetarProviderNoaa}},
+		{name: "URL", cfg: ServerConfig{MetarProvider: MetarProviderURL, MetarURLTemplate: "http://wx.local/{icao}"}},
+		{name: "URL without placeholder", cfg: ServerConfig{MetarProvider: MetarProviderURL, MetarURLTemplate: "http://wx.local/"}, wantErr: true},
+		{name: "File", cfg: ServerConfig{MetarProvider: MetarProviderFile, MetarFilePath: "/tmp"}},
+		{name: "File without path", cfg: ServerConfig{MetarProvider: MetarProviderFile}, wantErr: true},
+		{name: "Static", cfg: ServerConfig{MetarProvider: MetarProviderStatic}},
+		{name: "Unknown", cfg: ServerConfig{MetarProvider: "carrier-pigeon"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newMetarProvider(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newMetarProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// roundTripFunc adapts a function to an http.RoundTripper.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
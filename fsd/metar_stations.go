@@ -0,0 +1,151 @@
+package fsd
+
+import (
+	"encoding/csv"
+	"errors"
+	"github.com/tidwall/rtree"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxQnhStationDistance is the maximum distance (meters) from a pilot to the
+// reporting station their QNH is taken from.
+const maxQnhStationDistance = 185200 // 100 nautical miles
+
+// numNearbyStationCandidates is the number of stations (ordered by planar degree distance)
+// whose great circle distance is compared when finding the nearest station.
+const numNearbyStationCandidates = 8
+
+// stationIndex is a spatial index of METAR reporting stations.
+type stationIndex struct {
+	tree      rtree.RTreeGN[float64, string]
+	positions map[string][2]float64
+}
+
+// ErrInvalidStationFile is returned when a station file has no recognizable header.
+var ErrInvalidStationFile = errors.New("metar: station file has no station_id, latitude and longitude header")
+
+func newStationIndex() *stationIndex {
+	return &stationIndex{positions: make(map[string][2]float64, 4096)}
+}
+
+// loadStationIndex reads a station index from a CSV file.
+//
+// Any CSV file with a header row naming the station identifier (station_id or icao)
+// and its latitude and longitude columns is accepted, such as NOAA's metars.cache.csv.
+// Lines preceding the header row are skipped.
+func loadStationIndex(path string) (index *stationIndex, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	return parseStationIndex(f)
+}
+
+func parseStationIndex(r io.Reader) (index *stationIndex, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	icaoCol, latCol, lonCol := -1, -1, -1
+	for icaoCol < 0 || latCol < 0 || lonCol < 0 {
+		var header []string
+		if header, err = reader.Read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = ErrInvalidStationFile
+			}
+			return
+		}
+		icaoCol, latCol, lonCol = -1, -1, -1
+		for i, name := range header {
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "station_id", "icao":
+				icaoCol = i
+			case "latitude", "lat":
+				latCol = i
+			case "longitude", "lon":
+				lonCol = i
+			}
+		}
+	}
+
+	index = newStationIndex()
+	for {
+		var record []string
+		if record, err = reader.Read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return
+		}
+		if len(record) <= max(icaoCol, latCol, lonCol) {
+			continue
+		}
+
+		lat, latErr := strconv.ParseFloat(record[latCol], 64)
+		lon, lonErr := strconv.ParseFloat(record[lonCol], 64)
+		if latErr != nil || lonErr != nil {
+			continue
+		}
+		index.add(strings.ToUpper(record[icaoCol]), lat, lon)
+	}
+}
+
+// add inserts or moves a station in the index.
+func (x *stationIndex) add(icaoCode string, lat, lon float64) {
+	if !isValidIcaoCode(icaoCode) {
+		return
+	}
+	if old, ok := x.positions[icaoCode]; ok {
+		x.tree.Delete(old, old, icaoCode)
+	}
+	pos := [2]float64{lat, lon}
+	x.positions[icaoCode] = pos
+	x.tree.Insert(pos, pos, icaoCode)
+}
+
+// nearest returns the station closest to a given position, within maxDistance meters.
+func (x *stationIndex) nearest(lat, lon float64, maxDistance float64) (icaoCode string, ok bool) {
+	bestDistance := maxDistance
+	candidates := 0
+	point := [2]float64{lat, lon}
+
+	x.tree.Nearby(
+		rtree.BoxDist[float64, string](point, point, nil),
+		func(min, _ [2]float64, station string, _ float64) bool {
+			if d := distance(lat, lon, min[0], min[1]); d <= bestDistance {
+				bestDistance = d
+				icaoCode = station
+				ok = true
+			}
+			candidates++
+			return candidates < numNearbyStationCandidates
+		},
+	)
+	return
+}
+
+// nearestQnh returns the altimeter setting reported by the station nearest to a given position.
+//
+// Only cached observations are used, so ok is false until the nearest station's METAR has been fetched.
+func (s *Server) nearestQnh(lat, lon float64) (qnhInHg float64, qnhMb int, ok bool) {
+	if s.stations == nil {
+		return
+	}
+	icaoCode, found := s.stations.nearest(lat, lon, maxQnhStationDistance)
+	if !found {
+		return
+	}
+	rawMetar, found := s.metarService.cachedMetar(icaoCode)
+	if !found {
+		return
+	}
+	metar, err := ParseMetar(rawMetar)
+	if err != nil || !metar.HasAltimeter {
+		return
+	}
+	return metar.AltimeterInHg, metar.AltimeterHpa(), true
+}
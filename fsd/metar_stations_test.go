@@ -0,0 +1,93 @@
+package fsd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testStationFile = `No errors
+No warnings
+3 results
+raw_text,station_id,observation_time,latitude,longitude
+KJFK 301951Z 18010KT 10SM FEW250 29/19 A2992,KJFK,2023-04-30T19:51:00Z,40.64,-73.76
+KLGA 301951Z 20008KT 10SM FEW250 28/18 A2990,KLGA,2023-04-30T19:51:00Z,40.78,-73.88
+EGLL 301950Z 24008KT 9999 FEW040 18/12 Q1015,EGLL,2023-04-30T19:50:00Z,51.48,-0.45
+`
+
+// TestParseStationIndex verifies parsing a station file with a preamble.
+func TestParseStationIndex(t *testing.T) {
+	index, err := parseStationIndex(strings.NewReader(testStationFile))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(index.positions) != 3 {
+		t.Errorf("expected 3 stations, got %d", len(index.positions))
+	}
+
+	if _, err = parseStationIndex(strings.NewReader("foo,bar\n1,2\n")); !errors.Is(err, ErrInvalidStationFile) {
+		t.Errorf("expected ErrInvalidStationFile, got %v", err)
+	}
+}
+
+// TestStationIndex_Nearest verifies nearest station lookups.
+func TestStationIndex_Nearest(t *testing.T) {
+	index, err := parseStationIndex(strings.NewReader(testStationFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     string
+		wantOk   bool
+	}{
+		{name: "JFK", lat: 40.62, lon: -73.70, want: "KJFK", wantOk: true},
+		{name: "LGA", lat: 40.80, lon: -73.90, want: "KLGA", wantOk: true},
+		{name: "London", lat: 51.50, lon: -0.10, want: "EGLL", wantOk: true},
+		{name: "Mid-Atlantic", lat: 45.00, lon: -35.00, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := index.nearest(tt.lat, tt.lon, maxQnhStationDistance)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("nearest() = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+// TestServer_NearestQnh verifies that QNH is taken from the nearest station's cached METAR.
+func TestServer_NearestQnh(t *testing.T) {
+	index, err := parseStationIndex(strings.NewReader(testStationFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := NewStaticMetarProvider(map[string]string{
+		"EGLL": "EGLL 301950Z 24008KT 9999 FEW040 18/12 Q1015",
+	})
+	s := &Server{
+		metarService: newMetarService(1, provider, time.Second, time.Minute, time.Minute),
+		stations:     index,
+	}
+
+	// The first lookup only starts a background fetch
+	if _, _, ok := s.nearestQnh(51.50, -0.10); ok {
+		t.Fatal("expected no QNH before the METAR is cached")
+	}
+	s.metarService.handleMetarRequest(context.Background(), <-s.metarService.metarRequests)
+
+	qnhInHg, qnhMb, ok := s.nearestQnh(51.50, -0.10)
+	if !ok {
+		t.Fatal("expected QNH once the METAR is cached")
+	}
+	if qnhMb != 1015 {
+		t.Errorf("expected 1015 hPa, got %d", qnhMb)
+	}
+	if qnhInHg < 29.97 || qnhInHg > 29.98 {
+		t.Errorf("expected ~29.97 inHg, got %f", qnhInHg)
+	}
+}
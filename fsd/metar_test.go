@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"go.uber.org/atomic"
 	"io"
+	"log/slog"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 )
 
 // mockClient simulates a Client for capturing sent packets.
@@ -23,6 +26,7 @@ func newMockClient(callsign string) *mockClient {
 		ctx:       ctx,
 		cancelCtx: cancel,
 		sendChan:  make(chan string, 32), // Buffered to prevent blocking
+		logger:    slog.New(slog.DiscardHandler),
 		loginData: loginData{callsign: callsign},
 	}
 	return &mockClient{
@@ -105,13 +109,13 @@ func TestBuildMetarResponsePacket(t *testing.T) {
 			name:     "Valid METAR for KJFK",
 			callsign: "TEST",
 			metar:    []byte("KJFK 301951Z 18010KT 10SM FEW250 29/19 A2992"),
-			expected: "$ARSERVER:TEST:KJFK 301951Z 18010KT 10SM FEW250 29/19 A2992\r\n",
+			expected: "$ARSERVER:TEST:METAR:KJFK 301951Z 18010KT 10SM FEW250 29/19 A2992\r\n",
 		},
 		{
 			name:     "Valid METAR for EGLL",
 			callsign: "PILOT1",
 			metar:    []byte("EGLL 301950Z 24008KT 9999 FEW040 18/12 Q1015"),
-			expected: "$ARSERVER:PILOT1:EGLL 301950Z 24008KT 9999 FEW040 18/12 Q1015\r\n",
+			expected: "$ARSERVER:PILOT1:METAR:EGLL 301950Z 24008KT 9999 FEW040 18/12 Q1015\r\n",
 		},
 	}
 	for _, tt := range tests {
@@ -127,11 +131,7 @@ func TestBuildMetarResponsePacket(t *testing.T) {
 // TestSendMetarServiceError verifies that sendMetarServiceError sends the correct error packet to the client.
 func TestSendMetarServiceError(t *testing.T) {
 	mockClient := newMockClient("TEST")
-	req := &metarRequest{
-		client:   mockClient.Client,
-		icaoCode: "KJFK",
-	}
-	sendMetarServiceError(req)
+	sendMetarServiceError(mockClient.Client, "KJFK")
 
 	packets := mockClient.collectPackets()
 	expectedPacket := "$ERserver:unknown:9::Error fetching METAR for KJFK\r\n"
@@ -142,6 +142,22 @@ func TestSendMetarServiceError(t *testing.T) {
 	}
 }
 
+// newTestMetarService creates a metarService backed by a NOAA provider using the provided transport.
+func newTestMetarService(transport http.RoundTripper) *metarService {
+	provider := NewNoaaMetarProvider(&http.Client{Transport: transport})
+	return newMetarService(1, provider, time.Second, time.Minute, time.Minute)
+}
+
+// requestAndProcessMetar queues a METAR request for a client and processes the resulting fetch.
+func requestAndProcessMetar(service *metarService, client *Client, icaoCode string) {
+	service.fetchAndSendMetar(client, icaoCode)
+	select {
+	case queued := <-service.metarRequests:
+		service.handleMetarRequest(context.Background(), queued)
+	default:
+	}
+}
+
 // TestHandleMetarRequest_Success verifies that handleMetarRequest correctly processes a valid METAR response.
 func TestHandleMetarRequest_Success(t *testing.T) {
 	responseBody := []byte("2023/04/30 19:51\nKJFK 301951Z 18010KT 10SM FEW250 29/19 A2992\n")
@@ -149,140 +165,182 @@ func TestHandleMetarRequest_Success(t *testing.T) {
 		StatusCode: http.StatusOK,
 		Body:       io.NopCloser(bytes.NewReader(responseBody)),
 	}
-	mockTransport := &mockTransport{response: mockResponse}
-
-	service := &metarService{
-		httpClient: &http.Client{Transport: mockTransport},
-	}
+	service := newTestMetarService(&mockTransport{response: mockResponse})
 
 	mockClient := newMockClient("TEST")
-	req := &metarRequest{
-		client:   mockClient.Client,
-		icaoCode: "KJFK",
-	}
-
-	service.handleMetarRequest(req)
+	requestAndProcessMetar(service, mockClient.Client, "KJFK")
 
 	packets := mockClient.collectPackets()
 	if len(packets) != 1 {
-		t.Errorf("expected 1 packet sent, got %d", len(packets))
+		t.Fatalf("expected 1 packet sent, got %d", len(packets))
 	}
 
-	if !strings.HasPrefix(packets[0], "$ARSERVER:TEST:KJFK ") || !strings.HasSuffix(packets[0], "\r\n") {
-		t.Errorf("bad response packet")
+	expectedPacket := "$ARSERVER:TEST:METAR:KJFK 301951Z 18010KT 10SM FEW250 29/19 A2992\r\n"
+	if packets[0] != expectedPacket {
+		t.Errorf("expected packet %q, got %q", expectedPacket, packets[0])
 	}
 }
 
-// TestHandleMetarRequest_HTTPError verifies that handleMetarRequest handles HTTP errors correctly.
-func TestHandleMetarRequest_HTTPError(t *testing.T) {
-	mockResponse := &http.Response{
-		StatusCode: http.StatusNotFound,
-		Body:       io.NopCloser(strings.NewReader("Not Found")),
-	}
-	mockTransport := &mockTransport{response: mockResponse}
-
-	service := &metarService{
-		httpClient: &http.Client{Transport: mockTransport},
+// TestHandleMetarRequest_Errors verifies that handleMetarRequest reports upstream failures to the client.
+func TestHandleMetarRequest_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport http.RoundTripper
+		icaoCode  string
+	}{
+		{
+			name: "HTTP error",
+			transport: &mockTransport{response: &http.Response{
+				StatusCode: http.StatusNotFound,
+				Body:       io.NopCloser(strings.NewReader("Not Found")),
+			}},
+			icaoCode: "ZZZZ",
+		},
+		{
+			name:      "Network error",
+			transport: &mockTransport{err: errors.New("network error")},
+			icaoCode:  "KJFK",
+		},
+		{
+			name: "Invalid response",
+			transport: &mockTransport{response: &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader("Invalid response\n")),
+			}},
+			icaoCode: "KJFK",
+		},
+		{
+			name: "More than two lines",
+			transport: &mockTransport{response: &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader("Line1\nLine2\nLine3\n")),
+			}},
+			icaoCode: "KJFK",
+		},
+		{
+			name:      "Invalid ICAO code",
+			transport: &mockTransport{err: errors.New("should not be called")},
+			icaoCode:  "INVALID",
+		},
 	}
-
-	mockClient := newMockClient("TEST")
-	req := &metarRequest{
-		client:   mockClient.Client,
-		icaoCode: "INVALID",
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestMetarService(tt.transport)
+			mockClient := newMockClient("TEST")
+			requestAndProcessMetar(service, mockClient.Client, tt.icaoCode)
+
+			packets := mockClient.collectPackets()
+			expectedPacket := "$ERserver:unknown:9::Error fetching METAR for " + tt.icaoCode + "\r\n"
+			if len(packets) != 1 {
+				t.Errorf("expected 1 packet sent, got %d", len(packets))
+			} else if packets[0] != expectedPacket {
+				t.Errorf("expected packet %q, got %q", expectedPacket, packets[0])
+			}
+		})
 	}
+}
 
-	service.handleMetarRequest(req)
+// countingMetarProvider counts calls to FetchMetar.
+type countingMetarProvider struct {
+	MetarProvider
+	calls atomic.Int32
+}
 
-	packets := mockClient.collectPackets()
-	expectedPacket := "$ERserver:unknown:9::Error fetching METAR for INVALID\r\n"
-	if len(packets) != 1 {
-		t.Errorf("expected 1 packet sent, got %d", len(packets))
-	} else if packets[0] != expectedPacket {
-		t.Errorf("expected packet %q, got %q", expectedPacket, packets[0])
-	}
+func (p *countingMetarProvider) FetchMetar(ctx context.Context, icaoCode string) (string, error) {
+	p.calls.Inc()
+	return p.MetarProvider.FetchMetar(ctx, icaoCode)
 }
 
-// TestHandleMetarRequest_NetworkError verifies that handleMetarRequest handles network errors correctly.
-func TestHandleMetarRequest_NetworkError(t *testing.T) {
-	mockTransport := &mockTransport{err: errors.New("network error")}
+// TestMetarService_Coalescing verifies that concurrent requests for one station result in a single fetch.
+func TestMetarService_Coalescing(t *testing.T) {
+	provider := &countingMetarProvider{MetarProvider: NewStaticMetarProvider(map[string]string{
+		"KLAX": "KLAX 301953Z 25012KT 10SM CLR 21/12 A2990",
+	})}
+	service := newMetarService(1, provider, time.Second, time.Minute, time.Minute)
 
-	service := &metarService{
-		httpClient: &http.Client{Transport: mockTransport},
+	clients := []*mockClient{newMockClient("PILOT1"), newMockClient("PILOT2"), newMockClient("PILOT3")}
+	for _, c := range clients {
+		service.fetchAndSendMetar(c.Client, "KLAX")
 	}
-
-	mockClient := newMockClient("TEST")
-	req := &metarRequest{
-		client:   mockClient.Client,
-		icaoCode: "KJFK",
+	if len(service.metarRequests) != 1 {
+		t.Fatalf("expected 1 queued fetch, got %d", len(service.metarRequests))
 	}
+	service.handleMetarRequest(context.Background(), <-service.metarRequests)
 
-	service.handleMetarRequest(req)
+	for _, c := range clients {
+		packets := c.collectPackets()
+		if len(packets) != 1 || !strings.HasPrefix(packets[0], "$ARSERVER:"+c.callsign+":METAR:KLAX ") {
+			t.Errorf("unexpected packets for %s: %q", c.callsign, packets)
+		}
+	}
 
-	packets := mockClient.collectPackets()
-	expectedPacket := "$ERserver:unknown:9::Error fetching METAR for KJFK\r\n"
-	if len(packets) != 1 {
+	// Subsequent requests must be served from cache
+	late := newMockClient("PILOT4")
+	service.fetchAndSendMetar(late.Client, "KLAX")
+	if len(service.metarRequests) != 0 {
+		t.Errorf("expected cached response, but a fetch was queued")
+	}
+	if packets := late.collectPackets(); len(packets) != 1 {
 		t.Errorf("expected 1 packet sent, got %d", len(packets))
-	} else if packets[0] != expectedPacket {
-		t.Errorf("expected packet %q, got %q", expectedPacket, packets[0])
+	}
+	if provider.calls.Load() != 1 {
+		t.Errorf("expected 1 provider call, got %d", provider.calls.Load())
 	}
 }
 
-// TestHandleMetarRequest_InvalidResponse verifies that handleMetarRequest handles responses with invalid formats.
-func TestHandleMetarRequest_InvalidResponse(t *testing.T) {
-	responseBody := []byte("Invalid response\n")
-	mockResponse := &http.Response{
-		StatusCode: http.StatusOK,
-		Body:       io.NopCloser(bytes.NewReader(responseBody)),
-	}
-	mockTransport := &mockTransport{response: mockResponse}
+// TestMetarService_NegativeCache verifies that failed lookups are cached.
+func TestMetarService_NegativeCache(t *testing.T) {
+	provider := &countingMetarProvider{MetarProvider: NewStaticMetarProvider(nil)}
+	service := newMetarService(1, provider, time.Second, time.Minute, time.Minute)
 
-	service := &metarService{
-		httpClient: &http.Client{Transport: mockTransport},
+	for range 2 {
+		mockClient := newMockClient("TEST")
+		requestAndProcessMetar(service, mockClient.Client, "ZZZZ")
+		if packets := mockClient.collectPackets(); len(packets) != 1 || !strings.HasPrefix(packets[0], "$ERserver:unknown:9:") {
+			t.Errorf("unexpected packets %q", packets)
+		}
 	}
-
-	mockClient := newMockClient("TEST")
-	req := &metarRequest{
-		client:   mockClient.Client,
-		icaoCode: "KJFK",
+	if provider.calls.Load() != 1 {
+		t.Errorf("expected 1 provider call, got %d", provider.calls.Load())
 	}
+}
 
-	service.handleMetarRequest(req)
+// TestMetarService_QueueFull verifies that a full fetch queue fails requests without blocking.
+func TestMetarService_QueueFull(t *testing.T) {
+	service := newMetarService(1, NewStaticMetarProvider(nil), time.Second, time.Minute, time.Minute)
+	service.metarRequests = make(chan weatherKey) // Unbuffered with no workers: always full
 
-	packets := mockClient.collectPackets()
-	expectedPacket := "$ERserver:unknown:9::Error fetching METAR for KJFK\r\n"
-	if len(packets) != 1 {
-		t.Errorf("expected 1 packet sent, got %d", len(packets))
-	} else if packets[0] != expectedPacket {
-		t.Errorf("expected packet %q, got %q", expectedPacket, packets[0])
-	}
-}
+	mockClient := newMockClient("TEST")
+	service.fetchAndSendMetar(mockClient.Client, "KJFK")
 
-// TestHandleMetarRequest_MoreThanTwoLines verifies that handleMetarRequest handles responses with too many lines.
-func TestHandleMetarRequest_MoreThanTwoLines(t *testing.T) {
-	responseBody := []byte("Line1\nLine2\nLine3\n")
-	mockResponse := &http.Response{
-		StatusCode: http.StatusOK,
-		Body:       io.NopCloser(bytes.NewReader(responseBody)),
+	if packets := mockClient.collectPackets(); len(packets) != 1 || !strings.HasPrefix(packets[0], "$ERserver:unknown:9:") {
+		t.Errorf("unexpected packets %q", packets)
 	}
-	mockTransport := &mockTransport{response: mockResponse}
-
-	service := &metarService{
-		httpClient: &http.Client{Transport: mockTransport},
+	if len(service.inflight) != 0 {
+		t.Errorf("expected no in-flight fetches")
 	}
+}
 
-	mockClient := newMockClient("TEST")
-	req := &metarRequest{
-		client:   mockClient.Client,
-		icaoCode: "KJFK",
-	}
+// TestMetarService_Taf verifies that TAF requests are served through the provider.
+func TestMetarService_Taf(t *testing.T) {
+	provider := NewStaticMetarProvider(nil)
+	provider.SetTaf("KJFK", "TAF KJFK 301730Z 3018/0124 18012KT P6SM FEW250")
+	service := newMetarService(1, provider, time.Second, time.Minute, time.Minute)
 
-	service.handleMetarRequest(req)
+	mockClient := newMockClient("TEST")
+	service.fetchAndSendTaf(mockClient.Client, "KJFK")
+	service.handleMetarRequest(context.Background(), <-service.metarRequests)
 
 	packets := mockClient.collectPackets()
-	expectedPacket := "$ERserver:unknown:9::Error fetching METAR for KJFK\r\n"
-	if len(packets) != 1 {
-		t.Errorf("expected 1 packet sent, got %d", len(packets))
-	} else if packets[0] != expectedPacket {
-		t.Errorf("expected packet %q, got %q", expectedPacket, packets[0])
+	expectedPacket := "$ARSERVER:TEST:TAF:TAF KJFK 301730Z 3018/0124 18012KT P6SM FEW250\r\n"
+	if len(packets) != 1 || packets[0] != expectedPacket {
+		t.Errorf("expected packet %q, got %q", expectedPacket, packets)
+	}
+
+	// A TAF must not be served from the METAR cache entry and vice versa
+	service.fetchAndSendMetar(mockClient.Client, "KJFK")
+	service.handleMetarRequest(context.Background(), <-service.metarRequests)
+	if packets = mockClient.collectPackets(); len(packets) != 1 || !strings.HasPrefix(packets[0], "$ERserver:unknown:9:") {
+		t.Errorf("unexpected packets %q", packets)
 	}
 }
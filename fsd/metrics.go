@@ -0,0 +1,218 @@
+package fsd
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const metricsNamespace = "openfsd"
+
+// Process-wide metrics. These are registered with the registry of each Server.
+var (
+	packetsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "packets_received_total",
+		Help:      "Packets received from clients by packet type.",
+	}, []string{"type"})
+
+	packetsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "packets_sent_total",
+		Help:      "Packets written to clients by packet type.",
+	}, []string{"type"})
+
+	errorPacketsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "error_packets_sent_total",
+		Help:      "$ER error packets sent to clients by error code.",
+	}, []string{"code"})
+
+	loginFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "login_failures_total",
+		Help:      "Rejected logins by reason.",
+	}, []string{"reason"})
+
+	sendQueueDrops = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "send_queue_drops_total",
+		Help:      "Packets discarded because the recipient disconnected before they could be queued.",
+	})
+
+	metarFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "metar_fetch_duration_seconds",
+		Help:      "Duration of weather report fetches from the METAR provider.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"report"})
+
+	metarFetchFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "metar_fetch_failures_total",
+		Help:      "Failed weather report fetches by report type and reason.",
+	}, []string{"report", "reason"})
+
+	rtreeSearchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "rtree_search_duration_seconds",
+		Help:      "Duration of R-tree searches for clients within visibility range.",
+		Buckets:   prometheus.ExponentialBuckets(1e-6, 4, 10),
+	})
+)
+
+// loginFailureReasons maps the error codes sent during login to login failure reasons
+var loginFailureReasons = map[int]string{
+	CallsignInUseError:           "callsign_in_use",
+	CallsignInvalidError:         "callsign_invalid",
+	SyntaxError:                  "syntax",
+	InvalidLogonError:            "invalid_credentials",
+	InvalidProtocolRevisionError: "invalid_protocol_revision",
+	RequestedLevelTooHighError:   "requested_level_too_high",
+	CertificateSuspendedError:    "certificate_suspended",
+	UnauthorizedSoftwareError:    "unauthorized_software",
+}
+
+func recordErrorPacket(code int) {
+	errorPacketsSent.WithLabelValues(strconv.Itoa(code)).Inc()
+}
+
+func loginFailureReason(code int) string {
+	if reason, ok := loginFailureReasons[code]; ok {
+		return reason
+	}
+	return "other"
+}
+
+func recordLoginFailure(code int) {
+	loginFailures.WithLabelValues(loginFailureReason(code)).Inc()
+}
+
+func recordMetarFetch(reportType weatherReportType, seconds float64, err error) {
+	report := reportType.String()
+	metarFetchDuration.WithLabelValues(report).Observe(seconds)
+
+	if err == nil {
+		return
+	}
+	reason := "error"
+	switch {
+	case errors.Is(err, ErrMetarNotFound):
+		reason = "not_found"
+	case errors.Is(err, context.DeadlineExceeded):
+		reason = "timeout"
+	}
+	metarFetchFailures.WithLabelValues(report, reason).Inc()
+}
+
+// newMetricsRegistry creates the registry served by the /metrics endpoint of a Server.
+func newMetricsRegistry(s *Server) (registry *prometheus.Registry) {
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		packetsReceived,
+		packetsSent,
+		errorPacketsSent,
+		loginFailures,
+		sendQueueDrops,
+		metarFetchDuration,
+		metarFetchFailures,
+		rtreeSearchDuration,
+		&clientCollector{server: s},
+	)
+	return
+}
+
+// clientCollector reports connected clients and send queue depths at scrape time.
+type clientCollector struct {
+	server *Server
+}
+
+var (
+	connectedClientsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "connected_clients"),
+		"Connected clients by type and ATC facility type.",
+		[]string{"type", "facility"}, nil,
+	)
+	sendQueueDepthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "send_queue_depth"),
+		"Packets waiting in client send queues.",
+		nil, nil,
+	)
+	sendQueueMaxDepthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "send_queue_max_depth"),
+		"Packets waiting in the fullest client send queue.",
+		nil, nil,
+	)
+)
+
+func (c *clientCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- connectedClientsDesc
+	ch <- sendQueueDepthDesc
+	ch <- sendQueueMaxDepthDesc
+}
+
+func (c *clientCollector) Collect(ch chan<- prometheus.Metric) {
+	postOffice := c.server.postOffice
+	postOffice.clientMapLock.RLock()
+	clients := maps.Clone(postOffice.clientMap)
+	postOffice.clientMapLock.RUnlock()
+
+	type clientKey struct {
+		clientType string
+		facility   string
+	}
+	counts := map[clientKey]int{}
+	var depth, maxDepth int
+	for _, client := range clients {
+		if client.peer != nil {
+			continue // Counted by its own server
+		}
+
+		key := clientKey{"pilot", ""}
+		if client.isAtc {
+			key = clientKey{"atc", strconv.Itoa(client.facilityType)}
+		}
+		counts[key]++
+
+		queued := len(client.sendChan)
+		depth += queued
+		maxDepth = max(maxDepth, queued)
+	}
+
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(connectedClientsDesc, prometheus.GaugeValue, float64(count), key.clientType, key.facility)
+	}
+	ch <- prometheus.MustNewConstMetric(sendQueueDepthDesc, prometheus.GaugeValue, float64(depth))
+	ch <- prometheus.MustNewConstMetric(sendQueueMaxDepthDesc, prometheus.GaugeValue, float64(maxDepth))
+}
+
+// metricsAuthMiddleware verifies the metrics bearer token, if one is configured.
+// The /metrics endpoint does not accept fsd_service JWTs.
+func (s *Server) metricsAuthMiddleware(c *gin.Context) {
+	if s.cfg.MetricsBearerToken == "" {
+		c.Next()
+		return
+	}
+
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.MetricsBearerToken)) != 1 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	c.Next()
+}
+
+func (s *Server) handleGetMetrics() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(s.metrics, promhttp.HandlerOpts{}))
+}
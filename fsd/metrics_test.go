@@ -0,0 +1,110 @@
+package fsd
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestClientCollector verifies that connected clients are reported by type and facility.
+func TestClientCollector(t *testing.T) {
+	s := &Server{cfg: &ServerConfig{}, postOffice: newPostOffice()}
+	s.metrics = newMetricsRegistry(s)
+
+	clients := []struct {
+		callsign     string
+		isAtc        bool
+		facilityType int
+	}{
+		{"DAL1", false, 0},
+		{"DAL2", false, 0},
+		{"LAX_TWR", true, 4},
+		{"LAX_CTR", true, 6},
+		{"SCT_CTR", true, 6},
+	}
+	for _, c := range clients {
+		client := newMockClient(c.callsign)
+		client.isAtc = c.isAtc
+		client.facilityType = c.facilityType
+		client.setLatLon(33.9, -118.4)
+		if err := s.postOffice.register(client.Client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.postOffice.clientMap["DAL1"].sendChan <- "#TMserver:DAL1:hello\r\n"
+
+	families, err := s.metrics.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]float64{}
+	for _, family := range families {
+		switch family.GetName() {
+		case "openfsd_connected_clients":
+			for _, metric := range family.GetMetric() {
+				labels := map[string]string{}
+				for _, label := range metric.GetLabel() {
+					labels[label.GetName()] = label.GetValue()
+				}
+				got[labels["type"]+"/"+labels["facility"]] = metric.GetGauge().GetValue()
+			}
+		case "openfsd_send_queue_depth", "openfsd_send_queue_max_depth":
+			got[family.GetName()] = family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+
+	expected := map[string]float64{
+		"pilot/":                       2,
+		"atc/4":                        1,
+		"atc/6":                        2,
+		"openfsd_send_queue_depth":     1,
+		"openfsd_send_queue_max_depth": 1,
+	}
+	for key, value := range expected {
+		if got[key] != value {
+			t.Errorf("%s: expected %v, got %v", key, value, got[key])
+		}
+	}
+}
+
+// TestMetricsAuth verifies that /metrics requires the metrics bearer token rather than a service JWT.
+func TestMetricsAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		expected      int
+	}{
+		{"no token configured", "", "", http.StatusOK},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"correct token", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{cfg: &ServerConfig{MetricsBearerToken: tc.token}, postOffice: newPostOffice()}
+			s.metrics = newMetricsRegistry(s)
+			e := s.setupRoutes()
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expected {
+				t.Fatalf("expected status %d, got %d", tc.expected, rec.Code)
+			}
+			if rec.Code == http.StatusOK && !strings.Contains(rec.Body.String(), "openfsd_send_queue_depth") {
+				t.Error("expected openfsd metrics in response")
+			}
+		})
+	}
+}
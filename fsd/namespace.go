@@ -0,0 +1,173 @@
+package fsd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// NamespaceConfig describes an isolated network served by its own listeners, such as a sweatbox.
+type NamespaceConfig struct {
+	Name        string        `json:"name"`
+	ListenAddrs []string      `json:"listen_addrs"`
+	Sweatbox    bool          `json:"sweatbox"`
+	MaxClients  int           `json:"max_clients"`  // Zero allows any number of clients
+	Motd        string        `json:"motd"`         // Welcome message. Empty uses the one configured in the database.
+	MinRating   NetworkRating `json:"min_rating"`   // Minimum network rating allowed to log in
+	AnyPosition bool          `json:"any_position"` // Allow controllers to open any facility regardless of their rating
+}
+
+// DefaultNamespace is the name of the namespace served on FSD_LISTEN_ADDRS
+const DefaultNamespace = "live"
+
+var ErrInvalidNamespaces = errors.New("invalid namespaces")
+
+// LoadNamespaces reads a JSON-encoded file of NamespaceConfigs:
+//
+//	{"namespaces": [{"name": "sweatbox", "listen_addrs": [":6810"], "sweatbox": true, "any_position": true}]}
+func LoadNamespaces(path string) (namespaces []NamespaceConfig, err error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	file := struct {
+		Namespaces []NamespaceConfig `json:"namespaces"`
+	}{}
+	if err = json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidNamespaces, err)
+	}
+	return file.Namespaces, nil
+}
+
+// newNamespaces builds the default namespace from the server config, followed by the namespaces of the
+// namespaces file. Names and listen addresses must be unique.
+func newNamespaces(cfg *ServerConfig) (namespaces []*NamespaceConfig, err error) {
+	configs := []NamespaceConfig{{
+		Name:        DefaultNamespace,
+		ListenAddrs: cfg.FsdListenAddrs,
+		MaxClients:  cfg.FsdMaxClients,
+	}}
+	if cfg.NamespacesFile != "" {
+		var loaded []NamespaceConfig
+		if loaded, err = LoadNamespaces(cfg.NamespacesFile); err != nil {
+			return
+		}
+		configs = append(configs, loaded...)
+	}
+
+	var names, addrs []string
+	for i, config := range configs {
+		switch {
+		case config.Name == "":
+			err = fmt.Errorf("%w: a name is required", ErrInvalidNamespaces)
+		case slices.Contains(names, config.Name):
+			err = fmt.Errorf("%w: duplicate name %q", ErrInvalidNamespaces, config.Name)
+		case i > 0 && len(config.ListenAddrs) == 0:
+			err = fmt.Errorf("%w: %s has no listen addresses", ErrInvalidNamespaces, config.Name)
+		case config.MaxClients < 0:
+			err = fmt.Errorf("%w: %s has a negative client limit", ErrInvalidNamespaces, config.Name)
+		}
+		for _, addr := range config.ListenAddrs {
+			if slices.Contains(addrs, addr) {
+				err = fmt.Errorf("%w: %s is bound to more than one namespace", ErrInvalidNamespaces, addr)
+			}
+			addrs = append(addrs, addr)
+		}
+		if err != nil {
+			return
+		}
+
+		names = append(names, config.Name)
+		namespaces = append(namespaces, &config)
+	}
+	return
+}
+
+// allowsPosition returns whether a controller may open a facility in the namespace
+func (ns *NamespaceConfig) allowsPosition(rating NetworkRating, facilityType int) bool {
+	if ns != nil && ns.AnyPosition {
+		rating = NetworkRatingAdministator
+	}
+	return isAllowedFacilityType(rating, facilityType)
+}
+
+// newNamespaceServer creates the Server of an additional namespace.
+// It shares the services of s, but has its own post office and ATC state.
+func (s *Server) newNamespaceServer(ns *NamespaceConfig) (server *Server) {
+	server = &Server{
+		cfg:          s.cfg,
+		ns:           ns,
+		postOffice:   newPostOffice(),
+		metarService: s.metarService,
+		stations:     s.stations,
+		tracks:       newTrackStore(),
+		squawks:      newSquawkMonitor(),
+		capture:      s.capture,
+		restart:      s.restart,
+		nextConnID:   s.nextConnID,
+		dbRepo:       s.dbRepo,
+	}
+	server.postOffice.maxClients = ns.MaxClients
+	return
+}
+
+// namespaceServer returns the server of a namespace, or nil if there is no such namespace.
+// An empty name selects the default namespace.
+func (s *Server) namespaceServer(name string) *Server {
+	if name == "" || name == s.ns.Name {
+		return s
+	}
+	for _, server := range s.namespaces {
+		if server.ns.Name == name {
+			return server
+		}
+	}
+	return nil
+}
+
+// namespaced runs a service HTTP handler on the server of the namespace selected by the namespace query parameter
+func (s *Server) namespaced(handler func(s *Server, c *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		server := s.namespaceServer(c.Query("namespace"))
+		if server == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		handler(server, c)
+	}
+}
+
+// NamespaceResponseData describes a namespace served by the FSD server
+type NamespaceResponseData struct {
+	Name             string   `json:"name"`
+	Sweatbox         bool     `json:"sweatbox"`
+	ListenAddrs      []string `json:"listen_addrs"`
+	MaxClients       int      `json:"max_clients"`
+	ConnectedClients int      `json:"connected_clients"`
+}
+
+func (s *Server) handleGetNamespaces(c *gin.Context) {
+	resData := []NamespaceResponseData{}
+	for _, server := range append([]*Server{s}, s.namespaces...) {
+		server.postOffice.clientMapLock.RLock()
+		connected := len(server.postOffice.clientMap)
+		server.postOffice.clientMapLock.RUnlock()
+
+		resData = append(resData, NamespaceResponseData{
+			Name:             server.ns.Name,
+			Sweatbox:         server.ns.Sweatbox,
+			ListenAddrs:      server.ns.ListenAddrs,
+			MaxClients:       server.ns.MaxClients,
+			ConnectedClients: connected,
+		})
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	json.NewEncoder(c.Writer).Encode(&resData)
+}
@@ -0,0 +1,169 @@
+package fsd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/renorris/openfsd/db"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// writeNamespacesFile writes a namespaces file to a temporary directory and returns its path
+func writeNamespacesFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "namespaces.json")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewNamespaces(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		wantNames []string
+		wantErr   bool
+	}{
+		{"no file", "", []string{"live"}, false},
+		{"sweatbox", `{"namespaces": [{"name": "sweatbox", "listen_addrs": [":6810"], "sweatbox": true}]}`, []string{"live", "sweatbox"}, false},
+		{"missing name", `{"namespaces": [{"listen_addrs": [":6810"]}]}`, nil, true},
+		{"duplicate name", `{"namespaces": [{"name": "live", "listen_addrs": [":6810"]}]}`, nil, true},
+		{"no listen addresses", `{"namespaces": [{"name": "sweatbox"}]}`, nil, true},
+		{"shared listen address", `{"namespaces": [{"name": "sweatbox", "listen_addrs": [":6809"]}]}`, nil, true},
+		{"negative client limit", `{"namespaces": [{"name": "sweatbox", "listen_addrs": [":6810"], "max_clients": -1}]}`, nil, true},
+		{"malformed", `{"namespaces": [`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ServerConfig{FsdListenAddrs: []string{":6809"}}
+			if tt.file != "" {
+				cfg.NamespacesFile = writeNamespacesFile(t, tt.file)
+			}
+
+			namespaces, err := newNamespaces(&cfg)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidNamespaces) {
+					t.Errorf("expected ErrInvalidNamespaces, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, ns := range namespaces {
+				names = append(names, ns.Name)
+			}
+			if len(names) != len(tt.wantNames) {
+				t.Fatalf("expected namespaces %v, got %v", tt.wantNames, names)
+			}
+			for i := range names {
+				if names[i] != tt.wantNames[i] {
+					t.Errorf("expected namespaces %v, got %v", tt.wantNames, names)
+				}
+			}
+		})
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	live := newTestDatabaseServer(t, &ServerConfig{
+		PositionHistorySize: 10,
+		NamespacesFile: writeNamespacesFile(t, `{"namespaces": [
+			{"name": "sweatbox", "listen_addrs": [":6810"], "sweatbox": true, "max_clients": 2, "motd": "Welcome to the sweatbox", "any_position": true}
+		]}`),
+	})
+	sweatbox := live.namespaceServer("sweatbox")
+	if sweatbox == nil {
+		t.Fatal("expected the sweatbox namespace to exist")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	liveAtc := testVirtualLogin(t, ctx, live, loginData{
+		callsign:      "LAX_TWR",
+		cid:           1,
+		networkRating: NetworkRatingController1,
+		isAtc:         true,
+	})
+
+	// Callsigns are only unique within a namespace, and namespaces may override the welcome message
+	sweatboxAtc, err := sweatbox.connectVirtualClient(ctx, loginData{
+		callsign:      "LAX_TWR",
+		cid:           2,
+		networkRating: NetworkRatingObserver,
+		isAtc:         true,
+		protoRevision: 101,
+		loginTime:     time.Now(),
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectVirtualPacket(t, sweatboxAtc, "#TMserver:LAX_TWR:Welcome to the sweatbox")
+
+	// Controllers may open any position
+	sweatboxAtc.send("%LAX_TWR:18000:4:50:1:33.94250:-118.40810:0")
+	sweatboxAtc.send("$CQLAX_TWR:SERVER:ATC:LAX_TWR")
+	expectVirtualPacket(t, sweatboxAtc, "$CRSERVER:LAX_TWR:ATC:Y:LAX_TWR")
+
+	// Packets stay within their namespace
+	pilot, err := sweatbox.connectVirtualClient(ctx, loginData{
+		callsign:      "N123AB",
+		cid:           3,
+		networkRating: NetworkRatingObserver,
+		protoRevision: 101,
+		loginTime:     time.Now(),
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectVirtualPacket(t, pilot, "#TMserver:N123AB:Welcome to the sweatbox")
+	pilot.send("@N:N123AB:1200:1:33.94000:-118.40000:100:0:0:0")
+	expectVirtualPacket(t, sweatboxAtc, "@N:N123AB:1200:1:33.94000:-118.40000:100:0:0:0")
+	select {
+	case packet := <-liveAtc.packets():
+		t.Errorf("expected no packets in the live namespace, got %q", packet)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err = live.postOffice.find("N123AB"); err == nil {
+		t.Error("expected the pilot to be absent from the live namespace")
+	}
+
+	// Namespaces are limited to their own number of clients
+	if _, err = sweatbox.connectVirtualClient(ctx, loginData{callsign: "N456CD"}, false); !errors.Is(err, ErrServerFull) {
+		t.Errorf("expected ErrServerFull, got %v", err)
+	}
+}
+
+func TestNamespaceMinRating(t *testing.T) {
+	live := newTestDatabaseServer(t, &ServerConfig{
+		PositionHistorySize: 10,
+		NamespacesFile:      writeNamespacesFile(t, `{"namespaces": [{"name": "training", "listen_addrs": [":6811"], "min_rating": 5}]}`),
+	})
+	training := live.namespaceServer("training")
+
+	user := &db.User{Password: "secret", NetworkRating: int(NetworkRatingObserver)}
+	if err := live.dbRepo.UserRepo.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	cid := strconv.Itoa(user.CID)
+
+	conn, serverConn := net.Pipe()
+	defer conn.Close()
+	go training.handleConn(context.Background(), serverConn, ":6811")
+
+	scanner := bufio.NewScanner(conn)
+	expectPacketPrefix(t, scanner, "$DISERVER")
+	writeReplayPacket(conn, []byte("$IDN123AB:SERVER:0000:Test:1:0:"+cid+":0"))
+	writeReplayPacket(conn, []byte("#APN123AB:SERVER:"+cid+":secret:1:101:1:Test Pilot"))
+	expectPacketPrefix(t, scanner, "$ERserver:unknown:"+strconv.Itoa(InvalidLogonError)+"::Network rating too low")
+}
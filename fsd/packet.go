@@ -25,8 +25,57 @@ const (
 	PacketTypeHandoffAccept
 	PacketTypeFlightPlan
 	PacketTypeFlightPlanAmendment
+	PacketTypeWeatherRequest
 )
 
+// String returns the name of a packet type
+func (t PacketType) String() string {
+	switch t {
+	case PacketTypeTextMessage:
+		return "text_message"
+	case PacketTypePilotPosition:
+		return "pilot_position"
+	case PacketTypePilotPositionFast:
+		return "pilot_position_fast"
+	case PacketTypePilotPositionSlow:
+		return "pilot_position_slow"
+	case PacketTypePilotPositionStopped:
+		return "pilot_position_stopped"
+	case PacketTypeATCPosition:
+		return "atc_position"
+	case PacketTypeDeleteATC:
+		return "delete_atc"
+	case PacketTypeDeletePilot:
+		return "delete_pilot"
+	case PacketTypeClientQuery:
+		return "client_query"
+	case PacketTypeClientQueryResponse:
+		return "client_query_response"
+	case PacketTypeProController:
+		return "pro_controller"
+	case PacketTypeSquawkbox:
+		return "squawkbox"
+	case PacketTypeMetarRequest:
+		return "metar_request"
+	case PacketTypeKillRequest:
+		return "kill_request"
+	case PacketTypeAuthChallenge:
+		return "auth_challenge"
+	case PacketTypeHandoffRequest:
+		return "handoff_request"
+	case PacketTypeHandoffAccept:
+		return "handoff_accept"
+	case PacketTypeFlightPlan:
+		return "flight_plan"
+	case PacketTypeFlightPlanAmendment:
+		return "flight_plan_amendment"
+	case PacketTypeWeatherRequest:
+		return "weather_request"
+	default:
+		return "unknown"
+	}
+}
+
 // sourceCallsignFieldIndex returns the index of the field containing the source callsign
 func sourceCallsignFieldIndex(packetType PacketType) (index int) {
 	switch packetType {
@@ -39,6 +88,9 @@ func sourceCallsignFieldIndex(packetType PacketType) (index int) {
 
 // getPacketType parses the packet type given a packet
 func getPacketType(packet []byte) PacketType {
+	if len(packet) < 3 {
+		return PacketTypeUnknown
+	}
 	switch packet[0] {
 	case '^':
 		return PacketTypePilotPositionFast
@@ -62,6 +114,8 @@ func getPacketType(packet []byte) PacketType {
 			return PacketTypeProController
 		case "#SB":
 			return PacketTypeSquawkbox
+		case "#WX":
+			return PacketTypeWeatherRequest
 		default:
 			return PacketTypeUnknown
 		}
@@ -115,6 +169,8 @@ func getPacketPrefix(packetType PacketType) string {
 		return "#PC"
 	case PacketTypeSquawkbox:
 		return "#SB"
+	case PacketTypeWeatherRequest:
+		return "#WX"
 	case PacketTypeClientQuery:
 		return "$CQ"
 	case PacketTypeClientQueryResponse:
@@ -172,6 +228,8 @@ func minFields(packetType PacketType) int {
 		return 17
 	case PacketTypeFlightPlanAmendment:
 		return 18
+	case PacketTypeWeatherRequest:
+		return 3
 	default:
 		return -1
 	}
@@ -0,0 +1,63 @@
+package fsd
+
+import (
+	"sync"
+	"time"
+)
+
+// PositionSample is a single recorded pilot position report.
+type PositionSample struct {
+	Time        time.Time `json:"time"`
+	Latitude    float64   `json:"latitude"`
+	Longitude   float64   `json:"longitude"`
+	Altitude    int       `json:"altitude"`    // Feet MSL
+	Groundspeed int       `json:"groundspeed"` // Knots
+	Heading     int       `json:"heading"`     // Degrees
+	Squawk      string    `json:"squawk"`
+}
+
+// positionHistory is a bounded ring buffer of a connection's most recent position reports.
+type positionHistory struct {
+	lock    sync.Mutex
+	samples []PositionSample
+	next    int  // Index of the next sample to write
+	full    bool // Whether the buffer has wrapped
+}
+
+func newPositionHistory(capacity int) *positionHistory {
+	return &positionHistory{
+		samples: make([]PositionSample, capacity),
+	}
+}
+
+// add records a sample, overwriting the oldest sample once the buffer is full.
+func (h *positionHistory) add(sample PositionSample) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.samples) == 0 {
+		return
+	}
+
+	h.samples[h.next] = sample
+	h.next++
+	if h.next == len(h.samples) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// snapshot returns a copy of the recorded samples, oldest first.
+func (h *positionHistory) snapshot() (samples []PositionSample) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if !h.full {
+		return append([]PositionSample{}, h.samples[:h.next]...)
+	}
+
+	samples = make([]PositionSample, 0, len(h.samples))
+	samples = append(samples, h.samples[h.next:]...)
+	samples = append(samples, h.samples[:h.next]...)
+	return
+}
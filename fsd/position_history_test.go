@@ -0,0 +1,53 @@
+package fsd
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPositionHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		added    int
+		expected []int // Expected altitudes, oldest first
+	}{
+		{"empty", 3, 0, []int{}},
+		{"partial", 3, 2, []int{0, 1}},
+		{"exactly full", 3, 3, []int{0, 1, 2}},
+		{"wrapped", 3, 5, []int{2, 3, 4}},
+		{"disabled", 0, 5, []int{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newPositionHistory(tc.capacity)
+			for i := 0; i < tc.added; i++ {
+				h.add(PositionSample{Altitude: i})
+			}
+
+			samples := h.snapshot()
+			if len(samples) != len(tc.expected) {
+				t.Fatalf("expected %d samples, got %d", len(tc.expected), len(samples))
+			}
+			for i, sample := range samples {
+				if sample.Altitude != tc.expected[i] {
+					t.Errorf("sample %d: expected altitude %d, got %d", i, tc.expected[i], sample.Altitude)
+				}
+			}
+		})
+	}
+}
+
+func TestPositionHistorySizeValidation(t *testing.T) {
+	t.Setenv("POSITION_HISTORY_SIZE", "-1")
+	if _, err := LoadServerConfig(context.Background()); !errors.Is(err, ErrInvalidServerConfig) {
+		t.Errorf("expected ErrInvalidServerConfig, got %v", err)
+	}
+
+	t.Setenv("POSITION_HISTORY_SIZE", "0")
+	if _, err := LoadServerConfig(context.Background()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
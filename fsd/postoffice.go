@@ -5,11 +5,13 @@ import (
 	"github.com/tidwall/rtree"
 	"math"
 	"sync"
+	"time"
 )
 
 type postOffice struct {
 	clientMap     map[string]*Client // Callsign -> *Client
 	clientMapLock *sync.RWMutex
+	maxClients    int // Zero allows any number of clients
 
 	tree     *rtree.RTreeG[*Client] // Geospatial rtree
 	treeLock *sync.RWMutex
@@ -26,8 +28,10 @@ func newPostOffice() *postOffice {
 
 var ErrCallsignInUse = errors.New("callsign in use")
 var ErrCallsignDoesNotExist = errors.New("callsign does not exist")
+var ErrServerFull = errors.New("server full")
 
-// register adds a new Client to the post office. Returns ErrCallsignInUse when the callsign is taken.
+// register adds a new Client to the post office. Returns ErrCallsignInUse when the callsign is taken,
+// or ErrServerFull when the post office already holds its maximum number of clients.
 func (p *postOffice) register(client *Client) (err error) {
 	p.clientMapLock.Lock()
 	if _, exists := p.clientMap[client.callsign]; exists {
@@ -35,6 +39,11 @@ func (p *postOffice) register(client *Client) (err error) {
 		err = ErrCallsignInUse
 		return
 	}
+	if p.maxClients > 0 && len(p.clientMap) >= p.maxClients {
+		p.clientMapLock.Unlock()
+		err = ErrServerFull
+		return
+	}
 	p.clientMap[client.callsign] = client
 	p.clientMapLock.Unlock()
 
@@ -92,6 +101,7 @@ func (p *postOffice) search(client *Client, callback func(recipient *Client) boo
 
 	client.closestVelocityClientDistance = math.MaxFloat64
 
+	start := time.Now()
 	p.treeLock.RLock()
 	p.tree.Search(clientMin, clientMax, func(foundMin [2]float64, foundMax [2]float64, foundClient *Client) bool {
 		if foundClient == client {
@@ -110,6 +120,7 @@ func (p *postOffice) search(client *Client, callback func(recipient *Client) boo
 		return callback(foundClient)
 	})
 	p.treeLock.RUnlock()
+	rtreeSearchDuration.Observe(time.Since(start).Seconds())
 }
 
 // send sends a packet to a client with a given callsign.
@@ -0,0 +1,172 @@
+package fsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relay tunnels the sessions of local clients to an upstream FSD server.
+//
+// Clients log in and are authenticated locally as usual. Each client then gets its own connection to the
+// upstream server, logged in with the client's own login packets and the relay's upstream password. Packets from the client are verified and
+// logged locally before being forwarded upstream, and packets from the upstream server are forwarded back.
+//
+// Every client logs in upstream with the same password, so the upstream server must accept it for every CID.
+// Upstream servers which authenticate each CID with its own token are not supported.
+type relay struct {
+	addr     string
+	password string // Password to log in upstream with. Local credentials never leave this server.
+}
+
+// upstream is the connection of a relayed client to the upstream server
+type upstream struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+var ErrInvalidRelayConfig = errors.New("invalid relay config")
+var ErrUpstreamLogin = errors.New("upstream login failed")
+
+const relayDialTimeout = 10 * time.Second
+
+// newRelay creates the relay described by the config, or returns nil if relay mode is disabled.
+func newRelay(cfg *ServerConfig) (r *relay, err error) {
+	if cfg.RelayUpstreamAddr == "" {
+		return
+	}
+	if cfg.FederationListenAddr != "" || len(cfg.FederationPeers) > 0 {
+		err = fmt.Errorf("%w: relay mode cannot be combined with federation", ErrInvalidRelayConfig)
+		return
+	}
+	if cfg.RelayUpstreamPassword == "" {
+		err = fmt.Errorf("%w: an upstream password is required", ErrInvalidRelayConfig)
+		return
+	}
+	if strings.ContainsAny(cfg.RelayUpstreamPassword, ":\r\n") {
+		err = fmt.Errorf("%w: the upstream password may not contain colons or line breaks", ErrInvalidRelayConfig)
+		return
+	}
+	if _, _, parseErr := jwt.NewParser().ParseUnverified(cfg.RelayUpstreamPassword, jwt.MapClaims{}); parseErr == nil {
+		err = fmt.Errorf("%w: the upstream password is a token, which is only valid for a single CID", ErrInvalidRelayConfig)
+		return
+	}
+
+	r = &relay{
+		addr:     cfg.RelayUpstreamAddr,
+		password: cfg.RelayUpstreamPassword,
+	}
+	return
+}
+
+// connect dials the upstream server and logs in with the client's login packets and the upstream password.
+// The upstream server's answer to the login is left to be relayed to the client.
+func (r *relay) connect(ctx context.Context, client *Client) (u *upstream, err error) {
+	dialer := net.Dialer{Timeout: relayDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return
+	}
+
+	conn.SetDeadline(time.Now().Add(relayDialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	scanner := bufio.NewScanner(conn)
+	buf := make([]byte, 4096)
+	scanner.Buffer(buf, len(buf))
+
+	if !scanner.Scan() || !bytes.HasPrefix(scanner.Bytes(), []byte("$DI")) {
+		conn.Close()
+		err = fmt.Errorf("%w: no server ident received", ErrUpstreamLogin)
+		return
+	}
+
+	login := bytes.Buffer{}
+	login.Write(stripIdentChallenge(client.identPacket))
+	login.WriteString("\r\n")
+	login.Write(setAddPacketToken(client.addPacket, r.password))
+	login.WriteString("\r\n")
+	if _, err = conn.Write(login.Bytes()); err != nil {
+		conn.Close()
+		return
+	}
+
+	u = &upstream{conn: conn, scanner: scanner}
+	return
+}
+
+// stripIdentChallenge removes the vatsimauth challenge from a $ID client ident packet.
+// Challenges from the client are answered by this server, so the upstream server must not expect them.
+func stripIdentChallenge(packet []byte) []byte {
+	packet = bytes.TrimRight(packet, "\r\n")
+	if countFields(packet) == 9 {
+		packet = packet[:bytes.LastIndexByte(packet, ':')]
+	}
+	return packet
+}
+
+// relayUpstream forwards packets from the upstream server to a relayed client until either side disconnects.
+func (s *Server) relayUpstream(client *Client) {
+	defer client.cancelCtx()
+
+	go func() {
+		<-client.ctx.Done()
+		client.upstream.conn.Close()
+	}()
+
+	for client.upstream.scanner.Scan() {
+		if err := client.send(client.upstream.scanner.Text() + "\r\n"); err != nil {
+			return
+		}
+	}
+	client.logger.Info("upstream connection closed")
+}
+
+// relayPacket forwards a verified packet from a relayed client to the upstream server.
+//
+// Auth challenges addressed to the server are answered locally, and controllers are held to the same
+// facility restrictions as local controllers. Positions are recorded for the online users datafeed.
+func (s *Server) relayPacket(client *Client, packetType PacketType, packet []byte) {
+	switch packetType {
+	case PacketTypeAuthChallenge:
+		if string(getField(packet, 1)) == "SERVER" {
+			s.handleAuthChallenge(client, packet)
+			return
+		}
+	case PacketTypeATCPosition:
+		facilityType, err := strconv.Atoi(string(getField(packet, 2)))
+		if err != nil || !s.ns.allowsPosition(client.networkRating, facilityType) {
+			client.sendError(InvalidPositionForRatingError, "Invalid position for rating")
+			client.cancelCtx()
+			return
+		}
+		client.facilityType = facilityType
+		if lat, lon, ok := parseLatLon(packet, 5, 6); ok {
+			s.postOffice.updatePosition(client, [2]float64{lat, lon}, 0)
+			client.lastUpdated.Store(time.Now())
+		}
+	case PacketTypePilotPosition:
+		if lat, lon, ok := parseLatLon(packet, 4, 5); ok {
+			s.postOffice.updatePosition(client, [2]float64{lat, lon}, 0)
+			client.transponder.Store(string(getField(packet, 2)))
+			client.lastUpdated.Store(time.Now())
+		}
+	}
+
+	if _, err := client.upstream.conn.Write(packet); err != nil {
+		client.cancelCtx()
+		return
+	}
+
+	// Logging off ends the session once the upstream server has been told
+	if packetType == PacketTypeDeletePilot || packetType == PacketTypeDeleteATC {
+		client.cancelCtx()
+	}
+}
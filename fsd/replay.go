@@ -0,0 +1,255 @@
+package fsd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/renorris/openfsd/db"
+	"go.uber.org/atomic"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replayListenAddr is the listener address reported for replayed connections
+const replayListenAddr = "replay"
+
+// replayWriteTimeout bounds how long a replayed packet may wait to be read by the server
+const replayWriteTimeout = 5 * time.Second
+
+// replayLoginTimeout bounds how long a replayed login may take
+const replayLoginTimeout = 5 * time.Second
+
+// replayDrainIdle is how long the server and the capture must have been quiet before the remaining
+// connections are closed once the capture has been read
+const replayDrainIdle = 250 * time.Millisecond
+
+var ErrInvalidReplayLogin = errors.New("invalid replay login record")
+
+// replayConn is a recorded connection being replayed
+type replayConn struct {
+	conn        net.Conn // Client end of the pipe. Nil until the add packet is replayed.
+	identPacket string
+}
+
+// Replay feeds the client packets of a capture file into the server.
+//
+// Each recorded connection is replayed over an in-memory pipe. Its login packets are sent with a freshly minted
+// FSD token in place of the redacted password, followed by its client packets. Connections are closed at their
+// end records, or once the capture has been read. Packets the server sends to replayed clients are written to out
+// as server capture records carrying the recorded connection ID, if out is non-nil.
+//
+// speed scales the delay between records: 1 replays in real time, 2 twice as fast.
+// Zero or less replays without delay, in which case the relative order of packets on different connections is approximate.
+func (s *Server) Replay(ctx context.Context, r io.Reader, out io.Writer, speed float64) (err error) {
+	secretKey, err := s.dbRepo.ConfigRepo.Get(db.ConfigJwtSecretKey)
+	if err != nil {
+		return
+	}
+
+	output := &replayOutput{w: out}
+	readersWg := sync.WaitGroup{}
+	conns := make(map[uint64]*replayConn)
+	defer func() {
+		// Let the server finish sending to the remaining connections
+		if err == nil {
+			err = output.waitIdle(ctx)
+		}
+		for _, rc := range conns {
+			if rc.conn != nil {
+				rc.conn.Close()
+			}
+		}
+		readersWg.Wait()
+	}()
+
+	reader := NewCaptureReader(r)
+	var last time.Time
+	for {
+		var record CaptureRecord
+		if record, err = reader.Next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return
+		}
+
+		if speed > 0 && !last.IsZero() {
+			if delay := record.Time.Sub(last); delay > 0 {
+				select {
+				case <-time.After(time.Duration(float64(delay) / speed)):
+				case <-ctx.Done():
+					err = ctx.Err()
+					return
+				}
+			}
+		}
+		last = record.Time
+		output.touch()
+
+		switch record.Direction {
+		case CaptureDirectionLogin:
+			rc, exists := conns[record.ConnID]
+			if !exists {
+				rc = &replayConn{}
+				conns[record.ConnID] = rc
+			}
+
+			if !strings.HasPrefix(record.Packet, "#AA") && !strings.HasPrefix(record.Packet, "#AP") {
+				rc.identPacket = record.Packet
+				continue
+			}
+
+			var addPacket []byte
+			if addPacket, err = replayAddPacket(record.Packet, secretKey); err != nil {
+				return
+			}
+
+			clientConn, serverConn := net.Pipe()
+			rc.conn = clientConn
+			loggedIn := make(chan struct{})
+
+			readersWg.Add(1)
+			go func(record CaptureRecord) {
+				defer readersWg.Done()
+				output.read(clientConn, record.ConnID, record.Callsign, loggedIn)
+			}(record)
+			go s.handleConn(ctx, serverConn, replayListenAddr)
+
+			writeReplayPacket(clientConn, []byte(rc.identPacket))
+			writeReplayPacket(clientConn, addPacket)
+
+			// Wait for the server to accept or reject the login before replaying further records
+			select {
+			case <-loggedIn:
+			case <-time.After(replayLoginTimeout):
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
+		case CaptureDirectionClient:
+			if rc, exists := conns[record.ConnID]; exists && rc.conn != nil {
+				writeReplayPacket(rc.conn, []byte(record.Packet))
+			}
+		case CaptureDirectionEnd:
+			if rc, exists := conns[record.ConnID]; exists {
+				if rc.conn != nil {
+					rc.conn.Close()
+				}
+				delete(conns, record.ConnID)
+			}
+		}
+	}
+}
+
+// replayAddPacket returns a recorded add packet with a valid FSD token for its CID inserted.
+func replayAddPacket(packet string, secretKey string) (addPacket []byte, err error) {
+	cidIndex := 2 // Pilot
+	if strings.HasPrefix(packet, "#AA") {
+		cidIndex = 3
+	}
+	if countFields([]byte(packet)) <= cidIndex {
+		err = ErrInvalidReplayLogin
+		return
+	}
+
+	cid, err := strconv.Atoi(string(getField([]byte(packet), cidIndex)))
+	if err != nil {
+		err = ErrInvalidReplayLogin
+		return
+	}
+
+	token, err := MakeJwtToken(&CustomFields{
+		TokenType:     "fsd",
+		CID:           cid,
+		NetworkRating: NetworkRatingAdministator,
+	}, time.Hour)
+	if err != nil {
+		return
+	}
+
+	signedToken, err := token.SignedString([]byte(secretKey))
+	if err != nil {
+		return
+	}
+
+	addPacket = setAddPacketToken([]byte(packet), signedToken)
+	return
+}
+
+// writeReplayPacket writes a packet to the client end of a replayed connection.
+// Errors are ignored: the server may have closed the connection, e.g. because the client was kicked.
+func writeReplayPacket(conn net.Conn, packet []byte) {
+	conn.SetWriteDeadline(time.Now().Add(replayWriteTimeout))
+	conn.Write(append(packet, '\r', '\n'))
+}
+
+// replayOutput collects the packets sent by the server to replayed connections.
+type replayOutput struct {
+	w          io.Writer // Nil discards output
+	lock       sync.Mutex
+	lastPacket atomic.Time
+}
+
+// touch marks the replay as active.
+func (o *replayOutput) touch() {
+	o.lastPacket.Store(time.Now())
+}
+
+// read reads the packets sent by the server to a replayed connection until it is closed.
+// loggedIn is closed once the server has answered the login, or the connection is closed.
+func (o *replayOutput) read(conn net.Conn, connID uint64, callsign string, loggedIn chan struct{}) {
+	defer func() {
+		if loggedIn != nil {
+			close(loggedIn)
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), 4096)
+
+	for scanner.Scan() {
+		o.touch()
+		packet := strings.TrimSuffix(scanner.Text(), "\r")
+
+		// The first packet after the server ident is the welcome message, or a login error
+		if loggedIn != nil && !strings.HasPrefix(packet, "$DI") {
+			close(loggedIn)
+			loggedIn = nil
+		}
+
+		if o.w == nil {
+			continue
+		}
+
+		record := CaptureRecord{
+			Time:      time.Now(),
+			ConnID:    connID,
+			Direction: CaptureDirectionServer,
+			Callsign:  callsign,
+			Packet:    packet,
+		}
+
+		o.lock.Lock()
+		io.WriteString(o.w, record.String()+"\n")
+		o.lock.Unlock()
+	}
+}
+
+// waitIdle waits until no packet has been replayed or received for replayDrainIdle.
+func (o *replayOutput) waitIdle(ctx context.Context) (err error) {
+	for {
+		idle := time.Since(o.lastPacket.Load())
+		if idle >= replayDrainIdle {
+			return
+		}
+		select {
+		case <-time.After(replayDrainIdle - idle):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
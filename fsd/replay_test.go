@@ -0,0 +1,207 @@
+package fsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"github.com/renorris/openfsd/db"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDatabaseServer(t *testing.T, cfg *ServerConfig) *Server {
+	sqlDb, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	sqlDb.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDb.Close() })
+
+	if err = db.Migrate(sqlDb); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	dbRepo, err := db.NewRepositories(sqlDb)
+	if err != nil {
+		t.Fatalf("failed to create repositories: %v", err)
+	}
+	if err = db.InitDefaultConfig(&dbRepo.ConfigRepo); err != nil {
+		t.Fatalf("failed to initialize config: %v", err)
+	}
+
+	s, err := NewServer(cfg, dbRepo, 1)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	return s
+}
+
+// testPilotLogin logs a pilot in to the server over conn, whose other end serverConn is served by s,
+// and waits for the welcome message.
+func testPilotLogin(t *testing.T, ctx context.Context, s *Server, conn, serverConn net.Conn, callsign string, cid int) (scanner *bufio.Scanner) {
+	secretKey, err := s.dbRepo.ConfigRepo.Get(db.ConfigJwtSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addPacket, err := replayAddPacket("#AP"+callsign+":SERVER:"+strconv.Itoa(cid)+"::1:101:1:Test Pilot", secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+	go s.handleConn(ctx, serverConn, "test")
+
+	scanner = bufio.NewScanner(conn)
+	expectPacketPrefix(t, scanner, "$DISERVER")
+	writeReplayPacket(conn, []byte("$ID"+callsign+":SERVER:0000:Test:1:0:"+strconv.Itoa(cid)+":0"))
+	writeReplayPacket(conn, addPacket)
+	expectPacketPrefix(t, scanner, "#TMserver:"+callsign)
+	return
+}
+
+func expectPacketPrefix(t *testing.T, scanner *bufio.Scanner, prefix string) {
+	t.Helper()
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), prefix) {
+			return
+		}
+	}
+	t.Fatalf("connection closed before receiving %s", prefix)
+}
+
+func TestCaptureRecordRoundTrip(t *testing.T) {
+	line := "2025-06-15T10:00:00.123456789Z\t42\tC\tN123AB\t#TMN123AB:DAL1:hello: there"
+	record, err := ParseCaptureRecord(line)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if record.ConnID != 42 || record.Direction != CaptureDirectionClient || record.Callsign != "N123AB" || record.Packet != "#TMN123AB:DAL1:hello: there" {
+		t.Errorf("unexpected record: %+v", record)
+	}
+	if got := record.String(); got != line {
+		t.Errorf("expected %q, got %q", line, got)
+	}
+
+	for _, invalid := range []string{"", "2025-06-15T10:00:00Z\t1\tC\tN1", "2025-06-15T10:00:00Z\t1\tX\tN1\t#TM", "yesterday\t1\tC\tN1\t#TM"} {
+		if _, err := ParseCaptureRecord(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestSetAddPacketToken(t *testing.T) {
+	tests := []struct {
+		packet   string
+		expected string
+	}{
+		{"#APN123AB:SERVER:100001:secret:1:101:1:Test Pilot\r\n", "#APN123AB:SERVER:100001::1:101:1:Test Pilot"},
+		{"#AALAX_TWR:SERVER:Test Controller:100002:secret:5:100", "#AALAX_TWR:SERVER:Test Controller:100002::5:100"},
+	}
+	for _, tc := range tests {
+		if got := string(setAddPacketToken([]byte(tc.packet), "")); got != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, got)
+		}
+	}
+}
+
+// TestLoginPacketsRedactToken verifies that the password/token is not retained with the login data.
+func TestLoginPacketsRedactToken(t *testing.T) {
+	conn, serverConn := net.Pipe()
+	defer conn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		writeReplayPacket(conn, []byte("$IDN123AB:SERVER:0000:Test:1:0:100001:0"))
+		writeReplayPacket(conn, []byte("#APN123AB:SERVER:100001:secret:1:101:1:Test Pilot"))
+	}()
+
+	data, token, err := readLoginPackets(slog.Default(), serverConn, bufio.NewScanner(serverConn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "secret" {
+		t.Errorf("expected token %q, got %q", "secret", token)
+	}
+	if expected := "#APN123AB:SERVER:100001::1:101:1:Test Pilot"; string(data.addPacket) != expected {
+		t.Errorf("expected %q, got %q", expected, data.addPacket)
+	}
+}
+
+// TestCaptureAndReplay captures a conversation between two pilots and replays it into a fresh server.
+func TestCaptureAndReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	captureDir := t.TempDir()
+	recorder := newTestDatabaseServer(t, &ServerConfig{
+		PositionHistorySize: 1,
+		CaptureDir:          captureDir,
+		CaptureCallsigns:    []string{"n1"},
+		CaptureMaxFiles:     2,
+	})
+
+	conn1, serverConn1 := net.Pipe()
+	testPilotLogin(t, ctx, recorder, conn1, serverConn1, "N1", 100001)
+	conn2, serverConn2 := net.Pipe()
+	scanner2 := testPilotLogin(t, ctx, recorder, conn2, serverConn2, "N2", 100002)
+
+	// Message text may contain tabs, which survive the capture as the packet is the last field
+	writeReplayPacket(conn1, []byte("#TMN1:N2:hello\tthere"))
+	expectPacketPrefix(t, scanner2, "#TMN1:N2:hello\tthere")
+	conn1.Close()
+
+	// The end record is written shortly after N2 is notified of the disconnect
+	expectPacketPrefix(t, scanner2, "#DPN1")
+	var capture []byte
+	for deadline := time.Now().Add(2 * time.Second); !bytes.Contains(capture, []byte("\tE\t")); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no end record captured:\n%s", capture)
+		}
+		files, err := filepath.Glob(filepath.Join(captureDir, "capture-*.log"))
+		if err != nil || len(files) != 1 {
+			t.Fatalf("expected 1 capture file, got %d (%v)", len(files), err)
+		}
+		if capture, err = os.ReadFile(files[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var directions []CaptureDirection
+	reader := NewCaptureReader(bytes.NewReader(capture))
+	for {
+		record, err := reader.Next()
+		if err != nil {
+			break
+		}
+		if record.Callsign != "N1" {
+			t.Errorf("captured packet of %s", record.Callsign)
+		}
+		if strings.Contains(record.Packet, "eyJ") {
+			t.Errorf("captured token in %q", record.Packet)
+		}
+		directions = append(directions, record.Direction)
+	}
+	if string(directions[:2]) != "LL" || directions[len(directions)-1] != CaptureDirectionEnd || !bytes.Contains(capture, []byte("\tC\tN1\t#TMN1:N2:hello\tthere\n")) {
+		t.Fatalf("unexpected capture:\n%s", capture)
+	}
+
+	// Replay into a fresh server, along with a recording of N2 so that the message has a recipient
+	replayer := newTestDatabaseServer(t, &ServerConfig{PositionHistorySize: 1})
+	recording := "2025-06-15T10:00:00Z\t7\tL\tN2\t$IDN2:SERVER:0000:Test:1:0:100002:0\n" +
+		"2025-06-15T10:00:00Z\t7\tL\tN2\t#APN2:SERVER:100002::1:101:1:Test Pilot\n" +
+		string(capture)
+
+	out := bytes.Buffer{}
+	if err := replayer.Replay(ctx, strings.NewReader(recording), &out, 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(out.String(), "\t7\tS\tN2\t#TMN1:N2:hello\tthere\n") {
+		t.Errorf("expected N2 to receive the replayed message, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,345 @@
+package fsd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// restarter hands the listeners and clients of this process over to a new process.
+//
+// Every listener of the server is created through the restarter, so that a new process can inherit it
+// and keep accepting connections from the same socket. Clients are paused, and their sockets are passed
+// to the new process along with their state, so that they stay connected across the restart.
+type restarter struct {
+	timeout time.Duration // How long the new process may take to start serving
+	pidFile string        // File the PID of the new process is written to. Empty if not configured.
+
+	lock       sync.Mutex
+	listeners  []restartListener       // Listeners created by this process
+	inherited  map[string]net.Listener // Listeners inherited from the previous process and not yet claimed, by address
+	previous   *net.UnixConn           // Connection to the previous process handing its clients over. Nil unless restarted.
+	restarting bool
+	done       chan struct{} // Closed once every client has been handed over to a new process
+}
+
+type restartListener struct {
+	addr     string
+	listener net.Listener
+}
+
+var ErrRestartInProgress = errors.New("restart already in progress")
+var ErrRestartFailed = errors.New("restart failed")
+var ErrRestartUnsupported = errors.New("restart is only supported on linux")
+
+// restartWarning is sent to clients which cannot be handed over to the new process before they are disconnected
+const restartWarning = "The server is restarting. Please reconnect."
+
+// newRestarter creates the restarter of a server, claiming anything inherited from a previous process.
+func newRestarter(cfg *ServerConfig) (r *restarter) {
+	r = &restarter{
+		timeout: cfg.RestartTimeout,
+		pidFile: cfg.RestartPidFile,
+		done:    make(chan struct{}),
+	}
+	r.inherited, r.previous = inheritRestart()
+	return
+}
+
+// listen creates a TCP listener, or claims the one inherited from the previous process for the same address.
+func (r *restarter) listen(ctx context.Context, addr string) (listener net.Listener, err error) {
+	if r == nil {
+		config := net.ListenConfig{}
+		return config.Listen(ctx, "tcp4", addr)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if inherited, ok := r.inherited[addr]; ok {
+		delete(r.inherited, addr)
+		listener = inherited
+	} else {
+		config := net.ListenConfig{}
+		if listener, err = config.Listen(ctx, "tcp4", addr); err != nil {
+			return
+		}
+	}
+	r.listeners = append(r.listeners, restartListener{addr: addr, listener: listener})
+	return
+}
+
+// closeListeners stops accepting connections on every listener, including inherited ones nobody claimed
+func (r *restarter) closeListeners() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, l := range r.listeners {
+		l.listener.Close()
+	}
+	for _, listener := range r.inherited {
+		listener.Close()
+	}
+	r.listeners = nil
+	r.inherited = nil
+}
+
+// handedOver returns a channel which is closed once this process has handed over to a new process
+func (r *restarter) handedOver() <-chan struct{} {
+	if r == nil {
+		return nil
+	}
+	return r.done
+}
+
+// handoverMessage is a message exchanged with a new process during a restart.
+// Messages holding a client are accompanied by the client's socket.
+type handoverMessage struct {
+	Ready   bool          `json:"ready,omitempty"` // Sent by the new process once it is serving
+	Tracks  []trackState  `json:"tracks,omitempty"`
+	History *historyState `json:"history,omitempty"` // Sent in batches ahead of the client it belongs to
+	Client  *clientState  `json:"client,omitempty"`
+	Done    bool          `json:"done,omitempty"` // Sent once every client has been handed over
+}
+
+// historyState is a batch of the position history of a client handed over to a new process
+type historyState struct {
+	Namespace string           `json:"namespace"`
+	Callsign  string           `json:"callsign"`
+	Samples   []PositionSample `json:"samples"`
+}
+
+// clientState is the state of a client handed over to a new process
+type clientState struct {
+	Namespace        string        `json:"namespace"`
+	ListenAddr       string        `json:"listen_addr"`
+	SessionID        int64         `json:"session_id"`
+	Callsign         string        `json:"callsign"`
+	CID              int           `json:"cid"`
+	RealName         string        `json:"real_name"`
+	NetworkRating    NetworkRating `json:"network_rating"`
+	MaxNetworkRating NetworkRating `json:"max_network_rating"`
+	ProtoRevision    int           `json:"proto_revision"`
+	LoginTime        time.Time     `json:"login_time"`
+	ClientID         uint16        `json:"client_id"`
+	ClientChallenge  string        `json:"client_challenge"`
+	ClientSoftware   string        `json:"client_software"`
+	IsATC            bool          `json:"is_atc"`
+	FacilityType     int           `json:"facility_type"`
+	Lat              float64       `json:"lat"`
+	Lon              float64       `json:"lon"`
+	VisRange         float64       `json:"vis_range"`
+	FlightPlan       string        `json:"flight_plan"`
+	Frequency        string        `json:"frequency"`
+	Altitude         int32         `json:"altitude"`
+	Groundspeed      int32         `json:"groundspeed"`
+	Transponder      string        `json:"transponder"`
+	Heading          int32         `json:"heading"`
+	LastUpdated      time.Time     `json:"last_updated"`
+	AuthInit         [16]byte      `json:"auth_init"`
+	AuthCurr         [16]byte      `json:"auth_curr"`
+	SendFastEnabled  bool          `json:"send_fast_enabled"`
+	TrackStateSent   bool          `json:"track_state_sent"`
+	Pending          []byte        `json:"pending"` // Partial packet read from the client before it was paused
+	Outbox           []string      `json:"outbox"`  // Packets queued for the client but not yet sent
+
+	History []PositionSample `json:"-"` // Position history, oldest first. Handed over in separate messages.
+}
+
+// newClientState captures the state of a paused client
+func newClientState(namespace string, client *Client, pending []byte, outbox []string) *clientState {
+	latLon := client.latLon()
+	var history []PositionSample
+	if client.history != nil {
+		history = client.history.snapshot()
+	}
+	return &clientState{
+		Namespace:        namespace,
+		ListenAddr:       client.listenAddr,
+		SessionID:        client.sessionID,
+		Callsign:         client.callsign,
+		CID:              client.cid,
+		RealName:         client.realName,
+		NetworkRating:    client.networkRating,
+		MaxNetworkRating: client.maxNetworkRating,
+		ProtoRevision:    client.protoRevision,
+		LoginTime:        client.loginTime,
+		ClientID:         client.clientId,
+		ClientChallenge:  client.clientChallenge,
+		ClientSoftware:   client.clientSoftware,
+		IsATC:            client.isAtc,
+		FacilityType:     client.facilityType,
+		Lat:              latLon[0],
+		Lon:              latLon[1],
+		VisRange:         client.visRange.Load(),
+		FlightPlan:       client.flightPlan.Load(),
+		Frequency:        client.frequency.Load(),
+		Altitude:         client.altitude.Load(),
+		Groundspeed:      client.groundspeed.Load(),
+		Transponder:      client.transponder.Load(),
+		Heading:          client.heading.Load(),
+		LastUpdated:      client.lastUpdated.Load(),
+		AuthInit:         client.authState.init,
+		AuthCurr:         client.authState.curr,
+		SendFastEnabled:  client.sendFastEnabled,
+		TrackStateSent:   client.trackStateSent,
+		Pending:          pending,
+		Outbox:           outbox,
+		History:          history,
+	}
+}
+
+func (state *clientState) loginData() loginData {
+	return loginData{
+		clientChallenge:  state.ClientChallenge,
+		callsign:         state.Callsign,
+		cid:              state.CID,
+		realName:         state.RealName,
+		networkRating:    state.NetworkRating,
+		maxNetworkRating: state.MaxNetworkRating,
+		protoRevision:    state.ProtoRevision,
+		loginTime:        state.LoginTime,
+		clientId:         state.ClientID,
+		clientSoftware:   state.ClientSoftware,
+		isAtc:            state.IsATC,
+	}
+}
+
+// restore sets the state of a client created from the login data of the state
+func (state *clientState) restore(client *Client) {
+	client.sessionID = state.SessionID
+	client.listenAddr = state.ListenAddr
+	client.resumed = true
+	client.facilityType = state.FacilityType
+	client.setLatLon(state.Lat, state.Lon)
+	client.visRange.Store(state.VisRange)
+	client.flightPlan.Store(state.FlightPlan)
+	client.frequency.Store(state.Frequency)
+	client.altitude.Store(state.Altitude)
+	client.groundspeed.Store(state.Groundspeed)
+	client.transponder.Store(state.Transponder)
+	client.heading.Store(state.Heading)
+	client.lastUpdated.Store(state.LastUpdated)
+	client.authState = VatsimAuthState{init: state.AuthInit, curr: state.AuthCurr, clientId: state.ClientID}
+	client.sendFastEnabled = state.SendFastEnabled
+	client.trackStateSent = state.TrackStateSent
+}
+
+// trackState is the shared ATC state of an aircraft handed over to a new process
+type trackState struct {
+	Namespace          string        `json:"namespace"`
+	Callsign           string        `json:"callsign"`
+	TrackingController string        `json:"tracking_controller"`
+	Scratchpad         string        `json:"scratchpad"`
+	TempAltitude       string        `json:"temp_altitude"`
+	FinalAltitude      string        `json:"final_altitude"`
+	BeaconCode         string        `json:"beacon_code"`
+	HandoffFrom        string        `json:"handoff_from"`
+	HandoffTo          string        `json:"handoff_to"`
+	HandoffStatus      handoffStatus `json:"handoff_status"`
+	HandoffExpires     time.Time     `json:"handoff_expires"`
+}
+
+func newTrackState(namespace string, callsign string, state aircraftState) trackState {
+	return trackState{
+		Namespace:          namespace,
+		Callsign:           callsign,
+		TrackingController: state.trackingController,
+		Scratchpad:         state.scratchpad,
+		TempAltitude:       state.tempAltitude,
+		FinalAltitude:      state.finalAltitude,
+		BeaconCode:         state.beaconCode,
+		HandoffFrom:        state.handoff.from,
+		HandoffTo:          state.handoff.to,
+		HandoffStatus:      state.handoff.status,
+		HandoffExpires:     state.handoff.expires,
+	}
+}
+
+func (state *trackState) aircraftState() aircraftState {
+	return aircraftState{
+		trackingController: state.TrackingController,
+		scratchpad:         state.Scratchpad,
+		tempAltitude:       state.TempAltitude,
+		finalAltitude:      state.FinalAltitude,
+		beaconCode:         state.BeaconCode,
+		handoff: handoffState{
+			from:    state.HandoffFrom,
+			to:      state.HandoffTo,
+			status:  state.HandoffStatus,
+			expires: state.HandoffExpires,
+		},
+	}
+}
+
+// warnRestart tells a client which cannot be handed over to the new process about the restart, then disconnects it.
+func (s *Server) warnRestart(client *Client) {
+	s.sendServerTextMessage(client, restartWarning)
+	client.cancelCtx()
+}
+
+// resumeClient serves a client handed over by the previous process on its socket file.
+func (s *Server) resumeClient(ctx context.Context, state *clientState, file *os.File) {
+	conn, err := net.FileConn(file)
+	file.Close()
+	if err != nil {
+		slog.Warn("unable to resume client", "callsign", state.Callsign, "error", err)
+		return
+	}
+	defer conn.Close()
+
+	server := s.namespaceServer(state.Namespace)
+	if server == nil {
+		slog.Warn("unable to resume client of unknown namespace", "callsign", state.Callsign, "namespace", state.Namespace)
+		conn.Write([]byte(buildServerTextMessagePacket(state.Callsign, restartWarning)))
+		return
+	}
+
+	connID := server.nextConnID.Inc()
+	data := state.loginData()
+	logger := withLoginData(server.connLogger(connID, remoteIP(conn)), &data)
+
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error("connection goroutine panicked", "panic", err, "stack", string(debug.Stack()))
+		}
+	}()
+
+	transport := newConnTransport(conn, state.Pending)
+	client := newClient(ctx, transport, data, logger)
+	client.connID = connID
+	state.restore(client)
+	if !client.isAtc {
+		client.history = newPositionHistory(server.cfg.PositionHistorySize)
+		for _, sample := range state.History {
+			client.history.add(sample)
+		}
+	}
+	if server.capture.matches(client.listenAddr, client.callsign) {
+		client.capture = server.capture
+		defer client.capturePacket(CaptureDirectionEnd, nil)
+	}
+
+	// Packets queued before the handover are sent ahead of anything new
+	for _, packet := range state.Outbox {
+		if _, err = transport.Write([]byte(packet)); err != nil {
+			return
+		}
+	}
+
+	if err = server.postOffice.register(client); err != nil {
+		logger.Warn("unable to resume client", "error", err)
+		server.warnRestart(client)
+		if client.sessionID != 0 {
+			server.endSession(client, client.sessionID)
+		}
+		return
+	}
+
+	server.serveClient(client)
+}
@@ -0,0 +1,532 @@
+//go:build linux
+
+package fsd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Environment variables describing what a new process inherits from the process restarting it.
+// Inherited listeners are passed as file descriptors 3 onwards, followed by the handover socket.
+const (
+	restartListenersEnv = "OPENFSD_RESTART_LISTENERS" // Comma-separated addresses of the inherited listeners
+	restartHandoverEnv  = "OPENFSD_RESTART_HANDOVER"  // File descriptor of the handover socket
+)
+
+const (
+	handoverMessageSize   = 128 << 10       // Maximum size of a handover message
+	handoverTrackBatch    = 256             // Number of aircraft states per handover message
+	handoverHistoryBatch  = 256             // Number of position samples per handover message
+	restartPauseTimeout   = 5 * time.Second // How long clients may take to pause for handover
+	restartReleaseTimeout = 5 * time.Second // How long clients which are not handed over may take to be released
+)
+
+var errHandoverMessageTooLarge = errors.New("handover message too large")
+
+// inheritRestart claims the listeners and handover socket passed down by a previous process, if any.
+func inheritRestart() (listeners map[string]net.Listener, previous *net.UnixConn) {
+	addrs := os.Getenv(restartListenersEnv)
+	handoverFd := os.Getenv(restartHandoverEnv)
+	os.Unsetenv(restartListenersEnv)
+	os.Unsetenv(restartHandoverEnv)
+	if handoverFd == "" {
+		return
+	}
+
+	listeners = make(map[string]net.Listener)
+	if addrs != "" {
+		for i, addr := range strings.Split(addrs, ",") {
+			file := os.NewFile(uintptr(3+i), addr)
+			listener, err := net.FileListener(file)
+			file.Close()
+			if err != nil {
+				slog.Warn("unable to inherit listener", "addr", addr, "error", err)
+				continue
+			}
+			listeners[addr] = listener
+		}
+	}
+
+	fd, err := strconv.Atoi(handoverFd)
+	if err != nil {
+		slog.Warn("invalid handover socket", "fd", handoverFd)
+		return
+	}
+	file := os.NewFile(uintptr(fd), "handover")
+	conn, err := net.FileConn(file)
+	file.Close()
+	if err != nil {
+		slog.Warn("unable to inherit handover socket", "error", err)
+		return
+	}
+	previous, _ = conn.(*net.UnixConn)
+	return
+}
+
+// watchRestartSignal restarts the server into a new process when SIGUSR2 is received
+func (s *Server) watchRestartSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			slog.Info("restarting into a new process")
+			if err := s.Restart(ctx); err != nil {
+				slog.Error("restart failed", "error", err)
+			}
+			select {
+			case <-s.restart.handedOver():
+				return
+			default:
+			}
+		}
+	}
+}
+
+// Restart hands this server over to a new process running the same executable with the same arguments and
+// environment. The new process inherits every listener, and clients are handed over with their state so that
+// they stay connected. Run returns once the handover is complete.
+//
+// If the new process does not start serving within RESTART_TIMEOUT, it is killed and this server carries on.
+func (s *Server) Restart(ctx context.Context) (err error) {
+	r := s.restart
+	r.lock.Lock()
+	if r.restarting {
+		r.lock.Unlock()
+		return ErrRestartInProgress
+	}
+	r.restarting = true
+	r.lock.Unlock()
+
+	defer func() {
+		if err != nil {
+			r.lock.Lock()
+			r.restarting = false
+			r.lock.Unlock()
+		}
+	}()
+
+	local, remote, err := handoverSocketPair()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRestartFailed, err)
+	}
+	defer local.Close()
+
+	cmd, err := r.startProcess(remote)
+	remote.Close()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRestartFailed, err)
+	}
+
+	// The new process closes its end of the socket if it exits before it is ready
+	local.SetReadDeadline(time.Now().Add(r.timeout))
+	msg, file, err := readHandoverMessage(local)
+	if file != nil {
+		file.Close()
+	}
+	if err == nil && !msg.Ready {
+		err = errors.New("unexpected handover message")
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("%w: the new process did not start serving: %w", ErrRestartFailed, err)
+	}
+	local.SetReadDeadline(time.Time{})
+	go cmd.Wait()
+
+	slog.Info("new process is serving", "pid", cmd.Process.Pid)
+	if r.pidFile != "" {
+		if err := os.WriteFile(r.pidFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644); err != nil {
+			slog.Warn("unable to write PID file", "path", r.pidFile, "error", err)
+		}
+	}
+
+	// The new process accepts every connection from now on
+	r.closeListeners()
+
+	err = s.handOverClients(local)
+	close(r.done)
+	return
+}
+
+// startProcess starts a copy of this process which inherits every listener and the handover socket
+func (r *restarter) startProcess(handover *os.File) (cmd *exec.Cmd, err error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return
+	}
+
+	var addrs []string
+	var files []*os.File
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	r.lock.Lock()
+	for _, l := range r.listeners {
+		fileListener, ok := l.listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		var file *os.File
+		if file, err = fileListener.File(); err != nil {
+			r.lock.Unlock()
+			return
+		}
+		addrs = append(addrs, l.addr)
+		files = append(files, file)
+	}
+	r.lock.Unlock()
+
+	cmd = exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		restartListenersEnv+"="+strings.Join(addrs, ","),
+		restartHandoverEnv+"="+strconv.Itoa(3+len(files)),
+	)
+	cmd.ExtraFiles = append(slices.Clone(files), handover)
+	err = cmd.Start()
+	return
+}
+
+// handoverSocketPair creates the socket clients are handed over on. Remote is passed to the new process.
+func handoverSocketPair() (local *net.UnixConn, remote *os.File, err error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return
+	}
+	remote = os.NewFile(uintptr(fds[1]), "handover")
+
+	localFile := os.NewFile(uintptr(fds[0]), "handover")
+	defer localFile.Close()
+	conn, err := net.FileConn(localFile)
+	if err != nil {
+		remote.Close()
+		return
+	}
+	local = conn.(*net.UnixConn)
+	return
+}
+
+// writeHandoverMessage sends a single message, along with a file such as a client's socket if not nil.
+func writeHandoverMessage(conn *net.UnixConn, msg *handoverMessage, file *os.File) (err error) {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	if len(buf) > handoverMessageSize {
+		return errHandoverMessageTooLarge
+	}
+
+	var oob []byte
+	if file != nil {
+		var rawConn syscall.RawConn
+		if rawConn, err = file.SyscallConn(); err != nil {
+			return
+		}
+		rawConn.Control(func(fd uintptr) {
+			oob = syscall.UnixRights(int(fd))
+		})
+	}
+
+	_, _, err = conn.WriteMsgUnix(buf, oob, nil)
+	return
+}
+
+// readHandoverMessage receives a single message, along with the file sent with it if any.
+func readHandoverMessage(conn *net.UnixConn) (msg handoverMessage, file *os.File, err error) {
+	buf := make([]byte, handoverMessageSize)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return
+	}
+
+	if oobn > 0 {
+		var cmsgs []syscall.SocketControlMessage
+		if cmsgs, err = syscall.ParseSocketControlMessage(oob[:oobn]); err != nil {
+			return
+		}
+		for i := range cmsgs {
+			fds, err := syscall.ParseUnixRights(&cmsgs[i])
+			if err != nil {
+				continue
+			}
+			for _, fd := range fds {
+				syscall.CloseOnExec(fd)
+				if file == nil {
+					file = os.NewFile(uintptr(fd), "client")
+				} else {
+					syscall.Close(fd)
+				}
+			}
+		}
+	}
+
+	if err = json.Unmarshal(buf[:n], &msg); err != nil && file != nil {
+		file.Close()
+		file = nil
+	}
+	return
+}
+
+// handOverClients pauses every client of this process, and passes their sockets and state to the new process
+// over conn. Clients which cannot be handed over are warned and disconnected, and their sessions are ended
+// before handOverClients returns.
+func (s *Server) handOverClients(conn *net.UnixConn) (err error) {
+	type pausedClient struct {
+		server    *Server
+		client    *Client
+		transport *connTransport
+		file      *os.File // Duplicate of the client's socket for the new process
+	}
+
+	// Clients which are not handed over end their sessions as they are released by this process,
+	// which must not exit before then as the new process does not end them.
+	var released []*Client
+	warn := func(server *Server, client *Client) {
+		server.warnRestart(client)
+		released = append(released, client)
+	}
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), restartReleaseTimeout)
+		defer cancel()
+		for _, client := range released {
+			select {
+			case <-client.served:
+			case <-releaseCtx.Done():
+				client.logger.Warn("client was not released before handover completed")
+			}
+		}
+	}()
+
+	// Virtual clients are recreated by the new process. Disconnect them first, so that clients handed over
+	// are told about it before they see them connect again.
+	servers := append([]*Server{s}, s.namespaces...)
+	disconnectVirtualClients(servers)
+
+	// Pause every client before handing any over, so that no packets are sent to clients already handed over
+	var pausing []pausedClient
+	for _, server := range servers {
+		var clients []*Client
+		server.postOffice.all(nil, func(client *Client) bool {
+			clients = append(clients, client)
+			return true
+		})
+
+		for _, client := range clients {
+			// Virtual clients were disconnected above, and linked servers link to the new process instead
+			if client.virtual || client.peer != nil {
+				continue
+			}
+			transport, ok := client.transport.(*connTransport)
+			if !ok || client.upstream != nil {
+				warn(server, client)
+				continue
+			}
+			file, err := socketFile(transport.Conn)
+			if err != nil {
+				client.logger.Warn("unable to hand client over", "error", err)
+				warn(server, client)
+				continue
+			}
+			transport.pause()
+			pausing = append(pausing, pausedClient{server: server, client: client, transport: transport, file: file})
+		}
+	}
+
+	pauseCtx, cancel := context.WithTimeout(context.Background(), restartPauseTimeout)
+	defer cancel()
+
+	var paused []pausedClient
+	for _, p := range pausing {
+		select {
+		case <-p.transport.paused:
+			paused = append(paused, p)
+			continue
+		case <-p.client.ctx.Done():
+			released = append(released, p.client)
+		case <-pauseCtx.Done():
+			p.client.logger.Warn("client did not pause for handover")
+			warn(p.server, p.client)
+		}
+		p.file.Close()
+	}
+
+	// Hand over the shared ATC state before the controllers relying on it
+	var tracks []trackState
+	for _, server := range servers {
+		for callsign, state := range server.tracks.snapshot() {
+			tracks = append(tracks, newTrackState(server.ns.Name, callsign, state))
+		}
+	}
+	for batch := range slices.Chunk(tracks, handoverTrackBatch) {
+		if err = writeHandoverMessage(conn, &handoverMessage{Tracks: batch}, nil); err != nil {
+			break
+		}
+	}
+
+	handedOver := 0
+	for _, p := range paused {
+		if err != nil {
+			warn(p.server, p.client)
+			p.file.Close()
+			continue
+		}
+
+		// Let the event loop return without releasing the client, then collect whatever the sender left unsent
+		select {
+		case p.client.handover <- true:
+		case <-p.client.ctx.Done():
+			released = append(released, p.client)
+			p.file.Close()
+			continue
+		}
+		<-p.client.senderDone
+		var outbox []string
+		for drained := false; !drained; {
+			select {
+			case packet := <-p.client.sendChan:
+				outbox = append(outbox, packet)
+			default:
+				drained = true
+			}
+		}
+
+		state := newClientState(p.server.ns.Name, p.client, p.transport.pending, outbox)
+		if writeErr := writeClientHandover(conn, state, p.file); writeErr != nil {
+			// The client is no longer served by this process, so it is warned over the duplicate socket
+			// and its session is ended here
+			p.client.logger.Warn("unable to hand client over", "error", writeErr)
+			p.file.Write([]byte(buildServerTextMessagePacket(p.client.callsign, restartWarning)))
+			if p.client.sessionID != 0 {
+				p.server.endSession(p.client, p.client.sessionID)
+			}
+			if !errors.Is(writeErr, errHandoverMessageTooLarge) {
+				err = writeErr
+			}
+		} else {
+			handedOver++
+		}
+		p.file.Close()
+	}
+
+	if err == nil {
+		err = writeHandoverMessage(conn, &handoverMessage{Done: true}, nil)
+	}
+	slog.Info("handed clients over to new process", "clients", handedOver)
+	return
+}
+
+// disconnectVirtualClients disconnects the virtual clients of servers, and waits until every client was told
+// about it.
+func disconnectVirtualClients(servers []*Server) {
+	var virtual []*Client
+	for _, server := range servers {
+		server.postOffice.all(nil, func(client *Client) bool {
+			if client.virtual {
+				virtual = append(virtual, client)
+			}
+			return true
+		})
+	}
+
+	releaseCtx, cancel := context.WithTimeout(context.Background(), restartReleaseTimeout)
+	defer cancel()
+	for _, client := range virtual {
+		client.cancelCtx()
+		select {
+		case <-client.served:
+		case <-releaseCtx.Done():
+			client.logger.Warn("virtual client was not released before handover")
+		}
+	}
+}
+
+// writeClientHandover sends the state of a client along with its socket, preceded by its position history.
+func writeClientHandover(conn *net.UnixConn, state *clientState, file *os.File) (err error) {
+	for batch := range slices.Chunk(state.History, handoverHistoryBatch) {
+		history := historyState{Namespace: state.Namespace, Callsign: state.Callsign, Samples: batch}
+		if err = writeHandoverMessage(conn, &handoverMessage{History: &history}, nil); err != nil {
+			return
+		}
+	}
+	return writeHandoverMessage(conn, &handoverMessage{Client: state}, file)
+}
+
+// socketFile duplicates the file descriptor of a socket
+func socketFile(conn net.Conn) (file *os.File, err error) {
+	fileConn, ok := conn.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, errors.New("connection is not a socket")
+	}
+	return fileConn.File()
+}
+
+// resumeClients tells the previous process that this process is serving, then serves the clients it hands over.
+func (s *Server) resumeClients(ctx context.Context, previous *net.UnixConn) {
+	defer previous.Close()
+
+	if err := writeHandoverMessage(previous, &handoverMessage{Ready: true}, nil); err != nil {
+		slog.Error("unable to reach previous process", "error", err)
+		return
+	}
+
+	resumed := 0
+	histories := make(map[[2]string][]PositionSample) // Position histories received ahead of their clients, by namespace and callsign
+	for {
+		msg, file, err := readHandoverMessage(previous)
+		if err != nil {
+			slog.Error("handover from previous process failed", "error", err)
+			return
+		}
+
+		for i := range msg.Tracks {
+			if server := s.namespaceServer(msg.Tracks[i].Namespace); server != nil {
+				server.tracks.replace(msg.Tracks[i].Callsign, msg.Tracks[i].aircraftState())
+			}
+		}
+		if msg.History != nil {
+			key := [2]string{msg.History.Namespace, msg.History.Callsign}
+			histories[key] = append(histories[key], msg.History.Samples...)
+		}
+		if msg.Client != nil {
+			key := [2]string{msg.Client.Namespace, msg.Client.Callsign}
+			msg.Client.History = histories[key]
+			delete(histories, key)
+		}
+		if msg.Client != nil && file != nil {
+			go s.resumeClient(ctx, msg.Client, file)
+			resumed++
+		} else if file != nil {
+			file.Close()
+		}
+
+		if msg.Done {
+			slog.Info("resumed clients from previous process", "clients", resumed)
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package fsd
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSocketPair connects two ends of a TCP socket, which unlike net.Pipe can be handed over to a new process
+func testSocketPair(t *testing.T) (conn, serverConn net.Conn) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if conn, err = net.Dial("tcp4", listener.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if serverConn, err = listener.Accept(); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return
+}
+
+func TestRestartHandover(t *testing.T) {
+	previous := newTestDatabaseServer(t, &ServerConfig{PositionHistorySize: 300})
+	next, err := NewServer(&ServerConfig{PositionHistorySize: 300}, previous.dbRepo, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousCtx, cancelPrevious := context.WithCancel(context.Background())
+	defer cancelPrevious()
+	nextCtx, cancelNext := context.WithCancel(context.Background())
+	defer cancelNext()
+
+	sender, serverConn := testSocketPair(t)
+	testPilotLogin(t, previousCtx, previous, sender, serverConn, "N1", 1)
+	recipient, serverConn := testSocketPair(t)
+	scanner := testPilotLogin(t, previousCtx, previous, recipient, serverConn, "N2", 2)
+	previous.tracks.replace("N1", aircraftState{scratchpad: "DCT"})
+
+	// Virtual clients are disconnected, as the new process connects them again
+	vc, err := previous.connectVirtualClient(previousCtx, loginData{callsign: "V1"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			select {
+			case <-vc.packets():
+			case <-vc.done():
+				return
+			}
+		}
+	}()
+
+	// Position histories span several handover messages
+	client, err := previous.postOffice.find("N1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 300 {
+		client.history.add(PositionSample{Altitude: i})
+	}
+
+	// Clients which are not connected over a socket cannot be handed over
+	pipe, serverPipe := net.Pipe()
+	pipeScanner := testPilotLogin(t, previousCtx, previous, pipe, serverPipe, "N3", 3)
+	warning := make(chan string, 1)
+	go func() {
+		for pipeScanner.Scan() {
+			if strings.HasPrefix(pipeScanner.Text(), "#TMserver:N3:") {
+				warning <- pipeScanner.Text()
+			}
+		}
+	}()
+
+	// A packet split across the restart is completed by the new process
+	sender.Write([]byte("#TMN1:N2:hel"))
+	time.Sleep(50 * time.Millisecond)
+
+	local, remote, err := handoverSocketPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	remoteConn, err := net.FileConn(remote)
+	remote.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go next.resumeClients(nextCtx, remoteConn.(*net.UnixConn))
+
+	if msg, _, err := readHandoverMessage(local); err != nil || !msg.Ready {
+		t.Fatalf("expected the new process to be ready, got %+v, %v", msg, err)
+	}
+	if err = previous.handOverClients(local); err != nil {
+		t.Fatal(err)
+	}
+
+	// They are warned, and their sessions are ended before the previous process exits
+	select {
+	case packet := <-warning:
+		if packet != "#TMserver:N3:"+restartWarning {
+			t.Errorf("unexpected warning %q", packet)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected a restart warning")
+	}
+	sessions, err := previous.dbRepo.SessionRepo.ListSessionsByCID(3, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].LogoutTime == nil {
+		t.Errorf("expected the session to be ended, got %+v", sessions)
+	}
+	cancelPrevious()
+
+	waitUntil(t, "clients are resumed", func() bool {
+		_, err1 := next.postOffice.find("N1")
+		_, err2 := next.postOffice.find("N2")
+		return err1 == nil && err2 == nil
+	})
+	if state, ok := next.tracks.get("N1"); !ok || state.scratchpad != "DCT" {
+		t.Errorf("expected the track state to be handed over, got %+v", state)
+	}
+	if client, err = next.postOffice.find("N1"); err != nil {
+		t.Fatal(err)
+	}
+	if history := client.history.snapshot(); len(history) != 300 || history[0].Altitude != 0 || history[299].Altitude != 299 {
+		t.Errorf("expected the position history to be handed over, got %d samples", len(history))
+	}
+
+	sender.Write([]byte("lo\r\n"))
+
+	// Clients handed over stay connected, so nobody is told about their disconnect
+	virtualDisconnected := false
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "#DPN1:") || strings.HasPrefix(scanner.Text(), "#DPN2:") {
+			t.Fatalf("unexpected disconnect packet %q", scanner.Text())
+		}
+		if strings.HasPrefix(scanner.Text(), "#DPV1:") {
+			virtualDisconnected = true
+		}
+		if scanner.Text() == "#TMN1:N2:hello" {
+			if !virtualDisconnected {
+				t.Error("expected the virtual client to be disconnected")
+			}
+			return
+		}
+	}
+	t.Fatalf("connection closed before receiving the message: %v", scanner.Err())
+}
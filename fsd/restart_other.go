@@ -0,0 +1,21 @@
+//go:build !linux
+
+package fsd
+
+import (
+	"context"
+	"net"
+)
+
+func inheritRestart() (listeners map[string]net.Listener, previous *net.UnixConn) {
+	return
+}
+
+func (s *Server) watchRestartSignal(ctx context.Context) {}
+
+// Restart hands this server over to a new process. Only supported on linux.
+func (s *Server) Restart(ctx context.Context) (err error) {
+	return ErrRestartUnsupported
+}
+
+func (s *Server) resumeClients(ctx context.Context, previous *net.UnixConn) {}
@@ -0,0 +1,53 @@
+package fsd
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnTransportPause(t *testing.T) {
+	conn, serverConn := net.Pipe()
+	defer conn.Close()
+	transport := newConnTransport(serverConn, []byte("#TMN1:N2:"))
+	defer transport.Close()
+
+	go io.WriteString(conn, "first\r\nsecond\r\n#TMN1:N2:par")
+
+	// Buffered data is read ahead of the socket
+	for _, want := range []string{"#TMN1:N2:first", "second"} {
+		packet, err := transport.readPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(packet) != want {
+			t.Errorf("expected %q, got %q", want, packet)
+		}
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := transport.readPacket()
+		result <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	transport.pause()
+
+	select {
+	case err := <-result:
+		if err != errTransportPaused {
+			t.Fatalf("expected errTransportPaused, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the transport to pause")
+	}
+	select {
+	case <-transport.paused:
+	default:
+		t.Error("expected the paused channel to be closed")
+	}
+	if string(transport.pending) != "#TMN1:N2:par" {
+		t.Errorf("expected the partial packet to be pending, got %q", transport.pending)
+	}
+}
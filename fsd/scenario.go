@@ -0,0 +1,300 @@
+package fsd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/atomic"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scenario is a sweatbox training scenario: a set of server-controlled aircraft which
+// students control without live pilots, and instructors command over text messages.
+type Scenario struct {
+	Aircraft []ScenarioAircraft `json:"aircraft"`
+}
+
+// ScenarioAircraft is the initial state of an aircraft in a Scenario.
+type ScenarioAircraft struct {
+	Callsign    string              `json:"callsign"`
+	Type        string              `json:"type"`        // Aircraft type with equipment suffix, e.g. "B738/L"
+	Latitude    float64             `json:"latitude"`    // Degrees
+	Longitude   float64             `json:"longitude"`   // Degrees
+	Altitude    int                 `json:"altitude"`    // Feet MSL
+	Heading     int                 `json:"heading"`     // Degrees true
+	Speed       int                 `json:"speed"`       // Ground speed in knots
+	Transponder string              `json:"transponder"` // Defaults to 2000
+	FlightPlan  *ScenarioFlightPlan `json:"flight_plan"` // Filed when the aircraft connects. Optional.
+	Route       []ScenarioWaypoint  `json:"route"`       // Waypoints flown in order. The aircraft holds its heading after the last one.
+}
+
+// ScenarioWaypoint is a waypoint of a ScenarioAircraft route.
+// The altitude and speed become the aircraft's targets once it proceeds to the waypoint.
+type ScenarioWaypoint struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`  // Degrees
+	Longitude float64 `json:"longitude"` // Degrees
+	Altitude  int     `json:"altitude"`  // Feet MSL. Zero keeps the current target.
+	Speed     int     `json:"speed"`     // Knots. Zero keeps the current target.
+}
+
+// ScenarioFlightPlan is the flight plan filed by a ScenarioAircraft.
+type ScenarioFlightPlan struct {
+	Rules          string `json:"rules"`        // I, V, Y or Z. Defaults to I.
+	CruiseSpeed    int    `json:"cruise_speed"` // True airspeed in knots
+	Departure      string `json:"departure"`
+	DepartureTime  string `json:"departure_time"` // HHMM UTC
+	Altitude       string `json:"altitude"`       // Cruise altitude, e.g. "FL350"
+	Destination    string `json:"destination"`
+	EnrouteHours   int    `json:"enroute_hours"`
+	EnrouteMinutes int    `json:"enroute_minutes"`
+	FuelHours      int    `json:"fuel_hours"`
+	FuelMinutes    int    `json:"fuel_minutes"`
+	Alternate      string `json:"alternate"`
+	Remarks        string `json:"remarks"`
+	Route          string `json:"route"`
+}
+
+var ErrInvalidScenario = errors.New("invalid scenario")
+
+// LoadScenario reads and validates a JSON-encoded Scenario file.
+func LoadScenario(path string) (scenario *Scenario, err error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	return parseScenario(raw)
+}
+
+func parseScenario(raw []byte) (scenario *Scenario, err error) {
+	scenario = &Scenario{}
+	if err = json.Unmarshal(raw, scenario); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidScenario, err)
+	}
+	if err = scenario.validate(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s *Scenario) validate() error {
+	callsigns := make(map[string]bool, len(s.Aircraft))
+	for i, aircraft := range s.Aircraft {
+		if !isValidClientCallsign([]byte(aircraft.Callsign)) {
+			return fmt.Errorf("%w: aircraft %d: invalid callsign %q", ErrInvalidScenario, i, aircraft.Callsign)
+		}
+		if callsigns[aircraft.Callsign] {
+			return fmt.Errorf("%w: duplicate callsign %s", ErrInvalidScenario, aircraft.Callsign)
+		}
+		callsigns[aircraft.Callsign] = true
+
+		if !validLatLon(aircraft.Latitude, aircraft.Longitude) {
+			return fmt.Errorf("%w: %s: invalid position", ErrInvalidScenario, aircraft.Callsign)
+		}
+		if aircraft.Transponder != "" {
+			if _, err := parseTransponderCode(aircraft.Transponder); err != nil {
+				return fmt.Errorf("%w: %s: invalid transponder code %q", ErrInvalidScenario, aircraft.Callsign, aircraft.Transponder)
+			}
+		}
+		if aircraft.FlightPlan != nil && strings.ContainsAny(aircraft.FlightPlan.info(aircraft.Type), "\r\n") {
+			return fmt.Errorf("%w: %s: invalid flight plan", ErrInvalidScenario, aircraft.Callsign)
+		}
+		for _, waypoint := range aircraft.Route {
+			if waypoint.Name == "" || !validLatLon(waypoint.Latitude, waypoint.Longitude) {
+				return fmt.Errorf("%w: %s: invalid waypoint %q", ErrInvalidScenario, aircraft.Callsign, waypoint.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func validLatLon(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// info returns the flight plan information section of an $FP packet
+func (fp *ScenarioFlightPlan) info(aircraftType string) string {
+	rules := fp.Rules
+	if rules == "" {
+		rules = "I"
+	}
+
+	fields := []string{
+		rules,
+		aircraftType,
+		strconv.Itoa(fp.CruiseSpeed),
+		fp.Departure,
+		fp.DepartureTime,
+		fp.DepartureTime,
+		fp.Altitude,
+		fp.Destination,
+		strconv.Itoa(fp.EnrouteHours),
+		strconv.Itoa(fp.EnrouteMinutes),
+		strconv.Itoa(fp.FuelHours),
+		strconv.Itoa(fp.FuelMinutes),
+		fp.Alternate,
+		fp.Remarks,
+		fp.Route,
+	}
+	return strings.Join(fields, ":")
+}
+
+// scenarioEngine flies the aircraft of a loaded Scenario
+type scenarioEngine struct {
+	scenario         *Scenario
+	instructorRating NetworkRating
+	interval         time.Duration // Position update interval
+	paused           atomic.Bool
+	connected        atomic.Int32 // Number of scenario aircraft currently connected
+}
+
+// scenarioRealName is the real name reported for scenario aircraft
+const scenarioRealName = "Scenario Aircraft"
+
+func newScenarioEngine(cfg *ServerConfig) (engine *scenarioEngine, err error) {
+	if cfg.ScenarioPositionInterval <= 0 {
+		err = fmt.Errorf("%w: position interval must be positive", ErrInvalidScenario)
+		return
+	}
+	scenario, err := LoadScenario(cfg.ScenarioFile)
+	if err != nil {
+		return
+	}
+
+	engine = &scenarioEngine{
+		scenario:         scenario,
+		instructorRating: cfg.ScenarioInstructorRating,
+		interval:         cfg.ScenarioPositionInterval,
+	}
+	return
+}
+
+// runScenario connects every scenario aircraft. Aircraft disconnect when ctx is cancelled.
+func (s *Server) runScenario(ctx context.Context) {
+	for i := range s.scenario.scenario.Aircraft {
+		go s.flyScenarioAircraft(ctx, newScenarioAircraft(&s.scenario.scenario.Aircraft[i]))
+	}
+}
+
+// flyScenarioAircraft connects a scenario aircraft as a virtual client, and flies it until it is
+// disconnected. Instructions sent to the aircraft are executed on the same goroutine.
+func (s *Server) flyScenarioAircraft(ctx context.Context, aircraft *scenarioAircraft) {
+	data := loginData{
+		callsign:         aircraft.callsign,
+		realName:         scenarioRealName,
+		networkRating:    NetworkRatingObserver,
+		maxNetworkRating: NetworkRatingObserver,
+		protoRevision:    100,
+		loginTime:        time.Now(),
+		clientSoftware:   "openfsd scenario",
+	}
+	vc, err := s.connectVirtualClient(ctx, data, s.cfg.ScenarioHidden)
+	if err != nil {
+		slog.Warn("unable to connect scenario aircraft", "callsign", aircraft.callsign, "error", err)
+		return
+	}
+	defer vc.close()
+
+	s.scenario.connected.Inc()
+	defer s.scenario.connected.Dec()
+
+	instructions := make(chan string, 16)
+	go receiveScenarioInstructions(vc, instructions)
+
+	if fp := aircraft.spec.FlightPlan; fp != nil {
+		vc.send(BuildFileFlightplanPacket(vc.callsign, "*A", fp.info(aircraft.spec.Type)))
+	}
+	vc.send(aircraft.positionPacket())
+
+	ticker := time.NewTicker(s.scenario.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-vc.done():
+			return
+		case packet := <-instructions:
+			s.handleScenarioInstruction(vc, aircraft, packet)
+		case <-ticker.C:
+			if !s.scenario.paused.Load() {
+				aircraft.advance(s.scenario.interval)
+			}
+			vc.send(aircraft.positionPacket())
+		}
+	}
+}
+
+// receiveScenarioInstructions drains the packets sent to a scenario aircraft, passing direct text messages
+// on to instructions and discarding everything else. It never blocks the server.
+func receiveScenarioInstructions(vc *virtualClient, instructions chan<- string) {
+	for {
+		select {
+		case <-vc.done():
+			return
+		case packet := <-vc.packets():
+			if getPacketType([]byte(packet)) != PacketTypeTextMessage || string(getField([]byte(packet), 1)) != vc.callsign {
+				continue
+			}
+			select {
+			case instructions <- packet:
+			default:
+				vc.logger.Warn("dropped scenario instruction", "packet", strings.TrimSpace(packet))
+			}
+		}
+	}
+}
+
+// handleScenarioInstruction executes a text message sent to a scenario aircraft as an instruction and reads it back.
+// Messages from clients below the instructor rating are ignored.
+func (s *Server) handleScenarioInstruction(vc *virtualClient, aircraft *scenarioAircraft, packet string) {
+	source := string(getSourceCallsign([]byte(packet), PacketTypeTextMessage))
+	sender, err := s.postOffice.find(source)
+	if err != nil || sender.networkRating < s.scenario.instructorRating {
+		return
+	}
+
+	readback := aircraft.command(textMessageBody([]byte(packet)))
+	vc.logger.Info("scenario instruction", "by", source, "readback", readback)
+	vc.send(buildTextMessagePacket(vc.callsign, source, readback))
+}
+
+// handleScenarioCommand handles a "scenario ..." text message sent to SERVER.
+// Returns false if the message is not a scenario command.
+func (s *Server) handleScenarioCommand(client *Client, message string) (ok bool) {
+	fields := strings.Fields(strings.ToLower(message))
+	if s.scenario == nil || len(fields) == 0 || fields[0] != "scenario" {
+		return false
+	}
+
+	if client.networkRating < s.scenario.instructorRating {
+		client.sendError(InvalidControlError, "Invalid control")
+		return true
+	}
+
+	var reply string
+	switch strings.Join(fields[1:], " ") {
+	case "pause":
+		s.scenario.paused.Store(true)
+		client.logger.Info("scenario paused")
+		reply = "Scenario paused"
+	case "resume":
+		s.scenario.paused.Store(false)
+		client.logger.Info("scenario resumed")
+		reply = "Scenario resumed"
+	case "status":
+		state := "running"
+		if s.scenario.paused.Load() {
+			state = "paused"
+		}
+		reply = fmt.Sprintf("Scenario %s with %d aircraft connected", state, s.scenario.connected.Load())
+	default:
+		reply = "Scenario commands: pause, resume, status"
+	}
+	client.send(buildServerTextMessagePacket(client.callsign, reply))
+	return true
+}
@@ -0,0 +1,330 @@
+package fsd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Performance of scenario aircraft
+const (
+	scenarioTurnRate          = 3.0         // Degrees per second (standard rate turn)
+	scenarioClimbRate         = 2000.0 / 60 // Feet per second
+	scenarioDescentRate       = 1500.0 / 60 // Feet per second
+	scenarioAcceleration      = 2.0         // Knots per second
+	scenarioWaypointTolerance = 1.0         // Distance in nautical miles at which a waypoint is passed
+	scenarioTransitionLevel   = 18000       // Altitudes at or above are read back as flight levels
+	scenarioMaxAltitude       = 60000       // Feet
+	scenarioMaxSpeed          = 700         // Knots
+)
+
+// Turn directions of scenario aircraft
+const (
+	turnShortest = iota
+	turnLeft
+	turnRight
+)
+
+// scenarioAircraft is the flight state of a scenario aircraft. It must only be accessed by the aircraft's goroutine.
+type scenarioAircraft struct {
+	spec     *ScenarioAircraft
+	callsign string
+
+	latitude, longitude float64
+	altitude            float64 // Feet MSL
+	heading             float64 // Degrees true
+	speed               float64 // Ground speed in knots
+	transponder         string
+
+	targetAltitude float64
+	targetHeading  float64
+	targetSpeed    float64
+	turnDirection  int
+
+	vectored         bool // Flying an assigned heading instead of the route
+	altitudeAssigned bool // Flying an assigned altitude instead of route constraints
+	speedAssigned    bool // Flying an assigned speed instead of route constraints
+	nextWaypoint     int  // Index of the route waypoint being flown to. Equal to len(route) once the route is complete.
+}
+
+func newScenarioAircraft(spec *ScenarioAircraft) (a *scenarioAircraft) {
+	a = &scenarioAircraft{
+		spec:        spec,
+		callsign:    spec.Callsign,
+		latitude:    spec.Latitude,
+		longitude:   spec.Longitude,
+		altitude:    float64(spec.Altitude),
+		heading:     normalizeHeading(float64(spec.Heading)),
+		speed:       float64(spec.Speed),
+		transponder: spec.Transponder,
+	}
+	if a.transponder == "" {
+		a.transponder = "2000"
+	}
+	a.targetAltitude = a.altitude
+	a.targetHeading = a.heading
+	a.targetSpeed = a.speed
+	a.proceedTo(0)
+	return
+}
+
+// proceedTo makes a route waypoint the active one, applying its altitude and speed constraints.
+func (a *scenarioAircraft) proceedTo(index int) {
+	a.nextWaypoint = index
+	if index >= len(a.spec.Route) {
+		return
+	}
+
+	waypoint := a.spec.Route[index]
+	if waypoint.Altitude > 0 && !a.altitudeAssigned {
+		a.targetAltitude = float64(waypoint.Altitude)
+	}
+	if waypoint.Speed > 0 && !a.speedAssigned {
+		a.targetSpeed = float64(waypoint.Speed)
+	}
+}
+
+// advance flies the aircraft for a duration.
+func (a *scenarioAircraft) advance(d time.Duration) {
+	seconds := d.Seconds()
+
+	// Follow the route
+	if !a.vectored {
+		for a.nextWaypoint < len(a.spec.Route) {
+			waypoint := a.spec.Route[a.nextWaypoint]
+			remaining := distance(a.latitude, a.longitude, waypoint.Latitude, waypoint.Longitude) / 1852.0
+			if remaining > max(scenarioWaypointTolerance, a.speed*seconds/3600) {
+				a.targetHeading = initialBearing(a.latitude, a.longitude, waypoint.Latitude, waypoint.Longitude)
+				break
+			}
+			a.proceedTo(a.nextWaypoint + 1)
+		}
+		if a.nextWaypoint >= len(a.spec.Route) {
+			a.targetHeading = a.heading
+		}
+	}
+
+	// Turn
+	turn := normalizeHeading(a.targetHeading-a.heading+180) - 180 // Shortest turn in (-180, 180]
+	switch {
+	case a.turnDirection == turnLeft && turn > 0:
+		turn -= 360
+	case a.turnDirection == turnRight && turn < 0:
+		turn += 360
+	}
+	if maxTurn := scenarioTurnRate * seconds; math.Abs(turn) <= maxTurn {
+		a.heading = a.targetHeading
+		a.turnDirection = turnShortest
+	} else {
+		a.heading = normalizeHeading(a.heading + math.Copysign(maxTurn, turn))
+	}
+
+	// Climb or descend
+	if a.targetAltitude > a.altitude {
+		a.altitude = math.Min(a.altitude+scenarioClimbRate*seconds, a.targetAltitude)
+	} else {
+		a.altitude = math.Max(a.altitude-scenarioDescentRate*seconds, a.targetAltitude)
+	}
+
+	// Accelerate or decelerate
+	if a.targetSpeed > a.speed {
+		a.speed = math.Min(a.speed+scenarioAcceleration*seconds, a.targetSpeed)
+	} else {
+		a.speed = math.Max(a.speed-scenarioAcceleration*seconds, a.targetSpeed)
+	}
+
+	a.latitude, a.longitude = destinationPoint(a.latitude, a.longitude, a.heading, a.speed*seconds/3600*1852.0)
+}
+
+// positionPacket builds the aircraft's @ pilot position packet
+func (a *scenarioAircraft) positionPacket() string {
+	packet := strings.Builder{}
+	packet.Grow(96)
+	packet.WriteString("@N:")
+	packet.WriteString(a.callsign)
+	packet.WriteByte(':')
+	packet.WriteString(a.transponder)
+	packet.WriteString(":1:")
+	packet.WriteString(strconv.FormatFloat(a.latitude, 'f', 5, 64))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.FormatFloat(a.longitude, 'f', 5, 64))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(int(math.Round(a.altitude))))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.Itoa(int(math.Round(a.speed))))
+	packet.WriteByte(':')
+	packet.WriteString(strconv.FormatUint(uint64(PackPitchBankHeading(0, 0, a.heading)), 10))
+	packet.WriteString(":0\r\n")
+	return packet.String()
+}
+
+// command executes an instruction, such as "climb 5000", "turn left heading 270", "direct SMO", "speed 250"
+// or "squawk 4621", and returns the aircraft's readback.
+func (a *scenarioAircraft) command(instruction string) (readback string) {
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(instruction)) {
+		switch word {
+		case "and", "to", "fly", "proceed", "the":
+			continue
+		}
+		words = append(words, word)
+	}
+	if len(words) == 0 {
+		return "say again?"
+	}
+
+	verb, args := words[0], words[1:]
+	switch verb {
+	case "climb", "descend", "altitude", "maintain":
+		if len(args) > 0 && args[0] == "maintain" {
+			args = args[1:]
+		}
+		if len(args) != 1 {
+			break
+		}
+		altitude, ok := parseScenarioAltitude(args[0])
+		if !ok {
+			break
+		}
+		a.targetAltitude = float64(altitude)
+		a.altitudeAssigned = true
+		switch {
+		case a.targetAltitude > a.altitude:
+			return "climbing to " + formatScenarioAltitude(altitude)
+		case a.targetAltitude < a.altitude:
+			return "descending to " + formatScenarioAltitude(altitude)
+		default:
+			return "maintaining " + formatScenarioAltitude(altitude)
+		}
+
+	case "turn", "heading":
+		direction := turnShortest
+		if verb == "turn" && len(args) > 0 {
+			switch args[0] {
+			case "left":
+				direction = turnLeft
+			case "right":
+				direction = turnRight
+			}
+			if direction != turnShortest {
+				args = args[1:]
+			}
+		}
+		if len(args) > 0 && args[0] == "heading" {
+			args = args[1:]
+		}
+		if len(args) != 1 {
+			break
+		}
+		heading, err := strconv.Atoi(args[0])
+		if err != nil || heading < 1 || heading > 360 {
+			break
+		}
+		a.vectored = true
+		a.targetHeading = normalizeHeading(float64(heading))
+		a.turnDirection = direction
+		switch direction {
+		case turnLeft:
+			return fmt.Sprintf("turning left heading %03d", heading)
+		case turnRight:
+			return fmt.Sprintf("turning right heading %03d", heading)
+		default:
+			return fmt.Sprintf("flying heading %03d", heading)
+		}
+
+	case "direct":
+		if len(args) != 1 {
+			break
+		}
+		for i, waypoint := range a.spec.Route {
+			if strings.EqualFold(waypoint.Name, args[0]) {
+				a.vectored = false
+				a.turnDirection = turnShortest
+				a.proceedTo(i)
+				return "proceeding direct " + waypoint.Name
+			}
+		}
+		return "unable, " + strings.ToUpper(args[0]) + " is not on our route"
+
+	case "speed":
+		if len(args) != 1 {
+			break
+		}
+		speed, err := strconv.Atoi(args[0])
+		if err != nil || speed <= 0 || speed > scenarioMaxSpeed {
+			break
+		}
+		a.targetSpeed = float64(speed)
+		a.speedAssigned = true
+		return fmt.Sprintf("speed %d", speed)
+
+	case "squawk":
+		if len(args) != 1 {
+			break
+		}
+		if _, err := parseTransponderCode(args[0]); err != nil {
+			break
+		}
+		a.transponder = args[0]
+		return "squawking " + args[0]
+	}
+	return "say again?"
+}
+
+// parseScenarioAltitude parses an altitude in feet, e.g. "5000", or a flight level, e.g. "FL240"
+func parseScenarioAltitude(raw string) (altitude int, ok bool) {
+	multiplier := 1
+	if level, isLevel := strings.CutPrefix(raw, "fl"); isLevel {
+		raw, multiplier = level, 100
+	}
+	altitude, err := strconv.Atoi(raw)
+	if err != nil {
+		return
+	}
+	altitude *= multiplier
+	ok = altitude >= 0 && altitude <= scenarioMaxAltitude
+	return
+}
+
+func formatScenarioAltitude(altitude int) string {
+	if altitude >= scenarioTransitionLevel {
+		return fmt.Sprintf("FL%03d", altitude/100)
+	}
+	return strconv.Itoa(altitude)
+}
+
+// normalizeHeading maps a heading in degrees to [0, 360)
+func normalizeHeading(heading float64) float64 {
+	heading = math.Mod(heading, 360)
+	if heading < 0 {
+		heading += 360
+	}
+	return heading
+}
+
+// initialBearing returns the initial great-circle bearing in degrees true from one point to another.
+func initialBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := lat1*degToRad, lat2*degToRad
+	dLon := (lon2 - lon1) * degToRad
+
+	y := math.Sin(dLon) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLon)
+	return normalizeHeading(math.Atan2(y, x) / degToRad)
+}
+
+// destinationPoint returns the point reached by travelling a distance in meters along a great circle
+// from a starting point and initial bearing.
+func destinationPoint(lat, lon, bearing, dist float64) (destLat float64, destLon float64) {
+	phi1, lambda1 := lat*degToRad, lon*degToRad
+	theta := bearing * degToRad
+	delta := dist / earthRadius
+
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi1), math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+
+	destLat = phi2 / degToRad
+	destLon = math.Mod(lambda2/degToRad+540, 360) - 180
+	return
+}
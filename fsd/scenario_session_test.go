@@ -0,0 +1,77 @@
+package fsd_test
+
+import (
+	"github.com/renorris/openfsd/fsd"
+	"github.com/renorris/openfsd/fsd/fsdtest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testScenario = `{"aircraft": [{
+	"callsign": "AAL123", "type": "B738/L", "latitude": 34.1, "longitude": -118.0, "altitude": 12000,
+	"heading": 250, "speed": 280, "transponder": "4621",
+	"flight_plan": {"departure": "KLAS", "destination": "KLAX", "altitude": "FL350", "cruise_speed": 450, "departure_time": "1800", "route": "SEAVU2"},
+	"route": [{"name": "SEAVU", "latitude": 34.0, "longitude": -118.2, "altitude": 11000, "speed": 250}]
+}]}`
+
+func TestScenario(t *testing.T) {
+	scenarioFile := filepath.Join(t.TempDir(), "scenario.json")
+	if err := os.WriteFile(scenarioFile, []byte(testScenario), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := fsdtest.NewServer(t, func(cfg *fsd.ServerConfig) {
+		cfg.ScenarioFile = scenarioFile
+		cfg.ScenarioPositionInterval = 20 * time.Millisecond
+	})
+
+	student := s.ATC("LAX_APP", s.CreateUser(fsd.NetworkRatingStudent3, "secret"))
+	student.Send("%LAX_APP:24400:4:100:4:33.94250:-118.40810:0")
+	student.ExpectMatch(`^@N:AAL123:4621:1:`)
+
+	// The aircraft files its flight plan when it connects
+	student.Send("$CQLAX_APP:SERVER:FP:AAL123")
+	student.ExpectPrefix("$FPAAL123:*A:I:B738/L:450:KLAS:1800:1800:FL350:KLAX:0:0:0:0:::SEAVU2")
+
+	// Students can neither command the aircraft nor control the scenario
+	student.Send("#TMLAX_APP:AAL123:climb FL240")
+	student.Send("#TMLAX_APP:SERVER:scenario pause")
+	student.ExpectError(fsd.InvalidControlError)
+
+	instructor := s.ATC("LAX_OBS", s.CreateUser(fsd.NetworkRatingInstructor1, "secret"))
+	instructor.Send("#TMLAX_OBS:AAL123:climb and maintain FL240")
+	instructor.ExpectPrefix("#TMAAL123:LAX_OBS:climbing to FL240")
+	instructor.Send("#TMLAX_OBS:AAL123:turn left heading 180")
+	instructor.ExpectPrefix("#TMAAL123:LAX_OBS:turning left heading 180")
+	instructor.Send("#TMLAX_OBS:AAL123:hold at SEAVU")
+	instructor.ExpectPrefix("#TMAAL123:LAX_OBS:say again?")
+
+	instructor.Send("#TMLAX_OBS:SERVER:scenario pause")
+	instructor.ExpectPrefix("#TMserver:LAX_OBS:Scenario paused")
+	instructor.Send("#TMLAX_OBS:SERVER:scenario status")
+	instructor.ExpectPrefix("#TMserver:LAX_OBS:Scenario paused with 1 aircraft connected")
+
+	// Paused aircraft keep reporting the same position. Positions sent before the pause are drained first,
+	// checking the student's instruction was never read back.
+	time.Sleep(100 * time.Millisecond)
+	student.Send("$CQLAX_APP:SERVER:ATC:LAX_APP")
+	student.Expect("$CR response", func(packet string) bool {
+		if strings.HasPrefix(packet, "#TM") {
+			t.Errorf("unexpected text message %q", packet)
+		}
+		return strings.HasPrefix(packet, "$CRSERVER:LAX_APP:ATC:")
+	})
+	first := student.ExpectPrefix("@N:AAL123:")
+	if second := student.ExpectPrefix("@N:AAL123:"); first != second {
+		t.Errorf("expected paused aircraft not to move, got %q then %q", first, second)
+	}
+
+	instructor.Send("#TMLAX_OBS:SERVER:scenario resume")
+	instructor.ExpectPrefix("#TMserver:LAX_OBS:Scenario resumed")
+	first = student.ExpectPrefix("@N:AAL123:")
+	if second := student.ExpectPrefix("@N:AAL123:"); first == second {
+		t.Errorf("expected resumed aircraft to move, got %q twice", first)
+	}
+}
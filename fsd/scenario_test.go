@@ -0,0 +1,205 @@
+package fsd
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseScenario(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{
+			name: "Valid",
+			raw: `{"aircraft": [{
+				"callsign": "AAL123", "type": "B738/L", "latitude": 34.2, "longitude": -117.8, "altitude": 12000,
+				"heading": 250, "speed": 280, "transponder": "4621",
+				"flight_plan": {"departure": "KLAS", "destination": "KLAX", "altitude": "FL350", "cruise_speed": 450, "route": "SEAVU2"},
+				"route": [{"name": "SEAVU", "latitude": 34.1, "longitude": -117.9, "altitude": 11000, "speed": 250}]
+			}]}`,
+		},
+		{
+			name:    "Malformed JSON",
+			raw:     `{"aircraft": [`,
+			wantErr: true,
+		},
+		{
+			name:    "Invalid callsign",
+			raw:     `{"aircraft": [{"callsign": "aal123"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "Duplicate callsign",
+			raw:     `{"aircraft": [{"callsign": "AAL123"}, {"callsign": "AAL123"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "Invalid position",
+			raw:     `{"aircraft": [{"callsign": "AAL123", "latitude": 95}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "Invalid transponder code",
+			raw:     `{"aircraft": [{"callsign": "AAL123", "transponder": "1289"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "Flight plan field containing a line break",
+			raw:     `{"aircraft": [{"callsign": "AAL123", "flight_plan": {"remarks": "/v/\r\n#TMAAL123:*:hi"}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "Unnamed waypoint",
+			raw:     `{"aircraft": [{"callsign": "AAL123", "route": [{"latitude": 34.1, "longitude": -117.9}]}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseScenario([]byte(tc.raw))
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidScenario) {
+				t.Errorf("expected ErrInvalidScenario, got %v", err)
+			}
+		})
+	}
+}
+
+func TestScenarioFlightPlanInfo(t *testing.T) {
+	fp := ScenarioFlightPlan{
+		CruiseSpeed: 450, Departure: "KLAS", DepartureTime: "1800", Altitude: "FL350", Destination: "KLAX",
+		EnrouteHours: 1, EnrouteMinutes: 5, FuelHours: 3, Alternate: "KONT", Remarks: "/v/", Route: "SEAVU2",
+	}
+	expected := "I:B738/L:450:KLAS:1800:1800:FL350:KLAX:1:5:3:0:KONT:/v/:SEAVU2"
+	if info := fp.info("B738/L"); info != expected {
+		t.Errorf("expected %q, got %q", expected, info)
+	}
+}
+
+func TestScenarioAircraftCommand(t *testing.T) {
+	spec := &ScenarioAircraft{
+		Callsign: "AAL123", Altitude: 12000, Heading: 250, Speed: 280,
+		Route: []ScenarioWaypoint{
+			{Name: "SEAVU", Latitude: 34.1, Longitude: -117.9, Altitude: 11000},
+			{Name: "SMO", Latitude: 34.01, Longitude: -118.46, Speed: 210},
+		},
+	}
+
+	tests := []struct {
+		instruction  string
+		readback     string
+		check        func(a *scenarioAircraft) bool
+		shouldChange bool
+	}{
+		{"climb and maintain FL240", "climbing to FL240", func(a *scenarioAircraft) bool { return a.targetAltitude == 24000 && a.altitudeAssigned }, true},
+		{"Descend 5000", "descending to 5000", func(a *scenarioAircraft) bool { return a.targetAltitude == 5000 }, true},
+		{"maintain 12000", "maintaining 12000", func(a *scenarioAircraft) bool { return a.targetAltitude == 12000 }, true},
+		{"turn left heading 180", "turning left heading 180", func(a *scenarioAircraft) bool {
+			return a.vectored && a.targetHeading == 180 && a.turnDirection == turnLeft
+		}, true},
+		{"turn right 090", "turning right heading 090", func(a *scenarioAircraft) bool { return a.turnDirection == turnRight && a.targetHeading == 90 }, true},
+		{"fly heading 360", "flying heading 360", func(a *scenarioAircraft) bool { return a.targetHeading == 0 && a.turnDirection == turnShortest }, true},
+		{"proceed direct smo", "proceeding direct SMO", func(a *scenarioAircraft) bool {
+			return !a.vectored && a.nextWaypoint == 1 && a.targetSpeed == 210
+		}, true},
+		{"direct KLAX", "unable, KLAX is not on our route", nil, false},
+		{"speed 250", "speed 250", func(a *scenarioAircraft) bool { return a.targetSpeed == 250 && a.speedAssigned }, true},
+		{"squawk 4621", "squawking 4621", func(a *scenarioAircraft) bool { return a.transponder == "4621" }, true},
+		{"squawk 4629", "say again?", nil, false},
+		{"climb FL999", "say again?", nil, false},
+		{"turn left heading 400", "say again?", nil, false},
+		{"hold at SMO", "say again?", nil, false},
+		{"", "say again?", nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.instruction, func(t *testing.T) {
+			a := newScenarioAircraft(spec)
+			before := *a
+			if readback := a.command(tc.instruction); readback != tc.readback {
+				t.Errorf("expected readback %q, got %q", tc.readback, readback)
+			}
+			if tc.check != nil && !tc.check(a) {
+				t.Errorf("unexpected state after instruction: %+v", *a)
+			}
+			if !tc.shouldChange && *a != before {
+				t.Errorf("expected state to be unchanged, got %+v", *a)
+			}
+		})
+	}
+}
+
+func TestScenarioAircraftAdvance(t *testing.T) {
+	spec := &ScenarioAircraft{
+		Callsign: "AAL123", Latitude: 34.2, Longitude: -117.5, Altitude: 12000, Heading: 270, Speed: 240,
+		Route: []ScenarioWaypoint{
+			{Name: "ONE", Latitude: 34.2, Longitude: -117.6, Altitude: 10000, Speed: 200},
+			{Name: "TWO", Latitude: 34.5, Longitude: -117.6},
+		},
+	}
+	a := newScenarioAircraft(spec)
+
+	// Descends and decelerates towards the first waypoint's constraints
+	a.advance(6 * time.Second)
+	if a.altitude != 12000-scenarioDescentRate*6 || a.speed != 240-scenarioAcceleration*6 {
+		t.Errorf("unexpected altitude %f and speed %f", a.altitude, a.speed)
+	}
+	if math.Abs(a.heading-270) > 1 || a.longitude >= -117.5 {
+		t.Errorf("expected to fly west, got heading %f at %f,%f", a.heading, a.latitude, a.longitude)
+	}
+
+	// Passes the first waypoint and turns north towards the second at standard rate
+	for range 20 {
+		a.advance(5 * time.Second)
+	}
+	if a.nextWaypoint != 1 {
+		t.Fatalf("expected to fly to the second waypoint, got waypoint %d", a.nextWaypoint)
+	}
+	if a.altitude != 10000 || a.speed != 200 {
+		t.Errorf("expected constraints to be met, got altitude %f and speed %f", a.altitude, a.speed)
+	}
+	if a.heading > 10 && a.heading < 350 {
+		t.Errorf("expected to fly north, got heading %f", a.heading)
+	}
+
+	// Turns the long way around when instructed
+	a.command("turn left heading 090")
+	a.advance(10 * time.Second)
+	if a.heading < 300 || a.heading > 340 {
+		t.Errorf("expected a left turn through 330, got heading %f", a.heading)
+	}
+	for range 20 {
+		a.advance(5 * time.Second)
+	}
+	if a.heading != 90 || !a.vectored {
+		t.Errorf("expected to fly the assigned heading, got %f", a.heading)
+	}
+
+	// Holds its heading after the last waypoint
+	a.command("direct TWO")
+	for range 100 {
+		a.advance(5 * time.Second)
+	}
+	heading := a.heading
+	a.advance(5 * time.Second)
+	if a.nextWaypoint != 2 || a.heading != heading {
+		t.Errorf("expected to hold heading after the route, got waypoint %d and heading %f -> %f", a.nextWaypoint, heading, a.heading)
+	}
+}
+
+func TestDestinationPoint(t *testing.T) {
+	lat, lon := destinationPoint(33.9425, -118.4081, 90, 60*1852.0)
+	if d := distance(33.9425, -118.4081, lat, lon) / 1852.0; math.Abs(d-60) > 0.01 {
+		t.Errorf("expected to travel 60 nm, got %f", d)
+	}
+	if bearing := initialBearing(33.9425, -118.4081, lat, lon); math.Abs(bearing-90) > 0.01 {
+		t.Errorf("expected initial bearing 90, got %f", bearing)
+	}
+}
@@ -7,17 +7,34 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/renorris/openfsd/db"
+	"go.uber.org/atomic"
 	"io"
 	"log/slog"
 	"net"
+	"os"
 	"sync"
+	"time"
 )
 
 type Server struct {
 	cfg          *ServerConfig
+	ns           *NamespaceConfig // Namespace served by this server
+	namespaces   []*Server        // Servers of the additional namespaces, sharing the services of this server
 	postOffice   *postOffice
 	metarService *metarService
+	stations     *stationIndex // METAR reporting stations. Nil if not configured.
+	tracks       *trackStore
+	squawks      *squawkMonitor
+	scenario     *scenarioEngine // Nil if no scenario is configured
+	federation   *federation     // Nil if federation is disabled
+	relay        *relay          // Nil unless relay mode is enabled
+	restart      *restarter
+	packets      packetCounters
+	capture      *packetCapture // Nil if packet capture is disabled
+	metrics      *prometheus.Registry
+	nextConnID   *atomic.Uint64 // Last assigned connection ID, shared by every namespace
 	dbRepo       *db.Repositories
 }
 
@@ -25,21 +42,94 @@ type Server struct {
 //
 // See NewDefaultServer to create a server using default settings obtained via environment variables.
 func NewServer(cfg *ServerConfig, dbRepo *db.Repositories, numMetarWorkers int) (server *Server, err error) {
+	if err = cfg.validate(); err != nil {
+		return
+	}
+	metarProvider, err := newMetarProvider(cfg)
+	if err != nil {
+		return
+	}
+	namespaces, err := newNamespaces(cfg)
+	if err != nil {
+		return
+	}
+
 	server = &Server{
-		cfg:          cfg,
-		postOffice:   newPostOffice(),
-		metarService: newMetarService(numMetarWorkers),
-		dbRepo:       dbRepo,
+		cfg:        cfg,
+		ns:         namespaces[0],
+		postOffice: newPostOffice(),
+		metarService: newMetarService(
+			numMetarWorkers,
+			metarProvider,
+			cfg.MetarFetchTimeout,
+			cfg.MetarCacheTTL,
+			cfg.MetarNegativeCacheTTL,
+		),
+		tracks:     newTrackStore(),
+		squawks:    newSquawkMonitor(),
+		nextConnID: atomic.NewUint64(0),
+		dbRepo:     dbRepo,
+	}
+	server.postOffice.maxClients = server.ns.MaxClients
+	server.restart = newRestarter(cfg)
+
+	server.metrics = newMetricsRegistry(server)
+
+	if server.capture, err = newPacketCapture(cfg); err != nil {
+		return
+	}
+
+	if server.relay, err = newRelay(cfg); err != nil {
+		return
+	}
+	if server.federation, err = newFederation(server, cfg); err != nil {
+		return
+	}
+	if server.federation != nil {
+		server.tracks.onChange = server.federation.trackChanged
+	}
+
+	if cfg.MetarStationsFile != "" {
+		if server.stations, err = loadStationIndex(cfg.MetarStationsFile); err != nil {
+			return
+		}
+	}
+
+	for _, ns := range namespaces[1:] {
+		server.namespaces = append(server.namespaces, server.newNamespaceServer(ns))
+	}
+
+	if cfg.ScenarioFile != "" {
+		scenarioServer := server.namespaceServer(cfg.ScenarioNamespace)
+		if scenarioServer == nil {
+			err = fmt.Errorf("%w: no such namespace %q", ErrInvalidScenario, cfg.ScenarioNamespace)
+			return
+		}
+		if scenarioServer.scenario, err = newScenarioEngine(cfg); err != nil {
+			return
+		}
 	}
 	return
 }
 
 // NewDefaultServer creates a new Server instance using the default configuration obtained via environment variables
 func NewDefaultServer(ctx context.Context) (server *Server, err error) {
-	config, err := loadServerConfig(ctx)
+	config, err := LoadServerConfig(ctx)
+	if err != nil {
+		return
+	}
+
+	return NewServerFromConfig(ctx, config)
+}
+
+// NewServerFromConfig creates a new Server instance from a configuration, such as one obtained via LoadServerConfig.
+// It opens (and optionally migrates) the configured database, and initializes the default admin user and config.
+func NewServerFromConfig(ctx context.Context, config *ServerConfig) (server *Server, err error) {
+	logger, err := newLogger(os.Stderr, config)
 	if err != nil {
 		return
 	}
+	slog.SetDefault(logger)
 
 	slog.Info(fmt.Sprintf("using %s", config.DatabaseDriver))
 
@@ -129,22 +219,66 @@ func generateDefaultAdminUser(dbRepo *db.Repositories) (user *db.User, err error
 }
 
 func (s *Server) Run(ctx context.Context) (err error) {
+	// Close sessions left open by an unclean shutdown. Sessions stay open across a restart.
+	if s.restart.previous == nil {
+		if err = s.dbRepo.SessionRepo.EndOpenSessions(time.Now()); err != nil {
+			return
+		}
+	}
+
 	// Start metar service
 	go s.metarService.run(ctx)
 
+	// Start squawk monitors
+	go s.runSquawkMonitor(ctx)
+	for _, server := range s.namespaces {
+		go server.runSquawkMonitor(ctx)
+	}
+
+	// Start stats collector
+	go s.runStatsCollector(ctx)
+
 	// Start HTTP service
 	go s.runServiceHTTP(ctx)
 
-	errCh := make(chan error, len(s.cfg.FsdListenAddrs))
+	// Link to federated servers
+	if s.federation != nil {
+		if err = s.federation.start(ctx); err != nil {
+			return
+		}
+	}
+
+	// Connect scenario aircraft
+	servers := append([]*Server{s}, s.namespaces...)
+	for _, server := range servers {
+		if server.scenario != nil {
+			go server.runScenario(ctx)
+		}
+	}
+
+	// Serve the clients of the process this one replaces
+	if s.restart.previous != nil {
+		go s.resumeClients(ctx, s.restart.previous)
+	}
+	go s.watchRestartSignal(ctx)
+
+	numListeners := 0
+	for _, server := range servers {
+		numListeners += len(server.ns.ListenAddrs)
+	}
+	errCh := make(chan error, numListeners)
 	var listenerWg sync.WaitGroup
 
-	for _, addr := range s.cfg.FsdListenAddrs {
-		slog.Info(fmt.Sprintf("Listening on %s\n", addr))
-		listenerWg.Add(1)
-		go func(ctx context.Context, addr string) {
-			defer listenerWg.Done()
-			s.listen(ctx, addr, errCh)
-		}(ctx, addr)
+	// Every listener feeds the post office of its namespace
+	for _, server := range servers {
+		for _, addr := range server.ns.ListenAddrs {
+			slog.Info("listening", "addr", addr, "namespace", server.ns.Name)
+			listenerWg.Add(1)
+			go func(ctx context.Context, addr string) {
+				defer listenerWg.Done()
+				server.listen(ctx, addr, errCh)
+			}(ctx, addr)
+		}
 	}
 
 	// Collect startup errors
@@ -162,15 +296,17 @@ func (s *Server) Run(ctx context.Context) (err error) {
 		return fmt.Errorf("some listeners failed: %v", startupErrors)
 	}
 
-	// All listeners started successfully; wait for context to be cancelled
-	<-ctx.Done()
+	// Listeners stop once the context is cancelled, or once a new process takes over
+	select {
+	case <-ctx.Done():
+	case <-s.restart.handedOver():
+	}
 
 	return
 }
 
 func (s *Server) listen(ctx context.Context, addr string, errCh chan<- error) {
-	config := net.ListenConfig{}
-	listener, err := config.Listen(ctx, "tcp4", addr)
+	listener, err := s.restart.listen(ctx, addr)
 	if err != nil {
 		errCh <- fmt.Errorf("failed to listen on %s: %w", addr, err)
 		return
@@ -191,10 +327,17 @@ func (s *Server) listen(ctx context.Context, addr string, errCh chan<- error) {
 				// Listener was closed due to context cancellation; exit the loop
 				return
 			}
-			// Log or handle non-fatal accept errors
+			slog.Warn("error accepting connection", "addr", addr, "error", err)
 			continue
 		}
 		// Handle the connection in another goroutine
-		go s.handleConn(ctx, conn)
+		go s.handleConn(ctx, conn, addr)
 	}
 }
+
+// ServeConn serves a single FSD connection accepted outside of the configured listeners,
+// such as one end of a net.Pipe. It returns once the connection has closed.
+// The connection's local address is used as its listener address for packet capture.
+func (s *Server) ServeConn(ctx context.Context, conn net.Conn) {
+	s.handleConn(ctx, conn, conn.LocalAddr().String())
+}
@@ -0,0 +1,43 @@
+package fsd
+
+import (
+	"github.com/renorris/openfsd/db"
+	"net"
+	"time"
+)
+
+// startSession records the login of a registered client.
+// Failures are logged and do not prevent the client from connecting.
+func (s *Server) startSession(client *Client) (id int64, ok bool) {
+	session := db.Session{
+		CID:            client.cid,
+		Callsign:       client.callsign,
+		IsAtc:          client.isAtc,
+		Facility:       client.facilityType,
+		NetworkRating:  int(client.networkRating),
+		ClientSoftware: client.clientSoftware,
+		RemoteIP:       client.transport.remoteIP(),
+		LoginTime:      client.loginTime,
+	}
+	if err := s.dbRepo.SessionRepo.CreateSession(&session); err != nil {
+		client.logger.Error("error recording session", "error", err)
+		return
+	}
+	return session.ID, true
+}
+
+// endSession records the logout of a client.
+func (s *Server) endSession(client *Client, id int64) {
+	if err := s.dbRepo.SessionRepo.EndSession(id, client.facilityType, time.Now()); err != nil {
+		client.logger.Error("error ending session", "error", err)
+	}
+}
+
+// remoteIP returns the IP address of the remote end of a connection.
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
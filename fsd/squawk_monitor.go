@@ -0,0 +1,240 @@
+package fsd
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+)
+
+// squawkCheckInterval is how often pilot squawks are checked
+const squawkCheckInterval = 5 * time.Second
+
+// duplicateSquawkRange is the distance (meters) within which two aircraft squawking the same code are flagged
+const duplicateSquawkRange = 185200 // 100 nautical miles
+
+// nonDiscreteTransponderCodes are shared by many aircraft and never flagged as duplicates
+var nonDiscreteTransponderCodes = map[string]bool{
+	"0000": true,
+	"1000": true, // Mode S conspicuity
+	"1200": true, // VFR (North America)
+	"2000": true, // No code assigned
+	"2200": true, // VFR (Oceania)
+	"7000": true, // VFR (Europe)
+	"7500": true, // Hijack
+	"7600": true, // Radio failure
+	"7700": true, // Emergency
+}
+
+// SquawkAlertType is the kind of problem a SquawkAlert describes
+type SquawkAlertType string
+
+const (
+	SquawkAlertDuplicate SquawkAlertType = "duplicate" // Another nearby aircraft is squawking the same code
+	SquawkAlertMismatch  SquawkAlertType = "mismatch"  // The aircraft is not squawking its assigned code
+)
+
+// SquawkAlert is an active transponder code problem of an aircraft.
+type SquawkAlert struct {
+	Type           SquawkAlertType `json:"type"`
+	Callsign       string          `json:"callsign"`
+	Squawk         string          `json:"squawk"`
+	AssignedSquawk string          `json:"assigned_squawk,omitempty"` // Mismatch alerts only
+	OtherCallsign  string          `json:"other_callsign,omitempty"`  // Duplicate alerts only
+	Since          time.Time       `json:"since"`
+}
+
+type squawkAlertKey struct {
+	alertType SquawkAlertType
+	callsign  string
+}
+
+// squawkMonitor holds the state of the periodic squawk checks.
+type squawkMonitor struct {
+	lock          sync.Mutex
+	mismatchSince map[string]time.Time           // Pilot callsign -> when its squawk first differed from its assigned code
+	alerts        map[squawkAlertKey]SquawkAlert // Active alerts
+}
+
+func newSquawkMonitor() *squawkMonitor {
+	return &squawkMonitor{
+		mismatchSince: make(map[string]time.Time, 64),
+		alerts:        make(map[squawkAlertKey]SquawkAlert, 16),
+	}
+}
+
+// activeAlerts returns all active alerts ordered by callsign.
+func (m *squawkMonitor) activeAlerts() (alerts []SquawkAlert) {
+	m.lock.Lock()
+	alerts = make([]SquawkAlert, 0, len(m.alerts))
+	for _, alert := range m.alerts {
+		alerts = append(alerts, alert)
+	}
+	m.lock.Unlock()
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Callsign != alerts[j].Callsign {
+			return alerts[i].Callsign < alerts[j].Callsign
+		}
+		return alerts[i].Type < alerts[j].Type
+	})
+	return
+}
+
+func (s *Server) runSquawkMonitor(ctx context.Context) {
+	ticker := time.NewTicker(squawkCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.checkSquawks(now)
+		}
+	}
+}
+
+// checkSquawks flags duplicate and mismatched squawks, and notifies ATC of newly raised alerts.
+func (s *Server) checkSquawks(now time.Time) {
+	s.postOffice.clientMapLock.RLock()
+	clients := maps.Clone(s.postOffice.clientMap)
+	s.postOffice.clientMapLock.RUnlock()
+
+	var pilots, controllers []*Client
+	for _, client := range clients {
+		if client.isAtc {
+			// Controllers of linked servers are alerted by their own server
+			if client.peer == nil {
+				controllers = append(controllers, client)
+			}
+		} else {
+			pilots = append(pilots, client)
+		}
+	}
+
+	current := map[squawkAlertKey]SquawkAlert{}
+
+	// Duplicate squawks
+	bySquawk := map[string][]*Client{}
+	for _, pilot := range pilots {
+		squawk := pilot.transponder.Load()
+		if _, err := parseTransponderCode(squawk); err != nil || nonDiscreteTransponderCodes[squawk] {
+			continue
+		}
+		bySquawk[squawk] = append(bySquawk[squawk], pilot)
+	}
+	for squawk, group := range bySquawk {
+		for _, pilot := range group {
+			other, found := nearestClient(pilot, group, duplicateSquawkRange)
+			if !found {
+				continue
+			}
+			current[squawkAlertKey{SquawkAlertDuplicate, pilot.callsign}] = SquawkAlert{
+				Type:          SquawkAlertDuplicate,
+				Callsign:      pilot.callsign,
+				Squawk:        squawk,
+				OtherCallsign: other.callsign,
+				Since:         now,
+			}
+		}
+	}
+
+	s.squawks.lock.Lock()
+
+	// Squawk mismatches
+	mismatchSince := make(map[string]time.Time, len(s.squawks.mismatchSince))
+	for _, pilot := range pilots {
+		state, ok := s.tracks.get(pilot.callsign)
+		squawk := pilot.transponder.Load()
+		if !ok || state.beaconCode == "" || squawk == state.beaconCode {
+			continue
+		}
+
+		since, ok := s.squawks.mismatchSince[pilot.callsign]
+		if !ok {
+			since = now
+		}
+		mismatchSince[pilot.callsign] = since
+
+		if now.Sub(since) < s.cfg.SquawkMismatchDuration {
+			continue
+		}
+		current[squawkAlertKey{SquawkAlertMismatch, pilot.callsign}] = SquawkAlert{
+			Type:           SquawkAlertMismatch,
+			Callsign:       pilot.callsign,
+			Squawk:         squawk,
+			AssignedSquawk: state.beaconCode,
+			Since:          since,
+		}
+	}
+
+	// Keep the original time of ongoing alerts, and collect new ones
+	var raised []SquawkAlert
+	for key, alert := range current {
+		if previous, ok := s.squawks.alerts[key]; ok {
+			alert.Since = previous.Since
+			current[key] = alert
+			continue
+		}
+		raised = append(raised, alert)
+	}
+	s.squawks.alerts = current
+	s.squawks.mismatchSince = mismatchSince
+
+	s.squawks.lock.Unlock()
+
+	for _, alert := range raised {
+		s.sendSquawkAlert(clients[alert.Callsign], controllers, alert)
+	}
+}
+
+// sendSquawkAlert notifies the controller tracking an aircraft of an alert,
+// or every active controller in range if the aircraft is not tracked.
+func (s *Server) sendSquawkAlert(pilot *Client, controllers []*Client, alert SquawkAlert) {
+	var msg string
+	switch alert.Type {
+	case SquawkAlertDuplicate:
+		msg = "Duplicate squawk " + alert.Squawk + ": " + alert.Callsign + " and " + alert.OtherCallsign
+	case SquawkAlertMismatch:
+		msg = alert.Callsign + " squawking " + alert.Squawk + ", assigned " + alert.AssignedSquawk
+	}
+
+	if state, ok := s.tracks.get(alert.Callsign); ok && state.trackingController != "" {
+		if controller, err := s.postOffice.find(state.trackingController); err == nil {
+			controller.send(buildServerTextMessagePacket(controller.callsign, msg))
+			return
+		}
+	}
+
+	pilotLatLon := pilot.latLon()
+	for _, controller := range controllers {
+		if controller.facilityType <= 0 {
+			continue
+		}
+		controllerLatLon := controller.latLon()
+		if distance(pilotLatLon[0], pilotLatLon[1], controllerLatLon[0], controllerLatLon[1]) > controller.visRange.Load() {
+			continue
+		}
+		controller.send(buildServerTextMessagePacket(controller.callsign, msg))
+	}
+}
+
+// nearestClient returns the client in candidates closest to client within maxDistance meters, excluding client itself.
+func nearestClient(client *Client, candidates []*Client, maxDistance float64) (nearest *Client, found bool) {
+	latLon := client.latLon()
+	bestDistance := maxDistance
+	for _, candidate := range candidates {
+		if candidate == client {
+			continue
+		}
+		candidateLatLon := candidate.latLon()
+		if d := distance(latLon[0], latLon[1], candidateLatLon[0], candidateLatLon[1]); d <= bestDistance {
+			bestDistance = d
+			nearest = candidate
+			found = true
+		}
+	}
+	return
+}
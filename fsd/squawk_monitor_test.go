@@ -0,0 +1,110 @@
+package fsd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestCheckSquawks_Duplicate verifies that nearby aircraft squawking the same code are flagged once.
+func TestCheckSquawks_Duplicate(t *testing.T) {
+	s, pilot, atc1, atc2 := newTrackStateTestServer(t)
+	pilot.transponder.Store("4521")
+
+	other := newMockClient("DAL42")
+	other.setLatLon(34.0, -118.3)
+	other.transponder.Store("4521")
+	if err := s.postOffice.register(other.Client); err != nil {
+		t.Fatal(err)
+	}
+
+	// Far away aircraft squawking the same code is not a duplicate
+	distant := newMockClient("BAW1")
+	distant.setLatLon(51.5, -0.4)
+	distant.transponder.Store("4521")
+	if err := s.postOffice.register(distant.Client); err != nil {
+		t.Fatal(err)
+	}
+
+	// Non-discrete codes are never flagged
+	vfr1, vfr2 := newMockClient("N1"), newMockClient("N2")
+	for _, vfr := range []*mockClient{vfr1, vfr2} {
+		vfr.setLatLon(33.9, -118.4)
+		vfr.transponder.Store("1200")
+		if err := s.postOffice.register(vfr.Client); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	s.checkSquawks(now)
+
+	want := []SquawkAlert{
+		{Type: SquawkAlertDuplicate, Callsign: "DAL42", Squawk: "4521", OtherCallsign: "ROU1887", Since: now},
+		{Type: SquawkAlertDuplicate, Callsign: "ROU1887", Squawk: "4521", OtherCallsign: "DAL42", Since: now},
+	}
+	if got := s.squawks.activeAlerts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected alerts %+v, got %+v", want, got)
+	}
+
+	// Both in-range controllers are notified of both alerts
+	for _, atc := range []*mockClient{atc1, atc2} {
+		if packets := atc.collectPackets(); len(packets) != 2 {
+			t.Errorf("expected 2 alerts sent to %s, got %q", atc.callsign, packets)
+		}
+	}
+
+	// Ongoing alerts are not sent again
+	s.checkSquawks(now.Add(squawkCheckInterval))
+	if packets := atc1.collectPackets(); len(packets) != 0 {
+		t.Errorf("expected no repeated alerts, got %q", packets)
+	}
+	if got := s.squawks.activeAlerts(); len(got) != 2 || !got[0].Since.Equal(now) {
+		t.Errorf("expected ongoing alerts to keep their start time, got %+v", got)
+	}
+
+	// Alerts clear once resolved
+	other.transponder.Store("4522")
+	s.checkSquawks(now.Add(2 * squawkCheckInterval))
+	if got := s.squawks.activeAlerts(); len(got) != 0 {
+		t.Errorf("expected no alerts, got %+v", got)
+	}
+}
+
+// TestCheckSquawks_Mismatch verifies that a pilot squawking a code other than their assigned
+// code is flagged after SquawkMismatchDuration, and that only the tracking controller is notified.
+func TestCheckSquawks_Mismatch(t *testing.T) {
+	s, pilot, atc1, atc2 := newTrackStateTestServer(t)
+	pilot.transponder.Store("2000")
+
+	s.recordClientQueryTrackState(atc1.Client, []byte("$CQSCT_APP:@94835:IT:ROU1887\r\n"))
+	s.recordClientQueryTrackState(atc1.Client, []byte("$CQSCT_APP:@94835:BC:ROU1887:4521\r\n"))
+
+	now := time.Now()
+	s.checkSquawks(now)
+	if got := s.squawks.activeAlerts(); len(got) != 0 {
+		t.Fatalf("expected no alerts before SquawkMismatchDuration, got %+v", got)
+	}
+
+	s.checkSquawks(now.Add(time.Minute))
+	want := []SquawkAlert{
+		{Type: SquawkAlertMismatch, Callsign: "ROU1887", Squawk: "2000", AssignedSquawk: "4521", Since: now},
+	}
+	if got := s.squawks.activeAlerts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected alerts %+v, got %+v", want, got)
+	}
+
+	wantPackets := []string{"#TMserver:SCT_APP:ROU1887 squawking 2000, assigned 4521\r\n"}
+	if got := atc1.collectPackets(); !reflect.DeepEqual(got, wantPackets) {
+		t.Errorf("expected packets %q, got %q", wantPackets, got)
+	}
+	if got := atc2.collectPackets(); len(got) != 0 {
+		t.Errorf("expected no packets sent to non-tracking controller, got %q", got)
+	}
+
+	pilot.transponder.Store("4521")
+	s.checkSquawks(now.Add(time.Minute + squawkCheckInterval))
+	if got := s.squawks.activeAlerts(); len(got) != 0 {
+		t.Errorf("expected no alerts, got %+v", got)
+	}
+}
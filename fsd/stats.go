@@ -0,0 +1,67 @@
+package fsd
+
+import (
+	"context"
+	"github.com/renorris/openfsd/db"
+	"go.uber.org/atomic"
+	"log/slog"
+	"time"
+)
+
+// packetCounters counts the packets received from and sent to all clients.
+type packetCounters struct {
+	in  atomic.Uint64
+	out atomic.Uint64
+}
+
+// runStatsCollector periodically stores a network activity sample in the database.
+func (s *Server) runStatsCollector(ctx context.Context) {
+	if s.cfg.StatsSampleInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.StatsSampleInterval)
+	defer ticker.Stop()
+
+	lastIn, lastOut := s.packets.in.Load(), s.packets.out.Load()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sample := s.sampleStats(now, s.cfg.StatsSampleInterval)
+
+			in, out := s.packets.in.Load(), s.packets.out.Load()
+			sample.PacketsIn, sample.PacketsOut = int64(in-lastIn), int64(out-lastOut)
+			lastIn, lastOut = in, out
+
+			if err := s.dbRepo.StatsRepo.CreateStatsSample(&sample); err != nil {
+				slog.Error("error storing stats sample", "error", err)
+			}
+		}
+	}
+}
+
+// sampleStats counts the connected clients. Unique users are counted by distinct CID.
+func (s *Server) sampleStats(now time.Time, interval time.Duration) (sample db.StatsSample) {
+	sample.Time = now
+	sample.Interval = interval
+
+	cids := map[int]bool{}
+	s.postOffice.clientMapLock.RLock()
+	for _, client := range s.postOffice.clientMap {
+		if client.peer != nil {
+			continue // Counted by its own server
+		}
+		if client.isAtc {
+			sample.ATC++
+		} else {
+			sample.Pilots++
+		}
+		cids[client.cid] = true
+	}
+	s.postOffice.clientMapLock.RUnlock()
+
+	sample.UniqueUsers = len(cids)
+	return
+}
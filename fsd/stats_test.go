@@ -0,0 +1,42 @@
+package fsd
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSampleStats verifies that clients are counted by type and unique users by distinct CID.
+func TestSampleStats(t *testing.T) {
+	s := &Server{postOffice: newPostOffice()}
+
+	clients := []struct {
+		callsign string
+		cid      int
+		isAtc    bool
+	}{
+		{"DAL1", 100001, false},
+		{"DAL2", 100002, false},
+		{"LAX_TWR", 100003, true},
+		{"LAX_ATIS", 100003, true}, // Same controller connected twice
+		{"LAX_OBS", 100001, true},  // Pilot also observing
+	}
+	for _, c := range clients {
+		client := newMockClient(c.callsign)
+		client.cid = c.cid
+		client.isAtc = c.isAtc
+		client.setLatLon(33.9, -118.4)
+		if err := s.postOffice.register(client.Client); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	sample := s.sampleStats(now, time.Minute)
+
+	if sample.Pilots != 2 || sample.ATC != 3 || sample.UniqueUsers != 3 {
+		t.Errorf("expected 2 pilots, 3 ATC and 3 unique users, got %+v", sample)
+	}
+	if !sample.Time.Equal(now) || sample.Interval != time.Minute {
+		t.Errorf("unexpected sample time or interval: %+v", sample)
+	}
+}
@@ -0,0 +1,195 @@
+package fsd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Track export formats
+const (
+	TrackFormatGeoJSON = "geojson"
+	TrackFormatKML     = "kml"
+	TrackFormatGPX     = "gpx"
+)
+
+var ErrUnknownTrackFormat = errors.New("unknown track format")
+
+const metersPerFoot = 0.3048
+
+// trackContentType returns the MIME type of a track export format.
+func trackContentType(format string) (contentType string, err error) {
+	switch format {
+	case TrackFormatGeoJSON:
+		contentType = "application/geo+json"
+	case TrackFormatKML:
+		contentType = "application/vnd.google-earth.kml+xml"
+	case TrackFormatGPX:
+		contentType = "application/gpx+xml"
+	default:
+		err = ErrUnknownTrackFormat
+	}
+	return
+}
+
+// writeTrack writes a recorded track in the given format.
+func writeTrack(w io.Writer, format string, callsign string, samples []PositionSample) (err error) {
+	switch format {
+	case TrackFormatGeoJSON:
+		return writeTrackGeoJSON(w, callsign, samples)
+	case TrackFormatKML:
+		return writeTrackKML(w, callsign, samples)
+	case TrackFormatGPX:
+		return writeTrackGPX(w, callsign, samples)
+	default:
+		return ErrUnknownTrackFormat
+	}
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   geoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// writeTrackGeoJSON writes a track as a GeoJSON FeatureCollection containing a LineString
+// of the whole track followed by a Point for each sample. Altitudes are in meters.
+func writeTrackGeoJSON(w io.Writer, callsign string, samples []PositionSample) (err error) {
+	lineCoords := make([][3]float64, 0, len(samples))
+	coordTimes := make([]time.Time, 0, len(samples))
+	features := make([]geoJSONFeature, 1, len(samples)+1)
+
+	for _, sample := range samples {
+		coord := [3]float64{sample.Longitude, sample.Latitude, float64(sample.Altitude) * metersPerFoot}
+		lineCoords = append(lineCoords, coord)
+		coordTimes = append(coordTimes, sample.Time)
+		features = append(features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "Point", Coordinates: coord},
+			Properties: map[string]any{
+				"time":        sample.Time,
+				"altitude":    sample.Altitude,
+				"groundspeed": sample.Groundspeed,
+				"heading":     sample.Heading,
+				"squawk":      sample.Squawk,
+			},
+		})
+	}
+
+	features[0] = geoJSONFeature{
+		Type:     "Feature",
+		Geometry: geoJSONGeometry{Type: "LineString", Coordinates: lineCoords},
+		Properties: map[string]any{
+			"callsign":   callsign,
+			"coordTimes": coordTimes,
+		},
+	}
+
+	return json.NewEncoder(w).Encode(&geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: features,
+	})
+}
+
+type kmlDocument struct {
+	XMLName   xml.Name `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Name      string   `xml:"Document>name"`
+	Placemark struct {
+		Name        string `xml:"name"`
+		Description string `xml:"description"`
+		LineString  struct {
+			AltitudeMode string `xml:"altitudeMode"`
+			Coordinates  string `xml:"coordinates"`
+		} `xml:"LineString"`
+	} `xml:"Document>Placemark"`
+}
+
+// writeTrackKML writes a track as a KML LineString placemark. Altitudes are in meters.
+func writeTrackKML(w io.Writer, callsign string, samples []PositionSample) (err error) {
+	doc := kmlDocument{Name: callsign}
+	doc.Placemark.Name = callsign
+	doc.Placemark.LineString.AltitudeMode = "absolute"
+
+	coords := strings.Builder{}
+	for i, sample := range samples {
+		if i > 0 {
+			coords.WriteByte(' ')
+		}
+		coords.WriteString(strconv.FormatFloat(sample.Longitude, 'f', -1, 64))
+		coords.WriteByte(',')
+		coords.WriteString(strconv.FormatFloat(sample.Latitude, 'f', -1, 64))
+		coords.WriteByte(',')
+		coords.WriteString(strconv.FormatFloat(float64(sample.Altitude)*metersPerFoot, 'f', 1, 64))
+	}
+	doc.Placemark.LineString.Coordinates = coords.String()
+
+	if len(samples) > 0 {
+		doc.Placemark.Description = samples[0].Time.UTC().Format(time.RFC3339) + " to " + samples[len(samples)-1].Time.UTC().Format(time.RFC3339)
+	}
+
+	return writeXML(w, &doc)
+}
+
+type gpxDocument struct {
+	XMLName xml.Name `xml:"http://www.topografix.com/GPX/1/1 gpx"`
+	Version string   `xml:"version,attr"`
+	Creator string   `xml:"creator,attr"`
+	Track   struct {
+		Name   string          `xml:"name"`
+		Points []gpxTrackPoint `xml:"trkseg>trkpt"`
+	} `xml:"trk"`
+}
+
+type gpxTrackPoint struct {
+	Lat         float64 `xml:"lat,attr"`
+	Lon         float64 `xml:"lon,attr"`
+	Elevation   float64 `xml:"ele"`
+	Time        string  `xml:"time"`
+	Description string  `xml:"desc"`
+}
+
+// writeTrackGPX writes a track as a GPX 1.1 track. Elevations are in meters, and the ground speed,
+// heading and squawk of each point are written to its description.
+func writeTrackGPX(w io.Writer, callsign string, samples []PositionSample) (err error) {
+	doc := gpxDocument{Version: "1.1", Creator: "openfsd"}
+	doc.Track.Name = callsign
+	doc.Track.Points = make([]gpxTrackPoint, 0, len(samples))
+
+	for _, sample := range samples {
+		doc.Track.Points = append(doc.Track.Points, gpxTrackPoint{
+			Lat:         sample.Latitude,
+			Lon:         sample.Longitude,
+			Elevation:   float64(sample.Altitude) * metersPerFoot,
+			Time:        sample.Time.UTC().Format(time.RFC3339),
+			Description: "GS " + strconv.Itoa(sample.Groundspeed) + " HDG " + strconv.Itoa(sample.Heading) + " SQ " + sample.Squawk,
+		})
+	}
+
+	return writeXML(w, &doc)
+}
+
+func writeXML(w io.Writer, v any) (err error) {
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err = encoder.Encode(v); err != nil {
+		return
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,116 @@
+package fsd
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTrackSamples() []PositionSample {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	return []PositionSample{
+		{Time: start, Latitude: 33.94, Longitude: -118.40, Altitude: 1000, Groundspeed: 180, Heading: 250, Squawk: "4521"},
+		{Time: start.Add(5 * time.Second), Latitude: 33.93, Longitude: -118.42, Altitude: 1500, Groundspeed: 190, Heading: 251, Squawk: "4521"},
+	}
+}
+
+func TestWriteTrackGeoJSON(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := writeTrack(&buf, TrackFormatGeoJSON, "ROU1887", testTrackSamples()); err != nil {
+		t.Fatal(err)
+	}
+
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &collection); err != nil {
+		t.Fatal(err)
+	}
+
+	if collection.Type != "FeatureCollection" {
+		t.Errorf("expected FeatureCollection, got %s", collection.Type)
+	}
+	if len(collection.Features) != 3 {
+		t.Fatalf("expected 3 features, got %d", len(collection.Features))
+	}
+
+	line := collection.Features[0]
+	if line.Geometry.Type != "LineString" || line.Properties["callsign"] != "ROU1887" {
+		t.Errorf("unexpected line feature: %+v", line)
+	}
+	var coords [][3]float64
+	if err := json.Unmarshal(line.Geometry.Coordinates, &coords); err != nil {
+		t.Fatal(err)
+	}
+	if len(coords) != 2 || coords[0] != [3]float64{-118.40, 33.94, 304.8} {
+		t.Errorf("unexpected line coordinates: %v", coords)
+	}
+
+	point := collection.Features[2]
+	if point.Geometry.Type != "Point" || point.Properties["squawk"] != "4521" || point.Properties["groundspeed"] != float64(190) {
+		t.Errorf("unexpected point feature: %+v", point)
+	}
+}
+
+func TestWriteTrackKML(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := writeTrack(&buf, TrackFormatKML, "ROU1887", testTrackSamples()); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := kmlDocument{}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Placemark.Name != "ROU1887" {
+		t.Errorf("expected placemark ROU1887, got %s", doc.Placemark.Name)
+	}
+	expected := "-118.4,33.94,304.8 -118.42,33.93,457.2"
+	if doc.Placemark.LineString.Coordinates != expected {
+		t.Errorf("expected coordinates %q, got %q", expected, doc.Placemark.LineString.Coordinates)
+	}
+}
+
+func TestWriteTrackGPX(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := writeTrack(&buf, TrackFormatGPX, "ROU1887", testTrackSamples()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Error("expected XML header")
+	}
+
+	doc := gpxDocument{}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Track.Name != "ROU1887" || len(doc.Track.Points) != 2 {
+		t.Fatalf("unexpected track: %+v", doc.Track)
+	}
+	point := doc.Track.Points[1]
+	if point.Lat != 33.93 || point.Lon != -118.42 || point.Time != "2025-01-01T12:00:05Z" || point.Description != "GS 190 HDG 251 SQ 4521" {
+		t.Errorf("unexpected track point: %+v", point)
+	}
+}
+
+func TestWriteTrack_UnknownFormat(t *testing.T) {
+	if err := writeTrack(&bytes.Buffer{}, "csv", "ROU1887", nil); !errors.Is(err, ErrUnknownTrackFormat) {
+		t.Errorf("expected ErrUnknownTrackFormat, got %v", err)
+	}
+	if _, err := trackContentType("csv"); !errors.Is(err, ErrUnknownTrackFormat) {
+		t.Errorf("expected ErrUnknownTrackFormat, got %v", err)
+	}
+}
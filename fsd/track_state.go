@@ -0,0 +1,244 @@
+package fsd
+
+import (
+	"maps"
+	"strings"
+	"sync"
+	"time"
+)
+
+// aircraftState is the ATC state of a single aircraft shared between controllers
+type aircraftState struct {
+	trackingController string // Callsign of the controller tracking the aircraft
+	scratchpad         string
+	tempAltitude       string
+	finalAltitude      string
+	beaconCode         string
+	handoff            handoffState // Most recent handoff of the aircraft
+}
+
+// trackStore is the authoritative table of per-aircraft ATC state.
+//
+// Controllers exchange this state with one another via $CQ and #PC packets. The server
+// remembers it so that controllers connecting later can be brought up to date.
+type trackStore struct {
+	lock     sync.Mutex
+	aircraft map[string]aircraftState                   // Aircraft callsign -> state
+	onChange func(callsign string, state aircraftState) // Called after update changes a state. Optional.
+}
+
+func newTrackStore() *trackStore {
+	return &trackStore{
+		aircraft: make(map[string]aircraftState, 128),
+	}
+}
+
+// update modifies the state of an aircraft. Empty states are removed from the table.
+// If fn returns an error, the state is left unchanged and the error is returned.
+func (t *trackStore) update(callsign string, fn func(state *aircraftState) error) (err error) {
+	t.lock.Lock()
+	state := t.aircraft[callsign]
+	if err = fn(&state); err != nil {
+		t.lock.Unlock()
+		return
+	}
+	t.store(callsign, state)
+	t.lock.Unlock()
+
+	if t.onChange != nil {
+		t.onChange(callsign, state)
+	}
+	return
+}
+
+// replace sets the state of an aircraft, such as one received from a linked server, without calling onChange.
+func (t *trackStore) replace(callsign string, state aircraftState) {
+	t.lock.Lock()
+	t.store(callsign, state)
+	t.lock.Unlock()
+}
+
+// store sets the state of an aircraft. The lock must be held.
+func (t *trackStore) store(callsign string, state aircraftState) {
+	if state == (aircraftState{}) {
+		delete(t.aircraft, callsign)
+		return
+	}
+	t.aircraft[callsign] = state
+}
+
+// get returns the state of an aircraft.
+func (t *trackStore) get(callsign string) (state aircraftState, ok bool) {
+	t.lock.Lock()
+	state, ok = t.aircraft[callsign]
+	t.lock.Unlock()
+	return
+}
+
+// snapshot returns a copy of the state of every aircraft.
+func (t *trackStore) snapshot() (aircraft map[string]aircraftState) {
+	t.lock.Lock()
+	aircraft = maps.Clone(t.aircraft)
+	t.lock.Unlock()
+	return
+}
+
+// release removes the state associated with a disconnecting client.
+// Pilots lose their entire state, while controllers lose any tracks they own.
+func (t *trackStore) release(client *Client) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !client.isAtc {
+		delete(t.aircraft, client.callsign)
+		return
+	}
+
+	for callsign, state := range t.aircraft {
+		if state.trackingController == client.callsign {
+			state.trackingController = ""
+		}
+		if state.handoff.involves(client.callsign) {
+			state.handoff.status = handoffCancelled
+		}
+		t.store(callsign, state)
+	}
+}
+
+// recordClientQueryTrackState records the shared ATC state carried by a $CQ packet.
+// Returns an error if the controller may not make the change.
+func (s *Server) recordClientQueryTrackState(client *Client, packet []byte) (err error) {
+	if countFields(packet) < 4 {
+		return
+	}
+	var value string
+	if countFields(packet) > 4 {
+		value = string(getField(packet, 4))
+	}
+	return s.recordTrackState(client, string(getField(packet, 2)), string(getField(packet, 3)), value)
+}
+
+// recordProControllerTrackState records the shared ATC state carried by a #PC packet.
+// Returns an error if the controller may not make the change.
+func (s *Server) recordProControllerTrackState(client *Client, packet []byte) (err error) {
+	if countFields(packet) < 5 {
+		return
+	}
+	var value string
+	if countFields(packet) > 5 {
+		value = string(getField(packet, 5))
+	}
+	return s.recordTrackState(client, string(getField(packet, 3)), string(getField(packet, 4)), value)
+}
+
+func (s *Server) recordTrackState(client *Client, stateType, targetCallsign, value string) (err error) {
+	// Only remember state for connected pilots
+	target, err := s.postOffice.find(targetCallsign)
+	if err != nil || target.isAtc {
+		return nil
+	}
+
+	return s.tracks.update(targetCallsign, func(state *aircraftState) error {
+		switch stateType {
+		case "IT": // Initiate track
+			if state.trackingController != "" && state.trackingController != client.callsign {
+				return ErrTrackedByOtherController
+			}
+			state.trackingController = client.callsign
+		case "HT": // Accept handoff
+			// Clients announce a handoff already accepted with $HA to the other controllers in range
+			if state.handoff.status == handoffAccepted && state.handoff.to == client.callsign && state.trackingController == client.callsign {
+				return nil
+			}
+			return state.acceptHandoff(client.callsign, time.Now())
+		case "IH": // I have
+			if state.trackingController != "" && state.trackingController != client.callsign {
+				return ErrTrackedByOtherController
+			}
+			state.trackingController = client.callsign
+		case "DR": // Drop track
+			if state.trackingController == client.callsign {
+				state.trackingController = ""
+				if state.handoff.pending(time.Now()) {
+					state.handoff.status = handoffCancelled
+				}
+			}
+		case "SC":
+			state.scratchpad = value
+		case "TA":
+			state.tempAltitude = value
+		case "FA":
+			state.finalAltitude = value
+		case "BC":
+			state.beaconCode = value
+		}
+		return nil
+	})
+}
+
+// sendTrackState sends the shared ATC state of every aircraft in range to a controller.
+func (s *Server) sendTrackState(client *Client) {
+	var pilots []string
+	s.postOffice.search(client, func(recipient *Client) bool {
+		if !recipient.isAtc {
+			pilots = append(pilots, recipient.callsign)
+		}
+		return true
+	})
+
+	for _, pilot := range pilots {
+		state, ok := s.tracks.get(pilot)
+		if !ok {
+			continue
+		}
+		for _, packet := range buildTrackStatePackets(client.callsign, pilot, state) {
+			client.send(packet)
+		}
+	}
+}
+
+// buildTrackStatePackets builds the #PC packets describing the state of an aircraft.
+// Packets are sent on behalf of the tracking controller, or the server if the aircraft is not tracked.
+func buildTrackStatePackets(recipient, targetCallsign string, state aircraftState) (packets []string) {
+	source := state.trackingController
+	if source == "" {
+		source = "server"
+	} else {
+		packets = append(packets, buildProControllerPacket(source, recipient, "IH", targetCallsign, ""))
+	}
+
+	if state.scratchpad != "" {
+		packets = append(packets, buildProControllerPacket(source, recipient, "SC", targetCallsign, state.scratchpad))
+	}
+	if state.tempAltitude != "" {
+		packets = append(packets, buildProControllerPacket(source, recipient, "TA", targetCallsign, state.tempAltitude))
+	}
+	if state.finalAltitude != "" {
+		packets = append(packets, buildProControllerPacket(source, recipient, "FA", targetCallsign, state.finalAltitude))
+	}
+	if state.beaconCode != "" {
+		packets = append(packets, buildBeaconCodePacket(source, recipient, targetCallsign, state.beaconCode))
+	}
+	return
+}
+
+// buildProControllerPacket builds a #PC packet concerning a target aircraft. An empty value is omitted.
+func buildProControllerPacket(source, recipient, pcType, targetCallsign, value string) (packet string) {
+	builder := strings.Builder{}
+	builder.Grow(48)
+	builder.WriteString("#PC")
+	builder.WriteString(source)
+	builder.WriteByte(':')
+	builder.WriteString(recipient)
+	builder.WriteString(":CCP:")
+	builder.WriteString(pcType)
+	builder.WriteByte(':')
+	builder.WriteString(targetCallsign)
+	if value != "" {
+		builder.WriteByte(':')
+		builder.WriteString(value)
+	}
+	builder.WriteString("\r\n")
+
+	return builder.String()
+}
@@ -0,0 +1,139 @@
+package fsd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTrackStateTestServer creates a Server with a pilot and two controllers registered near each other.
+func newTrackStateTestServer(t *testing.T) (s *Server, pilot *mockClient, atc1 *mockClient, atc2 *mockClient) {
+	s = &Server{
+		cfg:        &ServerConfig{HandoffTimeout: time.Minute, SquawkMismatchDuration: time.Minute},
+		postOffice: newPostOffice(),
+		tracks:     newTrackStore(),
+		squawks:    newSquawkMonitor(),
+	}
+
+	pilot = newMockClient("ROU1887")
+	atc1 = newMockClient("SCT_APP")
+	atc1.isAtc = true
+	atc1.facilityType = 5
+	atc2 = newMockClient("LAX_CTR")
+	atc2.isAtc = true
+	atc2.facilityType = 6
+
+	for _, client := range []*mockClient{pilot, atc1, atc2} {
+		client.setLatLon(33.9, -118.4)
+		client.visRange.Store(100000)
+		if err := s.postOffice.register(client.Client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+// TestTrackState_Record verifies that shared ATC state is recorded from $CQ and #PC packets.
+func TestTrackState_Record(t *testing.T) {
+	s, _, atc1, atc2 := newTrackStateTestServer(t)
+
+	s.recordClientQueryTrackState(atc1.Client, []byte("$CQSCT_APP:@94835:IT:ROU1887\r\n"))
+	s.recordProControllerTrackState(atc1.Client, []byte("#PCSCT_APP:@94835:CCP:SC:ROU1887:H270\r\n"))
+	s.recordProControllerTrackState(atc1.Client, []byte("#PCSCT_APP:@94835:CCP:TA:ROU1887:7000\r\n"))
+	s.recordClientQueryTrackState(atc1.Client, []byte("$CQSCT_APP:@94835:FA:ROU1887:35000\r\n"))
+	s.recordProControllerTrackState(atc1.Client, []byte("#PCSCT_APP:@94835:CCP:BC:ROU1887:6342\r\n"))
+
+	// Another controller cannot initiate a track on a tracked aircraft
+	if err := s.recordClientQueryTrackState(atc2.Client, []byte("$CQLAX_CTR:@94835:IT:ROU1887\r\n")); !errors.Is(err, ErrTrackedByOtherController) {
+		t.Errorf("expected ErrTrackedByOtherController, got %v", err)
+	}
+
+	// State is not recorded for unknown callsigns
+	s.recordClientQueryTrackState(atc1.Client, []byte("$CQSCT_APP:@94835:IT:N12345\r\n"))
+
+	want := aircraftState{
+		trackingController: "SCT_APP",
+		scratchpad:         "H270",
+		tempAltitude:       "7000",
+		finalAltitude:      "35000",
+		beaconCode:         "6342",
+	}
+	if got, _ := s.tracks.get("ROU1887"); got != want {
+		t.Errorf("expected state %+v, got %+v", want, got)
+	}
+	if _, ok := s.tracks.get("N12345"); ok {
+		t.Error("expected no state for unknown callsign")
+	}
+
+	// Tracks cannot be taken without a handoff
+	if err := s.recordClientQueryTrackState(atc2.Client, []byte("$CQLAX_CTR:@94835:HT:ROU1887\r\n")); !errors.Is(err, ErrNoPendingHandoff) {
+		t.Errorf("expected ErrNoPendingHandoff, got %v", err)
+	}
+	if err := s.recordProControllerTrackState(atc2.Client, []byte("#PCLAX_CTR:@94835:CCP:IH:ROU1887\r\n")); !errors.Is(err, ErrTrackedByOtherController) {
+		t.Errorf("expected ErrTrackedByOtherController, got %v", err)
+	}
+	if got, _ := s.tracks.get("ROU1887"); got.trackingController != "SCT_APP" {
+		t.Errorf("expected SCT_APP to still track, got %q", got.trackingController)
+	}
+
+	// Accepting a handoff transfers the track
+	if err := s.requestHandoff("SCT_APP", "LAX_CTR", "ROU1887"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.recordClientQueryTrackState(atc2.Client, []byte("$CQLAX_CTR:@94835:HT:ROU1887\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.tracks.get("ROU1887"); got.trackingController != "LAX_CTR" {
+		t.Errorf("expected LAX_CTR to track, got %q", got.trackingController)
+	}
+
+	// Only the tracking controller can drop the track
+	s.recordClientQueryTrackState(atc1.Client, []byte("$CQSCT_APP:@94835:DR:ROU1887\r\n"))
+	if got, _ := s.tracks.get("ROU1887"); got.trackingController != "LAX_CTR" {
+		t.Errorf("expected LAX_CTR to still track, got %q", got.trackingController)
+	}
+	s.recordClientQueryTrackState(atc2.Client, []byte("$CQLAX_CTR:@94835:DR:ROU1887\r\n"))
+	if got, _ := s.tracks.get("ROU1887"); got.trackingController != "" {
+		t.Errorf("expected no tracking controller, got %q", got.trackingController)
+	}
+}
+
+// TestTrackState_Release verifies state cleanup when controllers and pilots disconnect.
+func TestTrackState_Release(t *testing.T) {
+	s, pilot, atc1, _ := newTrackStateTestServer(t)
+
+	s.recordClientQueryTrackState(atc1.Client, []byte("$CQSCT_APP:@94835:IT:ROU1887\r\n"))
+	s.recordClientQueryTrackState(atc1.Client, []byte("$CQSCT_APP:@94835:SC:ROU1887:SFR\r\n"))
+
+	s.tracks.release(atc1.Client)
+	want := aircraftState{scratchpad: "SFR"}
+	if got, _ := s.tracks.get("ROU1887"); got != want {
+		t.Errorf("expected state %+v after controller release, got %+v", want, got)
+	}
+
+	s.tracks.release(pilot.Client)
+	if _, ok := s.tracks.get("ROU1887"); ok {
+		t.Error("expected no state after pilot release")
+	}
+}
+
+// TestTrackState_SendToNewController verifies that a newly positioned controller receives aircraft state.
+func TestTrackState_SendToNewController(t *testing.T) {
+	s, _, atc1, atc2 := newTrackStateTestServer(t)
+
+	s.recordClientQueryTrackState(atc1.Client, []byte("$CQSCT_APP:@94835:IT:ROU1887\r\n"))
+	s.recordProControllerTrackState(atc1.Client, []byte("#PCSCT_APP:@94835:CCP:SC:ROU1887:H270\r\n"))
+	s.recordProControllerTrackState(atc1.Client, []byte("#PCSCT_APP:@94835:CCP:BC:ROU1887:6342\r\n"))
+
+	s.sendTrackState(atc2.Client)
+
+	want := []string{
+		"#PCSCT_APP:LAX_CTR:CCP:IH:ROU1887\r\n",
+		"#PCSCT_APP:LAX_CTR:CCP:SC:ROU1887:H270\r\n",
+		"#PCSCT_APP:LAX_CTR:CCP:BC:ROU1887:6342\r\n",
+	}
+	if got := atc2.collectPackets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected packets %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,143 @@
+package fsd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TransponderCodeRange is a range of transponder codes which may be allocated to aircraft.
+type TransponderCodeRange struct {
+	Region   string `json:"region"`   // Controller callsign prefix the range applies to. Empty matches any controller.
+	Facility int    `json:"facility"` // Controller facility type the range applies to. Zero matches any facility.
+	Start    string `json:"start"`    // First code of the range, e.g. "2201"
+	End      string `json:"end"`      // Last code of the range, e.g. "2277"
+}
+
+// defaultTransponderCodeRange is used when no configured range matches a controller
+var defaultTransponderCodeRange = TransponderCodeRange{Start: "0101", End: "7677"}
+
+// reservedTransponderCodes are never allocated to aircraft
+var reservedTransponderCodes = map[int]bool{
+	0o1200: true, // VFR (North America)
+	0o2000: true, // No code assigned
+	0o7000: true, // VFR (Europe)
+	0o7500: true, // Hijack
+	0o7600: true, // Radio failure
+	0o7700: true, // Emergency
+}
+
+var (
+	ErrInvalidTransponderCode     = errors.New("invalid transponder code")
+	ErrNoTransponderCodeAvailable = errors.New("no transponder code available")
+)
+
+// parseTransponderCode parses a 4-digit octal transponder code.
+func parseTransponderCode(code string) (value int, err error) {
+	if len(code) != 4 {
+		err = ErrInvalidTransponderCode
+		return
+	}
+	parsed, err := strconv.ParseUint(code, 8, 16)
+	if err != nil {
+		err = ErrInvalidTransponderCode
+		return
+	}
+	value = int(parsed)
+	return
+}
+
+func formatTransponderCode(value int) string {
+	return fmt.Sprintf("%04o", value)
+}
+
+// parseTransponderCodeRanges parses the JSON-encoded transponder code range configuration.
+func parseTransponderCodeRanges(raw string) (ranges []TransponderCodeRange, err error) {
+	if strings.TrimSpace(raw) == "" {
+		return
+	}
+	if err = json.Unmarshal([]byte(raw), &ranges); err != nil {
+		return
+	}
+	for _, r := range ranges {
+		start, startErr := parseTransponderCode(r.Start)
+		end, endErr := parseTransponderCode(r.End)
+		if startErr != nil || endErr != nil || start > end {
+			err = fmt.Errorf("%w: range %s-%s", ErrInvalidTransponderCode, r.Start, r.End)
+			return
+		}
+	}
+	return
+}
+
+// selectTransponderCodeRange returns the first range matching a controller's callsign and facility type,
+// falling back to defaultTransponderCodeRange.
+func selectTransponderCodeRange(ranges []TransponderCodeRange, callsign string, facilityType int) TransponderCodeRange {
+	for _, r := range ranges {
+		if !strings.HasPrefix(callsign, r.Region) {
+			continue
+		}
+		if r.Facility != 0 && r.Facility != facilityType {
+			continue
+		}
+		return r
+	}
+	return defaultTransponderCodeRange
+}
+
+// allocateTransponderCode assigns a free code from a range to an aircraft.
+//
+// Codes assigned to or squawked by other online aircraft are skipped. If the aircraft
+// already has a code assigned within the range, it is kept.
+func (s *Server) allocateTransponderCode(targetCallsign string, codeRange TransponderCodeRange) (code string, err error) {
+	start, err := parseTransponderCode(codeRange.Start)
+	if err != nil {
+		return
+	}
+	end, err := parseTransponderCode(codeRange.End)
+	if err != nil {
+		return
+	}
+
+	// Collect codes squawked by other aircraft
+	inUse := map[int]bool{}
+	s.postOffice.all(nil, func(recipient *Client) bool {
+		if recipient.isAtc || recipient.callsign == targetCallsign {
+			return true
+		}
+		if squawk, parseErr := parseTransponderCode(recipient.transponder.Load()); parseErr == nil {
+			inUse[squawk] = true
+		}
+		return true
+	})
+
+	// The code is chosen and stored under the track store lock, and shared with linked servers like any other change
+	err = s.tracks.update(targetCallsign, func(state *aircraftState) error {
+		for callsign, other := range s.tracks.aircraft {
+			if callsign == targetCallsign {
+				continue
+			}
+			if assigned, parseErr := parseTransponderCode(other.beaconCode); parseErr == nil {
+				inUse[assigned] = true
+			}
+		}
+
+		if current, parseErr := parseTransponderCode(state.beaconCode); parseErr == nil && current >= start && current <= end && !inUse[current] {
+			code = state.beaconCode
+			return nil
+		}
+
+		for value := start; value <= end; value++ {
+			if inUse[value] || reservedTransponderCodes[value] {
+				continue
+			}
+			code = formatTransponderCode(value)
+			state.beaconCode = code
+			return nil
+		}
+		return ErrNoTransponderCodeAvailable
+	})
+	return
+}
@@ -0,0 +1,121 @@
+package fsd
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestParseTransponderCodeRanges verifies parsing and validation of the range configuration.
+func TestParseTransponderCodeRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantLen int
+		wantErr bool
+	}{
+		{name: "Empty", raw: ""},
+		{name: "Empty list", raw: "[]"},
+		{name: "Valid", raw: `[{"region":"LAX_","facility":5,"start":"2201","end":"2277"},{"start":"0101","end":"0177"}]`, wantLen: 2},
+		{name: "Non-octal", raw: `[{"start":"0180","end":"0190"}]`, wantErr: true},
+		{name: "Reversed", raw: `[{"start":"2277","end":"2201"}]`, wantErr: true},
+		{name: "Invalid JSON", raw: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, err := parseTransponderCodeRanges(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTransponderCodeRanges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(ranges) != tt.wantLen {
+				t.Errorf("expected %d ranges, got %d", tt.wantLen, len(ranges))
+			}
+		})
+	}
+}
+
+// TestSelectTransponderCodeRange verifies range selection by region and facility.
+func TestSelectTransponderCodeRange(t *testing.T) {
+	ranges := []TransponderCodeRange{
+		{Region: "LAX_", Facility: 5, Start: "2201", End: "2277"},
+		{Region: "LAX_", Start: "2301", End: "2377"},
+		{Region: "EG", Start: "4501", End: "4577"},
+	}
+
+	tests := []struct {
+		callsign     string
+		facilityType int
+		wantStart    string
+	}{
+		{"LAX_APP", 5, "2201"},
+		{"LAX_CTR", 6, "2301"},
+		{"EGLL_TWR", 4, "4501"},
+		{"KJFK_TWR", 4, defaultTransponderCodeRange.Start},
+	}
+	for _, tt := range tests {
+		t.Run(tt.callsign, func(t *testing.T) {
+			if got := selectTransponderCodeRange(ranges, tt.callsign, tt.facilityType); got.Start != tt.wantStart {
+				t.Errorf("expected range starting %s, got %s", tt.wantStart, got.Start)
+			}
+		})
+	}
+}
+
+// TestAllocateTransponderCode verifies conflict avoidance against assigned and squawked codes.
+func TestAllocateTransponderCode(t *testing.T) {
+	s, pilot, _, _ := newTrackStateTestServer(t)
+
+	other := newMockClient("N12345")
+	other.setLatLon(0, 0)
+	other.transponder.Store("1200")
+	if err := s.postOffice.register(other.Client); err != nil {
+		t.Fatal(err)
+	}
+	third := newMockClient("DAL42")
+	third.setLatLon(0, 0)
+	third.transponder.Store("1201")
+	if err := s.postOffice.register(third.Client); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another aircraft is already assigned the first free code
+	s.tracks.update("DAL42", func(state *aircraftState) error {
+		state.beaconCode = "1202"
+		return nil
+	})
+
+	codeRange := TransponderCodeRange{Start: "1177", End: "1204"}
+	code, err := s.allocateTransponderCode(pilot.callsign, codeRange)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if code != "1177" {
+		t.Errorf("expected 1177, got %s", code)
+	}
+
+	// Allocation is stable for an aircraft which already has a code in range
+	if code, _ = s.allocateTransponderCode(pilot.callsign, codeRange); code != "1177" {
+		t.Errorf("expected 1177 to be kept, got %s", code)
+	}
+
+	// 1200 is reserved and squawked, 1201 is squawked, 1202 is assigned
+	var changed string
+	s.tracks.onChange = func(callsign string, state aircraftState) {
+		changed = callsign + ":" + state.beaconCode
+	}
+	code, err = s.allocateTransponderCode(pilot.callsign, TransponderCodeRange{Start: "1200", End: "1204"})
+	if err != nil || code != "1203" {
+		t.Errorf("expected 1203, got %s (%v)", code, err)
+	}
+	if state, _ := s.tracks.get(pilot.callsign); state.beaconCode != "1203" {
+		t.Errorf("expected assigned code 1203, got %s", state.beaconCode)
+	}
+
+	// Allocated codes are shared with linked servers
+	if expected := pilot.callsign + ":1203"; changed != expected {
+		t.Errorf("expected change %q, got %q", expected, changed)
+	}
+
+	if _, err = s.allocateTransponderCode(pilot.callsign, TransponderCodeRange{Start: "1200", End: "1202"}); !errors.Is(err, ErrNoTransponderCodeAvailable) {
+		t.Errorf("expected ErrNoTransponderCodeAvailable, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package fsd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"go.uber.org/atomic"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transport carries the packets exchanged between the server and a Client.
+// Write delivers a single CRLF-terminated packet to the client, and Close disconnects it.
+type transport interface {
+	io.WriteCloser
+
+	// readPacket returns the next packet sent by the client without its CRLF delimiter.
+	// The returned slice is only valid until the next call.
+	readPacket() (packet []byte, err error)
+
+	// remoteIP returns the IP address of the client
+	remoteIP() string
+}
+
+// connTransport is the transport of a client connected over a socket
+type connTransport struct {
+	net.Conn
+	scanner *bufio.Scanner
+	pausing atomic.Bool   // Set once reading is being paused to hand the connection over to a new process
+	paused  chan struct{} // Closed once reading has paused
+	pending []byte        // Partial packet read before the pause. Only valid once paused.
+}
+
+// errTransportPaused is returned by readPacket once a connTransport has paused
+var errTransportPaused = errors.New("transport paused")
+
+// newConnTransport creates the transport of a socket. Buffered holds data already read from the socket,
+// which is read before anything else.
+func newConnTransport(conn net.Conn, buffered []byte) *connTransport {
+	var reader io.Reader = conn
+	if len(buffered) > 0 {
+		reader = io.MultiReader(bytes.NewReader(buffered), conn)
+	}
+	scanner := bufio.NewScanner(reader)
+	buf := make([]byte, 4096)
+	scanner.Buffer(buf, len(buf))
+
+	return &connTransport{
+		Conn:    conn,
+		scanner: scanner,
+		paused:  make(chan struct{}),
+	}
+}
+
+func (t *connTransport) readPacket() (packet []byte, err error) {
+	scanned := t.scanner.Scan()
+
+	// The scanner only reads once it holds no complete packet,
+	// so anything scanned after the pause interrupted a read is a partial packet.
+	if t.pausing.Load() && errors.Is(t.scanner.Err(), os.ErrDeadlineExceeded) {
+		if scanned {
+			t.pending = append([]byte{}, t.scanner.Bytes()...)
+		}
+		close(t.paused)
+		err = errTransportPaused
+		return
+	}
+
+	if !scanned {
+		if err = t.scanner.Err(); err == nil {
+			err = io.EOF
+		}
+		return
+	}
+	return t.scanner.Bytes(), nil
+}
+
+// pause interrupts reading from the socket without closing it. readPacket then returns errTransportPaused.
+func (t *connTransport) pause() {
+	t.pausing.Store(true)
+	t.SetReadDeadline(time.Now())
+}
+
+func (t *connTransport) remoteIP() string {
+	return remoteIP(t.Conn)
+}
+
+// channelTransport is an in-process transport between the server and a virtual client
+type channelTransport struct {
+	toServer  chan string   // Packets sent by the virtual client
+	toClient  chan string   // Packets sent by the server
+	done      chan struct{} // Closed once the transport is closed
+	closeOnce sync.Once
+}
+
+func newChannelTransport() *channelTransport {
+	return &channelTransport{
+		toServer: make(chan string),
+		toClient: make(chan string),
+		done:     make(chan struct{}),
+	}
+}
+
+// Write blocks until the virtual client receives the packet or the transport is closed.
+func (t *channelTransport) Write(packet []byte) (n int, err error) {
+	select {
+	case t.toClient <- string(packet):
+		return len(packet), nil
+	case <-t.done:
+		return 0, net.ErrClosed
+	}
+}
+
+func (t *channelTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.done) })
+	return nil
+}
+
+func (t *channelTransport) readPacket() (packet []byte, err error) {
+	select {
+	case p := <-t.toServer:
+		return []byte(strings.TrimSuffix(p, "\r\n")), nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+// remoteIP returns the loopback address, as virtual clients run inside the server.
+func (t *channelTransport) remoteIP() string {
+	return "127.0.0.1"
+}
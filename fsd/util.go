@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"math"
 	"slices"
 	"strconv"
 	"strings"
@@ -272,6 +273,18 @@ func broadcastAll(po *postOffice, client *Client, packet []byte) {
 	})
 }
 
+// broadcastAllLocal broadcasts a packet to every client connected to this server, excluding clients of linked servers
+func broadcastAllLocal(po *postOffice, client *Client, packet []byte) {
+	packetStr := string(packet)
+	po.all(client, func(recipient *Client) bool {
+		if recipient.peer != nil {
+			return true
+		}
+		recipient.send(packetStr)
+		return true
+	})
+}
+
 // broadcastAllATC broadcasts a packet to all ATC on entire server
 func broadcastAllATC(po *postOffice, client *Client, packet []byte) {
 	packetStr := string(packet)
@@ -323,8 +336,17 @@ func extractFlightplanInfoSection(packet []byte) (fpl string) {
 	return string(packet)
 }
 
-// buildFileFlightplanPacket builds an $FP packet
-func buildFileFlightplanPacket(source, recipient, fplInfo string) (packet string) {
+// textMessageBody extracts the message of a #TM packet, which may itself contain colons
+func textMessageBody(packet []byte) string {
+	for range 2 {
+		packet = rebaseToNextField(packet)
+	}
+	packet, _ = bytes.CutSuffix(packet, []byte("\r\n"))
+	return string(packet)
+}
+
+// BuildFileFlightplanPacket builds an $FP packet
+func BuildFileFlightplanPacket(source, recipient, fplInfo string) (packet string) {
 	prefix := strings.Builder{}
 	prefix.WriteString("$FP")
 	prefix.WriteString(source)
@@ -335,8 +357,8 @@ func buildFileFlightplanPacket(source, recipient, fplInfo string) (packet string
 	return buildFlightplanPacket(prefix.String(), fplInfo)
 }
 
-// buildAmendFlightplanPacket builds an $AM packet
-func buildAmendFlightplanPacket(source, recipient, targetCallsign, fplInfo string) (packet string) {
+// BuildAmendFlightplanPacket builds an $AM packet
+func BuildAmendFlightplanPacket(source, recipient, targetCallsign, fplInfo string) (packet string) {
 	prefix := strings.Builder{}
 	prefix.Grow(36)
 	prefix.WriteString("$AM")
@@ -376,7 +398,28 @@ func buildBeaconCodePacket(source, recipient, targetCallsign, beaconCode string)
 	return builder.String()
 }
 
-func pitchBankHeading(packed uint32) (pitch float64, bank float64, heading float64) {
+// buildServerTextMessagePacket builds a #TM packet from the server
+func buildServerTextMessagePacket(recipient, msg string) (packet string) {
+	return buildTextMessagePacket("server", recipient, msg)
+}
+
+// buildTextMessagePacket builds a #TM packet
+func buildTextMessagePacket(source, recipient, msg string) (packet string) {
+	builder := strings.Builder{}
+	builder.Grow(32 + len(msg))
+	builder.WriteString("#TM")
+	builder.WriteString(source)
+	builder.WriteByte(':')
+	builder.WriteString(recipient)
+	builder.WriteByte(':')
+	builder.WriteString(msg)
+	builder.WriteString("\r\n")
+
+	return builder.String()
+}
+
+// PitchBankHeading unpacks the pitch, bank and heading field of a pilot position packet into degrees.
+func PitchBankHeading(packed uint32) (pitch float64, bank float64, heading float64) {
 	// Map 11 bits of resolution to degrees [0..359]
 	const conversionRatio float64 = 359.0 / 1023.0
 	const mask uint32 = 1023 // 0b1111111111
@@ -388,6 +431,22 @@ func pitchBankHeading(packed uint32) (pitch float64, bank float64, heading float
 	return
 }
 
+// PackPitchBankHeading packs pitch, bank and heading in degrees [0..359] into the field format read by PitchBankHeading.
+func PackPitchBankHeading(pitch float64, bank float64, heading float64) (packed uint32) {
+	const conversionRatio float64 = 1023.0 / 359.0
+
+	pack := func(degrees float64) uint32 {
+		degrees = math.Mod(degrees, 360)
+		if degrees < 0 {
+			degrees += 360
+		}
+		return uint32(min(math.Round(degrees*conversionRatio), 1023))
+	}
+
+	packed = pack(pitch)<<22 | pack(bank)<<12 | pack(heading)<<2
+	return
+}
+
 func strPtr(str string) *string {
 	return &str
 }
@@ -2,6 +2,7 @@ package fsd
 
 import (
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -55,8 +56,29 @@ func TestGetField(t *testing.T) {
 }
 
 func TestPitchBankHeading(t *testing.T) {
-	pitch, bank, heading := pitchBankHeading(4261294148)
+	pitch, bank, heading := PitchBankHeading(4261294148)
 	fmt.Println(pitch)
 	fmt.Println(bank)
 	fmt.Println(heading)
 }
+
+func TestPackPitchBankHeading(t *testing.T) {
+	tests := []struct {
+		pitch, bank, heading float64
+	}{
+		{0, 0, 0},
+		{10, 350, 90},
+		{-5, 15, 359.9},
+		{0, 0, 720},
+	}
+
+	for _, tt := range tests {
+		pitch, bank, heading := PitchBankHeading(PackPitchBankHeading(tt.pitch, tt.bank, tt.heading))
+		for _, pair := range [][2]float64{{tt.pitch, pitch}, {tt.bank, bank}, {tt.heading, heading}} {
+			expected := math.Mod(math.Mod(pair[0], 360)+360, 360)
+			if diff := math.Abs(expected - pair[1]); diff > 1 && diff < 359 {
+				t.Errorf("PackPitchBankHeading(%v, %v, %v): expected %v, got %v", tt.pitch, tt.bank, tt.heading, expected, pair[1])
+			}
+		}
+	}
+}
@@ -6,7 +6,7 @@ import (
 )
 
 func TestVatsimAuth(t *testing.T) {
-	s := vatsimAuthState{}
+	s := VatsimAuthState{}
 
 	// 35044 = vPilot, 30984979d8caed23 = initial challenge
 	err := s.Initialize(35044, []byte("30984979d8caed23"))
@@ -24,7 +24,7 @@ func TestVatsimAuth(t *testing.T) {
 	expected = "8953f545c4e0ffd20943ad89b8ddd087"
 	assert.Equal(t, expected, actual)
 
-	s = vatsimAuthState{}
+	s = VatsimAuthState{}
 	// 48312 = TWRTrainer, 3ae3baf4 = initial challenge
 	err = s.Initialize(48312, []byte("3ae3baf4"))
 	assert.Nil(t, err)
@@ -36,7 +36,7 @@ func TestVatsimAuth(t *testing.T) {
 }
 
 func BenchmarkVatsimAuth(b *testing.B) {
-	s := vatsimAuthState{}
+	s := VatsimAuthState{}
 
 	if err := s.Initialize(35044, []byte("0123456789abcdef")); err != nil {
 		b.Fatal(err)
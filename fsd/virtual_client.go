@@ -0,0 +1,96 @@
+package fsd
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"strings"
+)
+
+// virtualClient is the in-process end of a Client which runs inside the server, such as a scenario aircraft.
+// Packets sent by a virtual client are handled like packets received from a socket.
+type virtualClient struct {
+	callsign  string
+	logger    *slog.Logger
+	transport *channelTransport
+}
+
+// connectVirtualClient connects a Client backed by a channelTransport instead of a socket.
+// Virtual clients skip authentication, and are hidden from the online users datafeed if hidden is set.
+//
+// It returns once the client is registered to the post office. The client is then served on another
+// goroutine until it is closed or ctx is cancelled. Packets sent to the client must be drained from
+// packets, as the server blocks on them like it blocks on a socket.
+func (s *Server) connectVirtualClient(ctx context.Context, data loginData, hidden bool) (vc *virtualClient, err error) {
+	connID := s.nextConnID.Inc()
+	logger := withLoginData(s.connLogger(connID, "virtual"), &data)
+
+	transport := newChannelTransport()
+	client := newClient(ctx, transport, data, logger)
+	client.connID = connID
+	client.virtual = true
+	client.hidden = hidden
+	if !client.isAtc {
+		client.history = newPositionHistory(s.cfg.PositionHistorySize)
+	}
+
+	if err = s.postOffice.register(client); err != nil {
+		client.cancelCtx()
+		return
+	}
+
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error("virtual client goroutine panicked", "panic", err, "stack", string(debug.Stack()))
+			}
+		}()
+		defer transport.Close()
+		s.serveClient(client)
+	}()
+
+	vc = &virtualClient{
+		callsign:  client.callsign,
+		logger:    logger,
+		transport: transport,
+	}
+	return
+}
+
+// send sends a single packet to the server as the virtual client.
+// It blocks until the server reads the packet, and returns an error once the client is disconnected.
+func (vc *virtualClient) send(packet string) (err error) {
+	if !strings.HasSuffix(packet, "\r\n") {
+		packet += "\r\n"
+	}
+
+	// Fail deterministically once closed, rather than racing the server's read
+	select {
+	case <-vc.transport.done:
+		return net.ErrClosed
+	default:
+	}
+
+	select {
+	case vc.transport.toServer <- packet:
+		return
+	case <-vc.transport.done:
+		return net.ErrClosed
+	}
+}
+
+// packets returns the channel of packets sent to the virtual client by the server.
+func (vc *virtualClient) packets() <-chan string {
+	return vc.transport.toClient
+}
+
+// done returns a channel which is closed once the virtual client is disconnected.
+func (vc *virtualClient) done() <-chan struct{} {
+	return vc.transport.done
+}
+
+// close disconnects the virtual client.
+func (vc *virtualClient) close() {
+	vc.transport.Close()
+}
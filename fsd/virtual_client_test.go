@@ -0,0 +1,104 @@
+package fsd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// expectVirtualPacket waits for a packet starting with prefix to be sent to a virtual client, discarding others.
+func expectVirtualPacket(t *testing.T, vc *virtualClient, prefix string) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case packet := <-vc.packets():
+			if strings.HasPrefix(packet, prefix) {
+				return
+			}
+		case <-vc.done():
+			t.Fatalf("%s disconnected before receiving %s", vc.callsign, prefix)
+		case <-timeout:
+			t.Fatalf("%s timed out waiting for %s", vc.callsign, prefix)
+		}
+	}
+}
+
+func TestVirtualClient(t *testing.T) {
+	s := newTestDatabaseServer(t, &ServerConfig{PositionHistorySize: 10})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	atc, err := s.connectVirtualClient(ctx, loginData{
+		callsign:      "LAX_TWR",
+		cid:           1,
+		realName:      "Virtual Tower",
+		networkRating: NetworkRatingController1,
+		protoRevision: 101,
+		isAtc:         true,
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectVirtualPacket(t, atc, "#TMserver:LAX_TWR:Connected to openfsd")
+	if err = atc.send("%LAX_TWR:18000:4:50:5:33.94250:-118.40810:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.connectVirtualClient(ctx, loginData{callsign: "LAX_TWR"}, false); !errors.Is(err, ErrCallsignInUse) {
+		t.Errorf("expected ErrCallsignInUse, got %v", err)
+	}
+
+	pilot, err := s.connectVirtualClient(ctx, loginData{
+		callsign:      "N123AB",
+		cid:           2,
+		realName:      "Virtual Pilot",
+		networkRating: NetworkRatingObserver,
+		protoRevision: 101,
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectVirtualPacket(t, pilot, "#TMserver:N123AB:Connected to openfsd")
+	expectVirtualPacket(t, atc, "#APN123AB:SERVER:2::1:101:1:Virtual Pilot")
+
+	// Packets from virtual clients are handled and broadcast like any others
+	pilot.send("@N:N123AB:1200:1:33.94000:-118.40000:100:0:0:0")
+	expectVirtualPacket(t, atc, "@N:N123AB:1200:1:33.94000:-118.40000:100:0:0:0")
+	pilot.send("#TMN123AB:LAX_TWR:ready for departure")
+	expectVirtualPacket(t, atc, "#TMN123AB:LAX_TWR:ready for departure")
+	atc.send("$CQLAX_TWR:SERVER:IP")
+	expectVirtualPacket(t, atc, "$CRSERVER:LAX_TWR:IP:127.0.0.1")
+
+	// Hidden clients are excluded from the datafeed
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	s.handleGetOnlineUsers(c)
+	var onlineUsers OnlineUsersResponseData
+	if err = json.Unmarshal(rec.Body.Bytes(), &onlineUsers); err != nil {
+		t.Fatal(err)
+	}
+	if len(onlineUsers.Pilots) != 0 || len(onlineUsers.ATC) != 1 || onlineUsers.ATC[0].Callsign != "LAX_TWR" {
+		t.Errorf("expected only LAX_TWR to be online, got %+v", onlineUsers)
+	}
+
+	// Closing a virtual client disconnects it
+	pilot.close()
+	expectVirtualPacket(t, atc, "#DPN123AB:SERVER:2")
+	if err = pilot.send("@N:N123AB:1200:1:33.94000:-118.40000:100:0:0:0"); err == nil {
+		t.Error("expected sending after close to fail")
+	}
+
+	// Cancelling the context disconnects the remaining clients
+	cancel()
+	select {
+	case <-atc.done():
+	case <-time.After(time.Second):
+		t.Fatal("expected LAX_TWR to disconnect")
+	}
+}
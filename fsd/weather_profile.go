@@ -0,0 +1,241 @@
+package fsd
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// WeatherProfile is a classic FSD weather profile. It is sent to clients
+// in response to #WX requests as a series of #TD, #WD and #CD packets.
+type WeatherProfile struct {
+	Barometer    int           `json:"barometer"`    // Altimeter setting in hundredths of inHg, e.g. 2992
+	Visibility   float64       `json:"visibility"`   // Visibility in statute miles
+	Temps        [4]TempLayer  `json:"temps"`        // Temperature layers, lowest first
+	Winds        [4]WindLayer  `json:"winds"`        // Wind layers, lowest first
+	Clouds       [2]CloudLayer `json:"clouds"`       // Cloud layers, lowest first
+	Thunderstorm StormLayer    `json:"thunderstorm"` // Thunderstorm layer. A zero coverage means no thunderstorms.
+}
+
+// TempLayer is a temperature layer of a WeatherProfile.
+type TempLayer struct {
+	Ceiling int `json:"ceiling"` // Feet MSL
+	Temp    int `json:"temp"`    // Degrees Celsius
+}
+
+// WindLayer is a wind layer of a WeatherProfile.
+type WindLayer struct {
+	Ceiling    int  `json:"ceiling"`    // Feet MSL
+	Floor      int  `json:"floor"`      // Feet MSL
+	Direction  int  `json:"direction"`  // Degrees true
+	Speed      int  `json:"speed"`      // Knots
+	Gusting    bool `json:"gusting"`    // Whether the wind is gusting
+	Turbulence int  `json:"turbulence"` // Turbulence intensity
+}
+
+// CloudLayer is a cloud layer of a WeatherProfile.
+type CloudLayer struct {
+	Ceiling    int  `json:"ceiling"`    // Feet MSL
+	Floor      int  `json:"floor"`      // Feet MSL
+	Coverage   int  `json:"coverage"`   // Coverage in octas
+	Icing      bool `json:"icing"`      // Whether icing is present
+	Turbulence int  `json:"turbulence"` // Turbulence intensity
+}
+
+// StormLayer is the thunderstorm layer of a WeatherProfile.
+type StormLayer struct {
+	Ceiling    int `json:"ceiling"`    // Feet MSL
+	Floor      int `json:"floor"`      // Feet MSL
+	Deviation  int `json:"deviation"`  // Direction deviation in degrees
+	Coverage   int `json:"coverage"`   // Coverage in octas
+	Turbulence int `json:"turbulence"` // Turbulence intensity
+}
+
+// Standard layer ceilings used when converting a METAR into a WeatherProfile
+var (
+	weatherProfileTempCeilings = [4]int{100, 10000, 18000, 35000}
+	weatherProfileWindCeilings = [4]int{2500, 10400, 22600, 90000}
+)
+
+// defaultWeatherProfileKey is the static weather profile key matching any station
+const defaultWeatherProfileKey = "*"
+
+// parseStaticWeatherProfiles parses the JSON-encoded static weather profile
+// configuration, a map of ICAO code (or "*" for any station) to WeatherProfile.
+func parseStaticWeatherProfiles(raw string) (profiles map[string]*WeatherProfile, err error) {
+	profiles = map[string]*WeatherProfile{}
+	if strings.TrimSpace(raw) == "" {
+		return
+	}
+	err = json.Unmarshal([]byte(raw), &profiles)
+	return
+}
+
+// lookupStaticWeatherProfile returns the static profile configured for a station, falling back
+// to the "*" profile. Returns nil if no static profile applies.
+func lookupStaticWeatherProfile(profiles map[string]*WeatherProfile, icaoCode string) *WeatherProfile {
+	if profile, ok := profiles[icaoCode]; ok {
+		return profile
+	}
+	return profiles[defaultWeatherProfileKey]
+}
+
+// newWeatherProfileFromMetar approximates a classic FSD weather profile from a decoded METAR.
+//
+// Upper temperatures follow the standard lapse rate from the reported surface temperature,
+// and upper winds are extrapolated from the surface wind.
+func newWeatherProfileFromMetar(metar *Metar) (profile *WeatherProfile) {
+	profile = &WeatherProfile{
+		Barometer:  2992,
+		Visibility: 10,
+	}
+
+	if metar.HasAltimeter {
+		profile.Barometer = int(metar.AltimeterInHg*100 + 0.5)
+	}
+	if metar.HasVisibility {
+		profile.Visibility = metar.VisibilityStatuteMiles()
+	}
+
+	surfaceTemp := 15
+	if metar.HasTemperature {
+		surfaceTemp = metar.Temperature
+	}
+	for i, ceiling := range weatherProfileTempCeilings {
+		temp := surfaceTemp - (2 * ceiling / 1000) // 2°C per 1000ft
+		profile.Temps[i] = TempLayer{Ceiling: ceiling, Temp: max(temp, -56)}
+	}
+
+	floor := 0
+	for i, ceiling := range weatherProfileWindCeilings {
+		layer := WindLayer{
+			Ceiling:   ceiling,
+			Floor:     floor,
+			Direction: metar.WindDirection,
+			Speed:     metar.WindSpeed,
+		}
+		if i == 0 {
+			layer.Gusting = metar.WindGust > 0
+		} else if metar.WindSpeed > 0 {
+			// Veer and strengthen with altitude
+			layer.Direction = (metar.WindDirection + 10*i) % 360
+			layer.Speed = metar.WindSpeed + 10*i
+		}
+		profile.Winds[i] = layer
+		floor = ceiling
+	}
+
+	cloudIndex := 0
+	for _, layer := range metar.Clouds {
+		if layer.Type == "CB" {
+			profile.Thunderstorm = StormLayer{Floor: layer.BaseFeet, Ceiling: layer.BaseFeet + 30000, Coverage: 6, Turbulence: 3}
+			continue
+		}
+		if cloudIndex >= len(profile.Clouds) {
+			continue
+		}
+		profile.Clouds[cloudIndex] = CloudLayer{
+			Floor:    layer.BaseFeet,
+			Ceiling:  layer.BaseFeet + 2000,
+			Coverage: cloudCoverageOctas(layer.Coverage),
+			Icing:    surfaceTemp-(2*(layer.BaseFeet+1000)/1000) <= 0,
+		}
+		cloudIndex++
+	}
+	if metar.Thunderstorm && profile.Thunderstorm.Coverage == 0 {
+		profile.Thunderstorm = StormLayer{Floor: 3000, Ceiling: 33000, Coverage: 6, Turbulence: 3}
+	}
+
+	return
+}
+
+func cloudCoverageOctas(coverage string) int {
+	switch coverage {
+	case "FEW":
+		return 2
+	case "SCT":
+		return 4
+	case "BKN":
+		return 6
+	case "OVC", "VV":
+		return 8
+	default:
+		return 0
+	}
+}
+
+// buildWeatherProfilePackets builds the #TD, #WD and #CD packets describing a weather profile.
+func buildWeatherProfilePackets(callsign string, profile *WeatherProfile) (packets [3]string) {
+	td := newWeatherPacketBuilder("#TD", callsign)
+	for _, layer := range profile.Temps {
+		td.writeInt(layer.Ceiling)
+		td.writeInt(layer.Temp)
+	}
+	td.writeInt(profile.Barometer)
+	packets[0] = td.finish()
+
+	wd := newWeatherPacketBuilder("#WD", callsign)
+	for _, layer := range profile.Winds {
+		wd.writeInt(layer.Ceiling)
+		wd.writeInt(layer.Floor)
+		wd.writeInt(layer.Direction)
+		wd.writeInt(layer.Speed)
+		wd.writeBool(layer.Gusting)
+		wd.writeInt(layer.Turbulence)
+	}
+	packets[1] = wd.finish()
+
+	cd := newWeatherPacketBuilder("#CD", callsign)
+	for _, layer := range profile.Clouds {
+		cd.writeInt(layer.Ceiling)
+		cd.writeInt(layer.Floor)
+		cd.writeInt(layer.Coverage)
+		cd.writeBool(layer.Icing)
+		cd.writeInt(layer.Turbulence)
+	}
+	ts := profile.Thunderstorm
+	cd.writeInt(ts.Ceiling)
+	cd.writeInt(ts.Floor)
+	cd.writeInt(ts.Deviation)
+	cd.writeInt(ts.Coverage)
+	cd.writeInt(ts.Turbulence)
+	cd.writeString(strconv.FormatFloat(profile.Visibility, 'f', 2, 64))
+	packets[2] = cd.finish()
+
+	return
+}
+
+type weatherPacketBuilder struct {
+	strings.Builder
+}
+
+func newWeatherPacketBuilder(prefix, callsign string) (b *weatherPacketBuilder) {
+	b = &weatherPacketBuilder{}
+	b.Grow(128)
+	b.WriteString(prefix)
+	b.WriteString("SERVER:")
+	b.WriteString(callsign)
+	return
+}
+
+func (b *weatherPacketBuilder) writeString(str string) {
+	b.WriteByte(':')
+	b.WriteString(str)
+}
+
+func (b *weatherPacketBuilder) writeInt(i int) {
+	b.writeString(strconv.Itoa(i))
+}
+
+func (b *weatherPacketBuilder) writeBool(v bool) {
+	if v {
+		b.writeString("1")
+	} else {
+		b.writeString("0")
+	}
+}
+
+func (b *weatherPacketBuilder) finish() string {
+	b.WriteString("\r\n")
+	return b.String()
+}
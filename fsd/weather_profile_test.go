@@ -0,0 +1,103 @@
+package fsd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestBuildWeatherProfilePackets verifies the #TD, #WD and #CD packet encoding.
+func TestBuildWeatherProfilePackets(t *testing.T) {
+	profile := &WeatherProfile{
+		Barometer:  2992,
+		Visibility: 10,
+		Temps:      [4]TempLayer{{100, 15}, {10000, -5}, {18000, -21}, {35000, -55}},
+		Winds: [4]WindLayer{
+			{Ceiling: 2500, Floor: 0, Direction: 270, Speed: 10, Gusting: true},
+			{Ceiling: 10400, Floor: 2500, Direction: 280, Speed: 20},
+			{Ceiling: 22600, Floor: 10400, Direction: 290, Speed: 30},
+			{Ceiling: 90000, Floor: 22600, Direction: 300, Speed: 40, Turbulence: 1},
+		},
+		Clouds: [2]CloudLayer{{Ceiling: 5000, Floor: 3000, Coverage: 4}},
+	}
+
+	packets := buildWeatherProfilePackets("N123", profile)
+	expected := [3]string{
+		"#TDSERVER:N123:100:15:10000:-5:18000:-21:35000:-55:2992\r\n",
+		"#WDSERVER:N123:2500:0:270:10:1:0:10400:2500:280:20:0:0:22600:10400:290:30:0:0:90000:22600:300:40:0:1\r\n",
+		"#CDSERVER:N123:5000:3000:4:0:0:0:0:0:0:0:0:0:0:0:0:10.00\r\n",
+	}
+	if packets != expected {
+		t.Errorf("buildWeatherProfilePackets() = %q, want %q", packets, expected)
+	}
+}
+
+// TestNewWeatherProfileFromMetar verifies the METAR to weather profile conversion.
+func TestNewWeatherProfileFromMetar(t *testing.T) {
+	metar, err := ParseMetar("KJFK 301951Z 18010G18KT 10SM FEW025 29/19 A3012")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := newWeatherProfileFromMetar(metar)
+	if profile.Barometer != 3012 {
+		t.Errorf("expected barometer 3012, got %d", profile.Barometer)
+	}
+	if profile.Temps[0] != (TempLayer{Ceiling: 100, Temp: 29}) {
+		t.Errorf("unexpected surface temperature layer %+v", profile.Temps[0])
+	}
+	if w := profile.Winds[0]; w.Direction != 180 || w.Speed != 10 || !w.Gusting {
+		t.Errorf("unexpected surface wind layer %+v", w)
+	}
+	if c := profile.Clouds[0]; c.Floor != 2500 || c.Coverage != 2 {
+		t.Errorf("unexpected cloud layer %+v", c)
+	}
+	if profile.Thunderstorm.Coverage != 0 {
+		t.Errorf("expected no thunderstorm layer")
+	}
+}
+
+// TestFetchAndSendWeatherProfile verifies that static profiles take precedence
+// over METAR-derived profiles, and that missing data yields NoWeatherProfileError.
+func TestFetchAndSendWeatherProfile(t *testing.T) {
+	provider := NewStaticMetarProvider(map[string]string{
+		"KJFK": "KJFK 301951Z 18010KT 10SM FEW250 29/19 A2992",
+	})
+	service := newMetarService(1, provider, time.Second, time.Minute, time.Minute)
+
+	staticProfiles, err := parseStaticWeatherProfiles(`{"KSWB": {"barometer": 2900, "visibility": 3}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Static profile
+	mockClient := newMockClient("TEST")
+	service.fetchAndSendWeatherProfile(mockClient.Client, "KSWB", staticProfiles)
+	packets := mockClient.collectPackets()
+	if len(packets) != 3 || packets[0] != "#TDSERVER:TEST:0:0:0:0:0:0:0:0:2900\r\n" {
+		t.Errorf("unexpected packets %q", packets)
+	}
+
+	// METAR-derived profile
+	service.fetchAndSendWeatherProfile(mockClient.Client, "KJFK", staticProfiles)
+	service.handleMetarRequest(context.Background(), <-service.metarRequests)
+	packets = mockClient.collectPackets()
+	if len(packets) != 3 || packets[0] != "#TDSERVER:TEST:100:29:10000:9:18000:-7:35000:-41:2992\r\n" {
+		t.Errorf("unexpected packets %q", packets)
+	}
+
+	// No data
+	service.fetchAndSendWeatherProfile(mockClient.Client, "EGLL", staticProfiles)
+	service.handleMetarRequest(context.Background(), <-service.metarRequests)
+	packets = mockClient.collectPackets()
+	if len(packets) != 1 || packets[0] != "$ERserver:unknown:9::No weather profile for EGLL\r\n" {
+		t.Errorf("unexpected packets %q", packets)
+	}
+
+	// Wildcard static profile
+	staticProfiles[defaultWeatherProfileKey] = &WeatherProfile{Barometer: 3000}
+	service.fetchAndSendWeatherProfile(mockClient.Client, "EGLL", staticProfiles)
+	if packets = mockClient.collectPackets(); len(packets) != 3 {
+		t.Errorf("expected 3 packets, got %q", packets)
+	}
+}
@@ -9,8 +9,6 @@ import (
 )
 
 func main() {
-	setSlogLevel()
-
 	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt)
 	server, err := fsd.NewDefaultServer(ctx)
 	if err != nil {
@@ -22,9 +20,3 @@ func main() {
 	}
 	slog.Info("FSD server closed")
 }
-
-func setSlogLevel() {
-	if os.Getenv("LOG_DEBUG") == "true" {
-		slog.SetLogLoggerLevel(slog.LevelDebug)
-	}
-}
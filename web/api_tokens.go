@@ -5,6 +5,7 @@ import (
 	"github.com/renorris/openfsd/db"
 	"github.com/renorris/openfsd/fsd"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -56,6 +57,12 @@ func (s *Server) handleCreateNewAPIToken(c *gin.Context) {
 		return
 	}
 
+	// Record only the token's expiry; the token itself is a secret
+	type auditToken struct {
+		ExpiryDateTime time.Time `json:"expiry_date_time"`
+	}
+	s.audit(c, db.AuditActionAPITokenCreate, strconv.Itoa(claims.CID), nil, auditToken{ExpiryDateTime: reqBody.ExpiryDateTime})
+
 	type ResponseBody struct {
 		Token string `json:"token"`
 	}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/renorris/openfsd/db"
+	"github.com/renorris/openfsd/fsd"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// audit records an administrative action performed by the requesting user.
+// before and after are stored as JSON and must already have any secrets redacted.
+//
+// Failures are logged rather than returned, so that auditing never fails the action itself.
+func (s *Server) audit(c *gin.Context, action string, target string, before any, after any) {
+	entry := db.AuditLogEntry{
+		Time:     time.Now(),
+		ActorCID: getJwtContext(c).CID,
+		Action:   action,
+		Target:   target,
+		Before:   marshalAuditValue(before),
+		After:    marshalAuditValue(after),
+		SourceIP: c.ClientIP(),
+	}
+
+	if err := s.dbRepo.AuditLogRepo.CreateAuditLogEntry(&entry); err != nil {
+		slog.Error("failed to write audit log entry", "action", action, "target", target, "error", err)
+	}
+}
+
+// marshalAuditValue encodes an audited value as JSON. A nil value is stored as an empty string.
+func marshalAuditValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(buf)
+}
+
+// auditUser is the audited representation of a db.User
+type auditUser struct {
+	CID           int     `json:"cid"`
+	Password      string  `json:"password,omitempty"`
+	FirstName     *string `json:"first_name"`
+	LastName      *string `json:"last_name"`
+	NetworkRating int     `json:"network_rating"`
+}
+
+// newAuditUser returns the audited representation of a user.
+// passwordChanged controls whether a redacted password field is included.
+func newAuditUser(user *db.User, passwordChanged bool) (u auditUser) {
+	u = auditUser{
+		CID:           user.CID,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		NetworkRating: user.NetworkRating,
+	}
+	if passwordChanged {
+		u.Password = db.RedactedValue
+	}
+	return
+}
+
+// handleGetAuditLog returns a page of audit log entries, most recent first.
+//
+// Only >= ADM can browse the audit log.
+func (s *Server) handleGetAuditLog(c *gin.Context) {
+	claims := getJwtContext(c)
+	if claims.NetworkRating < fsd.NetworkRatingAdministator {
+		writeAPIV1Response(c, http.StatusForbidden, &genericAPIV1Forbidden)
+		return
+	}
+
+	type QueryParams struct {
+		Limit  int `form:"limit" binding:"min=0,max=100"`
+		Offset int `form:"offset" binding:"min=0"`
+	}
+
+	var params QueryParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		res := newAPIV1Failure("Invalid query parameters")
+		writeAPIV1Response(c, http.StatusBadRequest, &res)
+		return
+	}
+
+	if params.Limit == 0 {
+		params.Limit = 25
+	}
+
+	entries, err := s.dbRepo.AuditLogRepo.ListAuditLogEntries(params.Limit, params.Offset)
+	if err != nil {
+		writeAPIV1Response(c, http.StatusInternalServerError, &genericAPIV1InternalServerError)
+		return
+	}
+
+	total, err := s.dbRepo.AuditLogRepo.CountAuditLogEntries()
+	if err != nil {
+		writeAPIV1Response(c, http.StatusInternalServerError, &genericAPIV1InternalServerError)
+		return
+	}
+
+	type Entry struct {
+		ID       int64     `json:"id"`
+		Time     time.Time `json:"time"`
+		ActorCID int       `json:"actor_cid"`
+		Action   string    `json:"action"`
+		Target   string    `json:"target"`
+		Before   string    `json:"before"`
+		After    string    `json:"after"`
+		SourceIP string    `json:"source_ip"`
+	}
+
+	type ResponseBody struct {
+		Entries []Entry `json:"entries"`
+		Total   int     `json:"total"`
+		Limit   int     `json:"limit"`
+		Offset  int     `json:"offset"`
+	}
+
+	resBody := ResponseBody{
+		Entries: make([]Entry, 0, len(entries)),
+		Total:   total,
+		Limit:   params.Limit,
+		Offset:  params.Offset,
+	}
+	for _, entry := range entries {
+		resBody.Entries = append(resBody.Entries, Entry{
+			ID:       entry.ID,
+			Time:     entry.Time,
+			ActorCID: entry.ActorCID,
+			Action:   entry.Action,
+			Target:   entry.Target,
+			Before:   entry.Before,
+			After:    entry.After,
+			SourceIP: entry.SourceIP,
+		})
+	}
+
+	res := newAPIV1Success(&resBody)
+	writeAPIV1Response(c, http.StatusOK, &res)
+}
@@ -26,6 +26,8 @@ func (s *Server) handleGetConfig(c *gin.Context) {
 		db.ConfigFsdServerIdent,
 		db.ConfigFsdServerLocation,
 		db.ConfigApiServerBaseURL,
+		db.ConfigWeatherProfiles,
+		db.ConfigTransponderCodeRanges,
 	}
 
 	type ResponseBody struct {
@@ -77,11 +79,19 @@ func (s *Server) handleUpdateConfig(c *gin.Context) {
 
 	for i := range reqBody.KeyValuePairs {
 		kv := reqBody.KeyValuePairs[i]
+
+		var before any
+		if prev, err := s.dbRepo.ConfigRepo.Get(kv.Key); err == nil {
+			before = db.RedactConfigValue(kv.Key, prev)
+		}
+
 		if err := s.dbRepo.ConfigRepo.Set(kv.Key, kv.Value); err != nil {
 			res := newAPIV1Failure("Error writing key/value into persistent storage")
 			writeAPIV1Response(c, http.StatusInternalServerError, &res)
 			return
 		}
+
+		s.audit(c, db.AuditActionConfigUpdate, kv.Key, before, db.RedactConfigValue(kv.Key, kv.Value))
 	}
 
 	res := newAPIV1Success(nil)
@@ -106,6 +116,8 @@ func (s *Server) handleResetSecretKey(c *gin.Context) {
 		return
 	}
 
+	s.audit(c, db.AuditActionSecretKeyReset, db.ConfigJwtSecretKey, db.RedactedValue, db.RedactedValue)
+
 	res := newAPIV1Success(nil)
 	writeAPIV1Response(c, http.StatusOK, &res)
 }
@@ -14,7 +14,9 @@ import (
 	"go.uber.org/atomic"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"text/template"
@@ -94,6 +96,9 @@ func (s *Server) handleGetStatusJSON(c *gin.Context) {
 			"v3": {
 				baseURL + "/api/v1/data/openfsd-data.json",
 			},
+			"v3_sweatbox": {
+				baseURL + "/api/v1/data/sweatbox-data.json",
+			},
 			"servers": {
 				baseURL + "/api/v1/data/openfsd-servers.json",
 			},
@@ -128,37 +133,27 @@ type DataJsonServer struct {
 	IsSweatbox               bool   `json:"is_sweatbox"`
 }
 
+// serverList selects the namespaces included in a server list
+type serverList int
+
+const (
+	serverListLive     serverList = iota // Namespaces which are not sweatboxes
+	serverListSweatbox                   // Sweatbox namespaces
+	serverListAll                        // Every namespace
+)
+
 func (s *Server) handleGetServersJSON(c *gin.Context) {
-	serverIdent, serverHostname, serverLocation, err := s.getFsdServerInfo()
+	list := serverListLive
+	if value, exists := c.Get("server_list"); exists {
+		list = value.(serverList)
+	}
+
+	dataJson, err := s.generateServerList(list)
 	if err != nil {
 		writePlaintext500Error(c, "Unable to load FSD server info from configuration")
 		return
 	}
 
-	_, isSweatbox := c.Get("is_sweatbox")
-
-	type ServersJson []DataJsonServer
-	dataJson := ServersJson{
-		{
-			Ident:                    serverIdent,
-			HostnameOrIp:             serverHostname,
-			Location:                 serverLocation,
-			Name:                     serverIdent,
-			ClientConnectionsAllowed: true,
-			ClientsConnectionAllowed: 99,
-			IsSweatbox:               isSweatbox,
-		},
-		{
-			Ident:                    "AUTOMATIC",
-			HostnameOrIp:             serverHostname,
-			Location:                 serverLocation,
-			Name:                     serverIdent,
-			ClientConnectionsAllowed: true,
-			ClientsConnectionAllowed: 99,
-			IsSweatbox:               isSweatbox,
-		},
-	}
-
 	res, err := json.Marshal(&dataJson)
 	if err != nil {
 		slog.Error(err.Error())
@@ -171,6 +166,97 @@ func (s *Server) handleGetServersJSON(c *gin.Context) {
 	c.Writer.Write(res)
 }
 
+// generateServerList lists the FSD namespaces selected by list.
+// The default namespace is listed under the configured server ident and AUTOMATIC, and every other
+// namespace under its uppercase name. Without any sweatbox namespace, the sweatbox list falls back to
+// the default namespace flagged as a sweatbox.
+func (s *Server) generateServerList(list serverList) (servers []DataJsonServer, err error) {
+	serverIdent, serverHostname, serverLocation, err := s.getFsdServerInfo()
+	if err != nil {
+		return
+	}
+
+	// List only the default namespace if the FSD server can't be asked for its namespaces
+	namespaces, err := s.fetchNamespaces()
+	if err != nil {
+		slog.Warn("unable to fetch FSD namespaces", "error", err)
+		namespaces = []fsd.NamespaceResponseData{{Name: fsd.DefaultNamespace}}
+		err = nil
+	}
+
+	servers = []DataJsonServer{}
+	for _, ns := range namespaces {
+		if (list == serverListLive && ns.Sweatbox) || (list == serverListSweatbox && !ns.Sweatbox) {
+			continue
+		}
+
+		server := DataJsonServer{
+			Ident:                    strings.ToUpper(ns.Name),
+			HostnameOrIp:             namespaceHostname(serverHostname, ns.ListenAddrs),
+			Location:                 serverLocation,
+			Name:                     serverIdent + " " + ns.Name,
+			ClientConnectionsAllowed: true,
+			ClientsConnectionAllowed: 99,
+			IsSweatbox:               ns.Sweatbox,
+		}
+		if ns.Name != fsd.DefaultNamespace {
+			servers = append(servers, server)
+			continue
+		}
+
+		server.Ident = serverIdent
+		server.Name = serverIdent
+		automatic := server
+		automatic.Ident = "AUTOMATIC"
+		servers = append(servers, server, automatic)
+	}
+
+	if list == serverListSweatbox && len(servers) == 0 {
+		if servers, err = s.generateServerList(serverListLive); err != nil {
+			return
+		}
+		for i := range servers {
+			servers[i].IsSweatbox = true
+		}
+	}
+	return
+}
+
+// namespaceHostname returns the hostname clients connect to a namespace on.
+// The port of the first listen address is appended unless it is the default FSD port.
+func namespaceHostname(hostname string, listenAddrs []string) string {
+	if len(listenAddrs) == 0 {
+		return hostname
+	}
+	_, port, err := net.SplitHostPort(listenAddrs[0])
+	if err != nil || port == "" || port == "6809" {
+		return hostname
+	}
+	return hostname + ":" + port
+}
+
+// fetchNamespaces fetches the namespaces served by the FSD server
+func (s *Server) fetchNamespaces() (namespaces []fsd.NamespaceResponseData, err error) {
+	client := http.Client{}
+	req, err := s.makeFsdHttpServiceHttpRequest("GET", "/namespaces", nil)
+	if err != nil {
+		return
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		err = errors.New("FSD HTTP service returned a non-200 status code")
+		return
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&namespaces)
+	return
+}
+
 func (s *Server) handleGetServersTxt(c *gin.Context) {
 	serversTxt, err := s.generateServersTxt()
 	if err != nil {
@@ -185,34 +271,11 @@ func (s *Server) handleGetServersTxt(c *gin.Context) {
 }
 
 func (s *Server) generateServersTxt() (txt string, err error) {
-	serverIdent, serverHostname, serverLocation, err := s.getFsdServerInfo()
+	tmplData, err := s.generateServerList(serverListLive)
 	if err != nil {
-		slog.Error(err.Error())
 		return
 	}
 
-	type TemplateData []DataJsonServer
-	tmplData := TemplateData{
-		{
-			Ident:                    serverIdent,
-			HostnameOrIp:             serverHostname,
-			Location:                 serverLocation,
-			Name:                     serverIdent,
-			ClientConnectionsAllowed: true,
-			ClientsConnectionAllowed: 99,
-			IsSweatbox:               false,
-		},
-		{
-			Ident:                    "AUTOMATIC",
-			HostnameOrIp:             serverHostname,
-			Location:                 serverLocation,
-			Name:                     serverIdent,
-			ClientConnectionsAllowed: true,
-			ClientsConnectionAllowed: 99,
-			IsSweatbox:               false,
-		},
-	}
-
 	buf := bytes.Buffer{}
 	buf.Grow(1024)
 	if err = serversTxtTemplate.Execute(&buf, &tmplData); err != nil {
@@ -288,8 +351,6 @@ type DatafeedPilot struct {
 	Server         string              `json:"server"`
 	PilotRating    int                 `json:"pilot_rating"`          // INOP placeholder
 	MilitaryRating int                 `json:"military_rating"`       // INOP placeholder
-	QnhIHg         float64             `json:"qnh_i_hg"`              // INOP placeholder
-	QnhMb          int                 `json:"qnh_mb"`                // INOP placeholder
 	FlightPlan     *DatafeedFlightplan `json:"flight_plan,omitempty"` // INOP placeholder
 }
 
@@ -323,9 +384,16 @@ type DatafeedCache struct {
 }
 
 var datafeedCache atomic.Pointer[DatafeedCache]
+var sweatboxDatafeedCache atomic.Pointer[DatafeedCache]
+
+// serveDatafeed returns a handler serving the datafeed held by cache
+func (s *Server) serveDatafeed(cache *atomic.Pointer[DatafeedCache]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.getDatafeed(c, cache.Load())
+	}
+}
 
-func (s *Server) getDatafeed(c *gin.Context) {
-	feed := datafeedCache.Load()
+func (s *Server) getDatafeed(c *gin.Context, feed *DatafeedCache) {
 	if feed == nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
@@ -342,9 +410,22 @@ func (s *Server) getDatafeed(c *gin.Context) {
 	c.Writer.WriteString(feed.jsonStr)
 }
 
-func (s *Server) generateDatafeed() (feed *DatafeedCache, err error) {
+// countUniqueUsers counts the distinct CIDs of all online users.
+func countUniqueUsers(onlineUsers *fsd.OnlineUsersResponseData) int {
+	cids := make(map[int]bool, len(onlineUsers.Pilots)+len(onlineUsers.ATC))
+	for _, pilot := range onlineUsers.Pilots {
+		cids[pilot.CID] = true
+	}
+	for _, atc := range onlineUsers.ATC {
+		cids[atc.CID] = true
+	}
+	return len(cids)
+}
+
+// fetchOnlineUsers fetches the online users of an FSD namespace
+func (s *Server) fetchOnlineUsers(namespace string) (onlineUsers fsd.OnlineUsersResponseData, err error) {
 	client := http.Client{}
-	req, err := s.makeFsdHttpServiceHttpRequest("GET", "/online_users", nil)
+	req, err := s.makeFsdHttpServiceHttpRequest("GET", "/online_users?namespace="+url.QueryEscape(namespace), nil)
 	if err != nil {
 		return
 	}
@@ -352,49 +433,67 @@ func (s *Server) generateDatafeed() (feed *DatafeedCache, err error) {
 	if err != nil {
 		return
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
 		err = errors.New("FSD HTTP service returned a non-200 status code")
 		return
 	}
 
-	decoder := json.NewDecoder(res.Body)
-	onlineUsers := fsd.OnlineUsersResponseData{}
-	if err = decoder.Decode(&onlineUsers); err != nil {
-		return
+	err = json.NewDecoder(res.Body).Decode(&onlineUsers)
+	return
+}
+
+// datafeedServerName returns the server name of the clients of a namespace in the datafeed
+func datafeedServerName(namespace string) string {
+	if namespace == fsd.DefaultNamespace {
+		return "OPENFSD"
 	}
+	return strings.ToUpper(namespace)
+}
 
+// generateDatafeed generates a datafeed of the online users of the given FSD namespaces
+func (s *Server) generateDatafeed(namespaces ...string) (feed *DatafeedCache, err error) {
 	now := time.Now()
 
 	dataFeed := Datafeed{
 		General: DatafeedGeneral{
-			Version:          3, // Match VATSIM API version
-			UpdateTimestamp:  now,
-			ConnectedClients: len(onlineUsers.Pilots) + len(onlineUsers.ATC),
-			UniqueUsers:      len(onlineUsers.Pilots) + len(onlineUsers.ATC),
+			Version:         3, // Match VATSIM API version
+			UpdateTimestamp: now,
 		},
 		Pilots: []DatafeedPilot{},
 		ATC:    []DatafeedATC{},
 	}
 
-	for _, pilot := range onlineUsers.Pilots {
-		dataFeed.Pilots = append(dataFeed.Pilots, DatafeedPilot{
-			OnlineUserPilot: pilot,
-			Server:          "OPENFSD",
-			PilotRating:     1,
-			MilitaryRating:  1,
-			QnhIHg:          29.92,
-			QnhMb:           1013,
-		})
-	}
+	allUsers := fsd.OnlineUsersResponseData{}
+	for _, namespace := range namespaces {
+		var onlineUsers fsd.OnlineUsersResponseData
+		if onlineUsers, err = s.fetchOnlineUsers(namespace); err != nil {
+			return
+		}
+		allUsers.Pilots = append(allUsers.Pilots, onlineUsers.Pilots...)
+		allUsers.ATC = append(allUsers.ATC, onlineUsers.ATC...)
+
+		for _, pilot := range onlineUsers.Pilots {
+			// The assigned transponder code is carried by the embedded online user
+			dataFeed.Pilots = append(dataFeed.Pilots, DatafeedPilot{
+				OnlineUserPilot: pilot,
+				Server:          datafeedServerName(namespace),
+				PilotRating:     1,
+				MilitaryRating:  1,
+			})
+		}
 
-	for _, atc := range onlineUsers.ATC {
-		dataFeed.ATC = append(dataFeed.ATC, DatafeedATC{
-			OnlineUserATC: atc,
-			Server:        "OPENFSD",
-			TextATIS:      []string{},
-		})
+		for _, atc := range onlineUsers.ATC {
+			dataFeed.ATC = append(dataFeed.ATC, DatafeedATC{
+				OnlineUserATC: atc,
+				Server:        datafeedServerName(namespace),
+				TextATIS:      []string{},
+			})
+		}
 	}
+	dataFeed.General.ConnectedClients = len(allUsers.Pilots) + len(allUsers.ATC)
+	dataFeed.General.UniqueUsers = countUniqueUsers(&allUsers)
 
 	buf := bytes.Buffer{}
 	encoder := json.NewEncoder(&buf)
@@ -412,6 +511,42 @@ func (s *Server) generateDatafeed() (feed *DatafeedCache, err error) {
 	return
 }
 
+func (s *Server) handleGetMetar(c *gin.Context) {
+	client := http.Client{}
+	defer client.CloseIdleConnections()
+	req, err := s.makeFsdHttpServiceHttpRequest("GET", "/metar/"+url.PathEscape(c.Param("icao")), nil)
+	if err != nil {
+		writeAPIV1Response(c, http.StatusInternalServerError, &genericAPIV1InternalServerError)
+		return
+	}
+	res, err := client.Do(req.WithContext(c.Request.Context()))
+	if err != nil {
+		writeAPIV1Response(c, http.StatusInternalServerError, &genericAPIV1InternalServerError)
+		return
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		metar := fsd.MetarResponseData{}
+		if err = json.NewDecoder(res.Body).Decode(&metar); err != nil {
+			writeAPIV1Response(c, http.StatusInternalServerError, &genericAPIV1InternalServerError)
+			return
+		}
+		apiV1Res := newAPIV1Success(&metar)
+		writeAPIV1Response(c, http.StatusOK, &apiV1Res)
+	case http.StatusNotFound:
+		apiV1Res := newAPIV1Failure("METAR not found")
+		writeAPIV1Response(c, http.StatusNotFound, &apiV1Res)
+	case http.StatusServiceUnavailable:
+		apiV1Res := newAPIV1Failure("METAR service busy")
+		writeAPIV1Response(c, http.StatusServiceUnavailable, &apiV1Res)
+	default:
+		apiV1Res := newAPIV1Failure("unable to fetch METAR")
+		writeAPIV1Response(c, http.StatusBadGateway, &apiV1Res)
+	}
+}
+
 // makeFsdHttpServiceHttpRequest prepares an HTTP request destined for the internal FSD HTTP API.
 //
 // method sets the HTTP method, path is the relative HTTP path (e.g. /online_users), and body is an optional request body.
@@ -461,10 +596,28 @@ func (s *Server) runDatafeedWorker(ctx context.Context) {
 }
 
 func (s *Server) updateDataFeedCache() {
-	feed, err := s.generateDatafeed()
+	feed, err := s.generateDatafeed(fsd.DefaultNamespace)
 	if err != nil {
 		slog.Error(err.Error())
 		return
 	}
 	datafeedCache.Store(feed)
+
+	// Every sweatbox namespace shares the sweatbox datafeed
+	namespaces, err := s.fetchNamespaces()
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	var sweatboxes []string
+	for _, ns := range namespaces {
+		if ns.Sweatbox {
+			sweatboxes = append(sweatboxes, ns.Name)
+		}
+	}
+	if feed, err = s.generateDatafeed(sweatboxes...); err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	sweatboxDatafeedCache.Store(feed)
 }
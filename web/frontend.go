@@ -23,3 +23,7 @@ func (s *Server) handleFrontendUserEditor(c *gin.Context) {
 func (s *Server) handleFrontendConfigEditor(c *gin.Context) {
 	writeTemplate(c, "configeditor", nil)
 }
+
+func (s *Server) handleFrontendAuditLog(c *gin.Context) {
+	writeTemplate(c, "auditlog", nil)
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/gin-gonic/gin"
+	"github.com/renorris/openfsd/db"
 	"github.com/renorris/openfsd/fsd"
 	"net/http"
+	"net/url"
 )
 
 func (s *Server) handleKickActiveConnection(c *gin.Context) {
@@ -43,6 +45,7 @@ func (s *Server) handleKickActiveConnection(c *gin.Context) {
 
 	switch res.StatusCode {
 	case http.StatusNoContent:
+		s.audit(c, db.AuditActionConnectionKick, reqBody.Callsign, nil, nil)
 		apiV1Res := newAPIV1Success(nil)
 		writeAPIV1Response(c, http.StatusOK, &apiV1Res)
 		return
@@ -55,3 +58,43 @@ func (s *Server) handleKickActiveConnection(c *gin.Context) {
 		return
 	}
 }
+
+// handleGetTrack downloads the recorded track of a connected pilot as GeoJSON, KML or GPX.
+func (s *Server) handleGetTrack(c *gin.Context) {
+	claims := getJwtContext(c)
+	if claims.NetworkRating < fsd.NetworkRatingSupervisor {
+		writeAPIV1Response(c, http.StatusForbidden, &genericAPIV1Forbidden)
+		return
+	}
+
+	callsign := c.Param("callsign")
+	format := c.DefaultQuery("format", fsd.TrackFormatGeoJSON)
+
+	client := http.Client{}
+	defer client.CloseIdleConnections()
+	req, err := s.makeFsdHttpServiceHttpRequest("GET", "/track/"+url.PathEscape(callsign)+"?format="+url.QueryEscape(format), nil)
+	if err != nil {
+		writeAPIV1Response(c, http.StatusInternalServerError, &genericAPIV1InternalServerError)
+		return
+	}
+	res, err := client.Do(req.WithContext(c.Request.Context()))
+	if err != nil {
+		writeAPIV1Response(c, http.StatusInternalServerError, &genericAPIV1InternalServerError)
+		return
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		c.Header("Content-Disposition", `attachment; filename="`+callsign+"."+format+`"`)
+		c.DataFromReader(http.StatusOK, res.ContentLength, res.Header.Get("Content-Type"), res.Body, nil)
+	case http.StatusNotFound:
+		apiV1Res := newAPIV1Failure("Callsign not found")
+		writeAPIV1Response(c, http.StatusNotFound, &apiV1Res)
+	case http.StatusBadRequest:
+		apiV1Res := newAPIV1Failure("unknown track format")
+		writeAPIV1Response(c, http.StatusBadRequest, &apiV1Res)
+	default:
+		writeAPIV1Response(c, http.StatusInternalServerError, &genericAPIV1InternalServerError)
+	}
+}
@@ -31,6 +31,7 @@ func (s *Server) setupRoutes() (e *gin.Engine) {
 	s.setupConfigRoutes(apiV1Group)
 	s.setupDataRoutes(apiV1Group)
 	s.setupFsdConnRoutes(apiV1Group)
+	s.setupAuditLogRoutes(apiV1Group)
 
 	// Frontend groups
 	s.setupFrontendRoutes(e.Group(""))
@@ -57,6 +58,8 @@ func (s *Server) setupUserRoutes(parent *gin.RouterGroup) {
 	usersGroup.POST("/load", s.getUserByCID)
 	usersGroup.PATCH("/update", s.updateUser)
 	usersGroup.POST("/create", s.createUser)
+	usersGroup.POST("/sessions", s.getUserSessions)
+	usersGroup.POST("/hours", s.getUserHours)
 }
 
 func (s *Server) setupConfigRoutes(parent *gin.RouterGroup) {
@@ -72,6 +75,13 @@ func (s *Server) setupFsdConnRoutes(parent *gin.RouterGroup) {
 	fsdConnGroup := parent.Group("/fsdconn")
 	fsdConnGroup.Use(s.jwtBearerMiddleware)
 	fsdConnGroup.POST("/kickuser", s.handleKickActiveConnection)
+	fsdConnGroup.GET("/track/:callsign", s.handleGetTrack)
+}
+
+func (s *Server) setupAuditLogRoutes(parent *gin.RouterGroup) {
+	auditLogGroup := parent.Group("/auditlog")
+	auditLogGroup.Use(s.jwtBearerMiddleware)
+	auditLogGroup.GET("", s.handleGetAuditLog)
 }
 
 func (s *Server) setupDataRoutes(parent *gin.RouterGroup) {
@@ -81,11 +91,17 @@ func (s *Server) setupDataRoutes(parent *gin.RouterGroup) {
 	dataGroup.GET("/openfsd-servers.txt", s.handleGetServersTxt)
 	dataGroup.GET("/openfsd-servers.json", s.handleGetServersJSON)
 	dataGroup.GET("/sweatbox-servers.json", func(c *gin.Context) {
-		c.Set("is_sweatbox", "true")
+		c.Set("server_list", serverListSweatbox)
+		s.handleGetServersJSON(c)
+	})
+	dataGroup.GET("/all-servers.json", func(c *gin.Context) {
+		c.Set("server_list", serverListAll)
 		s.handleGetServersJSON(c)
 	})
-	dataGroup.GET("/all-servers.json", s.handleGetServersJSON)
-	dataGroup.GET("/openfsd-data.json", s.getDatafeed)
+	dataGroup.GET("/openfsd-data.json", s.serveDatafeed(&datafeedCache))
+	dataGroup.GET("/sweatbox-data.json", s.serveDatafeed(&sweatboxDatafeedCache))
+	dataGroup.GET("/metar/:icao", s.handleGetMetar)
+	dataGroup.GET("/stats", s.handleGetStats)
 }
 
 func (s *Server) setupFrontendRoutes(parent *gin.RouterGroup) {
@@ -95,4 +111,5 @@ func (s *Server) setupFrontendRoutes(parent *gin.RouterGroup) {
 	frontendGroup.GET("/dashboard", s.handleFrontendDashboard)
 	frontendGroup.GET("/usereditor", s.handleFrontendUserEditor)
 	frontendGroup.GET("/configeditor", s.handleFrontendConfigEditor)
+	frontendGroup.GET("/auditlog", s.handleFrontendAuditLog)
 }
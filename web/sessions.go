@@ -0,0 +1,126 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/renorris/openfsd/fsd"
+	"net/http"
+	"time"
+)
+
+// getUserSessions returns the connection history of the specified CID, most recent first.
+//
+// Only >= SUP can request CIDs other than what is indicated in their bearer token.
+func (s *Server) getUserSessions(c *gin.Context) {
+	type RequestBody struct {
+		CID    int `json:"cid" binding:"min=1,required"`
+		Limit  int `json:"limit" binding:"min=0,max=100"`
+		Offset int `json:"offset" binding:"min=0"`
+	}
+
+	var reqBody RequestBody
+	if !bindJSONOrAbort(c, &reqBody) {
+		return
+	}
+
+	claims := getJwtContext(c)
+	if reqBody.CID != claims.CID && claims.NetworkRating < fsd.NetworkRatingSupervisor {
+		writeAPIV1Response(c, http.StatusForbidden, &genericAPIV1Forbidden)
+		return
+	}
+
+	if reqBody.Limit == 0 {
+		reqBody.Limit = 25
+	}
+
+	sessions, err := s.dbRepo.SessionRepo.ListSessionsByCID(reqBody.CID, reqBody.Limit, reqBody.Offset)
+	if err != nil {
+		writeAPIV1Response(c, http.StatusInternalServerError, &genericAPIV1InternalServerError)
+		return
+	}
+
+	type Session struct {
+		Callsign       string     `json:"callsign"`
+		IsAtc          bool       `json:"is_atc"`
+		Facility       int        `json:"facility"`
+		NetworkRating  int        `json:"network_rating"`
+		ClientSoftware string     `json:"client_software"`
+		RemoteIP       string     `json:"remote_ip"`
+		LoginTime      time.Time  `json:"login_time"`
+		LogoutTime     *time.Time `json:"logout_time"`
+	}
+
+	type ResponseBody struct {
+		Sessions []Session `json:"sessions"`
+	}
+
+	resBody := ResponseBody{Sessions: make([]Session, 0, len(sessions))}
+	for _, session := range sessions {
+		resBody.Sessions = append(resBody.Sessions, Session{
+			Callsign:       session.Callsign,
+			IsAtc:          session.IsAtc,
+			Facility:       session.Facility,
+			NetworkRating:  session.NetworkRating,
+			ClientSoftware: session.ClientSoftware,
+			RemoteIP:       session.RemoteIP,
+			LoginTime:      session.LoginTime,
+			LogoutTime:     session.LogoutTime,
+		})
+	}
+
+	res := newAPIV1Success(&resBody)
+	writeAPIV1Response(c, http.StatusOK, &res)
+}
+
+// getUserHours returns the total time the specified CID has logged on each callsign.
+//
+// Only >= SUP can request CIDs other than what is indicated in their bearer token.
+func (s *Server) getUserHours(c *gin.Context) {
+	type RequestBody struct {
+		CID int `json:"cid" binding:"min=1,required"`
+	}
+
+	var reqBody RequestBody
+	if !bindJSONOrAbort(c, &reqBody) {
+		return
+	}
+
+	claims := getJwtContext(c)
+	if reqBody.CID != claims.CID && claims.NetworkRating < fsd.NetworkRatingSupervisor {
+		writeAPIV1Response(c, http.StatusForbidden, &genericAPIV1Forbidden)
+		return
+	}
+
+	hours, err := s.dbRepo.SessionRepo.GetPositionHoursByCID(reqBody.CID)
+	if err != nil {
+		writeAPIV1Response(c, http.StatusInternalServerError, &genericAPIV1InternalServerError)
+		return
+	}
+
+	type Position struct {
+		Callsign string  `json:"callsign"`
+		IsAtc    bool    `json:"is_atc"`
+		Sessions int     `json:"sessions"`
+		Hours    float64 `json:"hours"`
+	}
+
+	type ResponseBody struct {
+		Positions  []Position `json:"positions"`
+		TotalHours float64    `json:"total_hours"`
+	}
+
+	resBody := ResponseBody{Positions: make([]Position, 0, len(hours))}
+	var total time.Duration
+	for _, position := range hours {
+		resBody.Positions = append(resBody.Positions, Position{
+			Callsign: position.Callsign,
+			IsAtc:    position.IsAtc,
+			Sessions: position.Sessions,
+			Hours:    position.Duration.Hours(),
+		})
+		total += position.Duration
+	}
+	resBody.TotalHours = total.Hours()
+
+	res := newAPIV1Success(&resBody)
+	writeAPIV1Response(c, http.StatusOK, &res)
+}
@@ -0,0 +1,45 @@
+const auditLogPageSize = 25;
+let auditLogOffset = 0;
+
+$(async () => {
+    $("#audit-log-prev").on("click", async () => {
+        auditLogOffset = Math.max(0, auditLogOffset - auditLogPageSize);
+        await loadAuditLog();
+    });
+    $("#audit-log-next").on("click", async () => {
+        auditLogOffset += auditLogPageSize;
+        await loadAuditLog();
+    });
+
+    await loadAuditLog();
+})
+
+async function loadAuditLog() {
+    let res;
+    try {
+        res = await doAPIRequestWithAuth("GET", `/api/v1/auditlog?limit=${auditLogPageSize}&offset=${auditLogOffset}`);
+    } catch (error) {
+        alert("Failed to load audit log");
+        return;
+    }
+
+    const tbody = $("#audit-log-entries");
+    tbody.empty();
+    res.data.entries.forEach((entry) => {
+        const row = $("<tr>");
+        row.append($("<td>").text(new Date(entry.time).toISOString().replace("T", " ").substring(0, 19)));
+        row.append($("<td>").text(entry.actor_cid));
+        row.append($("<td>").text(entry.action));
+        row.append($("<td>").text(entry.target));
+        row.append($("<td class=\"audit-value font-monospace\">").text(entry.before));
+        row.append($("<td class=\"audit-value font-monospace\">").text(entry.after));
+        row.append($("<td>").text(entry.source_ip));
+        tbody.append(row);
+    });
+
+    const first = res.data.total === 0 ? 0 : res.data.offset + 1;
+    const last = res.data.offset + res.data.entries.length;
+    $("#audit-log-page").text(`${first}-${last} of ${res.data.total}`);
+    $("#audit-log-prev").prop("disabled", res.data.offset === 0);
+    $("#audit-log-next").prop("disabled", last >= res.data.total);
+}
@@ -29,6 +29,18 @@ const keyLabels = {
         "type": "text",
         "placeholder": "https://example.com"
     },
+    "WEATHER_PROFILES": {
+        "name": "Static Weather Profiles",
+        "description": "JSON map of ICAO code (or * for any station) to classic FSD weather profiles sent in response to weather requests. Stations without a static profile use their live METAR.",
+        "type": "text",
+        "placeholder": "{}"
+    },
+    "TRANSPONDER_CODE_RANGES": {
+        "name": "Transponder Code Ranges",
+        "description": "JSON list of transponder code ranges allocated to aircraft on controller request. Each range has a start and end code, and optionally a region (controller callsign prefix) and facility type. The first matching range is used.",
+        "type": "text",
+        "placeholder": "[{\"region\": \"LAX_\", \"facility\": 5, \"start\": \"2201\", \"end\": \"2277\"}]"
+    },
 };
 
 // Function to show message modal
@@ -70,9 +82,10 @@ async function loadConfig() {
             div.className = 'mb-3';
             div.innerHTML = `
                 <label for="${kv.key}" class="form-label">${label}</label>
-                <input type="${keyLabels[kv.key].type}" class="form-control" id="${kv.key}" value="${kv.value}" data-key="${kv.key}" placeholder="${keyLabels[kv.key].placeholder}">
+                <input type="${keyLabels[kv.key].type}" class="form-control" id="${kv.key}" data-key="${kv.key}" placeholder="${keyLabels[kv.key].placeholder}">
                 <div class="form-text">${desc}</div>
             `;
+            div.querySelector('input').value = kv.value;
             configForm.appendChild(div);
         });
     } catch (xhr) {
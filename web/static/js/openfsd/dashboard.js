@@ -68,6 +68,12 @@ async function loadUserInfo(cid) {
             <div class="mb-2"><a href="/configeditor" class="btn btn-primary">Configure Server</a></div>
         `)
     }
+
+    if (res.data.network_rating >= 12) {
+        $("#dashboard-user-editor").append(`
+            <div class="mb-2"><a href="/auditlog" class="btn btn-primary">Audit Log</a></div>
+        `)
+    }
 }
 
 let dashboardMarkers = [];
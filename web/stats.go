@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/renorris/openfsd/db"
+	"net/http"
+	"time"
+)
+
+// maxStatsRange limits the time range of a stats query per resolution
+var maxStatsRange = map[db.StatsResolution]time.Duration{
+	db.StatsResolutionRaw:  7 * 24 * time.Hour,
+	db.StatsResolutionHour: 366 * 24 * time.Hour,
+	db.StatsResolutionDay:  10 * 366 * 24 * time.Hour,
+}
+
+type StatsPeak struct {
+	Count int       `json:"count"`
+	Time  time.Time `json:"time"` // Start of the bucket in which the peak occurred
+}
+
+type StatsBucket struct {
+	Time                time.Time `json:"time"`
+	Samples             int       `json:"samples"`
+	PeakPilots          int       `json:"peak_pilots"`
+	PeakATC             int       `json:"peak_atc"`
+	PeakUniqueUsers     int       `json:"peak_unique_users"`
+	PacketsIn           int64     `json:"packets_in"`
+	PacketsOut          int64     `json:"packets_out"`
+	PacketsInPerSecond  float64   `json:"packets_in_per_second"`
+	PacketsOutPerSecond float64   `json:"packets_out_per_second"`
+}
+
+type StatsResponseData struct {
+	From       time.Time          `json:"from"`
+	To         time.Time          `json:"to"`
+	Resolution db.StatsResolution `json:"resolution"`
+	Peaks      struct {
+		Pilots      StatsPeak `json:"pilots"`
+		ATC         StatsPeak `json:"atc"`
+		UniqueUsers StatsPeak `json:"unique_users"`
+	} `json:"peaks"`
+	Buckets []StatsBucket `json:"buckets"`
+}
+
+// handleGetStats returns aggregated network statistics over a time range.
+//
+// Query parameters: from and to (RFC 3339, default the last 24 hours) and resolution (raw, hour or day; default hour).
+func (s *Server) handleGetStats(c *gin.Context) {
+	resData := StatsResponseData{
+		To:         time.Now().UTC(),
+		Resolution: db.StatsResolution(c.DefaultQuery("resolution", string(db.StatsResolutionHour))),
+		Buckets:    []StatsBucket{},
+	}
+
+	var err error
+	if to := c.Query("to"); to != "" {
+		if resData.To, err = time.Parse(time.RFC3339, to); err != nil {
+			res := newAPIV1Failure("invalid to time")
+			writeAPIV1Response(c, http.StatusBadRequest, &res)
+			return
+		}
+	}
+	resData.From = resData.To.Add(-24 * time.Hour)
+	if from := c.Query("from"); from != "" {
+		if resData.From, err = time.Parse(time.RFC3339, from); err != nil {
+			res := newAPIV1Failure("invalid from time")
+			writeAPIV1Response(c, http.StatusBadRequest, &res)
+			return
+		}
+	}
+
+	maxRange, ok := maxStatsRange[resData.Resolution]
+	if !ok {
+		res := newAPIV1Failure("invalid resolution")
+		writeAPIV1Response(c, http.StatusBadRequest, &res)
+		return
+	}
+	if !resData.From.Before(resData.To) || resData.To.Sub(resData.From) > maxRange {
+		res := newAPIV1Failure("invalid time range for resolution " + string(resData.Resolution))
+		writeAPIV1Response(c, http.StatusBadRequest, &res)
+		return
+	}
+
+	aggregates, err := s.dbRepo.StatsRepo.GetStatsAggregates(resData.From, resData.To, resData.Resolution)
+	if err != nil {
+		writeAPIV1Response(c, http.StatusInternalServerError, &genericAPIV1InternalServerError)
+		return
+	}
+
+	for _, aggregate := range aggregates {
+		bucket := StatsBucket{
+			Time:            aggregate.Time,
+			Samples:         aggregate.Samples,
+			PeakPilots:      aggregate.PeakPilots,
+			PeakATC:         aggregate.PeakATC,
+			PeakUniqueUsers: aggregate.PeakUniqueUsers,
+			PacketsIn:       aggregate.PacketsIn,
+			PacketsOut:      aggregate.PacketsOut,
+		}
+		if seconds := aggregate.Duration.Seconds(); seconds > 0 {
+			bucket.PacketsInPerSecond = float64(aggregate.PacketsIn) / seconds
+			bucket.PacketsOutPerSecond = float64(aggregate.PacketsOut) / seconds
+		}
+		resData.Buckets = append(resData.Buckets, bucket)
+
+		updateStatsPeak(&resData.Peaks.Pilots, aggregate.PeakPilots, aggregate.Time)
+		updateStatsPeak(&resData.Peaks.ATC, aggregate.PeakATC, aggregate.Time)
+		updateStatsPeak(&resData.Peaks.UniqueUsers, aggregate.PeakUniqueUsers, aggregate.Time)
+	}
+
+	res := newAPIV1Success(&resData)
+	writeAPIV1Response(c, http.StatusOK, &res)
+}
+
+func updateStatsPeak(peak *StatsPeak, count int, t time.Time) {
+	if count > peak.Count {
+		peak.Count = count
+		peak.Time = t
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/renorris/openfsd/db"
 	"github.com/renorris/openfsd/fsd"
 	"net/http"
+	"strconv"
 )
 
 // getUserByCID returns the user info of the specified CID.
@@ -93,6 +94,8 @@ func (s *Server) updateUser(c *gin.Context) {
 		return
 	}
 
+	before := newAuditUser(targetUser, false)
+
 	// Update target user's fields depending on what was provided in the request
 	if reqBody.Password != nil {
 		targetUser.Password = *reqBody.Password
@@ -117,6 +120,8 @@ func (s *Server) updateUser(c *gin.Context) {
 		return
 	}
 
+	s.audit(c, db.AuditActionUserUpdate, strconv.Itoa(targetUser.CID), before, newAuditUser(targetUser, reqBody.Password != nil))
+
 	type ResponseBody struct {
 		CID           int    `json:"cid"`
 		FirstName     string `json:"first_name"`
@@ -167,6 +172,8 @@ func (s *Server) createUser(c *gin.Context) {
 		return
 	}
 
+	s.audit(c, db.AuditActionUserCreate, strconv.Itoa(user.CID), nil, newAuditUser(user, true))
+
 	type ResponseBody struct {
 		CID           int     `json:"cid"`
 		FirstName     *string `json:"first_name"`